@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
+	"github.com/OpenListTeam/OpenList/v4/internal/bootstrap"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/spf13/cobra"
+)
+
+// masterKeyCmd represents the master-key command
+var masterKeyCmd = &cobra.Command{
+	Use:   "master-key",
+	Short: "Manage the master secret encrypting the confidential storage fields",
+}
+
+var rotateMasterKeyCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-encrypt the confidential storage fields with a new master secret",
+	Long: `Re-encrypt the confidential storage fields with a new master secret and save it to the config file.
+Stop the server before rotating, it keeps using the old secret until restarted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		newSecret, _ := cmd.Flags().GetString("secret")
+		if newSecret == "" {
+			newSecret = random.String(32)
+		}
+		bootstrap.Init()
+		defer bootstrap.Release()
+		// the drivers of the plugins are needed to know their confidential fields
+		bootstrap.InitPlugins()
+		oldSecret := conf.Conf.MasterSecret
+		if newSecret == oldSecret {
+			return fmt.Errorf("the new master secret is the same as the current one")
+		}
+		storages, _, err := db.GetStorages(1, -1)
+		if err != nil {
+			return fmt.Errorf("failed to query storages: %+v", err)
+		}
+		// decrypt all storages first so that nothing is written if any of them can't be decrypted
+		rotated := slices.Clone(storages)
+		for i := range rotated {
+			if err = op.RotateStorageAddition(&rotated[i], oldSecret, newSecret); err != nil {
+				return fmt.Errorf("failed to re-encrypt storage [%s]: %+v", storages[i].MountPath, err)
+			}
+		}
+		restore := func(n int) {
+			for i := 0; i < n; i++ {
+				if err := db.UpdateStorage(&storages[i]); err != nil {
+					utils.Log.Errorf("failed to restore storage [%s]: %+v", storages[i].MountPath, err)
+				}
+			}
+		}
+		for i := range rotated {
+			if err = db.UpdateStorage(&rotated[i]); err != nil {
+				restore(i)
+				return fmt.Errorf("failed to update storage [%s]: %+v", rotated[i].MountPath, err)
+			}
+		}
+		// write the secret only, the env overrides in conf.Conf must not be persisted
+		configBytes, err := os.ReadFile(conf.ConfigPath)
+		if err != nil {
+			restore(len(storages))
+			return fmt.Errorf("failed to read config file: %+v", err)
+		}
+		fileConf := conf.DefaultConfig(flags.DataDir)
+		if err = utils.Json.Unmarshal(configBytes, fileConf); err != nil {
+			restore(len(storages))
+			return fmt.Errorf("failed to load config file: %+v", err)
+		}
+		fileConf.MasterSecret = newSecret
+		if !utils.WriteJsonToFile(conf.ConfigPath, fileConf) {
+			restore(len(storages))
+			return fmt.Errorf("failed to write config file")
+		}
+		utils.Log.Infof("master secret has been rotated from CLI, %d storages re-encrypted", len(rotated))
+		fmt.Printf("Master secret has been rotated, %d storages re-encrypted\n", len(rotated))
+		envName := "OPENLIST_MASTER_SECRET"
+		if flags.NoPrefix {
+			envName = "MASTER_SECRET"
+		}
+		if _, ok := os.LookupEnv(envName); ok && !fileConf.Force {
+			fmt.Printf("Warning: the master secret is overridden by %s, update it to the new secret:\n", envName)
+			fmt.Println(newSecret)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(masterKeyCmd)
+	masterKeyCmd.AddCommand(rotateMasterKeyCmd)
+	rotateMasterKeyCmd.Flags().String("secret", "", "the new master secret, a random one is generated if not set")
+}
@@ -0,0 +1,428 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	stdpath "path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// the max number of prefetches running at the same time
+const prefetchConcurrency = 4
+
+type Cache struct {
+	model.Storage
+	Addition
+	store     *store
+	blockSize int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the blocks being fetched, readers wait for them instead of fetching again
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+	sem      chan struct{}
+}
+
+func (d *Cache) Config() driver.Config {
+	return config
+}
+
+func (d *Cache) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Cache) Init(ctx context.Context) error {
+	if d.MaxSize <= 0 {
+		return fmt.Errorf("max size must be positive")
+	}
+	if d.BlockSize <= 0 {
+		return fmt.Errorf("block size must be positive")
+	}
+	if d.Prefetch < 0 {
+		d.Prefetch = 0
+	}
+	d.RemotePath = utils.FixAndCleanPath(d.RemotePath)
+	d.EvictionPolicy = utils.GetNoneEmpty(d.EvictionPolicy, "lru")
+	dir := d.CacheDir
+	if dir == "" {
+		dir = filepath.Join(flags.DataDir, "cache", strconv.FormatUint(uint64(d.ID), 10))
+	}
+	s, err := newStore(dir, d.MaxSize*1024*1024, time.Duration(d.MaxAge)*time.Hour, d.EvictionPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to init cache dir: %w", err)
+	}
+	d.store = s
+	d.blockSize = d.BlockSize * 1024
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.inflight = map[string]chan struct{}{}
+	d.sem = make(chan struct{}, prefetchConcurrency)
+	return nil
+}
+
+func (d *Cache) Drop(ctx context.Context) error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	return nil
+}
+
+func (a Addition) GetRootPath() string {
+	return a.RemotePath
+}
+
+func (d *Cache) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	remoteFullPath := dir.GetPath()
+	objs, err := fs.List(ctx, remoteFullPath, &fs.ListArgs{NoLog: true, Refresh: args.Refresh})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, d.wrapObj(stdpath.Join(remoteFullPath, obj.GetName()), obj))
+	}
+	return result, nil
+}
+
+func (d *Cache) Get(ctx context.Context, path string) (model.Obj, error) {
+	remoteFullPath := stdpath.Join(d.RemotePath, path)
+	remoteObj, err := fs.Get(ctx, remoteFullPath, &fs.GetArgs{NoLog: true})
+	if err != nil {
+		return nil, err
+	}
+	return d.wrapObj(remoteFullPath, remoteObj), nil
+}
+
+// wrapObj keeps the name, hashes and thumbnail of the remote obj, but sets the path to the remote full path
+func (d *Cache) wrapObj(remoteFullPath string, obj model.Obj) model.Obj {
+	objRes := model.Object{
+		Path:     remoteFullPath,
+		Name:     obj.GetName(),
+		Size:     obj.GetSize(),
+		Modified: obj.ModTime(),
+		IsFolder: obj.IsDir(),
+		Ctime:    obj.CreateTime(),
+		HashInfo: obj.GetHash(),
+		Mask:     model.GetObjMask(obj) &^ model.Temp,
+	}
+	if thumb, ok := model.GetThumb(obj); ok {
+		return &model.ObjThumb{
+			Object:    objRes,
+			Thumbnail: model.Thumbnail{Thumbnail: thumb},
+		}
+	}
+	return &objRes
+}
+
+func (d *Cache) Link(ctx context.Context, file model.Obj, _ model.LinkArgs) (*model.Link, error) {
+	meta := fileMeta{Path: file.GetPath(), Size: file.GetSize(), Modified: file.ModTime()}
+	return &model.Link{
+		RangeReader: stream.RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+			end := meta.Size
+			if httpRange.Length >= 0 && httpRange.Start+httpRange.Length < end {
+				end = httpRange.Start + httpRange.Length
+			}
+			return &blockReader{ctx: ctx, d: d, meta: meta, key: meta.key(), off: httpRange.Start, end: end,
+				remote: &remoteFile{meta: meta}}, nil
+		}),
+	}, nil
+}
+
+// blockReader reads the range of the file block by block, from the cache or else from the remote storage
+type blockReader struct {
+	ctx    context.Context
+	d      *Cache
+	meta   fileMeta
+	key    string
+	off    int64
+	end    int64
+	buf    []byte
+	remote *remoteFile
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.off >= r.end {
+			return 0, io.EOF
+		}
+		idx := r.off / r.d.blockSize
+		data, err := r.d.getBlock(r.ctx, r.remote, r.key, idx)
+		if err != nil {
+			return 0, err
+		}
+		start := r.off - idx*r.d.blockSize
+		if start >= int64(len(data)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.buf = data[start:min(int64(len(data)), r.end-idx*r.d.blockSize)]
+		r.d.prefetch(r.meta, r.key, idx+1)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.off += int64(n)
+	return n, nil
+}
+
+func (r *blockReader) Close() error {
+	return r.remote.Close()
+}
+
+// remoteFile resolves the link of the remote file once for all the blocks read from it
+type remoteFile struct {
+	meta fileMeta
+	mu   sync.Mutex
+	link *model.Link
+	rr   model.RangeReaderIF
+}
+
+func (f *remoteFile) rangeReader(ctx context.Context) (model.RangeReaderIF, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rr != nil {
+		return f.rr, nil
+	}
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(f.meta.Path)
+	if err != nil {
+		return nil, err
+	}
+	remoteLink, remoteObj, err := op.Link(ctx, remoteStorage, remoteActualPath, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	if remoteObj.GetSize() != f.meta.Size {
+		_ = remoteLink.Close()
+		// the remote file is changed, the cached blocks of it are never read again
+		return nil, fmt.Errorf("the size of remote file %s is changed from %d to %d", f.meta.Path, f.meta.Size, remoteObj.GetSize())
+	}
+	rr, err := stream.GetRangeReaderFromLink(f.meta.Size, remoteLink)
+	if err != nil {
+		_ = remoteLink.Close()
+		return nil, err
+	}
+	f.link, f.rr = remoteLink, rr
+	return rr, nil
+}
+
+func (f *remoteFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.link == nil {
+		return nil
+	}
+	err := f.link.Close()
+	f.link, f.rr = nil, nil
+	return err
+}
+
+func (d *Cache) blockCount(size int64) int64 {
+	return (size + d.blockSize - 1) / d.blockSize
+}
+
+// claim marks the block as being fetched, it returns false with the channel to wait on if it is already
+func (d *Cache) claim(key string, idx int64) (chan struct{}, bool) {
+	k := key + "/" + strconv.FormatInt(idx, 10)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ch, ok := d.inflight[k]; ok {
+		return ch, false
+	}
+	ch := make(chan struct{})
+	d.inflight[k] = ch
+	return ch, true
+}
+
+func (d *Cache) release(key string, idx int64) {
+	k := key + "/" + strconv.FormatInt(idx, 10)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ch, ok := d.inflight[k]; ok {
+		close(ch)
+		delete(d.inflight, k)
+	}
+}
+
+func (d *Cache) getBlock(ctx context.Context, remote *remoteFile, key string, idx int64) ([]byte, error) {
+	for {
+		if data, ok := d.store.read(key, idx); ok {
+			return data, nil
+		}
+		ch, ok := d.claim(key, idx)
+		if !ok {
+			select {
+			case <-ch:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var data []byte
+		err := d.fetch(ctx, remote, key, idx, 1, func(i int64, b []byte) {
+			data = b
+		})
+		d.release(key, idx)
+		return data, err
+	}
+}
+
+// prefetch fetches the missing blocks following the read one in background with one request,
+// it stops at the first block cached or being fetched by others
+func (d *Cache) prefetch(meta fileMeta, key string, from int64) {
+	if d.Prefetch <= 0 {
+		return
+	}
+	last := min(from+int64(d.Prefetch), d.blockCount(meta.Size))
+	var count int64
+	for idx := from; idx < last; idx++ {
+		if d.store.has(key, idx) {
+			if count > 0 {
+				break
+			}
+			from++
+			continue
+		}
+		if _, ok := d.claim(key, idx); !ok {
+			break
+		}
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	go func() {
+		defer func() {
+			for i := range count {
+				d.release(key, from+i)
+			}
+		}()
+		select {
+		case d.sem <- struct{}{}:
+			defer func() { <-d.sem }()
+		case <-d.ctx.Done():
+			return
+		}
+		// the link of the reader may be closed before the prefetch finishes
+		remote := &remoteFile{meta: meta}
+		defer remote.Close()
+		if err := d.fetch(d.ctx, remote, key, from, count, nil); err != nil && d.ctx.Err() == nil {
+			log.Warnf("failed prefetch %s: %v", meta.Path, err)
+		}
+	}()
+}
+
+// fetch reads count blocks from idx of the remote file and saves them, the blocks must be claimed by the caller
+func (d *Cache) fetch(ctx context.Context, remote *remoteFile, key string, idx, count int64, fn func(int64, []byte)) error {
+	meta := remote.meta
+	rrf, err := remote.rangeReader(ctx)
+	if err != nil {
+		return err
+	}
+	start := idx * d.blockSize
+	length := min(count*d.blockSize, meta.Size-start)
+	rc, err := rrf.RangeRead(ctx, http_range.Range{Start: start, Length: length})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	for i := range count {
+		data := make([]byte, min(d.blockSize, meta.Size-start-i*d.blockSize))
+		if _, err = io.ReadFull(rc, data); err != nil {
+			return err
+		}
+		if err = d.store.write(meta, idx+i, data); err != nil {
+			log.Warnf("failed cache block %d of %s: %v", idx+i, meta.Path, err)
+		}
+		if fn != nil {
+			fn(idx+i, data)
+		}
+	}
+	return nil
+}
+
+func (d *Cache) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(parentDir.GetPath())
+	if err != nil {
+		return err
+	}
+	return op.MakeDir(ctx, remoteStorage, stdpath.Join(remoteActualPath, dirName))
+}
+
+func (d *Cache) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	d.store.invalidate(srcObj.GetPath())
+	_, err := fs.Move(ctx, srcObj.GetPath(), dstDir.GetPath())
+	return err
+}
+
+func (d *Cache) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(srcObj.GetPath())
+	if err != nil {
+		return err
+	}
+	d.store.invalidate(srcObj.GetPath())
+	return op.Rename(ctx, remoteStorage, remoteActualPath, newName)
+}
+
+func (d *Cache) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	_, err := fs.Copy(ctx, srcObj.GetPath(), dstDir.GetPath())
+	return err
+}
+
+func (d *Cache) Remove(ctx context.Context, obj model.Obj) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(obj.GetPath())
+	if err != nil {
+		return err
+	}
+	d.store.invalidate(obj.GetPath())
+	return op.Remove(ctx, remoteStorage, remoteActualPath)
+}
+
+func (d *Cache) Put(ctx context.Context, dstDir model.Obj, streamer model.FileStreamer, up driver.UpdateProgress) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(dstDir.GetPath())
+	if err != nil {
+		return err
+	}
+	d.store.invalidate(stdpath.Join(dstDir.GetPath(), streamer.GetName()))
+	return op.Put(ctx, remoteStorage, remoteActualPath, streamer, up)
+}
+
+func (d *Cache) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	remoteStorage, _, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return nil, errs.NotImplement
+	}
+	remoteDetails, err := op.GetStorageDetails(ctx, remoteStorage)
+	if err != nil {
+		return nil, err
+	}
+	return &model.StorageDetails{
+		DiskUsage: remoteDetails.DiskUsage,
+	}, nil
+}
+
+func (d *Cache) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
+	switch args.Method {
+	case "stats":
+		return d.store.stats(), nil
+	case "clear":
+		d.store.clear()
+		return d.store.stats(), nil
+	default:
+		return nil, errs.NotSupport
+	}
+}
+
+var _ driver.Driver = (*Cache)(nil)
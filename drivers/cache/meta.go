@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	RemotePath     string `json:"remote_path" required:"true" help:"The mount path of the storage to cache"`
+	CacheDir       string `json:"cache_dir" help:"The local dir of the cached blocks, empty for data/cache/<storage id>"`
+	MaxSize        int64  `json:"max_size" type:"number" required:"true" default:"10240" help:"MB, the least used blocks are evicted beyond it"`
+	BlockSize      int64  `json:"block_size" type:"number" required:"true" default:"1024" help:"KB, the unit of caching and fetching"`
+	Prefetch       int    `json:"prefetch" type:"number" default:"8" help:"the number of blocks fetched in background after a read, 0 to disable"`
+	EvictionPolicy string `json:"eviction_policy" type:"select" options:"lru,lfu,fifo" default:"lru"`
+	MaxAge         int    `json:"max_age" type:"number" default:"0" help:"hours, the blocks not read for longer are evicted, 0 to keep them"`
+}
+
+var config = driver.Config{
+	Name:        "Cache",
+	LocalSort:   true,
+	OnlyProxy:   true,
+	NoCache:     true,
+	DefaultRoot: "/",
+	NoLinkURL:   true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Cache{
+			Addition: Addition{
+				MaxSize:        10240,
+				BlockSize:      1024,
+				Prefetch:       8,
+				EvictionPolicy: "lru",
+			},
+		}
+	})
+}
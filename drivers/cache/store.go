@@ -0,0 +1,359 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const metaFileName = "meta.json"
+
+// the cache is evicted down to this ratio of the max size so that eviction doesn't happen on every write
+const evictRatio = 0.9
+
+// fileMeta identifies the version of a remote file, the blocks of other versions are never read
+type fileMeta struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func (m fileMeta) key() string {
+	h := sha1.Sum([]byte(m.Path + "\x00" + strconv.FormatInt(m.Size, 10) + "\x00" + strconv.FormatInt(m.Modified.UnixNano(), 10)))
+	return hex.EncodeToString(h[:])
+}
+
+type block struct {
+	size     int64
+	added    time.Time
+	accessed time.Time
+	hits     int64
+}
+
+type cachedFile struct {
+	meta   fileMeta
+	blocks map[int64]*block
+}
+
+type Stats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	HitBytes     int64 `json:"hit_bytes"`
+	FetchedBytes int64 `json:"fetched_bytes"`
+	Evictions    int64 `json:"evictions"`
+	Files        int   `json:"files"`
+	Blocks       int   `json:"blocks"`
+	Size         int64 `json:"size"`
+	MaxSize      int64 `json:"max_size"`
+}
+
+// store keeps the blocks of the files on disk, one file per block under <dir>/<key[:2]>/<key>/
+type store struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	policy  string
+
+	mu        sync.Mutex
+	files     map[string]*cachedFile
+	size      int64
+	lastPurge time.Time
+
+	hits, misses, hitBytes, fetchedBytes, evictions atomic.Int64
+}
+
+func newStore(dir string, maxSize int64, maxAge time.Duration, policy string) (*store, error) {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	s := &store{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		policy:  policy,
+		files:   map[string]*cachedFile{},
+	}
+	s.load()
+	s.mu.Lock()
+	s.evict()
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *store) fileDir(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func (s *store) blockPath(key string, idx int64) string {
+	return filepath.Join(s.fileDir(key), strconv.FormatInt(idx, 10))
+}
+
+// load rebuilds the index from the blocks on disk, the access time of a block is its modification time
+func (s *store) load() {
+	prefixes, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Warnf("failed read cache dir %s: %v", s.dir, err)
+		return
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() {
+			continue
+		}
+		keys, _ := os.ReadDir(filepath.Join(s.dir, prefix.Name()))
+		for _, k := range keys {
+			dir := filepath.Join(s.dir, prefix.Name(), k.Name())
+			f := s.loadFile(dir)
+			if f == nil || f.meta.key() != k.Name() {
+				_ = os.RemoveAll(dir)
+				continue
+			}
+			s.files[k.Name()] = f
+			for _, b := range f.blocks {
+				s.size += b.size
+			}
+		}
+	}
+}
+
+func (s *store) loadFile(dir string) *cachedFile {
+	data, err := os.ReadFile(filepath.Join(dir, metaFileName))
+	if err != nil {
+		return nil
+	}
+	f := &cachedFile{blocks: map[int64]*block{}}
+	if err = json.Unmarshal(data, &f.meta); err != nil {
+		return nil
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() == metaFileName {
+			continue
+		}
+		idx, err := strconv.ParseInt(e.Name(), 10, 64)
+		info, ierr := e.Info()
+		if err != nil || ierr != nil {
+			// unfinished writes
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		f.blocks[idx] = &block{size: info.Size(), added: info.ModTime(), accessed: info.ModTime()}
+	}
+	return f
+}
+
+func (s *store) has(key string, idx int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[key]
+	if !ok {
+		return false
+	}
+	_, ok = f.blocks[idx]
+	return ok
+}
+
+// read returns the data of the block, false if it is not cached
+func (s *store) read(key string, idx int64) ([]byte, bool) {
+	s.mu.Lock()
+	f, ok := s.files[key]
+	var b *block
+	if ok {
+		b, ok = f.blocks[idx]
+	}
+	if !ok {
+		s.mu.Unlock()
+		s.misses.Add(1)
+		return nil, false
+	}
+	b.accessed = time.Now()
+	b.hits++
+	s.mu.Unlock()
+	data, err := os.ReadFile(s.blockPath(key, idx))
+	if err != nil || int64(len(data)) != b.size {
+		log.Warnf("failed read cached block %d of %s: %v", idx, f.meta.Path, err)
+		s.mu.Lock()
+		s.removeBlock(key, idx)
+		s.mu.Unlock()
+		s.misses.Add(1)
+		return nil, false
+	}
+	s.hits.Add(1)
+	s.hitBytes.Add(int64(len(data)))
+	return data, true
+}
+
+func (s *store) write(meta fileMeta, idx int64, data []byte) error {
+	key := meta.key()
+	s.fetchedBytes.Add(int64(len(data)))
+	dir := s.fileDir(key)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	metaPath := filepath.Join(dir, metaFileName)
+	if !utils.Exists(metaPath) {
+		metaData, _ := json.Marshal(meta)
+		if err := os.WriteFile(metaPath, metaData, 0o666); err != nil {
+			return err
+		}
+	}
+	// write to a temp file first so that a block on disk is always complete
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.blockPath(key, idx))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[key]
+	if !ok {
+		f = &cachedFile{meta: meta, blocks: map[int64]*block{}}
+		s.files[key] = f
+	}
+	if old, ok := f.blocks[idx]; ok {
+		s.size -= old.size
+	}
+	f.blocks[idx] = &block{size: int64(len(data)), added: now, accessed: now}
+	s.size += int64(len(data))
+	s.evict()
+	return nil
+}
+
+// removeBlock must be called with the lock held
+func (s *store) removeBlock(key string, idx int64) {
+	f, ok := s.files[key]
+	if !ok {
+		return
+	}
+	if b, ok := f.blocks[idx]; ok {
+		s.size -= b.size
+		delete(f.blocks, idx)
+		_ = os.Remove(s.blockPath(key, idx))
+	}
+	if len(f.blocks) == 0 {
+		s.removeFile(key)
+	}
+}
+
+// removeFile must be called with the lock held
+func (s *store) removeFile(key string) {
+	f, ok := s.files[key]
+	if !ok {
+		return
+	}
+	for _, b := range f.blocks {
+		s.size -= b.size
+	}
+	delete(s.files, key)
+	_ = os.RemoveAll(s.fileDir(key))
+}
+
+type blockRef struct {
+	key string
+	idx int64
+	*block
+}
+
+// evict removes the expired blocks and then the blocks chosen by the policy until the size is under the limit,
+// it must be called with the lock held
+func (s *store) evict() {
+	now := time.Now()
+	if s.maxAge > 0 && now.Sub(s.lastPurge) > time.Minute {
+		s.lastPurge = now
+		for key, f := range s.files {
+			for idx, b := range f.blocks {
+				if now.Sub(b.accessed) > s.maxAge {
+					s.removeBlock(key, idx)
+					s.evictions.Add(1)
+				}
+			}
+		}
+	}
+	if s.size <= s.maxSize {
+		return
+	}
+	var refs []blockRef
+	for key, f := range s.files {
+		for idx, b := range f.blocks {
+			refs = append(refs, blockRef{key: key, idx: idx, block: b})
+		}
+	}
+	slices.SortFunc(refs, func(a, b blockRef) int {
+		switch s.policy {
+		case "lfu":
+			if a.hits != b.hits {
+				return int(a.hits - b.hits)
+			}
+		case "fifo":
+			return a.added.Compare(b.added)
+		}
+		return a.accessed.Compare(b.accessed)
+	})
+	target := int64(float64(s.maxSize) * evictRatio)
+	for _, ref := range refs {
+		if s.size <= target {
+			break
+		}
+		s.removeBlock(ref.key, ref.idx)
+		s.evictions.Add(1)
+	}
+}
+
+// invalidate removes the cached files at the path or under it
+func (s *store) invalidate(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, f := range s.files {
+		if f.meta.Path == path || strings.HasPrefix(f.meta.Path, strings.TrimSuffix(path, "/")+"/") {
+			s.removeFile(key)
+		}
+	}
+}
+
+func (s *store) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.files {
+		s.removeFile(key)
+	}
+}
+
+func (s *store) stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		Hits:         s.hits.Load(),
+		Misses:       s.misses.Load(),
+		HitBytes:     s.hitBytes.Load(),
+		FetchedBytes: s.fetchedBytes.Load(),
+		Evictions:    s.evictions.Load(),
+		Files:        len(s.files),
+		Size:         s.size,
+		MaxSize:      s.maxSize,
+	}
+	for _, f := range s.files {
+		st.Blocks += len(f.blocks)
+	}
+	return st
+}
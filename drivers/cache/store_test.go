@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testMeta(path string) fileMeta {
+	return fileMeta{Path: path, Size: 1 << 20, Modified: time.Unix(1700000000, 0)}
+}
+
+func writeBlocks(t *testing.T, s *store, meta fileMeta, size int, idxs ...int64) {
+	for _, idx := range idxs {
+		if err := s.write(meta, idx, bytes.Repeat([]byte{byte(idx)}, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkSize(t *testing.T, s *store) {
+	t.Helper()
+	var size int64
+	for _, f := range s.files {
+		for _, b := range f.blocks {
+			size += b.size
+		}
+	}
+	if s.size != size {
+		t.Errorf("wrong size %d, the blocks have %d", s.size, size)
+	}
+}
+
+func TestStoreReadWrite(t *testing.T) {
+	s, err := newStore(t.TempDir(), 1000, 0, "lru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := testMeta("/a")
+	writeBlocks(t, s, meta, 100, 0, 1)
+	// rewriting a block replaces its size
+	writeBlocks(t, s, meta, 50, 1)
+	if data, ok := s.read(meta.key(), 1); !ok || !bytes.Equal(data, bytes.Repeat([]byte{1}, 50)) {
+		t.Errorf("wrong block: %v", ok)
+	}
+	if _, ok := s.read(meta.key(), 2); ok {
+		t.Error("read the block not cached")
+	}
+	// another version of the file has another key
+	other := meta
+	other.Size++
+	if _, ok := s.read(other.key(), 0); ok {
+		t.Error("read the block of another version")
+	}
+	st := s.stats()
+	if st.Size != 150 || st.Blocks != 2 || st.Files != 1 || st.Hits != 1 || st.Misses != 2 || st.HitBytes != 50 {
+		t.Errorf("wrong stats: %+v", st)
+	}
+	checkSize(t, s)
+
+	// a block broken on disk is a miss and is removed
+	if err = os.WriteFile(s.blockPath(meta.key(), 0), []byte("x"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.read(meta.key(), 0); ok || s.has(meta.key(), 0) {
+		t.Error("the broken block is read")
+	}
+	checkSize(t, s)
+}
+
+func TestStoreEvict(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		evicted int64
+	}{
+		{policy: "lru", evicted: 0},
+		{policy: "lfu", evicted: 1},
+		{policy: "fifo", evicted: 2},
+	} {
+		s, err := newStore(t.TempDir(), 350, 0, tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := testMeta("/a")
+		writeBlocks(t, s, meta, 100, 0, 1, 2)
+		base := time.Now().Add(-time.Hour)
+		blocks := s.files[meta.key()].blocks
+		// block 0 is the least recently read, block 1 the least read and block 2 the first added
+		for idx, b := range []block{
+			{accessed: base, added: base.Add(2 * time.Minute), hits: 5},
+			{accessed: base.Add(2 * time.Minute), added: base.Add(time.Minute), hits: 0},
+			{accessed: base.Add(time.Minute), added: base, hits: 3},
+		} {
+			blocks[int64(idx)].accessed, blocks[int64(idx)].added, blocks[int64(idx)].hits = b.accessed, b.added, b.hits
+		}
+		writeBlocks(t, s, testMeta("/b"), 100, 0)
+		// evicted down to 315 bytes
+		for idx := int64(0); idx < 3; idx++ {
+			if s.has(meta.key(), idx) == (idx == tt.evicted) {
+				t.Errorf("%s: wrong eviction of block %d", tt.policy, idx)
+			}
+		}
+		if st := s.stats(); st.Size != 300 || st.Evictions != 1 {
+			t.Errorf("%s: wrong stats: %+v", tt.policy, st)
+		}
+		checkSize(t, s)
+	}
+}
+
+func TestStoreMaxAge(t *testing.T) {
+	s, err := newStore(t.TempDir(), 1000, time.Hour, "lru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := testMeta("/a")
+	writeBlocks(t, s, meta, 100, 0, 1)
+	s.files[meta.key()].blocks[0].accessed = time.Now().Add(-2 * time.Hour)
+	s.lastPurge = time.Time{}
+	writeBlocks(t, s, meta, 100, 2)
+	if s.has(meta.key(), 0) || !s.has(meta.key(), 1) {
+		t.Error("wrong eviction of the expired block")
+	}
+	checkSize(t, s)
+}
+
+func TestStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newStore(dir, 1000, 0, "lru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := testMeta("/a/b")
+	writeBlocks(t, s, meta, 100, 0, 3)
+	writeBlocks(t, s, testMeta("/c"), 100, 0)
+	// an unfinished write and a file moved to another key
+	if err = os.WriteFile(filepath.Join(s.fileDir(meta.key()), "tmp-1"), []byte("x"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	moved := testMeta("/moved")
+	if err = os.MkdirAll(filepath.Dir(s.fileDir(moved.key())), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(s.fileDir(testMeta("/c").key()), s.fileDir(moved.key())); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = newStore(dir, 1000, 0, "lru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := s.stats(); st.Files != 1 || st.Blocks != 2 || st.Size != 200 {
+		t.Errorf("wrong stats after load: %+v", st)
+	}
+	if data, ok := s.read(meta.key(), 3); !ok || len(data) != 100 {
+		t.Error("the loaded block is not read")
+	}
+	if _, err = os.Stat(s.fileDir(moved.key())); !os.IsNotExist(err) {
+		t.Errorf("the file of a wrong key is not removed: %v", err)
+	}
+	checkSize(t, s)
+
+	s.invalidate("/a")
+	if st := s.stats(); st.Files != 0 || st.Size != 0 {
+		t.Errorf("wrong stats after invalidate: %+v", st)
+	}
+}
@@ -0,0 +1,300 @@
+package compress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	stdpath "path"
+	"strings"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+type Compress struct {
+	model.Storage
+	Addition
+	// the format of the new uploaded files
+	ext             string
+	formats         map[string]format
+	passThroughExts []string
+}
+
+func (d *Compress) Config() driver.Config {
+	return config
+}
+
+func (d *Compress) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Compress) Init(ctx context.Context) error {
+	if d.FrameSize <= 0 || d.FrameSize > 64*1024 {
+		return fmt.Errorf("frame size must be between 1 and 65536 KB")
+	}
+	switch d.Algorithm {
+	case "gzip":
+		d.ext = "gz"
+	default:
+		d.ext = "zst"
+	}
+	d.RemotePath = utils.FixAndCleanPath(d.RemotePath)
+	d.passThroughExts = nil
+	for _, ext := range strings.Split(d.PassThroughExts, ",") {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			d.passThroughExts = append(d.passThroughExts, ext)
+		}
+	}
+	d.formats = map[string]format{}
+	for _, ext := range []string{"zst", "gz"} {
+		f, err := newFormat(ext, d.Level)
+		if err != nil {
+			return err
+		}
+		d.formats[ext] = f
+	}
+	return nil
+}
+
+func (d *Compress) Drop(ctx context.Context) error {
+	for _, f := range d.formats {
+		f.close()
+	}
+	return nil
+}
+
+func (a Addition) GetRootPath() string {
+	return a.RemotePath
+}
+
+func (d *Compress) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	remoteFullPath := dir.GetPath()
+	objs, err := fs.List(ctx, remoteFullPath, &fs.ListArgs{NoLog: true, Refresh: args.Refresh})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, d.convertObj(stdpath.Join(remoteFullPath, obj.GetName()), obj))
+	}
+	return result, nil
+}
+
+// convertObj shows the original name and size of the compressed file
+func (d *Compress) convertObj(remoteFullPath string, obj model.Obj) model.Obj {
+	objRes := &model.Object{
+		Path:     remoteFullPath,
+		Name:     obj.GetName(),
+		Size:     obj.GetSize(),
+		Modified: obj.ModTime(),
+		IsFolder: obj.IsDir(),
+		Ctime:    obj.CreateTime(),
+		Mask:     model.GetObjMask(obj) &^ model.Temp,
+	}
+	if obj.IsDir() {
+		return objRes
+	}
+	if name, size, _, ok := parseName(model.UnwrapObjName(obj).GetName()); ok {
+		// discarding hash as it's of the compressed data
+		objRes.Name = name
+		objRes.Size = size
+	} else {
+		objRes.HashInfo = obj.GetHash()
+	}
+	return objRes
+}
+
+func (d *Compress) Get(ctx context.Context, path string) (model.Obj, error) {
+	remoteFullPath := stdpath.Join(d.RemotePath, path)
+	remoteObj, err := fs.Get(ctx, remoteFullPath, &fs.GetArgs{NoLog: true})
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			// the compressed file is stored with the size in its name, let op.Get find it by op.List
+			return nil, errs.NotSupport
+		}
+		return nil, err
+	}
+	return d.convertObj(remoteFullPath, remoteObj), nil
+}
+
+func (d *Compress) Link(ctx context.Context, file model.Obj, _ model.LinkArgs) (*model.Link, error) {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	remoteLink, remoteFile, err := op.Link(ctx, remoteStorage, remoteActualPath, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	remoteSize := remoteLink.ContentLength
+	if remoteSize <= 0 {
+		remoteSize = remoteFile.GetSize()
+	}
+	rrf, err := stream.GetRangeReaderFromLink(remoteSize, remoteLink)
+	if err != nil {
+		_ = remoteLink.Close()
+		return nil, err
+	}
+	_, _, ext, ok := parseName(stdpath.Base(file.GetPath()))
+	if !ok {
+		return &model.Link{
+			RangeReader:      rrf,
+			SyncClosers:      utils.NewSyncClosers(remoteLink),
+			RequireReference: remoteLink.RequireReference,
+		}, nil
+	}
+
+	f := d.formats[ext]
+	mu := &sync.Mutex{}
+	var table *seekTable
+	return &model.Link{
+		RangeReader: stream.RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+			mu.Lock()
+			if table == nil {
+				t, err := readSeekTable(ctx, rrf, remoteSize, f)
+				if err != nil {
+					mu.Unlock()
+					return nil, fmt.Errorf("failed to read seek table of %s: %w", file.GetPath(), err)
+				}
+				table = t
+			}
+			mu.Unlock()
+			return table.rangeRead(ctx, rrf, f, httpRange)
+		}),
+		SyncClosers:      utils.NewSyncClosers(remoteLink),
+		RequireReference: remoteLink.RequireReference,
+	}, nil
+}
+
+func (d *Compress) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(parentDir.GetPath())
+	if err != nil {
+		return err
+	}
+	return op.MakeDir(ctx, remoteStorage, stdpath.Join(remoteActualPath, dirName))
+}
+
+func (d *Compress) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	_, err := fs.Move(ctx, srcObj.GetPath(), dstDir.GetPath())
+	return err
+}
+
+func (d *Compress) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(srcObj.GetPath())
+	if err != nil {
+		return err
+	}
+	if !srcObj.IsDir() {
+		if _, size, ext, ok := parseName(stdpath.Base(srcObj.GetPath())); ok {
+			newName = storedName(newName, size, ext)
+		}
+	}
+	return op.Rename(ctx, remoteStorage, remoteActualPath, newName)
+}
+
+func (d *Compress) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	_, err := fs.Copy(ctx, srcObj.GetPath(), dstDir.GetPath())
+	return err
+}
+
+func (d *Compress) Remove(ctx context.Context, obj model.Obj) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(obj.GetPath())
+	if err != nil {
+		return err
+	}
+	return op.Remove(ctx, remoteStorage, remoteActualPath)
+}
+
+func (d *Compress) Put(ctx context.Context, dstDir model.Obj, streamer model.FileStreamer, up driver.UpdateProgress) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(dstDir.GetPath())
+	if err != nil {
+		return err
+	}
+	name := streamer.GetName()
+	if d.passThrough(name) {
+		err = op.Put(ctx, remoteStorage, remoteActualPath, streamer, up)
+	} else {
+		name, err = d.putCompressed(ctx, remoteStorage, remoteActualPath, streamer, up)
+	}
+	if err != nil {
+		return err
+	}
+	// the overwritten file may be stored with another name, e.g. its size is changed
+	if exist := streamer.GetExist(); exist != nil && !exist.IsDir() {
+		existPath := exist.GetPath()
+		if stdpath.Dir(existPath) == dstDir.GetPath() && stdpath.Base(existPath) != name {
+			_, existActualPath, err := op.GetStorageAndActualPath(existPath)
+			if err != nil {
+				return err
+			}
+			return op.Remove(ctx, remoteStorage, existActualPath)
+		}
+	}
+	return nil
+}
+
+// putCompressed compresses the data into a temp file first, since the compressed size is required by the upload,
+// it returns the stored name
+func (d *Compress) putCompressed(ctx context.Context, remoteStorage driver.Driver, dstDirActualPath string, streamer model.FileStreamer, up driver.UpdateProgress) (string, error) {
+	tmpF, err := os.CreateTemp(conf.Conf.TempDir, "file-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmpF.Close()
+		_ = os.Remove(tmpF.Name())
+	}()
+	size, err := compressTo(tmpF, streamer, d.formats[d.ext], int(d.FrameSize*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to compress: %w", err)
+	}
+	if streamer.GetSize() > 0 && size != streamer.GetSize() {
+		return "", fmt.Errorf("the size of stream is %d, expect %d", size, streamer.GetSize())
+	}
+	compressedSize, err := tmpF.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmpF.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	name := storedName(streamer.GetName(), size, d.ext)
+	streamOut := &stream.FileStream{
+		Obj: &model.Object{
+			ID:       streamer.GetID(),
+			Path:     streamer.GetPath(),
+			Name:     name,
+			Size:     compressedSize,
+			Modified: streamer.ModTime(),
+			IsFolder: streamer.IsDir(),
+		},
+		Reader:   tmpF,
+		Mimetype: "application/octet-stream",
+	}
+	return name, op.Put(ctx, remoteStorage, dstDirActualPath, streamOut, up)
+}
+
+func (d *Compress) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	remoteStorage, _, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return nil, errs.NotImplement
+	}
+	remoteDetails, err := op.GetStorageDetails(ctx, remoteStorage)
+	if err != nil {
+		return nil, err
+	}
+	return &model.StorageDetails{
+		DiskUsage: remoteDetails.DiskUsage,
+	}, nil
+}
+
+var _ driver.Driver = (*Compress)(nil)
@@ -0,0 +1,29 @@
+package compress
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	RemotePath      string `json:"remote_path" required:"true" help:"This is where the compressed data stores"`
+	Algorithm       string `json:"algorithm" type:"select" required:"true" options:"zstd,gzip" default:"zstd" help:"the algorithm of the new uploaded files, the files of both are readable"`
+	Level           string `json:"level" type:"select" required:"true" options:"fastest,default,better,best" default:"default"`
+	FrameSize       int64  `json:"frame_size" type:"number" required:"true" default:"1024" help:"KB, the data is compressed in frames of this size, a ranged read decompresses whole frames"`
+	PassThroughExts string `json:"pass_through_exts" type:"text" default:"7z,avi,bz2,flac,gif,gz,heic,jpeg,jpg,m4a,mkv,mov,mp3,mp4,png,rar,tgz,webm,webp,xz,zip,zst" help:"the files of these extensions are stored as is, separated by commas"`
+}
+
+var config = driver.Config{
+	Name:        "Compress",
+	LocalSort:   true,
+	OnlyProxy:   true,
+	NoCache:     true,
+	DefaultRoot: "/",
+	NoLinkURL:   true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Compress{}
+	})
+}
@@ -0,0 +1,390 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressed file is a sequence of independently compressed frames of FrameSize bytes,
+// followed by a seek table of the compressed and decompressed size of every frame.
+// For zstd it is the seekable format of https://github.com/facebook/zstd/tree/dev/contrib/seekable_format,
+// the seek table is a skippable frame. For gzip every frame is a member,
+// the seek table is stored in the extra field of empty members.
+// So the files are still readable by the standard tools.
+
+const (
+	seekableMagic  = 0x8F92EAB1
+	skippableMagic = 0x184D2A5E
+	entrySize      = 8
+	footerSize     = 9
+
+	// the entries in the extra field of a gzip member, the extra field is at most 65535 bytes
+	gzipEntriesPerMember = 8000
+	// header, XLEN, subfield header, empty deflate block and trailer
+	gzipMemberOverhead = 10 + 2 + 4 + 2 + 8
+)
+
+var errInvalidSeekTable = errors.New("invalid seek table")
+
+type format interface {
+	ext() string
+	compress(dst, src []byte) ([]byte, error)
+	decompress(src []byte) ([]byte, error)
+	// index encodes the entries and footer of the seek table
+	index(entries, footer []byte) []byte
+	// tailSize is the size of the end of the file that contains the footer
+	tailSize() int64
+	footer(tail []byte) ([]byte, error)
+	// indexSize is the size of the seek table of n frames
+	indexSize(n uint32) int64
+	entries(index []byte, n uint32) ([]byte, error)
+	close()
+}
+
+func newFormat(ext, level string) (format, error) {
+	switch ext {
+	case "zst":
+		lv := map[string]zstd.EncoderLevel{
+			"fastest": zstd.SpeedFastest,
+			"better":  zstd.SpeedBetterCompression,
+			"best":    zstd.SpeedBestCompression,
+		}[level]
+		if lv == 0 {
+			lv = zstd.SpeedDefault
+		}
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(lv), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdFormat{enc: enc, dec: dec}, nil
+	case "gz":
+		lv, ok := map[string]int{
+			"fastest": gzip.BestSpeed,
+			"better":  7,
+			"best":    gzip.BestCompression,
+		}[level]
+		if !ok {
+			lv = gzip.DefaultCompression
+		}
+		return &gzipFormat{level: lv}, nil
+	}
+	return nil, fmt.Errorf("unknown compressed format %s", ext)
+}
+
+type zstdFormat struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func (f *zstdFormat) ext() string {
+	return "zst"
+}
+
+func (f *zstdFormat) close() {
+	_ = f.enc.Close()
+	f.dec.Close()
+}
+
+func (f *zstdFormat) compress(dst, src []byte) ([]byte, error) {
+	return f.enc.EncodeAll(src, dst), nil
+}
+
+func (f *zstdFormat) decompress(src []byte) ([]byte, error) {
+	return f.dec.DecodeAll(src, nil)
+}
+
+func (f *zstdFormat) index(entries, footer []byte) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, skippableMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(entries)+len(footer)))
+	buf = append(buf, entries...)
+	return append(buf, footer...)
+}
+
+func (f *zstdFormat) tailSize() int64 {
+	return footerSize
+}
+
+func (f *zstdFormat) footer(tail []byte) ([]byte, error) {
+	return tail, nil
+}
+
+func (f *zstdFormat) indexSize(n uint32) int64 {
+	return 8 + int64(n)*entrySize + footerSize
+}
+
+func (f *zstdFormat) entries(index []byte, n uint32) ([]byte, error) {
+	if binary.LittleEndian.Uint32(index) != skippableMagic ||
+		binary.LittleEndian.Uint32(index[4:]) != uint32(len(index)-8) {
+		return nil, errInvalidSeekTable
+	}
+	return index[8 : 8+n*entrySize], nil
+}
+
+type gzipFormat struct {
+	level int
+}
+
+func (f *gzipFormat) ext() string {
+	return "gz"
+}
+
+func (f *gzipFormat) close() {}
+
+func (f *gzipFormat) compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w, err := gzip.NewWriterLevel(buf, f.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *gzipFormat) decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	r.Multistream(false)
+	return io.ReadAll(r)
+}
+
+// emptyMember returns a gzip member without data, the extra field of which is a subfield "OL" of data
+func emptyMember(data []byte) []byte {
+	buf := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(data)+4))
+	buf = append(buf, 'O', 'L')
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(data)))
+	buf = append(buf, data...)
+	// the final empty block, CRC32 and ISIZE of no data
+	return append(buf, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func (f *gzipFormat) index(entries, footer []byte) []byte {
+	var buf []byte
+	for len(entries) > 0 {
+		n := min(len(entries), gzipEntriesPerMember*entrySize)
+		buf = append(buf, emptyMember(entries[:n])...)
+		entries = entries[n:]
+	}
+	return append(buf, emptyMember(footer)...)
+}
+
+func (f *gzipFormat) tailSize() int64 {
+	return gzipMemberOverhead + footerSize
+}
+
+// memberData returns the data of the member made by emptyMember
+func memberData(member []byte) ([]byte, error) {
+	if len(member) < gzipMemberOverhead || member[0] != 0x1f || member[1] != 0x8b || member[3] != 4 ||
+		member[12] != 'O' || member[13] != 'L' ||
+		int(binary.LittleEndian.Uint16(member[14:])) != len(member)-gzipMemberOverhead {
+		return nil, errInvalidSeekTable
+	}
+	return member[16 : len(member)-10], nil
+}
+
+func (f *gzipFormat) footer(tail []byte) ([]byte, error) {
+	return memberData(tail)
+}
+
+func (f *gzipFormat) indexSize(n uint32) int64 {
+	members := (int64(n) + gzipEntriesPerMember - 1) / gzipEntriesPerMember
+	return members*gzipMemberOverhead + int64(n)*entrySize + f.tailSize()
+}
+
+func (f *gzipFormat) entries(index []byte, n uint32) ([]byte, error) {
+	entries := make([]byte, 0, n*entrySize)
+	for rest := int(n); rest > 0; rest -= gzipEntriesPerMember {
+		size := gzipMemberOverhead + min(rest, gzipEntriesPerMember)*entrySize
+		data, err := memberData(index[:size])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, data...)
+		index = index[size:]
+	}
+	return entries, nil
+}
+
+// compressTo writes r compressed in frames of frameSize and the seek table to w,
+// it returns the size of the data read
+func compressTo(w io.Writer, r io.Reader, f format, frameSize int) (int64, error) {
+	var (
+		entries []byte
+		n       uint32
+		size    int64
+		buf     = make([]byte, frameSize)
+		out     []byte
+	)
+	for {
+		m, err := io.ReadFull(r, buf)
+		if m > 0 {
+			var cerr error
+			if out, cerr = f.compress(out[:0], buf[:m]); cerr != nil {
+				return size, cerr
+			}
+			if _, cerr = w.Write(out); cerr != nil {
+				return size, cerr
+			}
+			entries = binary.LittleEndian.AppendUint32(entries, uint32(len(out)))
+			entries = binary.LittleEndian.AppendUint32(entries, uint32(m))
+			n++
+			size += int64(m)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return size, err
+		}
+	}
+	footer := binary.LittleEndian.AppendUint32(nil, n)
+	// no checksums
+	footer = append(footer, 0)
+	footer = binary.LittleEndian.AppendUint32(footer, seekableMagic)
+	_, err := w.Write(f.index(entries, footer))
+	return size, err
+}
+
+// seekTable maps the decompressed offsets to the frames
+type seekTable struct {
+	// the compressed and decompressed start of every frame and the end of the last one
+	offsets []int64
+	starts  []int64
+}
+
+func (t *seekTable) size() int64 {
+	return t.starts[len(t.starts)-1]
+}
+
+func readAll(ctx context.Context, rr model.RangeReaderIF, start, length int64) ([]byte, error) {
+	rc, err := rr.RangeRead(ctx, http_range.Range{Start: start, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	buf := make([]byte, length)
+	_, err = io.ReadFull(rc, buf)
+	return buf, err
+}
+
+func readSeekTable(ctx context.Context, rr model.RangeReaderIF, remoteSize int64, f format) (*seekTable, error) {
+	if remoteSize < f.tailSize() {
+		return nil, errInvalidSeekTable
+	}
+	tail, err := readAll(ctx, rr, remoteSize-f.tailSize(), f.tailSize())
+	if err != nil {
+		return nil, err
+	}
+	footer, err := f.footer(tail)
+	if err != nil {
+		return nil, err
+	}
+	if len(footer) != footerSize || binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, errInvalidSeekTable
+	}
+	n := binary.LittleEndian.Uint32(footer)
+	indexSize := f.indexSize(n)
+	if indexSize > remoteSize {
+		return nil, errInvalidSeekTable
+	}
+	index, err := readAll(ctx, rr, remoteSize-indexSize, indexSize)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.entries(index, n)
+	if err != nil {
+		return nil, err
+	}
+	t := &seekTable{offsets: make([]int64, n+1), starts: make([]int64, n+1)}
+	for i := range n {
+		t.offsets[i+1] = t.offsets[i] + int64(binary.LittleEndian.Uint32(entries[i*entrySize:]))
+		t.starts[i+1] = t.starts[i] + int64(binary.LittleEndian.Uint32(entries[i*entrySize+4:]))
+	}
+	if t.offsets[n] != remoteSize-indexSize {
+		return nil, errInvalidSeekTable
+	}
+	return t, nil
+}
+
+// frameReader decompresses the frames of the range one by one
+type frameReader struct {
+	f     format
+	t     *seekTable
+	rc    io.ReadCloser
+	frame int
+	skip  int64
+	left  int64
+	buf   []byte
+}
+
+func (t *seekTable) rangeRead(ctx context.Context, rr model.RangeReaderIF, f format, httpRange http_range.Range) (io.ReadCloser, error) {
+	start := httpRange.Start
+	end := t.size()
+	if httpRange.Length >= 0 && start+httpRange.Length < end {
+		end = start + httpRange.Length
+	}
+	if start >= end {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	first := sort.Search(len(t.starts)-1, func(i int) bool { return t.starts[i+1] > start })
+	last := sort.Search(len(t.starts)-1, func(i int) bool { return t.starts[i+1] >= end })
+	rc, err := rr.RangeRead(ctx, http_range.Range{
+		Start:  t.offsets[first],
+		Length: t.offsets[last+1] - t.offsets[first],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &frameReader{f: f, t: t, rc: rc, frame: first, skip: start - t.starts[first], left: end - start}, nil
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	if len(r.buf) == 0 {
+		compressed := make([]byte, r.t.offsets[r.frame+1]-r.t.offsets[r.frame])
+		if _, err := io.ReadFull(r.rc, compressed); err != nil {
+			return 0, err
+		}
+		data, err := r.f.decompress(compressed)
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(data)) != r.t.starts[r.frame+1]-r.t.starts[r.frame] {
+			return 0, fmt.Errorf("the size of frame %d mismatches the seek table", r.frame)
+		}
+		r.buf = data[r.skip:]
+		r.skip = 0
+		r.frame++
+	}
+	n := copy(p, r.buf[:min(int64(len(r.buf)), r.left)])
+	r.buf = r.buf[n:]
+	r.left -= int64(n)
+	return n, nil
+}
+
+func (r *frameReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,59 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+func TestSeekable(t *testing.T) {
+	data := make([]byte, 100_000)
+	rand.New(rand.NewSource(1)).Read(data[:50_000])
+	for _, ext := range []string{"zst", "gz"} {
+		f, err := newFormat(ext, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		size, err := compressTo(&buf, bytes.NewReader(data), f, 4096)
+		if err != nil || size != int64(len(data)) {
+			t.Fatalf("%s: failed compress, size %d: %v", ext, size, err)
+		}
+		compressed := buf.Bytes()
+		rr := rangeReaderOf(compressed)
+		table, err := readSeekTable(context.Background(), rr, int64(len(compressed)), f)
+		if err != nil || table.size() != int64(len(data)) {
+			t.Fatalf("%s: failed read seek table: %v", ext, err)
+		}
+		for _, r := range []http_range.Range{{Start: 0, Length: -1}, {Start: 4095, Length: 2}, {Start: 12345, Length: 54321}, {Start: 99_999, Length: 10}} {
+			rc, err := table.rangeRead(context.Background(), rr, f, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			_ = rc.Close()
+			end := int64(len(data))
+			if r.Length >= 0 {
+				end = min(end, r.Start+r.Length)
+			}
+			if err != nil || !bytes.Equal(got, data[r.Start:end]) {
+				t.Fatalf("%s: unexpected data of range %+v: %v", ext, r, err)
+			}
+		}
+		f.close()
+	}
+}
+
+type rangeReaderOf []byte
+
+func (b rangeReaderOf) RangeRead(_ context.Context, r http_range.Range) (io.ReadCloser, error) {
+	end := int64(len(b))
+	if r.Length >= 0 {
+		end = min(end, r.Start+r.Length)
+	}
+	return io.NopCloser(bytes.NewReader(b[r.Start:end])), nil
+}
@@ -0,0 +1,33 @@
+package compress
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// the compressed files are stored as <name>.<original size>.seek.<zst|gz>,
+// so that List shows the original name and size without reading them
+var compressedName = regexp.MustCompile(`^(.+)\.(\d+)\.seek\.(zst|gz)$`)
+
+func parseName(name string) (origName string, size int64, ext string, ok bool) {
+	m := compressedName.FindStringSubmatch(name)
+	if m == nil {
+		return name, 0, "", false
+	}
+	size, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return name, 0, "", false
+	}
+	return m[1], size, m[3], true
+}
+
+func storedName(name string, size int64, ext string) string {
+	return fmt.Sprintf("%s.%d.seek.%s", name, size, ext)
+}
+
+func (d *Compress) passThrough(name string) bool {
+	return utils.SliceContains(d.passThroughExts, utils.Ext(name))
+}
@@ -0,0 +1,362 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	stdpath "path"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// the blob files not in the index are only collected after this age, since they may be being uploaded
+const orphanMinAge = time.Hour
+
+type Dedup struct {
+	model.Storage
+	Addition
+	blobLocks blobLocks
+}
+
+func (d *Dedup) Config() driver.Config {
+	return config
+}
+
+func (d *Dedup) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Dedup) Init(ctx context.Context) error {
+	d.RemotePath = utils.FixAndCleanPath(d.RemotePath)
+	return nil
+}
+
+func (d *Dedup) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *Dedup) GetRoot(ctx context.Context) (model.Obj, error) {
+	return &model.Object{
+		Path:     "/",
+		Name:     "root",
+		IsFolder: true,
+	}, nil
+}
+
+func (d *Dedup) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	entries, err := db.GetDedupEntries(d.ID, dir.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	return utils.SliceConvert(entries, func(e model.DedupEntry) (model.Obj, error) {
+		return entryToObj(&e), nil
+	})
+}
+
+func (d *Dedup) Get(ctx context.Context, path string) (model.Obj, error) {
+	if path == "/" {
+		return d.GetRoot(ctx)
+	}
+	e, err := db.GetDedupEntry(d.ID, path)
+	if err != nil {
+		return nil, err
+	}
+	return entryToObj(e), nil
+}
+
+func (d *Dedup) Link(ctx context.Context, file model.Obj, _ model.LinkArgs) (*model.Link, error) {
+	hash := file.GetHash().GetHash(utils.SHA256)
+	if hash == "" {
+		return nil, errs.NotFile
+	}
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(d.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	remoteLink, remoteFile, err := op.Link(ctx, remoteStorage, remoteActualPath, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	remoteSize := remoteLink.ContentLength
+	if remoteSize <= 0 {
+		remoteSize = remoteFile.GetSize()
+	}
+	rrf, err := stream.GetRangeReaderFromLink(remoteSize, remoteLink)
+	if err != nil {
+		_ = remoteLink.Close()
+		return nil, err
+	}
+	return &model.Link{
+		RangeReader:      rrf,
+		SyncClosers:      utils.NewSyncClosers(remoteLink),
+		RequireReference: remoteLink.RequireReference,
+	}, nil
+}
+
+func (d *Dedup) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	now := time.Now()
+	e := &model.DedupEntry{
+		StorageID: d.ID,
+		Parent:    parentDir.GetPath(),
+		Name:      dirName,
+		Modified:  now,
+		Created:   now,
+	}
+	if err := db.CreateDedupDir(e); err != nil {
+		return nil, err
+	}
+	return entryToObj(e), nil
+}
+
+func (d *Dedup) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	return db.MoveDedupEntry(d.ID, srcObj.GetPath(), dstDir.GetPath(), srcObj.GetName())
+}
+
+func (d *Dedup) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	return db.MoveDedupEntry(d.ID, srcObj.GetPath(), stdpath.Dir(srcObj.GetPath()), newName)
+}
+
+func (d *Dedup) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	return db.CopyDedupEntry(d.ID, srcObj.GetPath(), dstDir.GetPath())
+}
+
+func (d *Dedup) Remove(ctx context.Context, obj model.Obj) error {
+	unref, err := db.RemoveDedupEntry(d.ID, obj.GetPath())
+	if err != nil {
+		return err
+	}
+	for _, b := range unref {
+		d.removeBlob(ctx, b)
+	}
+	return nil
+}
+
+func (d *Dedup) Put(ctx context.Context, dstDir model.Obj, streamer model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	// the hash is always computed from the uploaded bytes, the one given by the client can't be trusted,
+	// or anyone could link to the content of others by its hash
+	file, hash, err := stream.CacheFullAndHash(streamer, &up, utils.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	unlock := d.blobLocks.lock(hash)
+	err = d.refBlob(ctx, hash, streamer, file, up)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	up(100)
+	now := time.Now()
+	e := &model.DedupEntry{
+		StorageID: d.ID,
+		Parent:    dstDir.GetPath(),
+		Name:      streamer.GetName(),
+		Hash:      hash,
+		Size:      streamer.GetSize(),
+		Modified:  streamer.ModTime(),
+		Created:   now,
+	}
+	if e.Modified.IsZero() {
+		e.Modified = now
+	}
+	unref, err := db.PutDedupFile(e)
+	if err != nil {
+		d.unrefBlob(ctx, hash)
+		return nil, err
+	}
+	if unref != nil {
+		d.removeBlob(ctx, *unref)
+	}
+	return entryToObj(e), nil
+}
+
+// refBlob references the blob before the file entry is created, so it can't be removed meanwhile,
+// and stores the data if the blob wasn't referenced, the blob must be locked
+func (d *Dedup) refBlob(ctx context.Context, hash string, streamer model.FileStreamer, file model.File, up driver.UpdateProgress) error {
+	unreferenced, err := db.RefDedupBlob(d.ID, hash, streamer.GetSize())
+	if err != nil || !unreferenced {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err == nil {
+		err = d.putBlob(ctx, hash, streamer, file, up)
+	}
+	if err != nil {
+		// the blob is left unreferenced for gc, it can't be removed while locked
+		if _, e := db.UnrefDedupBlob(d.ID, hash); e != nil {
+			log.Warnf("failed unref blob %s: %v", hash, e)
+		}
+	}
+	return err
+}
+
+func (d *Dedup) putBlob(ctx context.Context, hash string, streamer model.FileStreamer, r io.Reader, up driver.UpdateProgress) error {
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(stdpath.Dir(d.blobPath(hash)))
+	if err != nil {
+		return err
+	}
+	streamOut := &stream.FileStream{
+		Obj: &model.Object{
+			Name:     hash,
+			Size:     streamer.GetSize(),
+			Modified: time.Now(),
+			HashInfo: utils.NewHashInfo(utils.SHA256, hash),
+		},
+		Reader:   r,
+		Mimetype: "application/octet-stream",
+	}
+	return op.Put(ctx, remoteStorage, remoteActualPath, streamOut, up)
+}
+
+func (d *Dedup) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	remoteStorage, _, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return nil, errs.NotImplement
+	}
+	remoteDetails, err := op.GetStorageDetails(ctx, remoteStorage)
+	if err != nil {
+		return nil, err
+	}
+	return &model.StorageDetails{
+		DiskUsage: remoteDetails.DiskUsage,
+	}, nil
+}
+
+type GCResult struct {
+	RemovedBlobs   int   `json:"removed_blobs"`
+	RemovedOrphans int   `json:"removed_orphans"`
+	FreedSize      int64 `json:"freed_size"`
+}
+
+func (d *Dedup) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
+	switch args.Method {
+	case "stats":
+		return db.GetDedupStats(d.ID)
+	case "gc":
+		return d.gc(ctx)
+	default:
+		return nil, errs.NotSupport
+	}
+}
+
+// gc removes the blobs no longer referenced and the blob files not in the index
+func (d *Dedup) gc(ctx context.Context) (*GCResult, error) {
+	res := &GCResult{}
+	unref, err := db.GetUnreferencedDedupBlobs(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range unref {
+		if d.removeBlob(ctx, b) {
+			res.RemovedBlobs++
+			res.FreedSize += b.Size
+		}
+	}
+
+	hashes, err := db.GetDedupBlobHashes(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	indexed := make(map[string]struct{}, len(hashes))
+	for _, h := range hashes {
+		indexed[h] = struct{}{}
+	}
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(d.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+	// the blobs are stored in two levels of dirs
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		objs, err := op.List(ctx, remoteStorage, path, model.ListArgs{Refresh: true})
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			p := stdpath.Join(path, obj.GetName())
+			if obj.IsDir() {
+				if depth < 2 {
+					if err = walk(p, depth+1); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if _, ok := indexed[obj.GetName()]; ok || depth != 2 || time.Since(obj.ModTime()) < orphanMinAge {
+				continue
+			}
+			if err = op.Remove(ctx, remoteStorage, p); err != nil {
+				log.Warnf("failed remove orphan blob %s: %v", p, err)
+				continue
+			}
+			res.RemovedOrphans++
+			res.FreedSize += obj.GetSize()
+		}
+		return nil
+	}
+	if err = walk(remoteActualPath, 0); err != nil {
+		return res, fmt.Errorf("failed walk blobs: %w", err)
+	}
+	return res, nil
+}
+
+func (d *Dedup) blobPath(hash string) string {
+	return stdpath.Join(d.RemotePath, hash[:2], hash[2:4], hash)
+}
+
+func (d *Dedup) unrefBlob(ctx context.Context, hash string) {
+	b, err := db.UnrefDedupBlob(d.ID, hash)
+	if err != nil {
+		log.Warnf("failed unref blob %s: %v", hash, err)
+		return
+	}
+	if b != nil {
+		d.removeBlob(ctx, *b)
+	}
+}
+
+// removeBlob removes the blob if it's still not referenced, the failed ones are removed by gc later,
+// the blob is locked so that it's not referenced and uploaded again while its data is being removed
+func (d *Dedup) removeBlob(ctx context.Context, b model.DedupBlob) bool {
+	unlock := d.blobLocks.lock(b.Hash)
+	defer unlock()
+	deleted, err := db.DeleteDedupBlob(b.ID)
+	if err != nil || !deleted {
+		return false
+	}
+	remoteStorage, remoteActualPath, err := op.GetStorageAndActualPath(d.blobPath(b.Hash))
+	if err == nil {
+		err = op.Remove(ctx, remoteStorage, remoteActualPath)
+	}
+	if err != nil && !errs.IsObjectNotFound(err) {
+		log.Warnf("failed remove blob %s: %v", b.Hash, err)
+	}
+	return true
+}
+
+func entryToObj(e *model.DedupEntry) model.Obj {
+	obj := &model.Object{
+		ID:       strconv.FormatUint(uint64(e.ID), 10),
+		Path:     stdpath.Join(e.Parent, e.Name),
+		Name:     e.Name,
+		Size:     e.Size,
+		Modified: e.Modified,
+		Ctime:    e.Created,
+		IsFolder: e.IsDir,
+	}
+	if !e.IsDir {
+		obj.HashInfo = utils.NewHashInfo(utils.SHA256, e.Hash)
+	}
+	return obj
+}
+
+var _ driver.Driver = (*Dedup)(nil)
+var _ driver.MkdirResult = (*Dedup)(nil)
+var _ driver.PutResult = (*Dedup)(nil)
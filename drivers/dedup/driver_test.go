@@ -0,0 +1,190 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	// the shared memory database can't be written by several connections at once
+	sqlDB, err := dB.DB()
+	if err != nil {
+		panic(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+type testDedup struct {
+	*Dedup
+	t    *testing.T
+	root string
+}
+
+var lastID uint = 1000
+
+// newTestDedup creates the Dedup storing the blobs in a Local storage
+func newTestDedup(t *testing.T) *testDedup {
+	conf.Conf.TempDir = t.TempDir()
+	root := t.TempDir()
+	mountPath := "/blobs/" + t.Name()
+	ctx := context.Background()
+	_, err := op.CreateStorage(ctx, model.Storage{Driver: "Local", MountPath: mountPath, Addition: `{"root_folder_path":"` + root + `"}`})
+	if err != nil {
+		t.Fatalf("failed to create storage: %+v", err)
+	}
+	lastID++
+	d := &Dedup{Addition: Addition{RemotePath: mountPath}}
+	d.ID = lastID
+	if err = d.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return &testDedup{Dedup: d, t: t, root: root}
+}
+
+func (d *testDedup) put(path, data string) error {
+	dir, name := filepath.Split(path)
+	_, err := d.Put(context.Background(), &model.Object{Path: filepath.Clean(dir)}, &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(data))},
+		Reader: strings.NewReader(data),
+	}, func(float64) {})
+	return err
+}
+
+func (d *testDedup) get(path string) model.Obj {
+	obj, err := d.Get(context.Background(), path)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return obj
+}
+
+// checkBlob checks the reference count of the blob of data, and that it's stored only if referenced
+func (d *testDedup) checkBlob(data string, refs int64) {
+	d.t.Helper()
+	sum := sha256.Sum256([]byte(data))
+	hash := hex.EncodeToString(sum[:])
+	var refCount int64
+	if b, err := db.GetDedupBlob(d.ID, hash); err == nil {
+		refCount = b.RefCount
+	}
+	if refCount != refs {
+		d.t.Errorf("blob %q has %d references, want %d", data, refCount, refs)
+	}
+	stored, err := os.ReadFile(filepath.Join(d.root, hash[:2], hash[2:4], hash))
+	if refs > 0 && (err != nil || string(stored) != data) {
+		d.t.Errorf("blob %q is not stored: %q, %v", data, stored, err)
+	}
+	if refs == 0 && !os.IsNotExist(err) {
+		d.t.Errorf("blob %q is not removed: %v", data, err)
+	}
+}
+
+func TestRefCount(t *testing.T) {
+	d := newTestDedup(t)
+	ctx := context.Background()
+	root := d.get("/")
+	for _, dir := range []string{"dir", "other"} {
+		if _, err := d.MakeDir(ctx, root, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"/a.txt", "/dir/b.txt"} {
+		if err := d.put(path, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.checkBlob("x", 2)
+
+	if err := d.Copy(ctx, d.get("/dir"), d.get("/other")); err != nil {
+		t.Fatal(err)
+	}
+	d.checkBlob("x", 3)
+
+	// overwriting drops the reference of the old data, even with the same data
+	for i := 0; i < 2; i++ {
+		if err := d.put("/a.txt", "y"); err != nil {
+			t.Fatal(err)
+		}
+		d.checkBlob("x", 2)
+		d.checkBlob("y", 1)
+	}
+
+	if err := d.Remove(ctx, d.get("/dir")); err != nil {
+		t.Fatal(err)
+	}
+	d.checkBlob("x", 1)
+	if err := d.Remove(ctx, d.get("/other")); err != nil {
+		t.Fatal(err)
+	}
+	d.checkBlob("x", 0)
+	d.checkBlob("y", 1)
+}
+
+func TestPutFailed(t *testing.T) {
+	d := newTestDedup(t)
+	if _, err := d.MakeDir(context.Background(), d.get("/"), "dir"); err != nil {
+		t.Fatal(err)
+	}
+	// the reference taken for the upload is released if the entry isn't created
+	if err := d.put("/dir", "x"); err == nil {
+		t.Fatal("put the file over the dir")
+	}
+	d.checkBlob("x", 0)
+}
+
+// TestPutRemove puts a file while removing the last file of the same data,
+// the blob must not be removed once it's referenced again
+func TestPutRemove(t *testing.T) {
+	d := newTestDedup(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		src, dst := fmt.Sprintf("/%d", i), fmt.Sprintf("/%d", i+1)
+		if i == 0 {
+			if err := d.put(src, "x"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var wg sync.WaitGroup
+		var putErr, removeErr error
+		obj := d.get(src)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			putErr = d.put(dst, "x")
+		}()
+		go func() {
+			defer wg.Done()
+			removeErr = d.Remove(ctx, obj)
+		}()
+		wg.Wait()
+		if putErr != nil || removeErr != nil {
+			t.Fatalf("failed put or remove: %v, %v", putErr, removeErr)
+		}
+		d.checkBlob("x", 1)
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
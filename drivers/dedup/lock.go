@@ -0,0 +1,40 @@
+package dedup
+
+import "sync"
+
+type blobLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// blobLocks serializes the uploads and the removals of the same blob,
+// the lock of a hash is dropped once no one holds or waits for it
+type blobLocks struct {
+	mu    sync.Mutex
+	locks map[string]*blobLock
+}
+
+// lock locks the blob and returns the function to unlock it
+func (l *blobLocks) lock(hash string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*blobLock)
+	}
+	bl, ok := l.locks[hash]
+	if !ok {
+		bl = &blobLock{}
+		l.locks[hash] = bl
+	}
+	bl.waiters++
+	l.mu.Unlock()
+
+	bl.Lock()
+	return func() {
+		bl.Unlock()
+		l.mu.Lock()
+		if bl.waiters--; bl.waiters == 0 {
+			delete(l.locks, hash)
+		}
+		l.mu.Unlock()
+	}
+}
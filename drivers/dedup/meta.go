@@ -0,0 +1,24 @@
+package dedup
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	RemotePath string `json:"remote_path" required:"true" help:"This is where the blobs store"`
+}
+
+var config = driver.Config{
+	Name:        "Dedup",
+	LocalSort:   true,
+	OnlyProxy:   true,
+	DefaultRoot: "/",
+	NoLinkURL:   true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Dedup{}
+	})
+}
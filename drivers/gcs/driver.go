@@ -0,0 +1,130 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"net/http"
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/oauth2"
+)
+
+type GCS struct {
+	model.Storage
+	Addition
+	endpoint    string
+	tokenSource oauth2.TokenSource
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+}
+
+func (d *GCS) Config() driver.Config {
+	return config
+}
+
+func (d *GCS) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *GCS) Init(ctx context.Context) error {
+	d.endpoint = strings.TrimSuffix(d.Endpoint, "/")
+	if d.endpoint == "" {
+		d.endpoint = defaultEndpoint
+	}
+	if err := d.initCredentials(); err != nil {
+		return err
+	}
+	// check the bucket and the permission
+	_, err := d.request(ctx, http.MethodGet, d.bucketURL()+"/o", func(req *resty.Request) {
+		req.SetQueryParams(map[string]string{
+			"maxResults": "1",
+			"fields":     "nextPageToken",
+		})
+	}, nil)
+	return err
+}
+
+func (d *GCS) Drop(ctx context.Context) error {
+	d.tokenSource = nil
+	d.privateKey = nil
+	return nil
+}
+
+func (d *GCS) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	return d.list(ctx, dir.GetPath(), args)
+}
+
+func (d *GCS) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	key := getKey(file.GetPath(), false)
+	if d.privateKey != nil && !common.ShouldProxy(d, file.GetName()) {
+		u, err := d.signURL(key, file.GetName(), time.Hour*time.Duration(d.SignURLExpire))
+		if err != nil {
+			return nil, err
+		}
+		return &model.Link{URL: u}, nil
+	}
+	link := &model.Link{URL: d.objectURL(key) + "?alt=media"}
+	auth, err := d.authorization()
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		link.Header = http.Header{"Authorization": []string{auth}}
+	}
+	return link, nil
+}
+
+func (d *GCS) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	return d.Put(ctx, &model.Object{
+		Path: stdpath.Join(parentDir.GetPath(), dirName),
+	}, &stream.FileStream{
+		Obj: &model.Object{
+			Name:     getPlaceholderName(d.Placeholder),
+			Modified: time.Now(),
+		},
+		Reader:   bytes.NewReader([]byte{}),
+		Mimetype: "application/octet-stream",
+	}, func(float64) {})
+}
+
+func (d *GCS) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	err := d.Copy(ctx, srcObj, dstDir)
+	if err != nil {
+		return err
+	}
+	return d.Remove(ctx, srcObj)
+}
+
+func (d *GCS) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	err := d.copy(ctx, srcObj.GetPath(), stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName), srcObj.IsDir())
+	if err != nil {
+		return err
+	}
+	return d.Remove(ctx, srcObj)
+}
+
+func (d *GCS) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	return d.copy(ctx, srcObj.GetPath(), stdpath.Join(dstDir.GetPath(), srcObj.GetName()), srcObj.IsDir())
+}
+
+func (d *GCS) Remove(ctx context.Context, obj model.Obj) error {
+	if obj.IsDir() {
+		return d.removeDir(ctx, obj.GetPath())
+	}
+	return d.removeFile(ctx, obj.GetPath())
+}
+
+func (d *GCS) Put(ctx context.Context, dstDir model.Obj, s model.FileStreamer, up driver.UpdateProgress) error {
+	_, err := d.upload(ctx, getKey(stdpath.Join(dstDir.GetPath(), s.GetName()), false), s, up)
+	return err
+}
+
+var _ driver.Driver = (*GCS)(nil)
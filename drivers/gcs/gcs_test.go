@@ -0,0 +1,319 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+type fakeSession struct {
+	name string
+	data []byte
+}
+
+// fakeGCS serves the json api of a single bucket, the lists are paged by 2 entries
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	sessions map[string]*fakeSession
+	// partial makes the first chunk after the first one persisted only partially
+	partial  bool
+	puts     int
+	rewrites int
+}
+
+const bucketPath = "/storage/v1/b/bucket/o"
+
+func newFakeGCS(t *testing.T, objects map[string][]byte) (*fakeGCS, *GCS) {
+	f := &fakeGCS{objects: objects, sessions: make(map[string]*fakeSession)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	conf.Conf = &conf.Config{TempDir: t.TempDir()}
+	base.InitClient()
+	d := &GCS{Addition: Addition{Bucket: "bucket", Endpoint: srv.URL, ChunkSize: 1}}
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return f, d
+}
+
+func (f *fakeGCS) object(name string) Object {
+	sum := md5.Sum(f.objects[name])
+	return Object{Name: name, Size: strconv.Itoa(len(f.objects[name])), MD5Hash: base64.StdEncoding.EncodeToString(sum[:])}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	var e ErrResp
+	e.Error.Code, e.Error.Message = code, msg
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = utils.Json.NewEncoder(w).Encode(e)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = utils.Json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.EscapedPath()
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && path == bucketPath:
+		f.list(w, query)
+	case r.Method == http.MethodPost && path == "/upload"+bucketPath:
+		if query.Get("uploadType") != "resumable" {
+			writeError(w, http.StatusBadRequest, "not resumable")
+			return
+		}
+		id := strconv.Itoa(len(f.sessions))
+		f.sessions[id] = &fakeSession{name: query.Get("name")}
+		w.Header().Set("Location", "http://"+r.Host+"/upload/session/"+id)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/upload/session/"):
+		s, ok := f.sessions[strings.TrimPrefix(path, "/upload/session/")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "no session")
+			return
+		}
+		f.putChunk(w, r, s)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, bucketPath+"/"):
+		src, dst, ok := strings.Cut(strings.TrimPrefix(path, bucketPath+"/"), "/rewriteTo/b/bucket/o/")
+		src, _ = url.PathUnescape(src)
+		dst, _ = url.PathUnescape(dst)
+		if _, exists := f.objects[src]; !ok || !exists {
+			writeError(w, http.StatusNotFound, "no object "+src)
+			return
+		}
+		f.rewrites++
+		// the first call of a rewrite is never done
+		if query.Get("rewriteToken") != "token" {
+			writeJSON(w, RewriteResp{RewriteToken: "token"})
+			return
+		}
+		f.objects[dst] = f.objects[src]
+		writeJSON(w, RewriteResp{Done: true})
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, bucketPath+"/"):
+		name, _ := url.PathUnescape(strings.TrimPrefix(path, bucketPath+"/"))
+		if _, ok := f.objects[name]; !ok {
+			writeError(w, http.StatusNotFound, "no object "+name)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusBadRequest, r.Method+" "+path)
+	}
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	var resp ListResp
+	var entries []string
+	prefixes := make(map[string]bool)
+	for name := range f.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// the names with the delimiter after the prefix are rolled up into the prefixes
+		if i := strings.Index(name[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			name = name[:len(prefix)+i+1]
+			if prefixes[name] {
+				continue
+			}
+			prefixes[name] = true
+		}
+		entries = append(entries, name)
+	}
+	sort.Strings(entries)
+	start, _ := strconv.Atoi(query.Get("pageToken"))
+	end := min(start+2, len(entries))
+	if end < len(entries) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	for _, e := range entries[start:end] {
+		if prefixes[e] {
+			resp.Prefixes = append(resp.Prefixes, e)
+		} else {
+			resp.Items = append(resp.Items, f.object(e))
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (f *fakeGCS) putChunk(w http.ResponseWriter, r *http.Request, s *fakeSession) {
+	var start, end, size int64
+	cr := r.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		if _, err = fmt.Sscanf(cr, "bytes */%d", &size); err != nil {
+			writeError(w, http.StatusBadRequest, "wrong range "+cr)
+			return
+		}
+		start, end = size, size-1
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil || int64(len(data)) != end-start+1 {
+		writeError(w, http.StatusBadRequest, "wrong length of "+cr)
+		return
+	}
+	persisted := int64(len(s.data))
+	if start > persisted {
+		writeError(w, http.StatusBadRequest, "missing bytes before "+cr)
+		return
+	}
+	// the bytes persisted already are ignored
+	data = data[persisted-start:]
+	f.puts++
+	if f.partial && start > 0 && len(data) > 1 {
+		f.partial = false
+		data = data[:len(data)/2]
+	}
+	s.data = append(s.data, data...)
+	if int64(len(s.data)) == size {
+		f.objects[s.name] = s.data
+		writeJSON(w, f.object(s.name))
+		return
+	}
+	w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func TestList(t *testing.T) {
+	_, d := newFakeGCS(t, map[string][]byte{
+		"a.txt":         []byte("hello"),
+		"dir/b.txt":     []byte("b"),
+		"dir/c/d.txt":   []byte("d"),
+		"dir/c/":        nil,
+		"dir/.openlist": nil,
+		"dir/e.txt":     []byte("e"),
+		"f.txt":         []byte("f"),
+	})
+	ctx := context.Background()
+	for _, tt := range []struct {
+		dir         string
+		placeholder bool
+		want        string
+	}{
+		{dir: "/", want: "a.txt,dir/,f.txt"},
+		{dir: "/dir", want: "b.txt,c/,e.txt"},
+		{dir: "/dir", placeholder: true, want: ".openlist,b.txt,c/,e.txt"},
+		// the dir object created by the console is not listed
+		{dir: "/dir/c", want: "d.txt"},
+		{dir: "/missing", want: ""},
+	} {
+		objs, err := d.list(ctx, tt.dir, model.ListArgs{S3ShowPlaceholder: tt.placeholder})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range objs {
+			name := obj.GetName()
+			if obj.IsDir() {
+				name += "/"
+			}
+			names = append(names, name)
+			if want := strings.TrimSuffix(tt.dir, "/") + "/" + obj.GetName(); obj.GetPath() != want {
+				t.Errorf("wrong path %s of %s", obj.GetPath(), want)
+			}
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("wrong objs of %s: %s", tt.dir, got)
+		}
+	}
+
+	objs, err := d.list(ctx, "/", model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte("hello"))
+	for _, obj := range objs {
+		if obj.GetName() == "a.txt" && (obj.GetSize() != 5 || obj.GetHash().GetHash(utils.MD5) != hex.EncodeToString(sum[:])) {
+			t.Errorf("wrong obj: %+v", obj)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	f, d := newFakeGCS(t, map[string][]byte{})
+	ctx := context.Background()
+	// three chunks of 1 MiB, the second one is persisted partially and sent again
+	f.partial = true
+	data := make([]byte, 5*utils.MB/2)
+	rand.New(rand.NewSource(1)).Read(data)
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: "big.bin", Size: int64(len(data))},
+		Reader: bytes.NewReader(data),
+	}
+	defer file.Close()
+	var progress float64
+	if err := d.Put(ctx, &model.Object{Path: "/dir"}, file, func(p float64) { progress = p }); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.objects["dir/big.bin"], data) {
+		t.Errorf("wrong data of %d bytes uploaded", len(f.objects["dir/big.bin"]))
+	}
+	if f.puts != 4 || progress != 100 {
+		t.Errorf("wrong upload of %d puts, progress %v", f.puts, progress)
+	}
+
+	// the placeholder is an empty object
+	if err := d.MakeDir(ctx, &model.Object{Path: "/dir"}, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := f.objects["dir/sub/.openlist"]; !ok || len(data) != 0 {
+		t.Errorf("wrong placeholder: %v, %v", data, ok)
+	}
+}
+
+func TestCopyAndRemove(t *testing.T) {
+	f, d := newFakeGCS(t, map[string][]byte{"a b.txt": []byte("hello")})
+	ctx := context.Background()
+	// the rewrite is done by the second call, with the token of the first one
+	if err := d.copyFile(ctx, "/a b.txt", "/dir/c+d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.objects["dir/c+d.txt"]) != "hello" || f.rewrites != 2 {
+		t.Errorf("wrong copy in %d rewrites: %q", f.rewrites, f.objects["dir/c+d.txt"])
+	}
+	if err := d.copyFile(ctx, "/missing", "/dir/missing"); err == nil || !strings.Contains(err.Error(), "no object missing") {
+		t.Errorf("wrong error of copying the missing object: %v", err)
+	}
+	if err := d.removeFile(ctx, "/a b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.objects["a b.txt"]; ok {
+		t.Error("the object is not removed")
+	}
+	if err := d.removeFile(ctx, "/a b.txt"); err == nil {
+		t.Error("removed the missing object")
+	}
+}
+
+func TestPersistedEnd(t *testing.T) {
+	for header, want := range map[string]int64{"bytes=0-42": 42, "": -1, "bytes=0-": -1} {
+		if got := persistedEnd(header); got != want {
+			t.Errorf("wrong end of %q: %d", header, got)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package gcs
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	driver.RootPath
+	Bucket        string `json:"bucket" required:"true"`
+	Credentials   string `json:"credentials" type:"text" confidential:"true" help:"The JSON key of the service account. Leave it empty for anonymous access, e.g. to a public bucket or an emulator."`
+	Endpoint      string `json:"endpoint" help:"Override the endpoint, e.g. http://localhost:4443 for fake-gcs-server. Default https://storage.googleapis.com"`
+	SignURLExpire int    `json:"sign_url_expire" type:"number" default:"4" help:"The expiration time for signed URLs, in hours, at most 168."`
+	Attachment    bool   `json:"attachment" help:"Let signed URLs download the files as attachments instead of previewing them in the browser."`
+	ChunkSize     int    `json:"chunk_size" type:"number" default:"16" help:"The chunk size of resumable uploads, in MB."`
+	Placeholder   string `json:"placeholder"`
+}
+
+var config = driver.Config{
+	Name:        "Google Cloud Storage",
+	DefaultRoot: "/",
+	LocalSort:   true,
+	CheckStatus: true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &GCS{}
+	})
+}
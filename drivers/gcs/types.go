@@ -0,0 +1,62 @@
+package gcs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	stdpath "path"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+type serviceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type ErrResp struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type Object struct {
+	Name        string    `json:"name"`
+	Size        string    `json:"size"`
+	MD5Hash     string    `json:"md5Hash"`
+	TimeCreated time.Time `json:"timeCreated"`
+	Updated     time.Time `json:"updated"`
+}
+
+type ListResp struct {
+	Prefixes      []string `json:"prefixes"`
+	Items         []Object `json:"items"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+type RewriteResp struct {
+	Done         bool   `json:"done"`
+	RewriteToken string `json:"rewriteToken"`
+}
+
+func objectToObj(o Object, dirPath string) *model.Object {
+	name := stdpath.Base(o.Name)
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	obj := &model.Object{
+		Path:     stdpath.Join(dirPath, name),
+		Name:     name,
+		Size:     size,
+		Modified: o.Updated,
+		Ctime:    o.TimeCreated,
+	}
+	// the md5 is base64 encoded, and missing for composite objects
+	if md5, err := base64.StdEncoding.DecodeString(o.MD5Hash); err == nil && len(md5) > 0 {
+		obj.HashInfo = utils.NewHashInfo(utils.MD5, hex.EncodeToString(md5))
+	}
+	return obj
+}
@@ -0,0 +1,471 @@
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	stdpath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/avast/retry-go"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+// do others that not defined in Driver interface
+
+const (
+	defaultEndpoint = "https://storage.googleapis.com"
+	scope           = "https://www.googleapis.com/auth/devstorage.read_write"
+	// the chunks of resumable uploads must be multiples of 256 KiB except the last one
+	chunkAlign = 256 * 1024
+	// the longest expiration of V4 signed URLs
+	maxSignExpire = 7 * 24 * time.Hour
+)
+
+func (d *GCS) initCredentials() error {
+	if d.Credentials == "" {
+		return nil
+	}
+	var sa serviceAccount
+	if err := utils.Json.UnmarshalFromString(d.Credentials, &sa); err != nil {
+		return fmt.Errorf("invalid credentials: %w", err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return errors.New("invalid credentials: client_email and private_key required")
+	}
+	key, err := parsePrivateKey(sa.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	cfg := &jwt.Config{
+		Email:        sa.ClientEmail,
+		PrivateKey:   []byte(sa.PrivateKey),
+		PrivateKeyID: sa.PrivateKeyID,
+		Scopes:       []string{scope},
+		TokenURL:     sa.TokenURI,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base.HttpClient)
+	d.tokenSource = cfg.TokenSource(ctx)
+	d.clientEmail = sa.ClientEmail
+	d.privateKey = key
+	return nil
+}
+
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid private key: not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("invalid private key: not an RSA key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func (d *GCS) authorization() (string, error) {
+	if d.tokenSource == nil {
+		return "", nil
+	}
+	token, err := d.tokenSource.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.Type() + " " + token.AccessToken, nil
+}
+
+func (d *GCS) request(ctx context.Context, method, url string, callback base.ReqCallback, resp interface{}) (*resty.Response, error) {
+	req := base.RestyClient.R().SetContext(ctx)
+	auth, err := d.authorization()
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		req.SetHeader("Authorization", auth)
+	}
+	if callback != nil {
+		callback(req)
+	}
+	if resp != nil {
+		req.SetResult(resp)
+	}
+	var e ErrResp
+	req.SetError(&e)
+	res, err := req.Execute(method, url)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsError() {
+		if e.Error.Message != "" {
+			return res, fmt.Errorf("%d: %s", e.Error.Code, e.Error.Message)
+		}
+		return res, fmt.Errorf("%s: %s", res.Status(), res.String())
+	}
+	return res, nil
+}
+
+func (d *GCS) bucketURL() string {
+	return d.endpoint + "/storage/v1/b/" + encode(d.Bucket, false)
+}
+
+func (d *GCS) objectURL(key string) string {
+	return d.bucketURL() + "/o/" + encode(key, false)
+}
+
+func getKey(path string, dir bool) string {
+	path = strings.TrimPrefix(path, "/")
+	if path != "" && dir {
+		path += "/"
+	}
+	return path
+}
+
+var defaultPlaceholderName = ".openlist"
+
+func getPlaceholderName(placeholder string) string {
+	if placeholder == "" {
+		return defaultPlaceholderName
+	}
+	return placeholder
+}
+
+func (d *GCS) list(ctx context.Context, dirPath string, args model.ListArgs) ([]model.Obj, error) {
+	prefix := getKey(dirPath, true)
+	files := make([]model.Obj, 0)
+	pageToken := ""
+	for {
+		var resp ListResp
+		_, err := d.request(ctx, http.MethodGet, d.bucketURL()+"/o", func(req *resty.Request) {
+			req.SetQueryParams(map[string]string{
+				"prefix":     prefix,
+				"delimiter":  "/",
+				"pageToken":  pageToken,
+				"maxResults": "1000",
+				"fields":     "prefixes,items(name,size,md5Hash,timeCreated,updated),nextPageToken",
+			})
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range resp.Prefixes {
+			name := stdpath.Base(strings.TrimSuffix(p, "/"))
+			files = append(files, &model.Object{
+				Path:     stdpath.Join(dirPath, name),
+				Name:     name,
+				Modified: d.Modified,
+				IsFolder: true,
+			})
+		}
+		for _, o := range resp.Items {
+			// the objects ending with / are the dirs created by the console
+			if strings.HasSuffix(o.Name, "/") {
+				continue
+			}
+			name := stdpath.Base(o.Name)
+			if !args.S3ShowPlaceholder && (name == getPlaceholderName(d.Placeholder) || name == d.Placeholder) {
+				continue
+			}
+			files = append(files, objectToObj(o, dirPath))
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+	return files, nil
+}
+
+func (d *GCS) copy(ctx context.Context, src string, dst string, isDir bool) error {
+	if isDir {
+		return d.copyDir(ctx, src, dst)
+	}
+	return d.copyFile(ctx, src, dst)
+}
+
+// copyFile copies the object on the server side, large objects are rewritten in several calls
+func (d *GCS) copyFile(ctx context.Context, src string, dst string) error {
+	u := d.objectURL(getKey(src, false)) + "/rewriteTo/b/" + encode(d.Bucket, false) + "/o/" + encode(getKey(dst, false), false)
+	token := ""
+	for {
+		var resp RewriteResp
+		_, err := d.request(ctx, http.MethodPost, u, func(req *resty.Request) {
+			if token != "" {
+				req.SetQueryParam("rewriteToken", token)
+			}
+			req.SetQueryParam("fields", "done,rewriteToken")
+		}, &resp)
+		if err != nil {
+			return err
+		}
+		if resp.Done {
+			return nil
+		}
+		if resp.RewriteToken == "" {
+			return errors.New("rewrite isn't done but no rewrite token")
+		}
+		token = resp.RewriteToken
+	}
+}
+
+func (d *GCS) copyDir(ctx context.Context, src string, dst string) error {
+	objs, err := op.List(ctx, d, src, model.ListArgs{S3ShowPlaceholder: true})
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		cSrc := stdpath.Join(src, obj.GetName())
+		cDst := stdpath.Join(dst, obj.GetName())
+		if obj.IsDir() {
+			err = d.copyDir(ctx, cSrc, cDst)
+		} else {
+			err = d.copyFile(ctx, cSrc, cDst)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *GCS) removeDir(ctx context.Context, src string) error {
+	objs, err := op.List(ctx, d, src, model.ListArgs{})
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		cSrc := stdpath.Join(src, obj.GetName())
+		if obj.IsDir() {
+			err = d.removeDir(ctx, cSrc)
+		} else {
+			err = d.removeFile(ctx, cSrc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_ = d.removeFile(ctx, stdpath.Join(src, getPlaceholderName(d.Placeholder)))
+	_ = d.removeFile(ctx, stdpath.Join(src, d.Placeholder))
+	return nil
+}
+
+func (d *GCS) removeFile(ctx context.Context, src string) error {
+	_, err := d.request(ctx, http.MethodDelete, d.objectURL(getKey(src, false)), nil, nil)
+	return err
+}
+
+// upload uploads the file with a resumable upload session, chunk by chunk
+func (d *GCS) upload(ctx context.Context, key string, file model.FileStreamer, up driver.UpdateProgress) (*Object, error) {
+	contentType := file.GetMimetype()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	size := file.GetSize()
+	res, err := d.request(ctx, http.MethodPost, d.endpoint+"/upload/storage/v1/b/"+encode(d.Bucket, false)+"/o", func(req *resty.Request) {
+		req.SetQueryParams(map[string]string{
+			"uploadType": "resumable",
+			"name":       key,
+		})
+		req.SetHeader("X-Upload-Content-Type", contentType)
+		req.SetHeader("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+		req.SetBody(map[string]string{
+			"name":        key,
+			"contentType": contentType,
+		})
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	session := res.Header().Get("Location")
+	if session == "" {
+		return nil, errors.New("failed to create upload session: no session URI")
+	}
+	if size == 0 {
+		return d.uploadChunk(ctx, session, nil, 0, 0, 0)
+	}
+
+	chunkSize := int64(max(d.ChunkSize, 1)) * utils.MB
+	chunkSize = (chunkSize + chunkAlign - 1) / chunkAlign * chunkAlign
+	ss, err := stream.NewStreamSectionReader(file, int(chunkSize), &up)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	var obj *Object
+	for offset < size {
+		if utils.IsCanceled(ctx) {
+			return nil, ctx.Err()
+		}
+		length := min(size-offset, chunkSize)
+		reader, err := ss.GetSectionReader(offset, length)
+		if err != nil {
+			return nil, err
+		}
+		err = retry.Do(func() error {
+			if _, err := reader.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			obj, err = d.uploadChunk(ctx, session, driver.NewLimitedUploadStream(ctx, reader), offset, length, size)
+			return err
+		},
+			retry.Context(ctx),
+			retry.Attempts(3),
+			retry.DelayType(retry.BackOffDelay),
+			retry.Delay(time.Second))
+		ss.FreeSectionReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		offset += length
+		up(float64(offset) / float64(size) * 100)
+	}
+	if obj == nil {
+		return nil, errors.New("upload session isn't finalized")
+	}
+	return obj, nil
+}
+
+// uploadChunk uploads the chunk of the session, it returns the object once the last chunk is uploaded
+func (d *GCS) uploadChunk(ctx context.Context, session string, r io.Reader, offset, length, size int64) (*Object, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, r)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	}
+	res, err := base.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var obj Object
+		if err = utils.Json.NewDecoder(res.Body).Decode(&obj); err != nil {
+			return nil, err
+		}
+		return &obj, nil
+	case http.StatusPermanentRedirect:
+		// the server may persist only a part of the chunk, the chunk is sent again then,
+		// the bytes already persisted are ignored
+		if end := offset + length - 1; persistedEnd(res.Header.Get("Range")) < end {
+			return nil, fmt.Errorf("chunk is uploaded partially, %s of bytes %d-%d", res.Header.Get("Range"), offset, end)
+		}
+		return nil, nil
+	default:
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("failed to upload chunk: %s: %s", res.Status, string(body))
+	}
+}
+
+// persistedEnd parses the Range header like bytes=0-42
+func persistedEnd(header string) int64 {
+	_, end, ok := strings.Cut(strings.TrimPrefix(header, "bytes="), "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// signURL generates the V4 signed URL to download the object
+// https://cloud.google.com/storage/docs/access-control/signing-urls-manually
+func (d *GCS) signURL(key, fileName string, expire time.Duration) (string, error) {
+	u, err := url.Parse(d.endpoint)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	datetime := now.Format("20060102T150405Z")
+	credentialScope := now.Format("20060102") + "/auto/storage/goog4_request"
+	canonicalURI := "/" + encode(d.Bucket, false) + "/" + encode(key, true)
+	query := map[string]string{
+		"X-Goog-Algorithm":     "GOOG4-RSA-SHA256",
+		"X-Goog-Credential":    d.clientEmail + "/" + credentialScope,
+		"X-Goog-Date":          datetime,
+		"X-Goog-Expires":       strconv.FormatInt(int64(min(expire, maxSignExpire)/time.Second), 10),
+		"X-Goog-SignedHeaders": "host",
+	}
+	if d.Attachment {
+		query["response-content-disposition"] = fmt.Sprintf(`attachment; filename*=UTF-8''%s`, url.PathEscape(fileName))
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, encode(k, false)+"="+encode(query[k], false))
+	}
+	canonicalQuery := strings.Join(params, "&")
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		canonicalURI,
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"GOOG4-RSA-SHA256",
+		datetime,
+		credentialScope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, d.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s://%s%s?%s&X-Goog-Signature=%s",
+		u.Scheme, u.Host, canonicalURI, canonicalQuery, hex.EncodeToString(signature)), nil
+}
+
+// encode percent-encodes all the bytes except the unreserved characters, and / if keepSlash
+func encode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || keepSlash && c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	stdpath "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+type Git struct {
+	model.Storage
+	Addition
+	repo       string
+	putMsgTmpl *template.Template
+
+	// serializes the fetches and commits
+	mu        sync.Mutex
+	lastFetch time.Time
+	blobG     singleflight.Group[string]
+}
+
+func (d *Git) Config() driver.Config {
+	return config
+}
+
+func (d *Git) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Git) Init(ctx context.Context) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is not installed: %w", err)
+	}
+	var err error
+	d.putMsgTmpl, err = template.New("putCommitMsgTemplate").Parse(d.PutCommitMsg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case d.RemoteURL != "":
+		d.repo = filepath.Join(flags.DataDir, "git", strconv.FormatUint(uint64(d.ID), 10))
+		return d.clone(ctx)
+	case d.RepoPath != "":
+		d.repo = d.RepoPath
+		_, err = d.git(ctx, nil, nil, "rev-parse", "--git-dir")
+		return err
+	default:
+		return fmt.Errorf("one of repo path and remote URL required")
+	}
+}
+
+// clone clones the remote repository as a bare one, or fetches it if it's cloned already
+func (d *Git) clone(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(d.repo, "HEAD")); err == nil {
+		if _, err = d.git(ctx, nil, nil, "remote", "set-url", "origin", d.RemoteURL); err != nil {
+			return err
+		}
+		return d.fetch(ctx)
+	}
+	_ = os.RemoveAll(d.repo)
+	if err := os.MkdirAll(filepath.Dir(d.repo), 0o777); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "git", "clone", "--bare", "--quiet", "--", d.RemoteURL, d.repo)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	d.lastFetch = time.Now()
+	return nil
+}
+
+// fetch updates the branches from the remote, the upload branch is only fast-forwarded
+// so that the commits not pushed yet are kept
+func (d *Git) fetch(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	args := []string{"fetch", "--quiet", "--prune", "--tags", "origin", "+refs/heads/*:refs/heads/*"}
+	if d.UploadBranch != "" {
+		// the negative refspec keeps the upload branch untouched, including pruning
+		args = append(args, "^refs/heads/"+d.UploadBranch)
+	}
+	if _, err := d.git(ctx, nil, nil, args...); err != nil {
+		return err
+	}
+	d.lastFetch = time.Now()
+	if d.UploadBranch == "" {
+		return nil
+	}
+	// the pattern doesn't fail if the upload branch isn't on the remote, unlike the exact name
+	if _, err := d.git(ctx, nil, nil, "fetch", "--quiet", "origin",
+		"+refs/heads/"+d.UploadBranch+"*:refs/remotes/origin/"+d.UploadBranch+"*"); err != nil {
+		return err
+	}
+	local, remote := "refs/heads/"+d.UploadBranch, "refs/remotes/origin/"+d.UploadBranch
+	out, err := d.git(ctx, nil, nil, "rev-parse", "--verify", "-q", remote+"^{commit}")
+	if err != nil {
+		// the upload branch isn't on the remote
+		return nil
+	}
+	remoteCommit := strings.TrimSpace(string(out))
+	var localCommit string
+	if out, err = d.git(ctx, nil, nil, "rev-parse", "--verify", "-q", local+"^{commit}"); err == nil {
+		localCommit = strings.TrimSpace(string(out))
+		if _, err = d.git(ctx, nil, nil, "merge-base", "--is-ancestor", local, remote); err != nil {
+			if localCommit != remoteCommit {
+				log.Warnf("the branch %s of %s has commits not pushed, not updated from the remote", d.UploadBranch, d.MountPath)
+			}
+			return nil
+		}
+	}
+	// the old value makes sure that the branch isn't updated meanwhile
+	_, err = d.git(ctx, nil, nil, "update-ref", "-m", "fetch: fast-forward", local, remoteCommit, localCommit)
+	return err
+}
+
+func (d *Git) Drop(ctx context.Context) error {
+	_ = os.RemoveAll(d.blobCacheDir())
+	return nil
+}
+
+func (d *Git) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	if args.Refresh && d.RemoteURL != "" && time.Since(d.lastFetch) > time.Duration(d.FetchInterval)*time.Minute {
+		if err := d.fetch(ctx); err != nil {
+			log.Warnf("failed fetch %s: %v", d.MountPath, err)
+		}
+	}
+	if dir.GetPath() == "/" {
+		refs, err := d.refs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return utils.SliceConvert(refs, func(r ref) (model.Obj, error) {
+			return &model.Object{
+				ID:       r.commit,
+				Path:     "/" + r.name,
+				Name:     r.name,
+				Modified: r.time,
+				IsFolder: true,
+			}, nil
+		})
+	}
+	r, sub, err := d.resolve(ctx, dir.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	return d.lsTree(ctx, r, sub, dir.GetPath())
+}
+
+func (d *Git) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	oid := file.GetID()
+	return &model.Link{
+		RangeReader: stream.RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+			return d.catFile(ctx, oid, httpRange.Start, httpRange.Length)
+		}),
+	}, nil
+}
+
+func (d *Git) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	// git doesn't track empty dirs
+	return d.put(ctx, stdpath.Join(parentDir.GetPath(), dirName, ".gitkeep"), bytes.NewReader(nil))
+}
+
+func (d *Git) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) error {
+	err := d.put(ctx, stdpath.Join(dstDir.GetPath(), file.GetName()), driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	}))
+	if err != nil {
+		return err
+	}
+	up(100)
+	return nil
+}
+
+func (d *Git) put(ctx context.Context, path string, data io.Reader) error {
+	if d.UploadBranch == "" {
+		return errs.PermissionDenied
+	}
+	r, sub, err := d.resolve(ctx, path)
+	if err != nil {
+		return err
+	}
+	if r.fullName != "refs/heads/"+d.UploadBranch {
+		return fmt.Errorf("only the branch %s is writable", d.UploadBranch)
+	}
+	var message bytes.Buffer
+	err = d.putMsgTmpl.Execute(&message, map[string]string{
+		"UserName": getUsername(ctx),
+		"ObjName":  stdpath.Base(path),
+		"ObjPath":  "/" + sub,
+	})
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err = d.commitFile(ctx, d.UploadBranch, sub, data, message.String()); err != nil {
+		return err
+	}
+	if d.RemoteURL != "" && d.PushAfterCommit {
+		ref := "refs/heads/" + d.UploadBranch
+		if _, err = d.git(ctx, nil, nil, "push", "--quiet", "origin", ref+":"+ref); err != nil {
+			return fmt.Errorf("committed but failed to push: %w", err)
+		}
+	}
+	return nil
+}
+
+func getUsername(ctx context.Context) string {
+	user, ok := ctx.Value(conf.UserKey).(*model.User)
+	if !ok {
+		return "<system>"
+	}
+	return user.Username
+}
+
+var _ driver.Driver = (*Git)(nil)
@@ -0,0 +1,147 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+var identity = []string{"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost"}
+
+// testRepo creates a bare repository with the branches main and feature/x, the lightweight tag v1,
+// the annotated tag v2 and the tag main hidden by the branch
+func testRepo(t *testing.T) *Git {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	conf.Conf = &conf.Config{TempDir: t.TempDir()}
+	d := &Git{Addition: Addition{ShowTags: true, AuthorName: "test", AuthorEmail: "test@localhost"}, repo: t.TempDir()}
+	ctx := context.Background()
+	if _, err := d.git(ctx, nil, nil, "init", "--bare", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct{ branch, path, data string }{
+		{"main", "a.txt", "hello world"},
+		{"main", "dir/name with space.txt", "0123456789"},
+		{"feature/x", "b.txt", "feature"},
+	} {
+		if err := d.commitFile(ctx, f.branch, f.path, strings.NewReader(f.data), "add "+f.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"tag", "v1", "refs/heads/main"},
+		{"tag", "-a", "v2", "-m", "v2", "refs/heads/feature/x"},
+		{"tag", "main", "refs/heads/feature/x"},
+	} {
+		if _, err := d.git(ctx, nil, identity, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestRefs(t *testing.T) {
+	d := testRepo(t)
+	ctx := context.Background()
+	refs, err := d.refs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	commits := map[string]string{}
+	for _, r := range refs {
+		names = append(names, r.name)
+		commits[r.name] = r.commit
+		if r.time.IsZero() {
+			t.Errorf("no time of ref %s", r.name)
+		}
+	}
+	if strings.Join(names, ",") != "feature%2Fx,main,v1,v2" {
+		t.Errorf("wrong refs: %v", names)
+	}
+	// the annotated tag is peeled to the commit, the branch wins over the tag of the same name
+	if commits["v2"] != commits["feature%2Fx"] || commits["v1"] != commits["main"] || commits["main"] == commits["v2"] {
+		t.Errorf("wrong commits of refs: %v", commits)
+	}
+
+	d.ShowTags = false
+	if refs, err = d.refs(ctx); err != nil || len(refs) != 2 {
+		t.Errorf("wrong refs without tags: %+v, %v", refs, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	d := testRepo(t)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		path, ref, sub string
+	}{
+		{path: "/main", ref: "refs/heads/main"},
+		{path: "/main/dir/name with space.txt", ref: "refs/heads/main", sub: "dir/name with space.txt"},
+		{path: "/feature%2Fx/b.txt", ref: "refs/heads/feature/x", sub: "b.txt"},
+		{path: "/v2", ref: "refs/tags/v2"},
+	} {
+		r, sub, err := d.resolve(ctx, tt.path)
+		if err != nil {
+			t.Errorf("failed resolve %s: %v", tt.path, err)
+			continue
+		}
+		if r.fullName != tt.ref || sub != tt.sub {
+			t.Errorf("wrong resolve of %s: %s, %s", tt.path, r.fullName, sub)
+		}
+	}
+	// for-each-ref matches the prefixes of the path components
+	for _, path := range []string{"/feature", "/feature/x", "/ma", "/%zz"} {
+		if _, _, err := d.resolve(ctx, path); !errors.Is(err, errs.ObjectNotFound) {
+			t.Errorf("resolved %s: %v", path, err)
+		}
+	}
+}
+
+func TestListAndRead(t *testing.T) {
+	d := testRepo(t)
+	ctx := context.Background()
+	objs, err := d.List(ctx, &model.Object{Path: "/main"}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].GetName() != "a.txt" || objs[0].GetSize() != 11 || objs[0].IsDir() ||
+		objs[1].GetName() != "dir" || !objs[1].IsDir() || objs[1].GetPath() != "/main/dir" {
+		t.Fatalf("wrong objs of main: %+v", objs)
+	}
+	objs, err = d.List(ctx, objs[1], model.ListArgs{})
+	if err != nil || len(objs) != 1 || objs[0].GetName() != "name with space.txt" || objs[0].GetSize() != 10 {
+		t.Fatalf("wrong objs of dir: %+v, %v", objs, err)
+	}
+	file := objs[0]
+	for _, tt := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{5, -1, "56789"},
+	} {
+		rc, err := d.catFile(ctx, file.GetID(), tt.offset, tt.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil || string(data) != tt.want {
+			t.Errorf("wrong data from %d of %d: %q, %v", tt.offset, tt.length, data, err)
+		}
+	}
+	if _, err = d.List(ctx, &model.Object{Path: "/main/missing"}, model.ListArgs{}); err == nil {
+		t.Error("listed the missing dir")
+	}
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	RepoPath        string `json:"repo_path" help:"The path of a local bare repository, one of repo path and remote URL required"`
+	RemoteURL       string `json:"remote_url" help:"The repository is cloned into the data dir, the credentials can be set in the URL"`
+	FetchInterval   int    `json:"fetch_interval" type:"number" default:"10" help:"minutes, fetch the remote repository on refresh at most once per interval"`
+	ShowTags        bool   `json:"show_tags" default:"true"`
+	UploadBranch    string `json:"upload_branch" help:"The uploads are committed on this branch, empty to disable uploading"`
+	AuthorName      string `json:"author_name" default:"OpenList"`
+	AuthorEmail     string `json:"author_email" default:"openlist@localhost"`
+	PutCommitMsg    string `json:"put_commit_message" type:"text" default:"{{.UserName}} upload {{.ObjPath}}"`
+	PushAfterCommit bool   `json:"push_after_commit" default:"true" help:"push the upload branch to the remote repository after committing"`
+}
+
+var config = driver.Config{
+	Name:        "Git",
+	LocalSort:   true,
+	OnlyProxy:   true,
+	DefaultRoot: "/",
+	NoLinkURL:   true,
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Git{}
+	})
+}
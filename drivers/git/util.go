@@ -0,0 +1,311 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	stdpath "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// git runs the git command in the repository and returns its stdout
+func (d *Git) git(ctx context.Context, stdin io.Reader, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", d.repo}, args...)...)
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+type ref struct {
+	// the name shown as the top-level folder, the short name escaped
+	name     string
+	fullName string
+	commit   string
+	time     time.Time
+}
+
+// refs returns the branches, and the tags if shown, the branch wins if a tag has the same name
+func (d *Git) refs(ctx context.Context, patterns ...string) ([]ref, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"refs/heads"}
+		if d.ShowTags {
+			patterns = append(patterns, "refs/tags")
+		}
+	}
+	out, err := d.git(ctx, nil, nil, append([]string{"for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(*objectname)%00%(committerdate:unix)%00%(*committerdate:unix)%00%(objecttype)"},
+		patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+	var refs []ref
+	names := map[string]struct{}{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 6 {
+			continue
+		}
+		r := ref{fullName: fields[0], commit: fields[1]}
+		unix := fields[3]
+		// the annotated tag is peeled to the commit
+		if fields[2] != "" {
+			r.commit, unix = fields[2], fields[4]
+		} else if fields[5] != "commit" {
+			continue
+		}
+		short := strings.TrimPrefix(strings.TrimPrefix(r.fullName, "refs/heads/"), "refs/tags/")
+		r.name = url.PathEscape(short)
+		if _, ok := names[r.name]; ok {
+			continue
+		}
+		names[r.name] = struct{}{}
+		if sec, err := strconv.ParseInt(unix, 10, 64); err == nil {
+			r.time = time.Unix(sec, 0)
+		}
+		refs = append(refs, r)
+	}
+	return refs, nil
+}
+
+// resolve splits the path into the ref and the path in its tree
+func (d *Git) resolve(ctx context.Context, path string) (*ref, string, error) {
+	path = strings.TrimPrefix(path, "/")
+	name, sub, _ := strings.Cut(path, "/")
+	short, err := url.PathUnescape(name)
+	if err != nil {
+		return nil, "", errs.ObjectNotFound
+	}
+	patterns := []string{"refs/heads/" + short}
+	if d.ShowTags {
+		patterns = append(patterns, "refs/tags/"+short)
+	}
+	refs, err := d.refs(ctx, patterns...)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, r := range refs {
+		// for-each-ref matches the patterns as prefixes of the path components
+		if r.name == name {
+			return &r, sub, nil
+		}
+	}
+	return nil, "", errs.ObjectNotFound
+}
+
+// lsTree lists the entries of the tree at sub of the commit
+func (d *Git) lsTree(ctx context.Context, r *ref, sub, dirPath string) ([]model.Obj, error) {
+	treeish := r.commit + "^{tree}"
+	if sub != "" {
+		treeish = r.commit + ":" + sub
+	}
+	out, err := d.git(ctx, nil, nil, "ls-tree", "-l", "-z", treeish)
+	if err != nil {
+		return nil, err
+	}
+	var objs []model.Obj
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <name>
+		meta, name, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		obj := &model.Object{
+			ID:       fields[2],
+			Path:     stdpath.Join(dirPath, name),
+			Name:     name,
+			Modified: r.time,
+		}
+		switch fields[1] {
+		case "tree":
+			obj.IsFolder = true
+		case "blob":
+			obj.Size, _ = strconv.ParseInt(fields[3], 10, 64)
+		default:
+			// submodules
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// the blobs read from the middle are cached in the files until they're not read for this long
+const blobCacheTimeout = 30 * time.Minute
+
+func (d *Git) blobCacheDir() string {
+	return filepath.Join(conf.Conf.TempDir, "git", strconv.FormatUint(uint64(d.ID), 10))
+}
+
+// catFile reads the blob from offset, a negative length reads to the end
+func (d *Git) catFile(ctx context.Context, oid string, offset, length int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return d.streamBlob(ctx, oid, length)
+	}
+	// the blob is stored compressed and delta encoded, so it can only be read from the start,
+	// it's cached to read the ranges of it
+	p, err := d.cacheBlob(ctx, oid)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+	return utils.NewReadCloser(r, f.Close), nil
+}
+
+// cacheBlob writes the blob to the cache file if it's not cached, the blobs are immutable
+func (d *Git) cacheBlob(ctx context.Context, oid string) (string, error) {
+	dir := d.blobCacheDir()
+	p := filepath.Join(dir, oid)
+	if _, err := os.Stat(p); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(p, now, now)
+		return p, nil
+	}
+	p, err, _ := d.blobG.Do(oid, func() (string, error) {
+		d.cleanBlobCache()
+		if err := os.MkdirAll(dir, 0o777); err != nil {
+			return "", err
+		}
+		rc, err := d.streamBlob(ctx, oid, -1)
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		f, err := os.CreateTemp(dir, oid+"-*")
+		if err != nil {
+			return "", err
+		}
+		_, err = utils.CopyWithBuffer(f, rc)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), p)
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return "", err
+		}
+		return p, nil
+	})
+	return p, err
+}
+
+// cleanBlobCache removes the cached blobs not read for blobCacheTimeout
+func (d *Git) cleanBlobCache() {
+	entries, err := os.ReadDir(d.blobCacheDir())
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > blobCacheTimeout {
+			_ = os.Remove(filepath.Join(d.blobCacheDir(), e.Name()))
+		}
+	}
+}
+
+// streamBlob streams the blob from the start
+func (d *Git) streamBlob(ctx context.Context, oid string, length int64) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", d.repo, "cat-file", "blob", oid)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	closeFunc := func() error {
+		cancel()
+		_ = cmd.Wait()
+		return nil
+	}
+	var r io.Reader = stdout
+	if length >= 0 {
+		r = io.LimitReader(stdout, length)
+	}
+	return utils.NewReadCloser(r, closeFunc), nil
+}
+
+// commitFile writes the data to the path of the branch and commits it, the branch is created if not exists
+func (d *Git) commitFile(ctx context.Context, branch, path string, data io.Reader, message string) error {
+	blob, err := d.git(ctx, data, nil, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	index, err := os.CreateTemp(conf.Conf.TempDir, "git-index-*")
+	if err != nil {
+		return err
+	}
+	_ = index.Close()
+	_ = os.Remove(index.Name())
+	defer os.Remove(index.Name())
+	env := []string{
+		"GIT_INDEX_FILE=" + index.Name(),
+		"GIT_AUTHOR_NAME=" + d.AuthorName,
+		"GIT_AUTHOR_EMAIL=" + d.AuthorEmail,
+		"GIT_COMMITTER_NAME=" + d.AuthorName,
+		"GIT_COMMITTER_EMAIL=" + d.AuthorEmail,
+	}
+	fullName := "refs/heads/" + branch
+	var parent string
+	if out, err := d.git(ctx, nil, nil, "rev-parse", "--verify", "-q", fullName+"^{commit}"); err == nil {
+		parent = strings.TrimSpace(string(out))
+		if _, err = d.git(ctx, nil, env, "read-tree", parent); err != nil {
+			return err
+		}
+	}
+	if _, err = d.git(ctx, nil, env, "update-index", "--add", "--cacheinfo",
+		"100644,"+strings.TrimSpace(string(blob))+","+path); err != nil {
+		return err
+	}
+	tree, err := d.git(ctx, nil, env, "write-tree")
+	if err != nil {
+		return err
+	}
+	args := []string{"commit-tree", strings.TrimSpace(string(tree)), "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := d.git(ctx, nil, env, args...)
+	if err != nil {
+		return err
+	}
+	// the old value makes sure that the branch isn't updated meanwhile
+	_, err = d.git(ctx, nil, nil, "update-ref", "-m", message, fullName, strings.TrimSpace(string(commit)), parent)
+	return err
+}
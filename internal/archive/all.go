@@ -2,6 +2,7 @@ package archive
 
 import (
 	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/archives"
+	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/fsimage"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/iso9660"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/rardecode"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/sevenzip"
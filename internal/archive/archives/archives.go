@@ -1,6 +1,7 @@
 package archives
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,6 +13,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/mholt/archives"
 )
 
 type Archives struct {
@@ -53,6 +55,33 @@ func (Archives) GetMeta(ss []*stream.SeekableStream, args model.ArchiveArgs) (mo
 	}, nil
 }
 
+// Index reads all the entries in one pass, the offsets are recorded for the plain tar
+func (Archives) Index(ss []*stream.SeekableStream, args model.ArchiveArgs) (*tool.Index, error) {
+	reader, extractor, err := identify(ss[0], args)
+	if err != nil {
+		return nil, err
+	}
+	r := io.NewSectionReader(reader, 0, ss[0].GetSize())
+	if _, ok := extractor.(archives.Tar); ok {
+		return indexTar(r)
+	}
+	idx := &tool.Index{}
+	err = extractor.Extract(ss[0].Ctx, r, func(ctx context.Context, f archives.FileInfo) error {
+		idx.Entries = append(idx.Entries, tool.IndexEntry{
+			Path:     f.NameInArchive,
+			Size:     f.Size(),
+			Modified: f.ModTime(),
+			IsDir:    f.IsDir(),
+			Offset:   -1,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, filterPassword(err)
+	}
+	return idx, nil
+}
+
 func (Archives) List(ss []*stream.SeekableStream, args model.ArchiveInnerArgs) ([]model.Obj, error) {
 	fsys, err := getFs(ss[0], args.ArchiveArgs)
 	if err != nil {
@@ -140,6 +169,7 @@ func (Archives) Decompress(ss []*stream.SeekableStream, outputPath string, args
 }
 
 var _ tool.Tool = (*Archives)(nil)
+var _ tool.Indexer = (*Archives)(nil)
 
 func init() {
 	tool.RegisterTool(Archives{})
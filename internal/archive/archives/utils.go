@@ -1,6 +1,7 @@
 package archives
 
 import (
+	"archive/tar"
 	"fmt"
 	"io"
 	fs2 "io/fs"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/archive/tool"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
@@ -15,27 +17,37 @@ import (
 	"github.com/mholt/archives"
 )
 
-func getFs(ss *stream.SeekableStream, args model.ArchiveArgs) (*archives.ArchiveFS, error) {
+func identify(ss *stream.SeekableStream, args model.ArchiveArgs) (io.ReaderAt, archives.Extractor, error) {
 	reader, err := stream.NewReadAtSeeker(ss, 0)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if r, ok := reader.(*stream.RangeReadReadAtSeeker); ok {
 		r.InitHeadCache()
 	}
 	format, _, err := archives.Identify(ss.Ctx, ss.GetName(), reader)
 	if err != nil {
-		return nil, errs.UnknownArchiveFormat
-	}
-	extractor, ok := format.(archives.Extractor)
-	if !ok {
-		return nil, errs.UnknownArchiveFormat
+		return nil, nil, errs.UnknownArchiveFormat
 	}
 	switch f := format.(type) {
 	case archives.SevenZip:
 		f.Password = args.Password
+		format = f
 	case archives.Rar:
 		f.Password = args.Password
+		format = f
+	}
+	extractor, ok := format.(archives.Extractor)
+	if !ok {
+		return nil, nil, errs.UnknownArchiveFormat
+	}
+	return reader, extractor, nil
+}
+
+func getFs(ss *stream.SeekableStream, args model.ArchiveArgs) (*archives.ArchiveFS, error) {
+	reader, extractor, err := identify(ss, args)
+	if err != nil {
+		return nil, err
 	}
 	return &archives.ArchiveFS{
 		Stream:  io.NewSectionReader(reader, 0, ss.GetSize()),
@@ -44,6 +56,40 @@ func getFs(ss *stream.SeekableStream, args model.ArchiveArgs) (*archives.Archive
 	}, nil
 }
 
+// indexTar reads the headers of the plain tar only, the contents are skipped by seeking,
+// so the offsets of the regular files can be recorded
+func indexTar(r *io.SectionReader) (*tool.Index, error) {
+	idx := &tool.Index{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		info := hdr.FileInfo()
+		if !info.Mode().IsRegular() || hdr.Typeflag == tar.TypeGNUSparse {
+			offset = -1
+		}
+		idx.Entries = append(idx.Entries, tool.IndexEntry{
+			Path:     hdr.Name,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			IsDir:    info.IsDir(),
+			Offset:   offset,
+		})
+	}
+}
+
 func toModelObj(file os.FileInfo) *model.Object {
 	return &model.Object{
 		Name:     file.Name(),
@@ -0,0 +1,361 @@
+package fsimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+const sectorSize = 512
+
+// openDisk returns the virtual disk of the VHD and VMDK images, or the raw image itself
+func openDisk(r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	if size >= sectorSize {
+		header, err := readAt(r, sectorSize, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if bytes.Equal(header[:4], []byte("KDMV")) {
+			return openVMDK(r, size, header)
+		}
+		footer, err := readAt(r, sectorSize, size-sectorSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		if bytes.Equal(footer[:8], []byte("conectix")) {
+			return openVHD(r, size, footer)
+		}
+	}
+	return r, size, nil
+}
+
+// vhdDisk is the dynamic VHD, of which the blocks are allocated by the block allocation table
+type vhdDisk struct {
+	r         io.ReaderAt
+	size      int64
+	blockSize int64
+	// the size of the sector bitmap before the data of each block
+	bitmapSize int64
+	bat        []uint32
+}
+
+func openVHD(r io.ReaderAt, size int64, footer []byte) (io.ReaderAt, int64, error) {
+	be := binary.BigEndian
+	diskSize := int64(be.Uint64(footer[48:]))
+	switch be.Uint32(footer[60:]) {
+	case 2:
+		return io.NewSectionReader(r, 0, min(diskSize, size-sectorSize)), min(diskSize, size-sectorSize), nil
+	case 3:
+	case 4:
+		return nil, 0, errors.New("differencing vhd is not supported")
+	default:
+		return nil, 0, errors.New("unknown vhd disk type")
+	}
+	header, err := readAt(r, 1024, int64(be.Uint64(footer[16:])))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(header[:8], []byte("cxsparse")) {
+		return nil, 0, errors.New("invalid vhd dynamic disk header")
+	}
+	d := &vhdDisk{
+		r:         r,
+		size:      diskSize,
+		blockSize: int64(be.Uint32(header[32:])),
+	}
+	entries := int64(be.Uint32(header[28:]))
+	if d.blockSize <= 0 || d.blockSize%sectorSize != 0 || entries*d.blockSize < diskSize || entries > 1<<24 {
+		return nil, 0, errors.New("invalid vhd dynamic disk header")
+	}
+	d.bitmapSize = (d.blockSize/sectorSize/8 + sectorSize - 1) / sectorSize * sectorSize
+	table, err := readAt(r, int(entries*4), int64(be.Uint64(header[16:])))
+	if err != nil {
+		return nil, 0, err
+	}
+	d.bat = make([]uint32, entries)
+	for i := range d.bat {
+		d.bat[i] = be.Uint32(table[i*4:])
+	}
+	return d, diskSize, nil
+}
+
+func (d *vhdDisk) ReadAt(p []byte, off int64) (int, error) {
+	return readBlocks(p, off, d.size, d.blockSize, func(p []byte, block, off int64) error {
+		sector := d.bat[block]
+		if sector == 0xFFFFFFFF {
+			clear(p)
+			return nil
+		}
+		return readFull(d.r, p, int64(sector)*sectorSize+d.bitmapSize+off)
+	})
+}
+
+// readBlocks splits the read into the blocks of the virtual disk
+func readBlocks(p []byte, off, size, blockSize int64, read func(p []byte, block, off int64) error) (int, error) {
+	if off >= size {
+		return 0, io.EOF
+	}
+	var err error
+	if off+int64(len(p)) > size {
+		p = p[:size-off]
+		err = io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		inner := pos % blockSize
+		l := min(int64(len(p)-n), blockSize-inner)
+		if e := read(p[n:n+int(l)], pos/blockSize, inner); e != nil {
+			return n, e
+		}
+		n += int(l)
+	}
+	return n, err
+}
+
+// vmdkDisk is the monolithic sparse or stream optimized VMDK
+type vmdkDisk struct {
+	r          io.ReaderAt
+	size       int64
+	grainSize  int64
+	gtEntries  int64
+	gd         []uint32
+	compressed bool
+
+	mu     sync.Mutex
+	tables map[int64][]uint32
+	// the last decompressed grain
+	grainIdx int64
+	grain    []byte
+}
+
+func openVMDK(r io.ReaderAt, size int64, header []byte) (io.ReaderAt, int64, error) {
+	le := binary.LittleEndian
+	gdOffset := le.Uint64(header[56:])
+	if gdOffset == 0xFFFFFFFFFFFFFFFF {
+		// the stream optimized image has the grain directory in the footer
+		if size < 3*sectorSize {
+			return nil, 0, errors.New("invalid vmdk footer")
+		}
+		footer, err := readAt(r, sectorSize, size-2*sectorSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !bytes.Equal(footer[:4], []byte("KDMV")) {
+			return nil, 0, errors.New("invalid vmdk footer")
+		}
+		header = footer
+		gdOffset = le.Uint64(header[56:])
+	}
+	d := &vmdkDisk{
+		r:          r,
+		size:       int64(le.Uint64(header[12:])) * sectorSize,
+		grainSize:  int64(le.Uint64(header[20:])) * sectorSize,
+		gtEntries:  int64(le.Uint32(header[44:])),
+		compressed: le.Uint32(header[8:])&(1<<16) != 0,
+		tables:     make(map[int64][]uint32),
+		grainIdx:   -1,
+	}
+	if d.grainSize <= 0 || d.gtEntries <= 0 || d.size <= 0 {
+		return nil, 0, errors.New("invalid vmdk header")
+	}
+	tableSpan := d.grainSize * d.gtEntries
+	gdEntries := (d.size + tableSpan - 1) / tableSpan
+	if gdEntries > 1<<24 {
+		return nil, 0, errors.New("invalid vmdk header")
+	}
+	gd, err := readAt(r, int(gdEntries*4), int64(gdOffset)*sectorSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	d.gd = make([]uint32, gdEntries)
+	for i := range d.gd {
+		d.gd[i] = le.Uint32(gd[i*4:])
+	}
+	return d, d.size, nil
+}
+
+func (d *vmdkDisk) table(idx int64) ([]uint32, error) {
+	if t, ok := d.tables[idx]; ok {
+		return t, nil
+	}
+	t := make([]uint32, d.gtEntries)
+	if sector := d.gd[idx]; sector != 0 {
+		b, err := readAt(d.r, int(d.gtEntries*4), int64(sector)*sectorSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range t {
+			t[i] = binary.LittleEndian.Uint32(b[i*4:])
+		}
+	}
+	d.tables[idx] = t
+	return t, nil
+}
+
+func (d *vmdkDisk) ReadAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return readBlocks(p, off, d.size, d.grainSize, func(p []byte, grain, off int64) error {
+		t, err := d.table(grain / d.gtEntries)
+		if err != nil {
+			return err
+		}
+		sector := t[grain%d.gtEntries]
+		// 0 is not allocated and 1 is zeroed
+		if sector <= 1 {
+			clear(p)
+			return nil
+		}
+		if !d.compressed {
+			return readFull(d.r, p, int64(sector)*sectorSize+off)
+		}
+		if d.grainIdx != grain {
+			if err = d.readCompressedGrain(int64(sector) * sectorSize); err != nil {
+				return err
+			}
+			d.grainIdx = grain
+		}
+		copy(p, d.grain[off:])
+		return nil
+	})
+}
+
+// readCompressedGrain decompresses the grain which starts with the marker of lba and size
+func (d *vmdkDisk) readCompressedGrain(pos int64) error {
+	marker, err := readAt(d.r, 12, pos)
+	if err != nil {
+		return err
+	}
+	size := int64(binary.LittleEndian.Uint32(marker[8:]))
+	if size > 2*d.grainSize+sectorSize {
+		return errors.New("invalid vmdk compressed grain")
+	}
+	zr, err := zlib.NewReader(io.NewSectionReader(d.r, pos+12, size))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if d.grain == nil {
+		d.grain = make([]byte, d.grainSize)
+	}
+	d.grainIdx = -1
+	n, err := io.ReadFull(zr, d.grain)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		clear(d.grain[n:])
+		err = nil
+	}
+	return err
+}
+
+type partition struct {
+	offset int64
+	size   int64
+}
+
+// readPartitions reads the partitions of the MBR or GPT, the logical partitions of the extended partition are included
+func readPartitions(r io.ReaderAt, size int64) ([]partition, error) {
+	if size < 2*sectorSize {
+		return nil, nil
+	}
+	mbr, err := readAt(r, sectorSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return nil, nil
+	}
+	le := binary.LittleEndian
+	var parts []partition
+	add := func(start, count int64) {
+		p := partition{offset: start * sectorSize, size: count * sectorSize}
+		if p.size > 0 && p.offset > 0 && p.offset < size {
+			p.size = min(p.size, size-p.offset)
+			parts = append(parts, p)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		e := mbr[446+i*16 : 446+(i+1)*16]
+		typ := e[4]
+		start, count := int64(le.Uint32(e[8:])), int64(le.Uint32(e[12:]))
+		switch typ {
+		case 0:
+		case 0xEE:
+			return readGPT(r, size)
+		case 0x05, 0x0F, 0x85:
+			logical, err := readLogicalPartitions(r, start)
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range logical {
+				add(l.offset, l.size)
+			}
+		default:
+			add(start, count)
+		}
+	}
+	return parts, nil
+}
+
+// readLogicalPartitions follows the chain of the EBRs, the offsets and sizes returned are in sectors
+func readLogicalPartitions(r io.ReaderAt, extStart int64) ([]partition, error) {
+	le := binary.LittleEndian
+	var parts []partition
+	ebr := extStart
+	for i := 0; i < 128; i++ {
+		b, err := readAt(r, sectorSize, ebr*sectorSize)
+		if err != nil {
+			return nil, err
+		}
+		if b[510] != 0x55 || b[511] != 0xAA {
+			break
+		}
+		if b[446+4] != 0 {
+			parts = append(parts, partition{offset: ebr + int64(le.Uint32(b[446+8:])), size: int64(le.Uint32(b[446+12:]))})
+		}
+		next := b[462:478]
+		if next[4] == 0 {
+			break
+		}
+		ebr = extStart + int64(le.Uint32(next[8:]))
+	}
+	return parts, nil
+}
+
+func readGPT(r io.ReaderAt, size int64) ([]partition, error) {
+	header, err := readAt(r, sectorSize, sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:8], []byte("EFI PART")) {
+		return nil, errors.New("invalid gpt header")
+	}
+	le := binary.LittleEndian
+	start := int64(le.Uint64(header[72:]))
+	count := int64(le.Uint32(header[80:]))
+	entrySize := int64(le.Uint32(header[84:]))
+	if entrySize < 128 || count*entrySize > 1<<20 {
+		return nil, errors.New("invalid gpt header")
+	}
+	table, err := readAt(r, int(count*entrySize), start*sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	var parts []partition
+	for i := int64(0); i < count; i++ {
+		e := table[i*entrySize : (i+1)*entrySize]
+		if bytes.Equal(e[:16], make([]byte, 16)) {
+			continue
+		}
+		first, last := int64(le.Uint64(e[32:])), int64(le.Uint64(e[40:]))
+		p := partition{offset: first * sectorSize, size: (last - first + 1) * sectorSize}
+		if p.size > 0 && p.offset > 0 && p.offset < size {
+			p.size = min(p.size, size-p.offset)
+			parts = append(parts, p)
+		}
+	}
+	return parts, nil
+}
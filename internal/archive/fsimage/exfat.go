@@ -0,0 +1,181 @@
+package fsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf16"
+)
+
+type exfatFS struct {
+	r           io.ReaderAt
+	clusterSize int64
+	clusters    uint32
+	fatOffset   int64
+	heapOffset  int64
+	rootCluster uint32
+}
+
+type exfatRef struct {
+	cluster uint32
+	// the clusters are contiguous and not recorded in the FAT
+	noFatChain bool
+	size       int64
+	validSize  int64
+}
+
+func openExFAT(r io.ReaderAt, size int64) (fileSystem, error) {
+	if size < sectorSize {
+		return nil, nil
+	}
+	b, err := readAt(r, sectorSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[3:11], []byte("EXFAT   ")) {
+		return nil, nil
+	}
+	le := binary.LittleEndian
+	sectorShift, clusterShift := b[108], b[109]
+	if sectorShift < 9 || sectorShift > 12 || int(sectorShift)+int(clusterShift) > 25 {
+		return nil, errors.New("invalid exfat boot sector")
+	}
+	bytesPerSector := int64(1) << sectorShift
+	return &exfatFS{
+		r:           r,
+		clusterSize: bytesPerSector << clusterShift,
+		clusters:    le.Uint32(b[92:]),
+		fatOffset:   int64(le.Uint32(b[80:])) * bytesPerSector,
+		heapOffset:  int64(le.Uint32(b[88:])) * bytesPerSector,
+		rootCluster: le.Uint32(b[96:]),
+	}, nil
+}
+
+func (fs *exfatFS) root() (*entry, error) {
+	return &entry{isDir: true, ref: exfatRef{cluster: fs.rootCluster}}, nil
+}
+
+func (fs *exfatFS) clusterOffset(cluster uint32) int64 {
+	return fs.heapOffset + int64(cluster-2)*fs.clusterSize
+}
+
+// runs returns the runs of the data, the length is not limited if size is less than 0
+func (fs *exfatFS) runs(ref exfatRef, size int64) ([]run, error) {
+	if ref.cluster < 2 || ref.cluster >= fs.clusters+2 {
+		return nil, nil
+	}
+	if ref.noFatChain {
+		return []run{{Offset: fs.clusterOffset(ref.cluster), Length: size}}, nil
+	}
+	var runs []run
+	var length int64
+	cluster := ref.cluster
+	for i := uint32(0); cluster >= 2 && cluster < fs.clusters+2; i++ {
+		if i > fs.clusters {
+			return nil, errors.New("exfat cluster chain loops")
+		}
+		runs = appendRun(runs, run{Offset: fs.clusterOffset(cluster), Length: fs.clusterSize})
+		length += fs.clusterSize
+		if size >= 0 && length >= size {
+			break
+		}
+		b, err := readAt(fs.r, 4, fs.fatOffset+int64(cluster)*4)
+		if err != nil {
+			return nil, err
+		}
+		cluster = binary.LittleEndian.Uint32(b)
+	}
+	return runs, nil
+}
+
+func (fs *exfatFS) readDir(dir *entry) ([]*entry, error) {
+	ref := dir.ref.(exfatRef)
+	size := int64(-1)
+	if ref.noFatChain {
+		size = ref.size
+	}
+	runs, err := fs.runs(ref, size)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(&runsReader{r: fs.r, runs: runs})
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	var ret []*entry
+	for i := 0; i+32 <= len(data); i += 32 {
+		d := data[i : i+32]
+		if d[0] == 0 {
+			break
+		}
+		// the file entry followed by the stream extension and file name entries
+		if d[0] != 0x85 {
+			continue
+		}
+		secondary := int(d[1])
+		if secondary < 2 || i+32*(secondary+1) > len(data) {
+			continue
+		}
+		stream := data[i+32 : i+64]
+		if stream[0] != 0xC0 {
+			continue
+		}
+		nameLen := int(stream[3])
+		var name []uint16
+		for j := 2; j <= secondary && len(name) < nameLen; j++ {
+			n := data[i+32*j : i+32*(j+1)]
+			if n[0] != 0xC1 {
+				break
+			}
+			for k := 2; k < 32 && len(name) < nameLen; k += 2 {
+				name = append(name, le.Uint16(n[k:]))
+			}
+		}
+		e := &entry{
+			name:    string(utf16.Decode(name)),
+			size:    int64(le.Uint64(stream[24:])),
+			modTime: exfatTime(le.Uint32(d[12:]), d[21], d[24]),
+			isDir:   le.Uint16(d[4:])&0x10 != 0,
+			ref: exfatRef{
+				cluster:    le.Uint32(stream[20:]),
+				noFatChain: stream[1]&0x02 != 0,
+				size:       int64(le.Uint64(stream[24:])),
+				validSize:  int64(le.Uint64(stream[8:])),
+			},
+		}
+		if e.isDir {
+			e.size = 0
+		}
+		ret = append(ret, e)
+		i += 32 * secondary
+	}
+	return ret, nil
+}
+
+func exfatTime(ts uint32, ms10, utcOffset byte) time.Time {
+	t := dosTime(uint16(ts>>16), uint16(ts))
+	if t.IsZero() {
+		return t
+	}
+	t = t.Add(time.Duration(ms10) * 10 * time.Millisecond)
+	// the offset in 15 minutes is valid if the highest bit is set
+	if utcOffset&0x80 != 0 {
+		offset := int(int8(utcOffset<<1)>>1) * 15 * 60
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone("", offset))
+	}
+	return t
+}
+
+func (fs *exfatFS) open(file *entry) (io.Reader, error) {
+	ref := file.ref.(exfatRef)
+	valid := min(ref.validSize, file.size)
+	runs, err := fs.runs(ref, valid)
+	if err != nil {
+		return nil, err
+	}
+	// the data after the valid size is read as zeros
+	return &runsReader{r: fs.r, runs: truncateRuns(truncateRuns(runs, valid), file.size)}, nil
+}
@@ -0,0 +1,322 @@
+package fsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	extRootInode = 2
+
+	extIncompatFiletype  = 0x2
+	extIncompat64bit     = 0x80
+	extIncompatEncrypted = 0x10000
+
+	extFlagExtents    = 0x80000
+	extFlagInlineData = 0x10000000
+)
+
+// extFS is the ext2, ext3 or ext4 filesystem
+type extFS struct {
+	r              io.ReaderAt
+	blockSize      int64
+	inodeSize      int64
+	inodesPerGroup uint32
+	inodeCount     uint32
+	descSize       int64
+	descOffset     int64
+	is64bit        bool
+	fileType       bool
+	encrypted      bool
+}
+
+type extInode struct {
+	mode  uint16
+	size  int64
+	mtime time.Time
+	flags uint32
+	block []byte
+}
+
+type extRef struct {
+	ino   uint32
+	inode *extInode
+}
+
+func openExt(r io.ReaderAt, size int64) (fileSystem, error) {
+	if size < 2048 {
+		return nil, nil
+	}
+	sb, err := readAt(r, 1024, 1024)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	if le.Uint16(sb[56:]) != 0xEF53 {
+		return nil, nil
+	}
+	logBlockSize := le.Uint32(sb[24:])
+	if logBlockSize > 6 {
+		return nil, errors.New("invalid ext superblock")
+	}
+	incompat := le.Uint32(sb[96:])
+	fs := &extFS{
+		r:              r,
+		blockSize:      1024 << logBlockSize,
+		inodeSize:      128,
+		inodesPerGroup: le.Uint32(sb[40:]),
+		inodeCount:     le.Uint32(sb[0:]),
+		descSize:       32,
+		is64bit:        incompat&extIncompat64bit != 0,
+		fileType:       incompat&extIncompatFiletype != 0,
+		encrypted:      incompat&extIncompatEncrypted != 0,
+	}
+	if le.Uint32(sb[76:]) >= 1 {
+		fs.inodeSize = int64(le.Uint16(sb[88:]))
+	}
+	if fs.is64bit {
+		if descSize := int64(le.Uint16(sb[254:])); descSize >= 64 {
+			fs.descSize = descSize
+		}
+	}
+	if fs.inodesPerGroup == 0 || fs.inodeSize < 128 {
+		return nil, errors.New("invalid ext superblock")
+	}
+	// the group descriptors are in the block after the superblock
+	fs.descOffset = (int64(le.Uint32(sb[20:])) + 1) * fs.blockSize
+	return fs, nil
+}
+
+func (fs *extFS) readInode(ino uint32) (*extInode, error) {
+	if ino == 0 || ino > fs.inodeCount {
+		return nil, errors.New("invalid ext inode number")
+	}
+	group := int64((ino - 1) / fs.inodesPerGroup)
+	index := int64((ino - 1) % fs.inodesPerGroup)
+	desc, err := readAt(fs.r, int(fs.descSize), fs.descOffset+group*fs.descSize)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	table := int64(le.Uint32(desc[8:]))
+	if fs.descSize >= 64 {
+		table |= int64(le.Uint32(desc[40:])) << 32
+	}
+	b, err := readAt(fs.r, 128, table*fs.blockSize+index*fs.inodeSize)
+	if err != nil {
+		return nil, err
+	}
+	return &extInode{
+		mode:  le.Uint16(b[0:]),
+		size:  int64(le.Uint32(b[4:])) | int64(le.Uint32(b[108:]))<<32,
+		mtime: time.Unix(int64(le.Uint32(b[16:])), 0),
+		flags: le.Uint32(b[32:]),
+		block: b[40:100],
+	}, nil
+}
+
+func (in *extInode) isDir() bool {
+	return in.mode&0xF000 == 0x4000
+}
+
+func (in *extInode) isRegular() bool {
+	return in.mode&0xF000 == 0x8000
+}
+
+func (fs *extFS) root() (*entry, error) {
+	in, err := fs.readInode(extRootInode)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{isDir: true, modTime: in.mtime, ref: extRef{ino: extRootInode, inode: in}}, nil
+}
+
+// runs returns the runs of the inode data
+func (fs *extFS) runs(in *extInode) ([]run, error) {
+	var runs []run
+	var err error
+	if in.flags&extFlagExtents != 0 {
+		runs, err = fs.extentRuns(in.block, 0, 0)
+	} else {
+		blocks := (in.size + fs.blockSize - 1) / fs.blockSize
+		runs, err = fs.blockMapRuns(in.block, blocks)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return truncateRuns(runs, in.size), nil
+}
+
+// extentRuns reads the extent tree, next is the logical block expected, the holes are filled with zeros
+func (fs *extFS) extentRuns(node []byte, next int64, level int) ([]run, error) {
+	le := binary.LittleEndian
+	if len(node) < 12 || le.Uint16(node[0:]) != 0xF30A || level > 8 {
+		return nil, errors.New("invalid ext extent tree")
+	}
+	entries := int(le.Uint16(node[2:]))
+	depth := le.Uint16(node[6:])
+	if 12+entries*12 > len(node) {
+		return nil, errors.New("invalid ext extent tree")
+	}
+	var runs []run
+	for i := 0; i < entries; i++ {
+		e := node[12+i*12 : 24+i*12]
+		logical := int64(le.Uint32(e[0:]))
+		if depth > 0 {
+			leaf := int64(le.Uint32(e[4:])) | int64(le.Uint16(e[8:]))<<32
+			child, err := readAt(fs.r, int(fs.blockSize), leaf*fs.blockSize)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := fs.extentRuns(child, next, level+1)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range sub {
+				runs = appendRun(runs, r)
+				next += r.Length / fs.blockSize
+			}
+			continue
+		}
+		length := int64(le.Uint16(e[4:]))
+		uninit := length > 32768
+		if uninit {
+			length -= 32768
+		}
+		if logical < next {
+			continue
+		}
+		runs = appendRun(runs, run{Offset: -1, Length: (logical - next) * fs.blockSize})
+		start := (int64(le.Uint16(e[6:]))<<32 | int64(le.Uint32(e[8:]))) * fs.blockSize
+		if uninit {
+			start = -1
+		}
+		runs = appendRun(runs, run{Offset: start, Length: length * fs.blockSize})
+		next = logical + length
+	}
+	return runs, nil
+}
+
+// blockMapRuns reads the direct and indirect blocks of ext2 and ext3
+func (fs *extFS) blockMapRuns(block []byte, blocks int64) ([]run, error) {
+	le := binary.LittleEndian
+	var runs []run
+	add := func(b uint32) {
+		if b == 0 {
+			runs = appendRun(runs, run{Offset: -1, Length: fs.blockSize})
+		} else {
+			runs = appendRun(runs, run{Offset: int64(b) * fs.blockSize, Length: fs.blockSize})
+		}
+		blocks--
+	}
+	perBlock := fs.blockSize / 4
+	var indirect func(b uint32, level int) error
+	indirect = func(b uint32, level int) error {
+		if b == 0 {
+			// a hole of all the blocks referenced
+			n := perBlock
+			for i := 1; i < level; i++ {
+				n *= perBlock
+			}
+			n = min(n, blocks)
+			runs = appendRun(runs, run{Offset: -1, Length: n * fs.blockSize})
+			blocks -= n
+			return nil
+		}
+		data, err := readAt(fs.r, int(fs.blockSize), int64(b)*fs.blockSize)
+		if err != nil {
+			return err
+		}
+		for i := int64(0); i < perBlock && blocks > 0; i++ {
+			p := le.Uint32(data[i*4:])
+			if level == 1 {
+				add(p)
+			} else if err = indirect(p, level-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < 15 && blocks > 0; i++ {
+		p := le.Uint32(block[i*4:])
+		if i < 12 {
+			add(p)
+		} else if err := indirect(p, i-11); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (fs *extFS) data(in *extInode) (io.Reader, error) {
+	if fs.encrypted {
+		return nil, errors.New("encrypted ext filesystem is not supported")
+	}
+	if in.flags&extFlagInlineData != 0 {
+		// only the data in the inode is read, the rest in the extended attribute is not supported
+		if in.size > int64(len(in.block)) {
+			return nil, errors.New("ext inline data in extended attribute is not supported")
+		}
+		return bytes.NewReader(in.block[:in.size]), nil
+	}
+	runs, err := fs.runs(in)
+	if err != nil {
+		return nil, err
+	}
+	return &runsReader{r: fs.r, runs: runs}, nil
+}
+
+func (fs *extFS) readDir(dir *entry) ([]*entry, error) {
+	in := dir.ref.(extRef).inode
+	r, err := fs.data(in)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if in.flags&extFlagInlineData != 0 {
+		// the inline directory starts with the parent inode number
+		data = data[min(4, len(data)):]
+	}
+	le := binary.LittleEndian
+	var ret []*entry
+	for pos := 0; pos+8 <= len(data); {
+		ino := le.Uint32(data[pos:])
+		recLen := int(le.Uint16(data[pos+4:]))
+		nameLen := int(le.Uint16(data[pos+6:]))
+		if fs.fileType {
+			nameLen = int(data[pos+6])
+		}
+		if recLen < 8 || pos+recLen > len(data) {
+			break
+		}
+		if ino != 0 && 8+nameLen <= recLen {
+			name := string(data[pos+8 : pos+8+nameLen])
+			if name != "." && name != ".." {
+				child, err := fs.readInode(ino)
+				if err != nil {
+					return nil, err
+				}
+				// the special files are skipped, including the symbolic links
+				if child.isDir() || child.isRegular() {
+					e := &entry{name: name, modTime: child.mtime, isDir: child.isDir(), ref: extRef{ino: ino, inode: child}}
+					if !e.isDir {
+						e.size = child.size
+					}
+					ret = append(ret, e)
+				}
+			}
+		}
+		pos += recLen
+	}
+	return ret, nil
+}
+
+func (fs *extFS) open(file *entry) (io.Reader, error) {
+	return fs.data(file.ref.(extRef).inode)
+}
@@ -0,0 +1,281 @@
+package fsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// fatFS is the FAT12, FAT16 or FAT32 filesystem
+type fatFS struct {
+	r           io.ReaderAt
+	bits        int
+	clusterSize int64
+	clusters    uint32
+	fatOffset   int64
+	dataOffset  int64
+	// the fixed root directory of FAT12 and FAT16
+	rootOffset  int64
+	rootSize    int64
+	rootCluster uint32
+}
+
+type fatRef struct {
+	cluster uint32
+}
+
+func openFAT(r io.ReaderAt, size int64) (fileSystem, error) {
+	if size < sectorSize {
+		return nil, nil
+	}
+	b, err := readAt(r, sectorSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	bytesPerSector := int64(le.Uint16(b[11:]))
+	sectorsPerCluster := int64(b[13])
+	reserved := int64(le.Uint16(b[14:]))
+	fats := int64(b[16])
+	rootEntries := int64(le.Uint16(b[17:]))
+	totalSectors := int64(le.Uint16(b[19:]))
+	if totalSectors == 0 {
+		totalSectors = int64(le.Uint32(b[32:]))
+	}
+	fatSize := int64(le.Uint16(b[22:]))
+	if fatSize == 0 {
+		fatSize = int64(le.Uint32(b[36:]))
+	}
+	if (b[0] != 0xEB && b[0] != 0xE9) || b[510] != 0x55 || b[511] != 0xAA ||
+		(bytesPerSector != 512 && bytesPerSector != 1024 && bytesPerSector != 2048 && bytesPerSector != 4096) ||
+		sectorsPerCluster == 0 || sectorsPerCluster&(sectorsPerCluster-1) != 0 ||
+		reserved == 0 || fats == 0 || fatSize == 0 || totalSectors == 0 {
+		return nil, nil
+	}
+	rootSectors := (rootEntries*32 + bytesPerSector - 1) / bytesPerSector
+	dataSector := reserved + fats*fatSize + rootSectors
+	if dataSector >= totalSectors {
+		return nil, nil
+	}
+	fs := &fatFS{
+		r:           r,
+		clusterSize: bytesPerSector * sectorsPerCluster,
+		clusters:    uint32((totalSectors - dataSector) / sectorsPerCluster),
+		fatOffset:   reserved * bytesPerSector,
+		dataOffset:  dataSector * bytesPerSector,
+		rootOffset:  (reserved + fats*fatSize) * bytesPerSector,
+		rootSize:    rootSectors * bytesPerSector,
+	}
+	switch {
+	case fs.clusters < 4085:
+		fs.bits = 12
+	case fs.clusters < 65525:
+		fs.bits = 16
+	default:
+		fs.bits = 32
+		fs.rootCluster = le.Uint32(b[44:])
+	}
+	return fs, nil
+}
+
+func (fs *fatFS) root() (*entry, error) {
+	return &entry{isDir: true, ref: fatRef{cluster: fs.rootCluster}}, nil
+}
+
+// next returns the next cluster of the chain, 0 is returned at the end of the chain
+func (fs *fatFS) next(cluster uint32) (uint32, error) {
+	var next uint32
+	switch fs.bits {
+	case 12:
+		b, err := readAt(fs.r, 2, fs.fatOffset+int64(cluster+cluster/2))
+		if err != nil {
+			return 0, err
+		}
+		next = uint32(binary.LittleEndian.Uint16(b))
+		if cluster%2 == 1 {
+			next >>= 4
+		} else {
+			next &= 0xFFF
+		}
+	case 16:
+		b, err := readAt(fs.r, 2, fs.fatOffset+int64(cluster)*2)
+		if err != nil {
+			return 0, err
+		}
+		next = uint32(binary.LittleEndian.Uint16(b))
+	default:
+		b, err := readAt(fs.r, 4, fs.fatOffset+int64(cluster)*4)
+		if err != nil {
+			return 0, err
+		}
+		next = binary.LittleEndian.Uint32(b) & 0x0FFFFFFF
+	}
+	if next < 2 || next >= fs.clusters+2 {
+		return 0, nil
+	}
+	return next, nil
+}
+
+// chain returns the runs of the cluster chain, it stops after the max length if it's not 0
+func (fs *fatFS) chain(cluster uint32, maxLength int64) ([]run, error) {
+	var runs []run
+	var length int64
+	for i := uint32(0); cluster >= 2 && cluster < fs.clusters+2; i++ {
+		if i > fs.clusters {
+			return nil, errors.New("fat cluster chain loops")
+		}
+		runs = appendRun(runs, run{Offset: fs.dataOffset + int64(cluster-2)*fs.clusterSize, Length: fs.clusterSize})
+		length += fs.clusterSize
+		if maxLength > 0 && length >= maxLength {
+			break
+		}
+		next, err := fs.next(cluster)
+		if err != nil {
+			return nil, err
+		}
+		cluster = next
+	}
+	return runs, nil
+}
+
+func (fs *fatFS) readDir(dir *entry) ([]*entry, error) {
+	ref := dir.ref.(fatRef)
+	var data []byte
+	var err error
+	if ref.cluster == 0 {
+		data, err = readAt(fs.r, int(fs.rootSize), fs.rootOffset)
+	} else {
+		var runs []run
+		if runs, err = fs.chain(ref.cluster, 0); err == nil {
+			data, err = io.ReadAll(&runsReader{r: fs.r, runs: runs})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fs.parseDir(data), nil
+}
+
+func (fs *fatFS) parseDir(data []byte) []*entry {
+	le := binary.LittleEndian
+	var ret []*entry
+	var lfn []uint16
+	var lfnSum byte
+	for i := 0; i+32 <= len(data); i += 32 {
+		d := data[i : i+32]
+		if d[0] == 0 {
+			break
+		}
+		if d[0] == 0xE5 {
+			lfn = nil
+			continue
+		}
+		attr := d[11]
+		if attr&0x3F == 0x0F {
+			seq := int(d[0] & 0x1F)
+			if d[0]&0x40 != 0 {
+				lfn = make([]uint16, 13*seq)
+				lfnSum = d[13]
+			}
+			if seq == 0 || len(lfn) < 13*seq || d[13] != lfnSum {
+				lfn = nil
+				continue
+			}
+			part := lfn[13*(seq-1):]
+			for j, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				part[j] = le.Uint16(d[off:])
+			}
+			continue
+		}
+		name := fs.longName(lfn, lfnSum, d[:11])
+		lfn = nil
+		if attr&0x08 != 0 {
+			// volume label
+			continue
+		}
+		if name == "" {
+			name = shortName(d)
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+		cluster := uint32(le.Uint16(d[26:]))
+		if fs.bits == 32 {
+			cluster |= uint32(le.Uint16(d[20:])) << 16
+		}
+		ret = append(ret, &entry{
+			name:    name,
+			size:    int64(le.Uint32(d[28:])),
+			modTime: dosTime(le.Uint16(d[24:]), le.Uint16(d[22:])),
+			isDir:   attr&0x10 != 0,
+			ref:     fatRef{cluster: cluster},
+		})
+		if attr&0x10 != 0 {
+			ret[len(ret)-1].size = 0
+		}
+	}
+	return ret
+}
+
+// longName returns the long file name if its checksum matches the short name
+func (fs *fatFS) longName(lfn []uint16, sum byte, short []byte) string {
+	if lfn == nil {
+		return ""
+	}
+	var s byte
+	for _, c := range short {
+		s = (s>>1 | s<<7) + c
+	}
+	if s != sum {
+		return ""
+	}
+	for i, c := range lfn {
+		if c == 0 || c == 0xFFFF {
+			lfn = lfn[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(lfn))
+}
+
+func shortName(d []byte) string {
+	base := []byte(strings.TrimRight(string(d[:8]), " "))
+	ext := []byte(strings.TrimRight(string(d[8:11]), " "))
+	if len(base) > 0 && base[0] == 0x05 {
+		base[0] = 0xE5
+	}
+	// the lower case flags of Windows NT
+	if d[12]&0x08 != 0 {
+		base = bytes.ToLower(base)
+	}
+	if d[12]&0x10 != 0 {
+		ext = bytes.ToLower(ext)
+	}
+	if len(ext) == 0 {
+		return string(base)
+	}
+	return string(base) + "." + string(ext)
+}
+
+func dosTime(date, t uint16) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return time.Date(1980+int(date>>9), time.Month(date>>5&0x0F), int(date&0x1F),
+		int(t>>11), int(t>>5&0x3F), int(t&0x1F)*2, 0, time.Local)
+}
+
+func (fs *fatFS) open(file *entry) (io.Reader, error) {
+	if file.size == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	runs, err := fs.chain(file.ref.(fatRef).cluster, file.size)
+	if err != nil {
+		return nil, err
+	}
+	return &runsReader{r: fs.r, runs: truncateRuns(runs, file.size)}, nil
+}
@@ -0,0 +1,129 @@
+package fsimage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/archive/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+)
+
+// FsImage browses the filesystem images, FAT, exFAT, ext2/3/4 and SquashFS are supported,
+// which can be in the partitions of a raw, VHD or VMDK disk image
+type FsImage struct {
+}
+
+func (FsImage) AcceptedExtensions() []string {
+	return []string{
+		".img", ".ima", ".vfd", ".dd", ".raw",
+		".ext2", ".ext3", ".ext4",
+		".sqfs", ".squashfs", ".snap",
+		".vhd", ".vmdk",
+	}
+}
+
+func (FsImage) AcceptedMultipartExtensions() map[string]tool.MultipartExtension {
+	return map[string]tool.MultipartExtension{}
+}
+
+func (FsImage) GetMeta(ss []*stream.SeekableStream, args model.ArchiveArgs) (model.ArchiveMeta, error) {
+	// the folders are read on demand, the images may be too large to read all the metadata
+	return &model.ArchiveMetaInfo{
+		Comment:   "",
+		Encrypted: false,
+	}, nil
+}
+
+func (FsImage) List(ss []*stream.SeekableStream, args model.ArchiveInnerArgs) ([]model.Obj, error) {
+	img, err := getImage(ss[0])
+	if err != nil {
+		return nil, err
+	}
+	children, _, err := img.list(args.InnerPath)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]model.Obj, 0, len(children))
+	for _, child := range children {
+		ret = append(ret, toModelObj(child))
+	}
+	return ret, nil
+}
+
+func (FsImage) Extract(ss []*stream.SeekableStream, args model.ArchiveInnerArgs) (io.ReadCloser, int64, error) {
+	img, err := getImage(ss[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	fs, obj, err := img.getObj(args.InnerPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if obj.isDir {
+		return nil, 0, errs.NotFile
+	}
+	r, err := fs.open(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(r), obj.size, nil
+}
+
+func (FsImage) Decompress(ss []*stream.SeekableStream, outputPath string, args model.ArchiveInnerArgs, up model.UpdateProgress) error {
+	img, err := getImage(ss[0])
+	if err != nil {
+		return err
+	}
+	fs, obj, err := img.getObj(args.InnerPath)
+	if err != nil {
+		return err
+	}
+	if !obj.isDir {
+		return decompress(fs, obj, outputPath, up)
+	}
+	if args.InnerPath != "/" {
+		rootpath := outputPath
+		outputPath = filepath.Join(outputPath, obj.name)
+		if !strings.HasPrefix(outputPath, rootpath+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path: %s", obj.name)
+		}
+		if err = os.MkdirAll(outputPath, 0700); err != nil {
+			return err
+		}
+	}
+	if fs != nil {
+		return decompressAll(fs, obj, outputPath)
+	}
+	// all the volumes are decompressed into their own folders
+	volumes, _, err := img.list("/")
+	if err != nil {
+		return err
+	}
+	for i, v := range volumes {
+		fs := v.ref.(fileSystem)
+		root, err := fs.root()
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(outputPath, v.name)
+		if err = os.MkdirAll(dst, 0700); err != nil {
+			return err
+		}
+		if err = decompressAll(fs, root, dst); err != nil {
+			return err
+		}
+		up(float64(i+1) * 100 / float64(len(volumes)))
+	}
+	return nil
+}
+
+var _ tool.Tool = (*FsImage)(nil)
+
+func init() {
+	tool.RegisterTool(FsImage{})
+}
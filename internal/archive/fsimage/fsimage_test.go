@@ -0,0 +1,163 @@
+package fsimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the files in all the test images
+var testFiles = map[string][]byte{
+	"hello.txt":                     []byte("hello world\n"),
+	"sub/deep/a long file name.txt": []byte("deep file\n"),
+	"sub/big.bin":                   bigData(),
+}
+
+func bigData() []byte {
+	b := make([]byte, 20000)
+	for i := range b {
+		b[i] = byte(i * 7 % 251)
+	}
+	return b
+}
+
+func loadImage(t *testing.T, name string) *image {
+	f, err := os.Open(filepath.Join("testdata", name+".gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := openImage(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open %s: %+v", name, err)
+	}
+	return img
+}
+
+func checkFiles(t *testing.T, img *image, prefix string) {
+	for name, want := range testFiles {
+		fs, e, err := img.getObj(prefix + "/" + name)
+		if err != nil {
+			t.Errorf("failed to get %s: %+v", name, err)
+			continue
+		}
+		if e.isDir || e.size != int64(len(want)) {
+			t.Errorf("wrong entry of %s: dir %v, size %d", name, e.isDir, e.size)
+			continue
+		}
+		if _, ok := fs.(*exfatFS); ok && name == "hello.txt" {
+			// the valid data length of it is 6 in the exfat image, the rest is read as zeros
+			want = append([]byte("hello "), make([]byte, len(want)-6)...)
+		}
+		r, err := fs.open(e)
+		if err != nil {
+			t.Errorf("failed to open %s: %+v", name, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("wrong content of %s: %v", name, err)
+		}
+	}
+	children, _, err := img.list(prefix + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(children))
+	for _, c := range children {
+		names = append(names, c.name)
+	}
+	for _, name := range []string{"empty", "hello.txt", "sub"} {
+		if !strings.Contains(strings.Join(names, "/")+"/", name+"/") {
+			t.Errorf("%s not found in the root: %v", name, names)
+		}
+	}
+}
+
+func TestFileSystems(t *testing.T) {
+	for _, name := range []string{"fat12.img", "exfat.img", "ext4.img", "test.sqfs"} {
+		t.Run(name, func(t *testing.T) {
+			img := loadImage(t, name)
+			if len(img.volumes) != 1 || img.volumes[0].name != "" {
+				t.Fatalf("wrong volumes: %+v", img.volumes)
+			}
+			checkFiles(t, img, "")
+		})
+	}
+}
+
+func TestDisks(t *testing.T) {
+	// the disk has the partitions of fat12, ext4 and exfat
+	for _, name := range []string{"mbr.img", "dynamic.vhd", "sparse.vmdk", "stream.vmdk"} {
+		t.Run(name, func(t *testing.T) {
+			img := loadImage(t, name)
+			if len(img.volumes) != 3 {
+				t.Fatalf("wrong volumes: %+v", img.volumes)
+			}
+			for _, v := range img.volumes {
+				checkFiles(t, img, "/"+v.name)
+			}
+		})
+	}
+}
+
+func TestDecompressAll(t *testing.T) {
+	for _, name := range []string{"fat12.img", "exfat.img", "ext4.img", "test.sqfs"} {
+		img := loadImage(t, name)
+		fs, root, err := img.getObj("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err = decompressAll(fs, root, dir); err != nil {
+			t.Fatalf("failed to decompress %s: %+v", name, err)
+		}
+		for file, want := range testFiles {
+			got, err := os.ReadFile(filepath.Join(dir, file))
+			if err != nil || len(got) != len(want) {
+				t.Errorf("wrong content of %s in %s: %v", file, name, err)
+			}
+		}
+		if fi, err := os.Stat(filepath.Join(dir, "empty")); err != nil || !fi.IsDir() {
+			t.Errorf("empty dir not found in %s: %v", name, err)
+		}
+	}
+}
+
+// loopFS has a dir containing its parent
+type loopFS struct{}
+
+func (loopFS) root() (*entry, error) {
+	return &entry{isDir: true, ref: fatRef{cluster: 2}}, nil
+}
+
+func (loopFS) readDir(dir *entry) ([]*entry, error) {
+	if dir.ref.(fatRef).cluster == 2 {
+		return []*entry{{name: "a", isDir: true, ref: fatRef{cluster: 3}}}, nil
+	}
+	return []*entry{{name: "loop", isDir: true, ref: fatRef{cluster: 2}}}, nil
+}
+
+func (loopFS) open(file *entry) (io.Reader, error) {
+	return bytes.NewReader(nil), nil
+}
+
+func TestDecompressLoop(t *testing.T) {
+	root, _ := loopFS{}.root()
+	err := decompressAll(loopFS{}, root, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Errorf("the loop is not detected: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package fsimage
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	cacheBlockSize = 64 * 1024
+	cacheBlocks    = 64
+)
+
+// cachedReaderAt caches the recently read blocks, since the metadata of the filesystems
+// is read by lots of small reads, which are range requests of the remote storages.
+// the large reads of the file contents are not cached
+type cachedReaderAt struct {
+	r    io.ReaderAt
+	size int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func newCachedReaderAt(r io.ReaderAt, size int64) *cachedReaderAt {
+	return &cachedReaderAt{r: r, size: size, blocks: make(map[int64][]byte)}
+}
+
+func (c *cachedReaderAt) block(idx int64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.blocks[idx]; ok {
+		return b, nil
+	}
+	off := idx * cacheBlockSize
+	b := make([]byte, min(cacheBlockSize, c.size-off))
+	n, err := c.r.ReadAt(b, off)
+	if n < len(b) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if len(c.order) >= cacheBlocks {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.blocks[idx] = b
+	c.order = append(c.order, idx)
+	return b, nil
+}
+
+func (c *cachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	var err error
+	if end := off + int64(len(p)); end > c.size {
+		p = p[:c.size-off]
+		err = io.EOF
+	}
+	if len(p) >= 2*cacheBlockSize {
+		n, e := c.r.ReadAt(p, off)
+		if e != nil {
+			return n, e
+		}
+		return n, err
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		b, e := c.block(pos / cacheBlockSize)
+		if e != nil {
+			return n, e
+		}
+		n += copy(p[n:], b[pos%cacheBlockSize:])
+	}
+	return n, err
+}
+
+// readFull reads exactly len(p) bytes at the offset
+func readFull(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func readAt(r io.ReaderAt, size int, off int64) ([]byte, error) {
+	b := make([]byte, size)
+	if err := readFull(r, b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// run is a contiguous part of a file, Offset is -1 for the holes which are read as zeros
+type run struct {
+	Offset int64
+	Length int64
+}
+
+// appendRun merges the run to the last one if they are contiguous
+func appendRun(runs []run, r run) []run {
+	if r.Length <= 0 {
+		return runs
+	}
+	if n := len(runs); n > 0 {
+		last := &runs[n-1]
+		if (last.Offset < 0 && r.Offset < 0) || (last.Offset >= 0 && last.Offset+last.Length == r.Offset) {
+			last.Length += r.Length
+			return runs
+		}
+	}
+	return append(runs, r)
+}
+
+// truncateRuns keeps the first size bytes of the runs, and fills the rest with zeros if the runs are shorter
+func truncateRuns(runs []run, size int64) []run {
+	var ret []run
+	for _, r := range runs {
+		if size <= 0 {
+			break
+		}
+		r.Length = min(r.Length, size)
+		ret = append(ret, r)
+		size -= r.Length
+	}
+	return appendRun(ret, run{Offset: -1, Length: size})
+}
+
+// runsReader reads the runs of a file sequentially
+type runsReader struct {
+	r    io.ReaderAt
+	runs []run
+	pos  int64
+}
+
+func (rr *runsReader) Read(p []byte) (int, error) {
+	for len(rr.runs) > 0 && rr.pos >= rr.runs[0].Length {
+		rr.runs = rr.runs[1:]
+		rr.pos = 0
+	}
+	if len(rr.runs) == 0 {
+		return 0, io.EOF
+	}
+	cur := rr.runs[0]
+	if left := cur.Length - rr.pos; int64(len(p)) > left {
+		p = p[:left]
+	}
+	if cur.Offset < 0 {
+		clear(p)
+		rr.pos += int64(len(p))
+		return len(p), nil
+	}
+	n, err := rr.r.ReadAt(p, cur.Offset+rr.pos)
+	rr.pos += int64(n)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
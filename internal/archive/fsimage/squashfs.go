@@ -0,0 +1,445 @@
+package fsimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	squashfsMetaSize     = 8192
+	squashfsNoFragment   = 0xFFFFFFFF
+	squashfsUncompressed = 1 << 24
+
+	squashfsDir     = 1
+	squashfsFile    = 2
+	squashfsExtDir  = 8
+	squashfsExtFile = 9
+)
+
+// squashFS is the SquashFS 4.0 filesystem
+type squashFS struct {
+	r          io.ReaderAt
+	blockSize  int64
+	compressor uint16
+	rootInode  uint64
+	inodeTable int64
+	dirTable   int64
+	fragTable  int64
+	fragCount  uint32
+
+	mu   sync.Mutex
+	meta map[int64]squashfsMetaBlock
+}
+
+type squashfsMetaBlock struct {
+	data []byte
+	// the position of the next block
+	next int64
+}
+
+type squashfsInode struct {
+	typ   uint16
+	mtime time.Time
+	// the directory
+	dirBlock  int64
+	dirOffset int64
+	dirSize   int64
+	// the file
+	size        int64
+	blocksStart int64
+	blockSizes  []uint32
+	fragIndex   uint32
+	fragOffset  int64
+}
+
+type squashfsRef struct {
+	// the reference of the inode, the block and the offset in it
+	ref   uint64
+	inode *squashfsInode
+}
+
+func openSquashFS(r io.ReaderAt, size int64) (fileSystem, error) {
+	if size < 96 {
+		return nil, nil
+	}
+	sb, err := readAt(r, 96, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sb[:4], []byte("hsqs")) {
+		return nil, nil
+	}
+	le := binary.LittleEndian
+	if major := le.Uint16(sb[28:]); major != 4 {
+		return nil, fmt.Errorf("squashfs %d is not supported", major)
+	}
+	fs := &squashFS{
+		r:          r,
+		blockSize:  int64(le.Uint32(sb[12:])),
+		fragCount:  le.Uint32(sb[16:]),
+		compressor: le.Uint16(sb[20:]),
+		rootInode:  le.Uint64(sb[32:]),
+		inodeTable: int64(le.Uint64(sb[64:])),
+		dirTable:   int64(le.Uint64(sb[72:])),
+		fragTable:  int64(le.Uint64(sb[80:])),
+		meta:       make(map[int64]squashfsMetaBlock),
+	}
+	if fs.blockSize < 4096 || fs.blockSize > 1<<20 {
+		return nil, errors.New("invalid squashfs superblock")
+	}
+	return fs, nil
+}
+
+func (fs *squashFS) decompress(data []byte, size int64) ([]byte, error) {
+	switch fs.compressor {
+	case 1:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, size))
+	case 2:
+		lr, err := lzma.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(lr, size))
+	case 4:
+		xr, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(xr, size))
+	case 5:
+		out := make([]byte, size)
+		n, err := lz4.UncompressBlock(data, out)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case 6:
+		zr, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return zr.DecodeAll(data, make([]byte, 0, size))
+	case 3:
+		return nil, errors.New("squashfs with lzo compression is not supported")
+	default:
+		return nil, fmt.Errorf("unknown squashfs compressor %d", fs.compressor)
+	}
+}
+
+// metaBlock reads the metadata block at the position
+func (fs *squashFS) metaBlock(pos int64) (squashfsMetaBlock, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if b, ok := fs.meta[pos]; ok {
+		return b, nil
+	}
+	header, err := readAt(fs.r, 2, pos)
+	if err != nil {
+		return squashfsMetaBlock{}, err
+	}
+	h := binary.LittleEndian.Uint16(header)
+	size := int64(h & 0x7FFF)
+	if size == 0 || size > squashfsMetaSize {
+		return squashfsMetaBlock{}, errors.New("invalid squashfs metadata block")
+	}
+	data, err := readAt(fs.r, int(size), pos+2)
+	if err != nil {
+		return squashfsMetaBlock{}, err
+	}
+	if h&0x8000 == 0 {
+		if data, err = fs.decompress(data, squashfsMetaSize); err != nil {
+			return squashfsMetaBlock{}, err
+		}
+	}
+	b := squashfsMetaBlock{data: data, next: pos + 2 + size}
+	if len(fs.meta) >= 1024 {
+		clear(fs.meta)
+	}
+	fs.meta[pos] = b
+	return b, nil
+}
+
+// metaReader reads the metadata across the blocks
+type metaReader struct {
+	fs     *squashFS
+	block  squashfsMetaBlock
+	offset int
+}
+
+func (fs *squashFS) newMetaReader(pos, offset int64) (*metaReader, error) {
+	b, err := fs.metaBlock(pos)
+	if err != nil {
+		return nil, err
+	}
+	if offset > int64(len(b.data)) {
+		return nil, errors.New("invalid squashfs metadata offset")
+	}
+	return &metaReader{fs: fs, block: b, offset: int(offset)}, nil
+}
+
+func (m *metaReader) Read(p []byte) (int, error) {
+	if m.offset >= len(m.block.data) {
+		b, err := m.fs.metaBlock(m.block.next)
+		if err != nil {
+			return 0, err
+		}
+		m.block, m.offset = b, 0
+	}
+	n := copy(p, m.block.data[m.offset:])
+	m.offset += n
+	return n, nil
+}
+
+func (fs *squashFS) readInode(ref uint64) (*squashfsInode, error) {
+	m, err := fs.newMetaReader(fs.inodeTable+int64(ref>>16), int64(ref&0xFFFF))
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	header := make([]byte, 16)
+	if _, err = io.ReadFull(m, header); err != nil {
+		return nil, err
+	}
+	in := &squashfsInode{
+		typ:   le.Uint16(header[0:]),
+		mtime: time.Unix(int64(le.Uint32(header[8:])), 0),
+	}
+	var b []byte
+	read := func(n int) error {
+		b = make([]byte, n)
+		_, err := io.ReadFull(m, b)
+		return err
+	}
+	switch in.typ {
+	case squashfsDir:
+		if err = read(16); err != nil {
+			return nil, err
+		}
+		in.dirBlock = int64(le.Uint32(b[0:]))
+		in.dirSize = int64(le.Uint16(b[8:]))
+		in.dirOffset = int64(le.Uint16(b[10:]))
+	case squashfsExtDir:
+		if err = read(24); err != nil {
+			return nil, err
+		}
+		in.dirSize = int64(le.Uint32(b[4:]))
+		in.dirBlock = int64(le.Uint32(b[8:]))
+		in.dirOffset = int64(le.Uint16(b[18:]))
+	case squashfsFile:
+		if err = read(16); err != nil {
+			return nil, err
+		}
+		in.blocksStart = int64(le.Uint32(b[0:]))
+		in.fragIndex = le.Uint32(b[4:])
+		in.fragOffset = int64(le.Uint32(b[8:]))
+		in.size = int64(le.Uint32(b[12:]))
+	case squashfsExtFile:
+		if err = read(40); err != nil {
+			return nil, err
+		}
+		in.blocksStart = int64(le.Uint64(b[0:]))
+		in.size = int64(le.Uint64(b[8:]))
+		in.fragIndex = le.Uint32(b[28:])
+		in.fragOffset = int64(le.Uint32(b[32:]))
+	default:
+		return in, nil
+	}
+	if in.typ == squashfsFile || in.typ == squashfsExtFile {
+		count := in.size / fs.blockSize
+		if in.fragIndex == squashfsNoFragment && in.size%fs.blockSize != 0 {
+			count++
+		}
+		if count > 1<<24 {
+			return nil, errors.New("invalid squashfs file inode")
+		}
+		if err = read(int(count * 4)); err != nil {
+			return nil, err
+		}
+		in.blockSizes = make([]uint32, count)
+		for i := range in.blockSizes {
+			in.blockSizes[i] = le.Uint32(b[i*4:])
+		}
+	}
+	return in, nil
+}
+
+func (fs *squashFS) root() (*entry, error) {
+	in, err := fs.readInode(fs.rootInode)
+	if err != nil {
+		return nil, err
+	}
+	if in.typ != squashfsDir && in.typ != squashfsExtDir {
+		return nil, errors.New("invalid squashfs root inode")
+	}
+	return &entry{isDir: true, modTime: in.mtime, ref: squashfsRef{ref: fs.rootInode, inode: in}}, nil
+}
+
+func (fs *squashFS) readDir(dir *entry) ([]*entry, error) {
+	in := dir.ref.(squashfsRef).inode
+	// the size includes the 3 bytes of the implicit . and .. entries
+	size := in.dirSize - 3
+	if size <= 0 {
+		return nil, nil
+	}
+	m, err := fs.newMetaReader(fs.dirTable+in.dirBlock, in.dirOffset)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(m, data); err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	var ret []*entry
+	for pos := 0; pos+12 <= len(data); {
+		count := int(le.Uint32(data[pos:])) + 1
+		start := uint64(le.Uint32(data[pos+4:]))
+		pos += 12
+		for i := 0; i < count && pos+8 <= len(data); i++ {
+			offset := uint64(le.Uint16(data[pos:]))
+			typ := le.Uint16(data[pos+4:])
+			nameSize := int(le.Uint16(data[pos+6:])) + 1
+			if pos+8+nameSize > len(data) {
+				return nil, errors.New("invalid squashfs directory")
+			}
+			name := string(data[pos+8 : pos+8+nameSize])
+			pos += 8 + nameSize
+			// the special files are skipped, including the symbolic links
+			if typ != squashfsDir && typ != squashfsFile {
+				continue
+			}
+			ref := start<<16 | offset
+			child, err := fs.readInode(ref)
+			if err != nil {
+				return nil, err
+			}
+			e := &entry{name: name, modTime: child.mtime, ref: squashfsRef{ref: ref, inode: child}}
+			if child.typ == squashfsDir || child.typ == squashfsExtDir {
+				e.isDir = true
+			} else {
+				e.size = child.size
+			}
+			ret = append(ret, e)
+		}
+	}
+	return ret, nil
+}
+
+func (fs *squashFS) open(file *entry) (io.Reader, error) {
+	in := file.ref.(squashfsRef).inode
+	return &squashfsFileReader{fs: fs, inode: in, pos: in.blocksStart}, nil
+}
+
+// fragment reads the fragment block and returns the tail of the file in it
+func (fs *squashFS) fragment(in *squashfsInode) ([]byte, error) {
+	if in.fragIndex >= fs.fragCount {
+		return nil, errors.New("invalid squashfs fragment index")
+	}
+	// the fragment table is indexed by the locations of the metadata blocks
+	ptr, err := readAt(fs.r, 8, fs.fragTable+int64(in.fragIndex/512)*8)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fs.newMetaReader(int64(binary.LittleEndian.Uint64(ptr)), int64(in.fragIndex%512)*16)
+	if err != nil {
+		return nil, err
+	}
+	e := make([]byte, 16)
+	if _, err = io.ReadFull(m, e); err != nil {
+		return nil, err
+	}
+	data, err := fs.dataBlock(int64(binary.LittleEndian.Uint64(e[0:])), binary.LittleEndian.Uint32(e[8:]))
+	if err != nil {
+		return nil, err
+	}
+	tail := in.size % fs.blockSize
+	if in.fragOffset+tail > int64(len(data)) {
+		return nil, errors.New("invalid squashfs fragment")
+	}
+	return data[in.fragOffset : in.fragOffset+tail], nil
+}
+
+func (fs *squashFS) dataBlock(pos int64, sizeField uint32) ([]byte, error) {
+	size := int64(sizeField &^ squashfsUncompressed)
+	if size > fs.blockSize {
+		return nil, errors.New("invalid squashfs data block")
+	}
+	data, err := readAt(fs.r, int(size), pos)
+	if err != nil {
+		return nil, err
+	}
+	if sizeField&squashfsUncompressed != 0 {
+		return data, nil
+	}
+	return fs.decompress(data, fs.blockSize)
+}
+
+// squashfsFileReader reads the data blocks one by one, and the fragment at last
+type squashfsFileReader struct {
+	fs    *squashFS
+	inode *squashfsInode
+	// the position of the next data block
+	pos    int64
+	index  int
+	buf    []byte
+	read   int64
+	tailed bool
+}
+
+func (r *squashfsFileReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		in := r.inode
+		if r.read >= in.size {
+			return 0, io.EOF
+		}
+		switch {
+		case r.index < len(in.blockSizes):
+			sizeField := in.blockSizes[r.index]
+			want := min(r.fs.blockSize, in.size-r.read)
+			if sizeField == 0 {
+				// sparse block
+				r.buf = make([]byte, want)
+			} else {
+				data, err := r.fs.dataBlock(r.pos, sizeField)
+				if err != nil {
+					return 0, err
+				}
+				r.pos += int64(sizeField &^ squashfsUncompressed)
+				if int64(len(data)) < want {
+					return 0, io.ErrUnexpectedEOF
+				}
+				r.buf = data[:want]
+			}
+			r.index++
+		case !r.tailed && in.fragIndex != squashfsNoFragment:
+			data, err := r.fs.fragment(in)
+			if err != nil {
+				return 0, err
+			}
+			r.buf, r.tailed = data, true
+		default:
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.read += int64(len(r.buf))
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,265 @@
+package fsimage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+type entry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	// the filesystem specific reference to read the entry
+	ref any
+}
+
+// fileSystem is a read-only filesystem in the image
+type fileSystem interface {
+	root() (*entry, error)
+	readDir(dir *entry) ([]*entry, error)
+	open(file *entry) (io.Reader, error)
+}
+
+type volume struct {
+	name string
+	fs   fileSystem
+}
+
+// image is the filesystems in the disk image, the volumes are shown as the top folders if there are more than one
+type image struct {
+	volumes []volume
+}
+
+// detectors detects the filesystem at the beginning of the reader, nil is returned if it's not the filesystem
+var detectors = []func(r io.ReaderAt, size int64) (fileSystem, error){
+	openSquashFS,
+	openExt,
+	openExFAT,
+	openFAT,
+}
+
+func detectFS(r io.ReaderAt, size int64) (fileSystem, error) {
+	for _, detect := range detectors {
+		fs, err := detect(r, size)
+		if err != nil {
+			return nil, err
+		}
+		if fs != nil {
+			return fs, nil
+		}
+	}
+	return nil, nil
+}
+
+func getImage(ss *stream.SeekableStream) (*image, error) {
+	reader, err := stream.NewReadAtSeeker(ss, 0)
+	if err != nil {
+		return nil, err
+	}
+	return openImage(reader, ss.GetSize())
+}
+
+func openImage(reader io.ReaderAt, size int64) (*image, error) {
+	disk, size, err := openDisk(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	r := newCachedReaderAt(disk, size)
+	fs, err := detectFS(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if fs != nil {
+		return &image{volumes: []volume{{fs: fs}}}, nil
+	}
+	parts, err := readPartitions(r, size)
+	if err != nil {
+		return nil, err
+	}
+	img := &image{}
+	for i, p := range parts {
+		fs, err := detectFS(io.NewSectionReader(r, p.offset, p.size), p.size)
+		if err != nil || fs == nil {
+			continue
+		}
+		img.volumes = append(img.volumes, volume{name: fmt.Sprintf("partition%d", i+1), fs: fs})
+	}
+	if len(img.volumes) == 0 {
+		return nil, errs.UnknownArchiveFormat
+	}
+	if len(img.volumes) == 1 {
+		img.volumes[0].name = ""
+	}
+	return img, nil
+}
+
+func findChild(fs fileSystem, dir *entry, name string) (*entry, error) {
+	if !dir.isDir {
+		return nil, errs.ObjectNotFound
+	}
+	children, err := fs.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if child.name == name {
+			return child, nil
+		}
+	}
+	return nil, errs.ObjectNotFound
+}
+
+// getObj returns the entry of the path and its filesystem, the filesystem is nil for the root of the volumes
+func (img *image) getObj(path string) (fileSystem, *entry, error) {
+	var names []string
+	if p := strings.Trim(path, "/"); p != "" {
+		names = strings.Split(p, "/")
+	}
+	v := img.volumes[0]
+	if v.name != "" {
+		if len(names) == 0 {
+			return nil, &entry{isDir: true}, nil
+		}
+		found := false
+		for _, vol := range img.volumes {
+			if vol.name == names[0] {
+				v, found = vol, true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, errs.ObjectNotFound
+		}
+		names = names[1:]
+	}
+	obj, err := v.fs.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		if obj, err = findChild(v.fs, obj, name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if obj.name == "" && v.name != "" {
+		obj.name = v.name
+	}
+	return v.fs, obj, nil
+}
+
+func (img *image) list(path string) ([]*entry, fileSystem, error) {
+	fs, dir, err := img.getObj(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dir.isDir {
+		return nil, nil, errs.NotFolder
+	}
+	if fs == nil {
+		ret := make([]*entry, 0, len(img.volumes))
+		for _, v := range img.volumes {
+			ret = append(ret, &entry{name: v.name, isDir: true, ref: v.fs})
+		}
+		return ret, nil, nil
+	}
+	children, err := fs.readDir(dir)
+	return children, fs, err
+}
+
+func toModelObj(e *entry) model.Obj {
+	return &model.Object{
+		Name:     e.name,
+		Size:     e.size,
+		Modified: e.modTime,
+		IsFolder: e.isDir,
+	}
+}
+
+func decompress(fs fileSystem, e *entry, path string, up model.UpdateProgress) error {
+	destPath := filepath.Join(path, e.name)
+	if !strings.HasPrefix(destPath, path+string(os.PathSeparator)) {
+		return fmt.Errorf("illegal file path: %s", e.name)
+	}
+	r, err := fs.open(e)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = utils.CopyWithBuffer(file, &stream.ReaderUpdatingProgress{
+		Reader: &stream.SimpleReaderWithSize{
+			Reader: r,
+			Size:   e.size,
+		},
+		UpdateProgress: up,
+	})
+	return err
+}
+
+// the max depth of the dirs decompressed, the crafted images may have deeper or looped dirs
+const maxDirDepth = 256
+
+// dirID returns the identity of the dir in the filesystem, which is the inode or the first cluster
+func dirID(e *entry) any {
+	switch ref := e.ref.(type) {
+	case extRef:
+		return ref.ino
+	case squashfsRef:
+		return ref.ref
+	case fatRef:
+		return ref.cluster
+	case exfatRef:
+		return ref.cluster
+	}
+	return e.ref
+}
+
+func decompressAll(fs fileSystem, dir *entry, path string) error {
+	return decompressDir(fs, dir, path, map[any]bool{dirID(dir): true}, 0)
+}
+
+// decompressDir decompresses the dir recursively, the dirs visited are skipped to break the loops
+func decompressDir(fs fileSystem, dir *entry, path string, visited map[any]bool, depth int) error {
+	if depth >= maxDirDepth {
+		return fmt.Errorf("too deep directory: %s", path)
+	}
+	children, err := fs.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.isDir {
+			id := dirID(child)
+			if visited[id] {
+				return fmt.Errorf("directory loop detected at %s", filepath.Join(path, child.name))
+			}
+			visited[id] = true
+			nextPath := filepath.Join(path, child.name)
+			if !strings.HasPrefix(nextPath, path+string(os.PathSeparator)) {
+				return fmt.Errorf("illegal file path: %s", child.name)
+			}
+			if err = os.MkdirAll(nextPath, 0700); err != nil {
+				return err
+			}
+			if err = decompressDir(fs, child, nextPath, visited, depth+1); err != nil {
+				return err
+			}
+		} else if err = decompress(fs, child, path, func(_ float64) {}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package tool
+
+import (
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+)
+
+// IndexEntry is a file or folder of the archive,
+// Offset is the position of the stored content in the archive, or -1 if it's compressed or unknown
+type IndexEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	IsDir    bool      `json:"is_dir,omitempty"`
+	Offset   int64     `json:"offset"`
+}
+
+// Index is the full listing of an archive which can be persisted
+type Index struct {
+	Comment   string       `json:"comment,omitempty"`
+	Encrypted bool         `json:"encrypted,omitempty"`
+	Entries   []IndexEntry `json:"entries"`
+}
+
+// Indexer is implemented by the tools which can read all the entries of the archive in one pass,
+// it's preferred to GetMeta to get the archive meta
+type Indexer interface {
+	Index(ss []*stream.SeekableStream, args model.ArchiveArgs) (*Index, error)
+}
+
+func cleanEntryPath(p string) string {
+	return strings.Trim(stdpath.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+}
+
+// Find returns the entry of the inner path, or nil if not found
+func (idx *Index) Find(innerPath string) *IndexEntry {
+	p := cleanEntryPath(innerPath)
+	for i := len(idx.Entries) - 1; i >= 0; i-- {
+		if cleanEntryPath(idx.Entries[i].Path) == p {
+			return &idx.Entries[i]
+		}
+	}
+	return nil
+}
+
+// Tree builds the folder structure of the entries, the parent folders not recorded in the archive are added
+func (idx *Index) Tree() []model.ObjTree {
+	root := &model.ObjectTree{}
+	dirs := map[string]*model.ObjectTree{"": root}
+	files := map[string]*model.ObjectTree{}
+	var getDir func(p string, modified time.Time) *model.ObjectTree
+	getDir = func(p string, modified time.Time) *model.ObjectTree {
+		if d, ok := dirs[p]; ok {
+			return d
+		}
+		parentPath, name := stdpath.Split(p)
+		parent := getDir(strings.TrimSuffix(parentPath, "/"), modified)
+		d := &model.ObjectTree{Object: model.Object{Name: name, Modified: modified, IsFolder: true}}
+		d.Children = []model.ObjTree{}
+		parent.Children = append(parent.Children, d)
+		dirs[p] = d
+		return d
+	}
+	for _, e := range idx.Entries {
+		p := cleanEntryPath(e.Path)
+		if p == "" {
+			continue
+		}
+		if e.IsDir {
+			getDir(p, e.Modified).Modified = e.Modified
+			continue
+		}
+		if f, ok := files[p]; ok {
+			// the later one overrides, as how it's extracted
+			f.Size, f.Modified = e.Size, e.Modified
+			continue
+		}
+		parentPath, name := stdpath.Split(p)
+		parent := getDir(strings.TrimSuffix(parentPath, "/"), e.Modified)
+		f := &model.ObjectTree{Object: model.Object{Name: name, Size: e.Size, Modified: e.Modified}}
+		parent.Children = append(parent.Children, f)
+		files[p] = f
+	}
+	return root.Children
+}
+
+// Meta returns the archive meta with the full tree of the index
+func (idx *Index) Meta() model.ArchiveMeta {
+	return &model.ArchiveMetaInfo{
+		Comment:   idx.Comment,
+		Encrypted: idx.Encrypted,
+		Tree:      idx.Tree(),
+	}
+}
+
+// IndexFromMeta converts the meta got by GetMeta to index without offsets, nil is returned if there is no tree
+func IndexFromMeta(meta model.ArchiveMeta) *Index {
+	if meta == nil || meta.GetTree() == nil {
+		return nil
+	}
+	idx := &Index{Comment: meta.GetComment(), Encrypted: meta.IsEncrypted()}
+	var walk func(dir string, tree []model.ObjTree)
+	walk = func(dir string, tree []model.ObjTree) {
+		for _, t := range tree {
+			p := stdpath.Join(dir, t.GetName())
+			idx.Entries = append(idx.Entries, IndexEntry{
+				Path:     p,
+				Size:     t.GetSize(),
+				Modified: t.ModTime(),
+				IsDir:    t.IsDir(),
+				Offset:   -1,
+			})
+			if t.IsDir() {
+				walk(p, t.GetChildren())
+			}
+		}
+	}
+	walk("", meta.GetTree())
+	return idx
+}
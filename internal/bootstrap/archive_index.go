@@ -0,0 +1,14 @@
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+// the archive indexes not used within the max age are deleted on startup
+const archiveIndexMaxAge = 30 * 24 * time.Hour
+
+func InitArchiveIndex() {
+	go op.CleanArchiveIndex(archiveIndexMaxAge)
+}
@@ -4,12 +4,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/OpenListTeam/OpenList/v4/cmd/flags"
 	"github.com/OpenListTeam/OpenList/v4/drivers/base"
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/tus"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/caarlos0/env/v9"
 	"github.com/shirou/gopsutil/v4/mem"
@@ -134,6 +136,8 @@ func InitConfig() {
 	convertAbsPath(&conf.Conf.Log.Name)
 	convertAbsPath(&conf.Conf.TempDir)
 	convertAbsPath(&conf.Conf.BleveDir)
+	convertAbsPath(&conf.Conf.ArchiveIndexDir)
+	convertAbsPath(&conf.Conf.ThumbnailDir)
 	convertAbsPath(&conf.Conf.DistDir)
 
 	err := os.MkdirAll(conf.Conf.TempDir, 0o777)
@@ -173,13 +177,35 @@ func initURL() {
 	conf.URL = u
 }
 
-func CleanTempDir() {
-	files, err := os.ReadDir(conf.Conf.TempDir)
+// CleanTempDir removes the files in the temp dir except the unfinished resumable uploads and the paths to keep,
+// e.g. the partially downloaded files of the unfinished offline downloads
+func CleanTempDir(keep ...string) {
+	// unfinished resumable uploads are kept, they are expired by the tus package
+	keep = append(keep, filepath.Join(conf.Conf.TempDir, tus.TempDirName))
+	for i := range keep {
+		keep[i] = filepath.Clean(keep[i])
+	}
+	cleanDir(filepath.Clean(conf.Conf.TempDir), keep)
+}
+
+// cleanDir removes the files in the dir except the paths to keep and their parent dirs
+func cleanDir(dir string, keep []string) {
+	files, err := os.ReadDir(dir)
 	if err != nil {
 		log.Errorln("failed list temp file: ", err)
 	}
 	for _, file := range files {
-		if err := os.RemoveAll(filepath.Join(conf.Conf.TempDir, file.Name())); err != nil {
+		path := filepath.Join(dir, file.Name())
+		if slices.Contains(keep, path) {
+			continue
+		}
+		if file.IsDir() && slices.ContainsFunc(keep, func(k string) bool {
+			return strings.HasPrefix(k, path+string(filepath.Separator))
+		}) {
+			cleanDir(path, keep)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
 			log.Errorln("failed delete temp file: ", err)
 		}
 	}
@@ -0,0 +1,44 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/tus"
+)
+
+func TestCleanTempDir(t *testing.T) {
+	conf.Conf = &conf.Config{TempDir: t.TempDir()}
+	for _, name := range []string{
+		"file-1",
+		"SimpleHttp/finished/a.bin",
+		"SimpleHttp/unfinished/b.bin",
+		"BitTorrent/unfinished/dir/c.bin",
+		tus.TempDirName + "/upload.bin",
+	} {
+		path := filepath.Join(conf.Conf.TempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	CleanTempDir(
+		filepath.Join(conf.Conf.TempDir, "SimpleHttp/unfinished"),
+		filepath.Join(conf.Conf.TempDir, "BitTorrent/unfinished/"),
+	)
+	for name, kept := range map[string]bool{
+		"file-1":                          false,
+		"SimpleHttp/finished":             false,
+		"SimpleHttp/unfinished/b.bin":     true,
+		"BitTorrent/unfinished/dir/c.bin": true,
+		tus.TempDirName + "/upload.bin":   true,
+	} {
+		if _, err := os.Stat(filepath.Join(conf.Conf.TempDir, name)); (err == nil) != kept {
+			t.Errorf("%s is kept: %v, want %v", name, err == nil, kept)
+		}
+	}
+}
@@ -155,6 +155,21 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.ReadMeAutoRender, Value: "true", Type: conf.TypeBool, Group: model.PREVIEW},
 		{Key: conf.FilterReadMeScripts, Value: "true", Type: conf.TypeBool, Group: model.PREVIEW},
 		{Key: conf.NonEFSZipEncoding, Value: "IBM437", Type: conf.TypeString, Group: model.PREVIEW},
+		{Key: conf.ThumbnailEnabled, Value: "false", Type: conf.TypeBool, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `Generate thumbnails for the images and videos of the storages that don't provide them, ffmpeg is required for videos`},
+		{Key: conf.ThumbnailSize, Value: "320", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `max width and height of the thumbnails in pixels`},
+		{Key: conf.ThumbnailFormat, Value: "jpeg", Type: conf.TypeSelect, Options: "jpeg,webp", Group: model.PREVIEW, Flag: model.PRIVATE, Help: `webp requires ffmpeg built with libwebp`},
+		{Key: conf.ThumbnailQuality, Value: "80", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE},
+		{Key: conf.ThumbnailMaxImageSize, Value: "20", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `images larger than this size in MB are skipped`},
+		{Key: conf.ThumbnailVideoHeadSize, Value: "16", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `size in MB read from the beginning of the videos without a direct url`},
+		{Key: conf.MediaMetadataEnabled, Value: "false", Type: conf.TypeBool, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `Return the exif of the images, the tags and the duration of the audios and the container info of the videos in fs/get`},
+		{Key: conf.MediaMetadataGPS, Value: "false", Type: conf.TypeBool, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `Return the gps coordinates in the exif of the images in fs/get, and index them if the media metadata is indexed`},
+		{Key: conf.SubtitleEncoding, Value: "", Type: conf.TypeString, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `encoding of the subtitles which are neither utf-8 nor utf-16 when they are converted to webvtt, such as GB18030, Big5 or Shift_JIS`},
+		{Key: conf.ThumbnailCacheStorage, Value: "", Type: conf.TypeString, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `the path to store the generated thumbnails, they are stored in the thumbnail_dir of the config if empty`},
+		{Key: conf.HLSEnabled, Value: "false", Type: conf.TypeBool, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `Serve the videos as hls at /hls, the videos are remuxed if the codecs are supported by the browsers or transcoded otherwise, ffmpeg is run from the ffmpeg_path of the config`},
+		{Key: conf.HLSSegmentDuration, Value: "6", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `duration of the hls segments in seconds`},
+		{Key: conf.HLSMaxConcurrency, Value: "2", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `max count of the videos processed by ffmpeg at the same time`},
+		{Key: conf.HLSTranscodeHeight, Value: "1080", Type: conf.TypeNumber, Group: model.PREVIEW, Flag: model.PRIVATE, Help: `the transcoded videos higher than this are scaled down, 0 to keep the height`},
+		{Key: conf.HLSTranscodePreset, Value: "veryfast", Type: conf.TypeSelect, Options: "ultrafast,superfast,veryfast,faster,fast,medium", Group: model.PREVIEW, Flag: model.PRIVATE, Help: `preset of libx264, the faster ones use less cpu but produce larger segments`},
 		// global settings
 		{Key: conf.HideFiles, Value: "/\\/README.md/i", Type: conf.TypeText, Group: model.GLOBAL},
 		{Key: "package_download", Value: "true", Type: conf.TypeBool, Group: model.GLOBAL},
@@ -180,6 +195,7 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.HandleHookAfterWriting, Value: "false", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE},
 		{Key: conf.HandleHookRateLimit, Value: "0", Type: conf.TypeNumber, Group: model.GLOBAL, Flag: model.PRIVATE},
 		{Key: conf.IgnoreSystemFiles, Value: "false", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `When enabled, ignores common system files during upload (.DS_Store, desktop.ini, Thumbs.db, and files starting with ._)`},
+		{Key: conf.TusUploadExpiration, Value: "24", Type: conf.TypeNumber, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `Hours after which unfinished resumable uploads are removed`},
 
 		// single settings
 		{Key: conf.Token, Value: token, Type: conf.TypeString, Group: model.SINGLE, Flag: model.PRIVATE},
@@ -187,6 +203,7 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.AutoUpdateIndex, Value: "false", Type: conf.TypeBool, Group: model.INDEX},
 		{Key: conf.IgnorePaths, Value: "", Type: conf.TypeText, Group: model.INDEX, Flag: model.PRIVATE, Help: `one path per line`},
 		{Key: conf.MaxIndexDepth, Value: "20", Type: conf.TypeNumber, Group: model.INDEX, Flag: model.PRIVATE, Help: `max depth of index`},
+		{Key: conf.IndexMediaMetadata, Value: "false", Type: conf.TypeBool, Group: model.INDEX, Flag: model.PRIVATE, Help: `index the media metadata to be searched, it's slow since the files are read while building the index`},
 		{Key: conf.IndexProgress, Value: "{}", Type: conf.TypeText, Group: model.SINGLE, Flag: model.PRIVATE},
 
 		// SSO settings
@@ -238,6 +255,7 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.TaskCopyThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.Copy.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.TaskDecompressDownloadThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.Decompress.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.TaskDecompressUploadThreadsNum, Value: strconv.Itoa(conf.Conf.Tasks.DecompressUpload.Workers), Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
+		{Key: conf.TaskTransferVerify, Value: "false", Type: conf.TypeBool, Group: model.TRAFFIC, Flag: model.PRIVATE, Help: `Verify the size and hash of copied and moved files, hashes missing in the source are computed while streaming, which disables multi-threaded uploads from seekable sources`},
 		{Key: conf.StreamMaxClientDownloadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxClientUploadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxServerDownloadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
@@ -0,0 +1,7 @@
+package bootstrap
+
+import "github.com/OpenListTeam/OpenList/v4/internal/job"
+
+func InitJob() {
+	job.Init()
+}
@@ -0,0 +1,30 @@
+package v4_1_10
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// EncryptConfidentialAddition encrypts the clear text confidential fields of the storages with the master secret
+func EncryptConfidentialAddition() {
+	storages, _, err := db.GetStorages(1, -1)
+	if err != nil {
+		utils.Log.Errorf("[encrypt confidential addition] failed get storages: %v", err)
+		return
+	}
+	for i := range storages {
+		s := &storages[i]
+		addition := s.Addition
+		if err = op.EncryptStorageAddition(s); err != nil {
+			utils.Log.Errorf("[encrypt confidential addition] failed encrypt storage %s: %v", s.MountPath, err)
+			continue
+		}
+		if s.Addition == addition {
+			continue
+		}
+		if err = db.UpdateStorage(s); err != nil {
+			utils.Log.Errorf("[encrypt confidential addition] failed update storage %s: %v", s.MountPath, err)
+		}
+	}
+}
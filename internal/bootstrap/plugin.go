@@ -0,0 +1,9 @@
+package bootstrap
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/plugin"
+)
+
+func InitPlugins() {
+	plugin.Init()
+}
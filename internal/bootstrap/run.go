@@ -15,6 +15,8 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/db"
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/hls"
+	"github.com/OpenListTeam/OpenList/v4/internal/plugin"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server"
 	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
@@ -36,10 +38,14 @@ func Init() {
 	data.InitData()
 	InitStreamLimit()
 	InitIndex()
+	InitArchiveIndex()
+	InitThumbnail()
 	InitUpgradePatch()
 }
 
 func Release() {
+	plugin.Release()
+	hls.Release()
 	db.Close()
 }
 
@@ -90,8 +96,12 @@ func Start() {
 		time.Sleep(time.Duration(conf.Conf.DelayedStart) * time.Second)
 	}
 	InitOfflineDownloadTools()
+	InitPlugins()
 	LoadStorages()
 	InitTaskManager()
+	InitTusUpload()
+	InitJob()
+	InitFeed()
 	if !flags.Debug && !flags.Dev {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -0,0 +1,14 @@
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/thumbnail"
+)
+
+// the local thumbnails not used within the max age are deleted on startup
+const thumbnailMaxAge = 30 * 24 * time.Hour
+
+func InitThumbnail() {
+	go thumbnail.Clean(thumbnailMaxAge)
+}
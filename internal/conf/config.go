@@ -106,17 +106,33 @@ type SFTP struct {
 	Listen string `json:"listen" env:"LISTEN"`
 }
 
+type Plugin struct {
+	Name string `json:"name"`
+	// Path of the executable launched by OpenList, the plugin is restarted if it crashes
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	// Address of a plugin running on its own, e.g. 127.0.0.1:5300 or unix:///run/plugin.sock, used if Path is empty
+	Address  string `json:"address"`
+	Token    string `json:"token"`
+	Disabled bool   `json:"disabled"`
+}
+
 type Config struct {
 	Force                 bool        `json:"force" env:"FORCE"`
 	SiteURL               string      `json:"site_url" env:"SITE_URL"`
 	Cdn                   string      `json:"cdn" env:"CDN"`
 	JwtSecret             string      `json:"jwt_secret" env:"JWT_SECRET"`
+	MasterSecret          string      `json:"master_secret" env:"MASTER_SECRET"`
 	TokenExpiresIn        int         `json:"token_expires_in" env:"TOKEN_EXPIRES_IN"`
 	Database              Database    `json:"database" envPrefix:"DB_"`
 	Meilisearch           Meilisearch `json:"meilisearch" envPrefix:"MEILISEARCH_"`
 	Scheme                Scheme      `json:"scheme"`
 	TempDir               string      `json:"temp_dir" env:"TEMP_DIR"`
 	BleveDir              string      `json:"bleve_dir" env:"BLEVE_DIR"`
+	ArchiveIndexDir       string      `json:"archive_index_dir" env:"ARCHIVE_INDEX_DIR"`
+	ThumbnailDir          string      `json:"thumbnail_dir" env:"THUMBNAIL_DIR"`
+	FFmpegPath            string      `json:"ffmpeg_path" env:"FFMPEG_PATH"`
 	DistDir               string      `json:"dist_dir"`
 	Log                   LogConfig   `json:"log" envPrefix:"LOG_"`
 	DelayedStart          int         `json:"delayed_start" env:"DELAYED_START"`
@@ -132,11 +148,14 @@ type Config struct {
 	SFTP                  SFTP        `json:"sftp" envPrefix:"SFTP_"`
 	LastLaunchedVersion   string      `json:"last_launched_version"`
 	ProxyAddress          string      `json:"proxy_address" env:"PROXY_ADDRESS"`
+	Plugins               []Plugin    `json:"plugins"`
 }
 
 func DefaultConfig(dataDir string) *Config {
 	tempDir := filepath.Join(dataDir, "temp")
 	indexDir := filepath.Join(dataDir, "bleve")
+	archiveIndexDir := filepath.Join(dataDir, "archive_index")
+	thumbnailDir := filepath.Join(dataDir, "thumbnail")
 	logPath := filepath.Join(dataDir, "log/log.log")
 	dbPath := filepath.Join(dataDir, "data.db")
 	return &Config{
@@ -150,6 +169,7 @@ func DefaultConfig(dataDir string) *Config {
 			KeyFile:    "",
 		},
 		JwtSecret:      random.String(16),
+		MasterSecret:   random.String(32),
 		TokenExpiresIn: 48,
 		TempDir:        tempDir,
 		Database: Database{
@@ -162,7 +182,10 @@ func DefaultConfig(dataDir string) *Config {
 			Host:  "http://localhost:7700",
 			Index: "openlist",
 		},
-		BleveDir: indexDir,
+		BleveDir:        indexDir,
+		ArchiveIndexDir: archiveIndexDir,
+		ThumbnailDir:    thumbnailDir,
+		FFmpegPath:      "ffmpeg",
 		Log: LogConfig{
 			Enable:     true,
 			Name:       logPath,
@@ -245,6 +268,7 @@ func DefaultConfig(dataDir string) *Config {
 			Listen: ":5222",
 		},
 		LastLaunchedVersion: "",
+		Plugins:             []Plugin{},
 		ProxyAddress:        "",
 	}
 }
@@ -39,6 +39,21 @@ const (
 	ReadMeAutoRender              = "readme_autorender"
 	FilterReadMeScripts           = "filter_readme_scripts"
 	NonEFSZipEncoding             = "non_efs_zip_encoding"
+	ThumbnailEnabled              = "thumbnail_enabled"
+	ThumbnailSize                 = "thumbnail_size"
+	ThumbnailFormat               = "thumbnail_format"
+	ThumbnailQuality              = "thumbnail_quality"
+	ThumbnailMaxImageSize         = "thumbnail_max_image_size"
+	ThumbnailVideoHeadSize        = "thumbnail_video_head_size"
+	ThumbnailCacheStorage         = "thumbnail_cache_storage"
+	MediaMetadataEnabled          = "media_metadata_enabled"
+	MediaMetadataGPS              = "media_metadata_gps"
+	SubtitleEncoding              = "subtitle_encoding"
+	HLSEnabled                    = "hls_enabled"
+	HLSSegmentDuration            = "hls_segment_duration"
+	HLSMaxConcurrency             = "hls_max_concurrency"
+	HLSTranscodeHeight            = "hls_transcode_height"
+	HLSTranscodePreset            = "hls_transcode_preset"
 
 	// global
 	HideFiles               = "hide_files"
@@ -59,21 +74,36 @@ const (
 	HandleHookAfterWriting  = "handle_hook_after_writing"
 	HandleHookRateLimit     = "handle_hook_rate_limit"
 	IgnoreSystemFiles       = "ignore_system_files"
+	TusUploadExpiration     = "tus_upload_expiration"
 
 	// index
-	SearchIndex     = "search_index"
-	AutoUpdateIndex = "auto_update_index"
-	IgnorePaths     = "ignore_paths"
-	MaxIndexDepth   = "max_index_depth"
+	SearchIndex        = "search_index"
+	AutoUpdateIndex    = "auto_update_index"
+	IgnorePaths        = "ignore_paths"
+	MaxIndexDepth      = "max_index_depth"
+	IndexMediaMetadata = "index_media_metadata"
 
 	// aria2
 	Aria2Uri    = "aria2_uri"
 	Aria2Secret = "aria2_secret"
 
+	// simple http
+	SimpleHttpConcurrency = "simple_http_concurrency"
+
+	// remote
+	RemoteCredentials = "remote_credentials"
+
 	// transmission
 	TransmissionUri      = "transmission_uri"
 	TransmissionSeedtime = "transmission_seedtime"
 
+	// bittorrent
+	BitTorrentListenPort = "bittorrent_listen_port"
+	BitTorrentDHT        = "bittorrent_dht"
+	BitTorrentMaxPeers   = "bittorrent_max_peers"
+	BitTorrentSeedRatio  = "bittorrent_seed_ratio"
+	BitTorrentSeedtime   = "bittorrent_seedtime"
+
 	// 115
 	Pan115TempDir = "115_temp_dir"
 
@@ -157,6 +187,7 @@ const (
 	TaskMoveThreadsNum                    = "move_task_threads_num"
 	TaskDecompressDownloadThreadsNum      = "decompress_download_task_threads_num"
 	TaskDecompressUploadThreadsNum        = "decompress_upload_task_threads_num"
+	TaskTransferVerify                    = "transfer_task_verify"
 	StreamMaxClientDownloadSpeed          = "max_client_download_speed"
 	StreamMaxClientUploadSpeed            = "max_client_upload_speed"
 	StreamMaxServerDownloadSpeed          = "max_server_download_speed"
@@ -191,4 +222,5 @@ const (
 	PathKey
 	SharingIDKey
 	SkipHookKey
+	TaskTrackerKey
 )
@@ -12,7 +12,7 @@ var db *gorm.DB
 
 func Init(d *gorm.DB) {
 	db = d
-	err := AutoMigrate(new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey), new(model.SharingDB))
+	err := AutoMigrate(new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey), new(model.SharingDB), new(model.SharingAccess), new(model.Job), new(model.JobRun), new(model.DedupEntry), new(model.DedupBlob), new(model.Feed), new(model.FeedItem))
 	if err != nil {
 		log.Fatalf("failed migrate database: %s", err.Error())
 	}
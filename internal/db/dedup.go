@@ -0,0 +1,307 @@
+package db
+
+import (
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// whereDedupInDir matches the descendants of the dir
+func whereDedupInDir(tx *gorm.DB, storageID uint, dir string) *gorm.DB {
+	tx = tx.Where("storage_id = ?", storageID)
+	if dir == "/" {
+		return tx
+	}
+	return tx.Where(fmt.Sprintf("(%s = ? OR %s LIKE ? ESCAPE '!')", columnName("parent"), columnName("parent")),
+		dir, escapeLike(dir)+"/%")
+}
+
+// escapeLike escapes the wildcards of LIKE with '!', which needs no quoting in all the databases unlike the backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func getDedupEntry(tx *gorm.DB, storageID uint, path string) (*model.DedupEntry, error) {
+	parent, name := stdpath.Split(path)
+	var e model.DedupEntry
+	err := tx.Where(fmt.Sprintf("storage_id = ? AND %s = ? AND %s = ?", columnName("parent"), columnName("name")),
+		storageID, stdpath.Clean(parent), name).First(&e).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithStack(errs.ObjectNotFound)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &e, nil
+}
+
+func GetDedupEntry(storageID uint, path string) (*model.DedupEntry, error) {
+	return getDedupEntry(db, storageID, path)
+}
+
+func GetDedupEntries(storageID uint, parent string) ([]model.DedupEntry, error) {
+	var entries []model.DedupEntry
+	err := db.Where(fmt.Sprintf("storage_id = ? AND %s = ?", columnName("parent")), storageID, parent).Find(&entries).Error
+	return entries, errors.WithStack(err)
+}
+
+func CreateDedupDir(e *model.DedupEntry) error {
+	return errors.WithStack(db.Transaction(func(tx *gorm.DB) error {
+		if _, err := getDedupEntry(tx, e.StorageID, stdpath.Join(e.Parent, e.Name)); err == nil {
+			return errs.ObjectAlreadyExists
+		}
+		e.IsDir = true
+		return tx.Create(e).Error
+	}))
+}
+
+func GetDedupBlob(storageID uint, hash string) (*model.DedupBlob, error) {
+	var b model.DedupBlob
+	if err := db.Where("storage_id = ? AND hash = ?", storageID, hash).First(&b).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &b, nil
+}
+
+// refDedupBlob adds delta to the reference count of the blob, the blob is created if not exists,
+// it returns the blob if it's no longer referenced
+func refDedupBlob(tx *gorm.DB, storageID uint, hash string, size, delta int64) (*model.DedupBlob, error) {
+	var b model.DedupBlob
+	err := tx.Where("storage_id = ? AND hash = ?", storageID, hash).First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if delta <= 0 {
+			return nil, nil
+		}
+		b = model.DedupBlob{StorageID: storageID, Hash: hash, Size: size, RefCount: delta}
+		return nil, tx.Create(&b).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.RefCount += delta
+	if err = tx.Model(&b).Update("ref_count", gorm.Expr("ref_count + ?", delta)).Error; err != nil {
+		return nil, err
+	}
+	if b.RefCount <= 0 {
+		return &b, nil
+	}
+	return nil, nil
+}
+
+// RefDedupBlob references the blob, which is created if not exists,
+// it returns true if the blob wasn't referenced, so its data may not be stored
+func RefDedupBlob(storageID uint, hash string, size int64) (bool, error) {
+	var unreferenced bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var b model.DedupBlob
+		err := tx.Where("storage_id = ? AND hash = ?", storageID, hash).First(&b).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			unreferenced = true
+			return tx.Create(&model.DedupBlob{StorageID: storageID, Hash: hash, Size: size, RefCount: 1}).Error
+		}
+		if err != nil {
+			return err
+		}
+		unreferenced = b.RefCount <= 0
+		return tx.Model(&b).Update("ref_count", gorm.Expr("ref_count + ?", 1)).Error
+	})
+	return unreferenced, errors.WithStack(err)
+}
+
+// UnrefDedupBlob drops a reference of the blob, it returns the blob if it's no longer referenced
+func UnrefDedupBlob(storageID uint, hash string) (*model.DedupBlob, error) {
+	var unref *model.DedupBlob
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		unref, err = refDedupBlob(tx, storageID, hash, 0, -1)
+		return err
+	})
+	return unref, errors.WithStack(err)
+}
+
+// PutDedupFile creates the file entry or replaces the existing one, the blob of the file must be
+// referenced by RefDedupBlob before, it returns the blob of the replaced file if it's no longer referenced
+func PutDedupFile(e *model.DedupEntry) (*model.DedupBlob, error) {
+	var unref *model.DedupBlob
+	err := db.Transaction(func(tx *gorm.DB) error {
+		old, err := getDedupEntry(tx, e.StorageID, stdpath.Join(e.Parent, e.Name))
+		if err != nil && !errors.Is(err, errs.ObjectNotFound) {
+			return err
+		}
+		if old == nil {
+			return tx.Create(e).Error
+		}
+		if old.IsDir {
+			return errs.ObjectAlreadyExists
+		}
+		if unref, err = refDedupBlob(tx, old.StorageID, old.Hash, old.Size, -1); err != nil {
+			return err
+		}
+		e.ID = old.ID
+		e.Created = old.Created
+		return tx.Save(e).Error
+	})
+	return unref, errors.WithStack(err)
+}
+
+// RemoveDedupEntry removes the entry and its descendants,
+// it returns the blobs no longer referenced
+func RemoveDedupEntry(storageID uint, path string) ([]model.DedupBlob, error) {
+	var unref []model.DedupBlob
+	err := db.Transaction(func(tx *gorm.DB) error {
+		e, err := getDedupEntry(tx, storageID, path)
+		if err != nil {
+			return err
+		}
+		entries := []model.DedupEntry{*e}
+		if e.IsDir {
+			var children []model.DedupEntry
+			if err = whereDedupInDir(tx, storageID, path).Find(&children).Error; err != nil {
+				return err
+			}
+			entries = append(entries, children...)
+		}
+		ids := make([]uint, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+			if entry.IsDir {
+				continue
+			}
+			b, err := refDedupBlob(tx, storageID, entry.Hash, entry.Size, -1)
+			if err != nil {
+				return err
+			}
+			if b != nil {
+				unref = append(unref, *b)
+			}
+		}
+		return tx.Delete(&model.DedupEntry{}, ids).Error
+	})
+	return unref, errors.WithStack(err)
+}
+
+// MoveDedupEntry moves the entry with its descendants to dstParent and renames it to dstName
+func MoveDedupEntry(storageID uint, srcPath, dstParent, dstName string) error {
+	return errors.WithStack(db.Transaction(func(tx *gorm.DB) error {
+		e, err := getDedupEntry(tx, storageID, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := stdpath.Join(dstParent, dstName)
+		if _, err = getDedupEntry(tx, storageID, dstPath); err == nil {
+			return errs.ObjectAlreadyExists
+		}
+		if e.IsDir {
+			if dstPath == srcPath || strings.HasPrefix(dstPath, srcPath+"/") {
+				return errors.New("can't move a folder into itself")
+			}
+			var children []model.DedupEntry
+			if err = whereDedupInDir(tx, storageID, srcPath).Find(&children).Error; err != nil {
+				return err
+			}
+			for _, child := range children {
+				parent := dstPath + strings.TrimPrefix(child.Parent, srcPath)
+				if err = tx.Model(&child).Update("parent", parent).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Model(e).Updates(map[string]any{"parent": dstParent, "name": dstName}).Error
+	}))
+}
+
+// CopyDedupEntry copies the entry with its descendants to dstParent, only the references of the blobs are added
+func CopyDedupEntry(storageID uint, srcPath, dstParent string) error {
+	return errors.WithStack(db.Transaction(func(tx *gorm.DB) error {
+		e, err := getDedupEntry(tx, storageID, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := stdpath.Join(dstParent, e.Name)
+		if _, err = getDedupEntry(tx, storageID, dstPath); err == nil {
+			return errs.ObjectAlreadyExists
+		}
+		entries := []model.DedupEntry{*e}
+		entries[0].Parent = dstParent
+		if e.IsDir {
+			if dstParent == srcPath || strings.HasPrefix(dstParent, srcPath+"/") {
+				return errors.New("can't copy a folder into itself")
+			}
+			var children []model.DedupEntry
+			if err = whereDedupInDir(tx, storageID, srcPath).Find(&children).Error; err != nil {
+				return err
+			}
+			for _, child := range children {
+				child.Parent = dstPath + strings.TrimPrefix(child.Parent, srcPath)
+				entries = append(entries, child)
+			}
+		}
+		for i := range entries {
+			entries[i].ID = 0
+			if entries[i].IsDir {
+				continue
+			}
+			if _, err = refDedupBlob(tx, storageID, entries[i].Hash, entries[i].Size, 1); err != nil {
+				return err
+			}
+		}
+		return tx.CreateInBatches(&entries, 1000).Error
+	}))
+}
+
+func GetUnreferencedDedupBlobs(storageID uint) ([]model.DedupBlob, error) {
+	var blobs []model.DedupBlob
+	err := db.Where("storage_id = ? AND ref_count <= 0", storageID).Find(&blobs).Error
+	return blobs, errors.WithStack(err)
+}
+
+func GetDedupBlobHashes(storageID uint) ([]string, error) {
+	var hashes []string
+	err := db.Model(&model.DedupBlob{}).Where("storage_id = ?", storageID).Pluck("hash", &hashes).Error
+	return hashes, errors.WithStack(err)
+}
+
+// DeleteDedupBlob deletes the blob only if it's still not referenced,
+// it returns false if it's referenced again meanwhile
+func DeleteDedupBlob(id uint) (bool, error) {
+	res := db.Where("ref_count <= 0").Delete(&model.DedupBlob{}, id)
+	return res.RowsAffected > 0, errors.WithStack(res.Error)
+}
+
+func GetDedupStats(storageID uint) (*model.DedupStats, error) {
+	var stats model.DedupStats
+	err := db.Model(&model.DedupEntry{}).Where("storage_id = ? AND is_dir = ?", storageID, false).
+		Select("COUNT(*) AS files, COALESCE(SUM(size), 0) AS logical_size").Scan(&stats).Error
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = db.Model(&model.DedupEntry{}).Where("storage_id = ? AND is_dir = ?", storageID, true).
+		Count(&stats.Dirs).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var blobs struct {
+		Blobs      int64
+		StoredSize int64
+	}
+	err = db.Model(&model.DedupBlob{}).Where("storage_id = ?", storageID).
+		Select("COUNT(*) AS blobs, COALESCE(SUM(size), 0) AS stored_size").Scan(&blobs).Error
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	stats.Blobs = blobs.Blobs
+	stats.StoredSize = blobs.StoredSize
+	stats.SavedSize = stats.LogicalSize - stats.StoredSize
+	return &stats, nil
+}
+
+func DeleteDedupByStorage(storageID uint) error {
+	if err := db.Where("storage_id = ?", storageID).Delete(&model.DedupEntry{}).Error; err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(db.Where("storage_id = ?", storageID).Delete(&model.DedupBlob{}).Error)
+}
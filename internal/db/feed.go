@@ -0,0 +1,101 @@
+package db
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+)
+
+func GetFeedById(id uint) (*model.Feed, error) {
+	var f model.Feed
+	if err := db.First(&f, id).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get feed")
+	}
+	return &f, nil
+}
+
+func GetFeeds(pageIndex, pageSize int) (feeds []model.Feed, count int64, err error) {
+	feedDB := db.Model(&model.Feed{})
+	if err = feedDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get feeds count")
+	}
+	if err = feedDB.Order(columnName("id")).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&feeds).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find feeds")
+	}
+	return feeds, count, nil
+}
+
+func GetFeedsByCreatorId(creator uint, pageIndex, pageSize int) (feeds []model.Feed, count int64, err error) {
+	feedDB := db.Model(&model.Feed{}).Where(model.Feed{CreatorId: creator})
+	if err = feedDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get feeds count")
+	}
+	if err = feedDB.Order(columnName("id")).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&feeds).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find feeds")
+	}
+	return feeds, count, nil
+}
+
+func GetEnabledFeeds() (feeds []model.Feed, err error) {
+	if err = db.Where("disabled = ?", false).Find(&feeds).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed find enabled feeds")
+	}
+	return feeds, nil
+}
+
+func CreateFeed(f *model.Feed) error {
+	return errors.WithStack(db.Create(f).Error)
+}
+
+func UpdateFeed(f *model.Feed) error {
+	return errors.WithStack(db.Save(f).Error)
+}
+
+// UpdateFeedLastCheck only updates the last check fields, so that it doesn't override the feed updated meanwhile
+func UpdateFeedLastCheck(f *model.Feed) error {
+	return errors.WithStack(db.Model(&model.Feed{ID: f.ID}).Select("last_check_at", "last_error").Updates(f).Error)
+}
+
+func DeleteFeedById(id uint) error {
+	if err := db.Where(model.FeedItem{FeedID: id}).Delete(&model.FeedItem{}).Error; err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(db.Delete(&model.Feed{}, id).Error)
+}
+
+// GetFeedItemByGUID returns nil if the item has not been fetched
+func GetFeedItemByGUID(feedID uint, guid string) (*model.FeedItem, error) {
+	var items []model.FeedItem
+	if err := db.Where(model.FeedItem{FeedID: feedID, GUID: guid}).Limit(1).Find(&items).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get feed item")
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return &items[0], nil
+}
+
+func SaveFeedItem(item *model.FeedItem) error {
+	return errors.WithStack(db.Save(item).Error)
+}
+
+func GetFeedItems(feedID uint, pageIndex, pageSize int) (items []model.FeedItem, count int64, err error) {
+	itemDB := db.Model(&model.FeedItem{}).Where(model.FeedItem{FeedID: feedID})
+	if err = itemDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get feed items count")
+	}
+	if err = itemDB.Order(columnName("id") + " desc").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find feed items")
+	}
+	return items, count, nil
+}
+
+// DeleteOldFeedItems keeps the latest keep items of the feed
+func DeleteOldFeedItems(feedID uint, keep int) error {
+	var ids []uint
+	err := db.Model(&model.FeedItem{}).Where(model.FeedItem{FeedID: feedID}).Order(columnName("id")+" desc").
+		Offset(keep-1).Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(db.Where("feed_id = ? AND id < ?", feedID, ids[0]).Delete(&model.FeedItem{}).Error)
+}
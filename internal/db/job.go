@@ -0,0 +1,91 @@
+package db
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+)
+
+func GetJobById(id uint) (*model.Job, error) {
+	var j model.Job
+	if err := db.First(&j, id).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get job")
+	}
+	return &j, nil
+}
+
+func GetJobs(pageIndex, pageSize int) (jobs []model.Job, count int64, err error) {
+	jobDB := db.Model(&model.Job{})
+	if err = jobDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get jobs count")
+	}
+	if err = jobDB.Order(columnName("id")).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find jobs")
+	}
+	return jobs, count, nil
+}
+
+func GetEnabledJobs() (jobs []model.Job, err error) {
+	if err = db.Where("disabled = ?", false).Find(&jobs).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed find enabled jobs")
+	}
+	return jobs, nil
+}
+
+func CreateJob(j *model.Job) error {
+	return errors.WithStack(db.Create(j).Error)
+}
+
+func UpdateJob(j *model.Job) error {
+	return errors.WithStack(db.Save(j).Error)
+}
+
+// UpdateJobLastRun only updates the last run fields, so that it doesn't override the job updated meanwhile
+func UpdateJobLastRun(j *model.Job) error {
+	return errors.WithStack(db.Model(&model.Job{ID: j.ID}).Select("last_run_at", "last_state").Updates(j).Error)
+}
+
+func DeleteJobById(id uint) error {
+	if err := db.Where(model.JobRun{JobID: id}).Delete(&model.JobRun{}).Error; err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(db.Delete(&model.Job{}, id).Error)
+}
+
+func CreateJobRun(r *model.JobRun) error {
+	return errors.WithStack(db.Create(r).Error)
+}
+
+func UpdateJobRun(r *model.JobRun) error {
+	return errors.WithStack(db.Save(r).Error)
+}
+
+func GetJobRuns(jobID uint, pageIndex, pageSize int) (runs []model.JobRun, count int64, err error) {
+	runDB := db.Model(&model.JobRun{}).Where(model.JobRun{JobID: jobID})
+	if err = runDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get job runs count")
+	}
+	if err = runDB.Order(columnName("id") + " desc").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find job runs")
+	}
+	return runs, count, nil
+}
+
+// DeleteOldJobRuns keeps the latest keep runs of the job
+func DeleteOldJobRuns(jobID uint, keep int) error {
+	var ids []uint
+	err := db.Model(&model.JobRun{}).Where(model.JobRun{JobID: jobID}).Order(columnName("id")+" desc").
+		Offset(keep-1).Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(db.Where("job_id = ? AND id < ?", jobID, ids[0]).Delete(&model.JobRun{}).Error)
+}
+
+// FinishRunningJobRuns marks the runs interrupted by a restart as failed
+func FinishRunningJobRuns(message string) error {
+	now := time.Now()
+	return errors.WithStack(db.Model(&model.JobRun{}).Where(model.JobRun{State: model.JobRunRunning}).
+		Updates(model.JobRun{State: model.JobRunFailed, Message: message, FinishedAt: &now}).Error)
+}
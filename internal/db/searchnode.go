@@ -59,17 +59,20 @@ func SearchNode(req model.SearchReq, useFullText bool) ([]model.SearchNode, int6
 	if !useFullText || conf.Conf.Database.Type == "sqlite3" {
 		keywordsClause := db.Where("1 = 1")
 		for _, keyword := range strings.Fields(req.Keywords) {
-			keywordsClause = keywordsClause.Where("name LIKE ?", fmt.Sprintf("%%%s%%", keyword))
+			keyword = fmt.Sprintf("%%%s%%", keyword)
+			keywordsClause = keywordsClause.Where("(name LIKE ? OR media LIKE ?)", keyword, keyword)
 		}
 		searchDB = db.Model(&model.SearchNode{}).Where(whereInParent(req.Parent)).Where(keywordsClause)
 	} else {
 		switch conf.Conf.Database.Type {
 		case "mysql":
 			searchDB = db.Model(&model.SearchNode{}).Where(whereInParent(req.Parent)).
-				Where("MATCH (name) AGAINST (? IN BOOLEAN MODE)", "'*"+req.Keywords+"*'")
+				Where(db.Where("MATCH (name) AGAINST (? IN BOOLEAN MODE)", "'*"+req.Keywords+"*'").
+					Or("media LIKE ?", "%"+req.Keywords+"%"))
 		case "postgres":
 			searchDB = db.Model(&model.SearchNode{}).Where(whereInParent(req.Parent)).
-				Where("to_tsvector(name) @@ to_tsquery(?)", strings.Join(strings.Fields(req.Keywords), " & "))
+				Where(db.Where("to_tsvector(name) @@ to_tsquery(?)", strings.Join(strings.Fields(req.Keywords), " & ")).
+					Or("to_tsvector(media) @@ to_tsquery(?)", strings.Join(strings.Fields(req.Keywords), " & ")))
 		}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
 	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
 func GetSharingById(id string) (*model.SharingDB, error) {
@@ -70,5 +71,80 @@ func DeleteSharingById(id string) error {
 }
 
 func DeleteSharingsByCreatorId(creatorId uint) error {
+	sids := db.Model(&model.SharingDB{}).Select("id").Where("creator_id = ?", creatorId)
+	if err := db.Where("sharing_id IN (?)", sids).Delete(&model.SharingAccess{}).Error; err != nil {
+		return errors.WithStack(err)
+	}
 	return errors.WithStack(db.Where("creator_id = ?", creatorId).Delete(&model.SharingDB{}).Error)
 }
+
+func CreateSharingAccess(a *model.SharingAccess) error {
+	return errors.WithStack(db.Create(a).Error)
+}
+
+func AddSharingAccessBytes(id uint, bytes int64) error {
+	return errors.WithStack(db.Model(&model.SharingAccess{ID: id}).Update("bytes", gorm.Expr("bytes + ?", bytes)).Error)
+}
+
+func GetSharingAccesses(sid string, pageIndex, pageSize int) (accesses []model.SharingAccess, count int64, err error) {
+	accessDB := db.Model(&model.SharingAccess{}).Where("sharing_id = ?", sid)
+	if err := accessDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get sharing accesses count")
+	}
+	if err := accessDB.Order(columnName("id") + " desc").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Find(&accesses).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed find sharing accesses")
+	}
+	return accesses, count, nil
+}
+
+func CountSharingFileDownloads(sid, path string) (count int64, err error) {
+	err = db.Model(&model.SharingAccess{}).
+		Where("sharing_id = ? AND "+columnName("type")+" = ? AND path = ?", sid, model.SharingAccessDownload, path).
+		Count(&count).Error
+	return count, errors.Wrapf(err, "failed count sharing file downloads")
+}
+
+func GetSharingStats(sid string) (*model.SharingStats, error) {
+	var stats model.SharingStats
+	var counts []struct {
+		Type  string
+		Count int64
+		Bytes int64
+	}
+	if err := db.Model(&model.SharingAccess{}).Select(columnName("type")+", count(*) as count, sum(bytes) as bytes").
+		Where("sharing_id = ?", sid).Group(columnName("type")).Scan(&counts).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get sharing access counts")
+	}
+	for _, c := range counts {
+		switch c.Type {
+		case model.SharingAccessDownload:
+			stats.Downloads = c.Count
+		case model.SharingAccessUpload:
+			stats.Uploads = c.Count
+		default:
+			stats.Views += c.Count
+		}
+		stats.Bytes += c.Bytes
+	}
+	if err := db.Model(&model.SharingAccess{}).Where("sharing_id = ?", sid).
+		Distinct("ip").Count(&stats.UniqueIPs).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get sharing unique ips")
+	}
+	var last model.SharingAccess
+	if err := db.Where("sharing_id = ?", sid).Order(columnName("id") + " desc").Limit(1).Find(&last).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get sharing last access")
+	}
+	if last.ID != 0 {
+		stats.LastAccess = &last.Time
+	}
+	if err := db.Model(&model.SharingAccess{}).Select("path, count(*) as downloads, sum(bytes) as bytes").
+		Where("sharing_id = ? AND "+columnName("type")+" = ?", sid, model.SharingAccessDownload).
+		Group("path").Order("downloads desc").Scan(&stats.Files).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get sharing file stats")
+	}
+	return &stats, nil
+}
+
+func DeleteSharingAccesses(sid string) error {
+	return errors.WithStack(db.Where("sharing_id = ?", sid).Delete(&model.SharingAccess{}).Error)
+}
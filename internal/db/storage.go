@@ -24,7 +24,11 @@ func UpdateStorage(storage *model.Storage) error {
 
 // DeleteStorageById just delete storage from database by id
 func DeleteStorageById(id uint) error {
-	return errors.WithStack(db.Delete(&model.Storage{}, id).Error)
+	if err := db.Delete(&model.Storage{}, id).Error; err != nil {
+		return errors.WithStack(err)
+	}
+	// the index of the dedup storage
+	return DeleteDedupByStorage(id)
 }
 
 // GetStorages Get all storages from database order by index
@@ -11,6 +11,8 @@ type Item struct {
 	Options  string `json:"options"`
 	Required bool   `json:"required"`
 	Help     string `json:"help"`
+	// Confidential items are encrypted in the database and masked in responses
+	Confidential bool `json:"confidential,omitempty"`
 }
 
 type Info struct {
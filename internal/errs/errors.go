@@ -23,9 +23,16 @@ var (
 	WrongArchivePassword      = errors.New("wrong archive password")
 	DriverExtractNotSupported = errors.New("driver extraction not supported")
 
-	WrongShareCode  = errors.New("wrong share code")
-	InvalidSharing  = errors.New("invalid sharing")
-	SharingNotFound = errors.New("sharing not found")
+	WrongShareCode   = errors.New("wrong share code")
+	InvalidSharing   = errors.New("invalid sharing")
+	SharingNotFound  = errors.New("sharing not found")
+	SharingNeedLogin = errors.New("login is required to access the sharing")
+	SharingAuthLimit = errors.New("too many wrong share code attempts, try again later")
+
+	SharingUploadNotAllowed    = errors.New("upload to this sharing is not allowed")
+	SharingUploadLimitExceeded = errors.New("sharing upload limit exceeded")
+	SharingUploadRejected      = errors.New("the file can't be uploaded to this sharing")
+	SharingDownloadLimited     = errors.New("the file has reached its download limit")
 )
 
 // NewErr wrap constant error with an extra message
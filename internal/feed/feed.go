@@ -0,0 +1,264 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultInterval = 30
+	// the number of items kept in the history of each feed, the older ones may be downloaded again if they are still in the feed
+	historySize = 1000
+	// the max size of a feed
+	maxFeedSize = 16 << 20
+)
+
+// how often the feeds are checked whether they are due
+var tickInterval = time.Minute
+
+var (
+	mu sync.Mutex
+	// the feeds being checked
+	checking = map[uint]bool{}
+)
+
+// Init polls the enabled feeds in background
+func Init() {
+	go func() {
+		for {
+			pollDue()
+			time.Sleep(tickInterval)
+		}
+	}()
+}
+
+func pollDue() {
+	feeds, err := db.GetEnabledFeeds()
+	if err != nil {
+		log.Errorf("failed get feeds: %+v", err)
+		return
+	}
+	now := time.Now()
+	for i := range feeds {
+		f := &feeds[i]
+		if f.LastCheckAt != nil && f.LastCheckAt.Add(time.Duration(f.Interval)*time.Minute).After(now) {
+			continue
+		}
+		go func() {
+			if _, err := Check(context.Background(), f); err != nil && !errors.Is(err, errChecking) {
+				log.Errorf("failed check feed [%s]: %+v", f.Name, err)
+			}
+		}()
+	}
+}
+
+var errChecking = errors.New("feed is being checked")
+
+// Check fetches the feed and enqueues the new items matched, returns the number of the items enqueued
+func Check(ctx context.Context, f *model.Feed) (int, error) {
+	mu.Lock()
+	if checking[f.ID] {
+		mu.Unlock()
+		return 0, errChecking
+	}
+	checking[f.ID] = true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(checking, f.ID)
+		mu.Unlock()
+	}()
+
+	n, err := check(ctx, f)
+	now := time.Now()
+	f.LastCheckAt = &now
+	f.LastError = ""
+	if err != nil {
+		f.LastError = err.Error()
+	}
+	if e := db.UpdateFeedLastCheck(f); e != nil {
+		log.Errorf("failed update feed [%s]: %+v", f.Name, e)
+	}
+	return n, err
+}
+
+func check(ctx context.Context, f *model.Feed) (int, error) {
+	include, exclude, err := compile(f)
+	if err != nil {
+		return 0, err
+	}
+	user, err := op.GetUserById(f.CreatorId)
+	if err != nil {
+		return 0, errors.WithMessage(err, "failed get feed creator")
+	}
+	if user.Disabled || !user.CanAddOfflineDownloadTasks() {
+		return 0, errors.New("permission denied")
+	}
+	dstDir, err := user.JoinPath(f.DstDir)
+	if err != nil {
+		return 0, err
+	}
+	items, err := fetch(ctx, f.URL)
+	if err != nil {
+		return 0, err
+	}
+	ctx = context.WithValue(ctx, conf.UserKey, user)
+	ctx = context.WithValue(ctx, conf.ApiUrlKey, common.GetApiUrlFromRequest(nil))
+	n := 0
+	var errs []string
+	// the oldest items are usually the last ones
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.URL == "" || item.GUID == "" {
+			continue
+		}
+		if (include != nil && !include.MatchString(item.Title)) || (exclude != nil && exclude.MatchString(item.Title)) {
+			continue
+		}
+		fetched, err := db.GetFeedItemByGUID(f.ID, item.GUID)
+		if err != nil {
+			return n, err
+		}
+		if fetched != nil && fetched.Error == "" {
+			continue
+		}
+		if fetched == nil {
+			fetched = &model.FeedItem{FeedID: f.ID, GUID: item.GUID}
+		}
+		fetched.Title, fetched.URL, fetched.Error = item.Title, item.URL, ""
+		t, err := tool.AddURL(ctx, &tool.AddURLArgs{
+			URL:          item.URL,
+			DstDirPath:   dstDir,
+			Tool:         f.Tool,
+			DeletePolicy: tool.DeletePolicy(f.DeletePolicy),
+		})
+		if err != nil {
+			fetched.Error = err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", item.Title, err))
+		} else {
+			n++
+			if t != nil {
+				fetched.TaskID = t.GetID()
+			}
+		}
+		if err = db.SaveFeedItem(fetched); err != nil {
+			return n, err
+		}
+	}
+	if err = db.DeleteOldFeedItems(f.ID, historySize); err != nil {
+		log.Errorf("failed delete old items of feed [%s]: %+v", f.Name, err)
+	}
+	if len(errs) > 0 {
+		return n, errors.Errorf("failed enqueue %d items: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return n, nil
+}
+
+func fetch(ctx context.Context, u string) ([]Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", base.UserAgent)
+	res, err := net.NewHttpClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed fetch feed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed fetch feed, status: %s", res.Status)
+	}
+	return Parse(io.LimitReader(res.Body, maxFeedSize))
+}
+
+func compile(f *model.Feed) (include, exclude *regexp.Regexp, err error) {
+	if f.Include != "" {
+		if include, err = regexp.Compile(f.Include); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid include")
+		}
+	}
+	if f.Exclude != "" {
+		if exclude, err = regexp.Compile(f.Exclude); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid exclude")
+		}
+	}
+	return include, exclude, nil
+}
+
+// Validate checks the url, the filters and the tool of the feed
+func Validate(f *model.Feed) error {
+	u, err := url.Parse(f.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("invalid feed url")
+	}
+	if _, _, err = compile(f); err != nil {
+		return err
+	}
+	if _, err = tool.Tools.Get(f.Tool); err != nil {
+		return err
+	}
+	if f.Interval <= 0 {
+		f.Interval = defaultInterval
+	}
+	return nil
+}
+
+func CreateFeed(f *model.Feed) error {
+	if err := Validate(f); err != nil {
+		return err
+	}
+	return db.CreateFeed(f)
+}
+
+// UpdateFeed updates the definition of the feed, the check state and the creator are kept
+func UpdateFeed(f *model.Feed) error {
+	old, err := db.GetFeedById(f.ID)
+	if err != nil {
+		return err
+	}
+	if err = Validate(f); err != nil {
+		return err
+	}
+	f.CreatorId, f.LastCheckAt, f.LastError = old.CreatorId, old.LastCheckAt, old.LastError
+	return db.UpdateFeed(f)
+}
+
+func GetFeeds(pageIndex, pageSize int) ([]model.Feed, int64, error) {
+	return db.GetFeeds(pageIndex, pageSize)
+}
+
+func GetFeedsByCreatorId(creator uint, pageIndex, pageSize int) ([]model.Feed, int64, error) {
+	return db.GetFeedsByCreatorId(creator, pageIndex, pageSize)
+}
+
+func GetFeedById(id uint) (*model.Feed, error) {
+	return db.GetFeedById(id)
+}
+
+func DeleteFeedById(id uint) error {
+	return db.DeleteFeedById(id)
+}
+
+func GetFeedItems(id uint, pageIndex, pageSize int) ([]model.FeedItem, int64, error) {
+	return db.GetFeedItems(id, pageIndex, pageSize)
+}
@@ -0,0 +1,125 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+)
+
+type Item struct {
+	GUID  string
+	Title string
+	// URL is the url to download, the enclosure is preferred to the magnet uri and the link
+	URL string
+}
+
+type rss struct {
+	Channel struct {
+		Items []struct {
+			Title     string `xml:"title"`
+			Link      string `xml:"link"`
+			GUID      string `xml:"guid"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+			// the torrent namespace used by many trackers
+			MagnetURI string `xml:"magnetURI"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atom struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse parses the items of a RSS 2.0 or Atom feed
+func Parse(r io.Reader) ([]Item, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootName(data)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	switch root {
+	case "rss":
+		var f rss
+		if err = decode(data, &f); err != nil {
+			return nil, err
+		}
+		for _, i := range f.Channel.Items {
+			items = append(items, newItem(i.GUID, i.Title, i.Enclosure.URL, i.MagnetURI, i.Link))
+		}
+	case "feed":
+		var f atom
+		if err = decode(data, &f); err != nil {
+			return nil, err
+		}
+		for _, e := range f.Entries {
+			var enclosure, link string
+			for _, l := range e.Links {
+				switch l.Rel {
+				case "enclosure":
+					enclosure = l.Href
+				case "", "alternate":
+					link = l.Href
+				}
+			}
+			items = append(items, newItem(e.ID, e.Title, enclosure, "", link))
+		}
+	default:
+		return nil, errors.Errorf("unsupported feed format: %s", root)
+	}
+	return items, nil
+}
+
+func newItem(guid, title string, urls ...string) Item {
+	item := Item{GUID: strings.TrimSpace(guid), Title: strings.TrimSpace(title)}
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u != "" {
+			item.URL = u
+			break
+		}
+	}
+	if item.GUID == "" {
+		item.GUID = item.URL
+	}
+	return item
+}
+
+func decoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+	return d
+}
+
+func decode(data []byte, v any) error {
+	return errors.Wrap(decoder(data).Decode(v), "invalid feed")
+}
+
+func rootName(data []byte) (string, error) {
+	d := decoder(data)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "invalid feed")
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want []Item
+	}{
+		{
+			name: "rss",
+			feed: `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+<channel><title>releases</title>
+<item><title> v1.0 </title><link>https://example.com/v1.0</link><guid>g1</guid>
+<enclosure url="https://example.com/v1.0.torrent" type="application/x-bittorrent"/></item>
+<item><title>v0.9</title><link>https://example.com/v0.9</link>
+<torrent:magnetURI>magnet:?xt=urn:btih:abc</torrent:magnetURI></item>
+<item><title>v0.8</title><link>https://example.com/v0.8</link></item>
+</channel></rss>`,
+			want: []Item{
+				{GUID: "g1", Title: "v1.0", URL: "https://example.com/v1.0.torrent"},
+				{GUID: "magnet:?xt=urn:btih:abc", Title: "v0.9", URL: "magnet:?xt=urn:btih:abc"},
+				{GUID: "https://example.com/v0.8", Title: "v0.8", URL: "https://example.com/v0.8"},
+			},
+		},
+		{
+			name: "atom",
+			feed: `<?xml version="1.0" encoding="ISO-8859-1"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>releases</title>
+<entry><title>caf` + "\xe9" + `</title><id>tag:1</id>
+<link href="https://example.com/1"/><link rel="enclosure" href="https://example.com/1.zip"/></entry>
+<entry><title>2</title><id>tag:2</id><link rel="alternate" href="https://example.com/2"/></entry>
+</feed>`,
+			want: []Item{
+				{GUID: "tag:1", Title: "café", URL: "https://example.com/1.zip"},
+				{GUID: "tag:2", Title: "2", URL: "https://example.com/2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.feed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d items, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("item %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+	if _, err := Parse(strings.NewReader(`<html></html>`)); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
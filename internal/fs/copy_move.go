@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	stdpath "path"
+	"sync"
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
 	"github.com/OpenListTeam/OpenList/v4/internal/task_group"
@@ -29,6 +31,8 @@ func (t taskType) String() string {
 		return "move"
 	case merge:
 		return "merge"
+	case synchronize:
+		return "sync"
 	default:
 		return "unknown"
 	}
@@ -38,12 +42,39 @@ const (
 	copy taskType = iota
 	move
 	merge
+	synchronize
 )
 
 type FileTransferTask struct {
 	TaskData
 	TaskType taskType
+	Sync     *SyncArgs `json:"sync,omitempty"` // only for sync tasks
 	groupID  string
+	tracker  *TaskTracker
+}
+
+// TaskTracker collects the transfer task and the tasks launched by it for the objs in the dirs,
+// it's passed in the context by conf.TaskTrackerKey
+type TaskTracker struct {
+	mu    sync.Mutex
+	tasks []task.TaskExtensionInfo
+}
+
+func (tt *TaskTracker) add(t *FileTransferTask) {
+	if tt == nil {
+		return
+	}
+	t.tracker = tt
+	tt.mu.Lock()
+	tt.tasks = append(tt.tasks, t)
+	tt.mu.Unlock()
+}
+
+// Tasks returns the tasks collected so far, the tasks of the objs in a dir are collected before the task of the dir finishes
+func (tt *TaskTracker) Tasks() []task.TaskExtensionInfo {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return append([]task.TaskExtensionInfo(nil), tt.tasks...)
 }
 
 func (t *FileTransferTask) GetName() string {
@@ -68,8 +99,9 @@ func (t *FileTransferTask) Run() error {
 	t.SetStartTime(time.Now())
 	defer func() { t.SetEndTime(time.Now()) }()
 	return t.RunWithNextTaskCallback(func(nextTask *FileTransferTask) error {
-		task_group.TransferCoordinator.AddTask(t.groupID, nil)
-		if t.TaskType == copy || t.TaskType == merge {
+		t.tracker.add(nextTask)
+		task_group.TransferCoordinator.AddTask(nextTask.groupID, nil)
+		if t.TaskType == copy || t.TaskType == merge || t.TaskType == synchronize {
 			CopyTaskManager.Add(nextTask)
 		} else {
 			MoveTaskManager.Add(nextTask)
@@ -167,6 +199,8 @@ func transfer(ctx context.Context, taskType taskType, srcObjPath, dstDirPath str
 
 	t.Creator, _ = ctx.Value(conf.UserKey).(*model.User)
 	t.ApiUrl = common.GetApiUrl(ctx)
+	tracker, _ := ctx.Value(conf.TaskTrackerKey).(*TaskTracker)
+	tracker.add(t)
 	if taskType == copy || taskType == merge {
 		CopyTaskManager.Add(t)
 	} else {
@@ -183,6 +217,10 @@ func (t *FileTransferTask) RunWithNextTaskCallback(f func(nextTask *FileTransfer
 		return errors.WithMessagef(err, "failed get src [%s] file", t.SrcActualPath)
 	}
 
+	if srcObj.IsDir() && t.TaskType == synchronize {
+		return t.runSyncDir(f)
+	}
+
 	if srcObj.IsDir() {
 		t.Status = "src object is dir, listing objs"
 		objs, err := op.List(t.Ctx(), t.SrcStorage, t.SrcActualPath, model.ListArgs{})
@@ -249,18 +287,30 @@ func (t *FileTransferTask) RunWithNextTaskCallback(f func(nextTask *FileTransfer
 	if err != nil {
 		return errors.WithMessagef(err, "failed get [%s] link", t.SrcActualPath)
 	}
-	// any link provided is seekable
-	ss, err := stream.NewSeekableStream(&stream.FileStream{
-		Obj: srcObj,
-		Ctx: t.Ctx(),
-	}, link)
+	var ss *stream.SeekableStream
+	var hasher *utils.MultiHasher
+	verify := setting.GetBool(conf.TaskTransferVerify)
+	if verify {
+		ss, hasher, err = verifyingStream(t.Ctx(), srcObj, link)
+	} else {
+		// any link provided is seekable
+		ss, err = stream.NewSeekableStream(&stream.FileStream{
+			Obj: srcObj,
+			Ctx: t.Ctx(),
+		}, link)
+	}
 	if err != nil {
 		_ = link.Close()
 		return errors.WithMessagef(err, "failed get [%s] stream", t.SrcActualPath)
 	}
 	t.SetTotalBytes(ss.GetSize())
 	t.Status = "uploading"
-	return op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.DstStorage, t.DstActualPath, ss, t.SetProgress)
+	err = op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.DstStorage, t.DstActualPath, ss, t.SetProgress)
+	if err != nil || !verify {
+		return err
+	}
+	t.Status = "verifying"
+	return t.verify(srcObj, hasher)
 }
 
 var (
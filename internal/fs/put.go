@@ -42,11 +42,22 @@ func (t *UploadTask) Run() error {
 	return op.Put(context.WithValue(t.Ctx(), conf.SkipHookKey, struct{}{}), t.storage, t.dstDirActualPath, t.file, t.SetProgress)
 }
 
+// UploadCallback is implemented by the files which are kept until they're uploaded
+type UploadCallback interface {
+	OnUploaded(succeeded bool)
+}
+
 func (t *UploadTask) OnSucceeded() {
+	if cb, ok := t.file.(UploadCallback); ok {
+		cb.OnUploaded(true)
+	}
 	task_group.TransferCoordinator.Done(context.WithoutCancel(t.Ctx()), stdpath.Join(t.storage.GetStorage().MountPath, t.dstDirActualPath), true)
 }
 
 func (t *UploadTask) OnFailed() {
+	if cb, ok := t.file.(UploadCallback); ok {
+		cb.OnUploaded(false)
+	}
 	task_group.TransferCoordinator.Done(context.WithoutCancel(t.Ctx()), stdpath.Join(t.storage.GetStorage().MountPath, t.dstDirActualPath), false)
 }
 
@@ -0,0 +1,353 @@
+package fs
+
+import (
+	"context"
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/internal/task_group"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/pkg/errors"
+)
+
+type SyncMode string
+
+const (
+	// SyncMirror makes the destination identical to the source, extra objs in the destination are removed
+	SyncMirror SyncMode = "mirror"
+	// SyncUpdate copies new files and the files which are newer in the source, nothing is removed
+	SyncUpdate SyncMode = "update"
+	// SyncBidirectional copies the missing objs of each side to the other side, nothing is removed
+	SyncBidirectional SyncMode = "bidirectional"
+)
+
+// SyncConflict decides what to do with a file which differs on both sides
+// and is not simply newer in the source (update mode) or differs at all (bidirectional mode)
+type SyncConflict string
+
+const (
+	SyncConflictNewer       SyncConflict = "newer"
+	SyncConflictSource      SyncConflict = "source"
+	SyncConflictDestination SyncConflict = "destination"
+	SyncConflictSkip        SyncConflict = "skip"
+)
+
+// modification times closer than it are considered the same, some storages only keep 2 seconds precision
+const syncModTimeWindow = 2 * time.Second
+
+type SyncArgs struct {
+	Mode     SyncMode     `json:"mode"`
+	Conflict SyncConflict `json:"conflict"`
+}
+
+func (a *SyncArgs) Validate() error {
+	switch a.Mode {
+	case SyncMirror, SyncUpdate, SyncBidirectional:
+	default:
+		return errors.Errorf("invalid sync mode [%s]", a.Mode)
+	}
+	switch a.Conflict {
+	case "":
+		a.Conflict = SyncConflictNewer
+	case SyncConflictNewer, SyncConflictSource, SyncConflictDestination, SyncConflictSkip:
+	default:
+		return errors.Errorf("invalid sync conflict policy [%s]", a.Conflict)
+	}
+	return nil
+}
+
+const (
+	SyncActionMkdir  = "mkdir"
+	SyncActionCopy   = "copy"
+	SyncActionDelete = "delete"
+	SyncActionSkip   = "skip"
+)
+
+// SyncAction is a planned action of a sync, the paths are mount paths
+type SyncAction struct {
+	Action string `json:"action"`
+	Src    string `json:"src,omitempty"`
+	Dst    string `json:"dst"`
+	IsDir  bool   `json:"is_dir"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+type syncStep struct {
+	action  string
+	obj     model.Obj // the obj on the side it is copied from, or the obj deleted / skipped
+	reverse bool      // copy from the destination to the source
+	reason  string
+}
+
+// syncSame compares the files by size, hash when both sides have a hash of the same type and modification time
+func syncSame(src, dst model.Obj) bool {
+	if src.GetSize() != dst.GetSize() {
+		return false
+	}
+	dstHash := dst.GetHash()
+	for ht, v := range src.GetHash().All() {
+		if dv := dstHash.GetHash(ht); v != "" && dv != "" {
+			return strings.EqualFold(v, dv)
+		}
+	}
+	d := src.ModTime().Sub(dst.ModTime())
+	return d < syncModTimeWindow && d > -syncModTimeWindow
+}
+
+func syncCompareFile(args *SyncArgs, src, dst model.Obj) syncStep {
+	if syncSame(src, dst) {
+		return syncStep{action: SyncActionSkip, obj: src, reason: "same"}
+	}
+	srcNewer := src.ModTime().Sub(dst.ModTime()) >= syncModTimeWindow
+	dstNewer := dst.ModTime().Sub(src.ModTime()) >= syncModTimeWindow
+	switch args.Mode {
+	case SyncMirror:
+		return syncStep{action: SyncActionCopy, obj: src, reason: "changed"}
+	case SyncUpdate:
+		if srcNewer {
+			return syncStep{action: SyncActionCopy, obj: src, reason: "newer"}
+		}
+	}
+	switch args.Conflict {
+	case SyncConflictSource:
+		return syncStep{action: SyncActionCopy, obj: src, reason: "conflict, source wins"}
+	case SyncConflictDestination:
+		if args.Mode == SyncBidirectional {
+			return syncStep{action: SyncActionCopy, obj: dst, reverse: true, reason: "conflict, destination wins"}
+		}
+	case SyncConflictNewer:
+		if srcNewer {
+			return syncStep{action: SyncActionCopy, obj: src, reason: "conflict, source is newer"}
+		}
+		if dstNewer && args.Mode == SyncBidirectional {
+			return syncStep{action: SyncActionCopy, obj: dst, reverse: true, reason: "conflict, destination is newer"}
+		}
+	}
+	return syncStep{action: SyncActionSkip, obj: src, reason: "conflict"}
+}
+
+// syncDiff compares the objs in the src dir and the dst dir, the dirs existing on both sides
+// or on a single side are returned as copy steps and have to be compared recursively
+func syncDiff(ctx context.Context, args *SyncArgs, srcStorage driver.Driver, srcPath string,
+	dstStorage driver.Driver, dstPath string) (steps []syncStep, dstExists bool, err error) {
+	srcObjs, err := op.List(ctx, srcStorage, srcPath, model.ListArgs{})
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "failed list src [%s] objs", srcPath)
+	}
+	dstObjs, err := op.List(ctx, dstStorage, dstPath, model.ListArgs{})
+	if err != nil && !errors.Is(err, errs.ObjectNotFound) {
+		return nil, false, errors.WithMessagef(err, "failed list dst [%s] objs", dstPath)
+	}
+	dstExists = err == nil
+	dstMap := make(map[string]model.Obj, len(dstObjs))
+	for _, obj := range dstObjs {
+		dstMap[obj.GetName()] = obj
+	}
+	for _, srcObj := range srcObjs {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		dstObj, ok := dstMap[srcObj.GetName()]
+		if !ok {
+			steps = append(steps, syncStep{action: SyncActionCopy, obj: srcObj, reason: "new"})
+			continue
+		}
+		delete(dstMap, srcObj.GetName())
+		if srcObj.IsDir() != dstObj.IsDir() {
+			if args.Mode == SyncMirror {
+				steps = append(steps,
+					syncStep{action: SyncActionDelete, obj: dstObj, reason: "type changed"},
+					syncStep{action: SyncActionCopy, obj: srcObj, reason: "type changed"})
+			} else {
+				steps = append(steps, syncStep{action: SyncActionSkip, obj: srcObj, reason: "conflict, type mismatch"})
+			}
+			continue
+		}
+		if srcObj.IsDir() {
+			steps = append(steps, syncStep{action: SyncActionCopy, obj: srcObj})
+			continue
+		}
+		steps = append(steps, syncCompareFile(args, srcObj, dstObj))
+	}
+	for _, dstObj := range dstObjs {
+		if _, ok := dstMap[dstObj.GetName()]; !ok {
+			continue
+		}
+		switch args.Mode {
+		case SyncMirror:
+			steps = append(steps, syncStep{action: SyncActionDelete, obj: dstObj, reason: "not in source"})
+		case SyncBidirectional:
+			steps = append(steps, syncStep{action: SyncActionCopy, obj: dstObj, reverse: true, reason: "new"})
+		}
+	}
+	return steps, dstExists, nil
+}
+
+// SyncPlan returns the actions a sync from srcDirPath to dstDirPath would take without doing anything
+func SyncPlan(ctx context.Context, srcDirPath, dstDirPath string, args SyncArgs) ([]SyncAction, error) {
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	srcStorage, srcActualPath, err := op.GetStorageAndActualPath(srcDirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get src storage")
+	}
+	dstStorage, dstActualPath, err := op.GetStorageAndActualPath(dstDirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get dst storage")
+	}
+	var actions []SyncAction
+	err = syncPlan(ctx, &args, srcStorage, srcActualPath, dstStorage, dstActualPath, &actions)
+	return actions, err
+}
+
+func syncPlan(ctx context.Context, args *SyncArgs, srcStorage driver.Driver, srcPath string,
+	dstStorage driver.Driver, dstPath string, actions *[]SyncAction) error {
+	steps, dstExists, err := syncDiff(ctx, args, srcStorage, srcPath, dstStorage, dstPath)
+	if err != nil {
+		return err
+	}
+	srcMp, dstMp := srcStorage.GetStorage().MountPath, dstStorage.GetStorage().MountPath
+	if !dstExists {
+		*actions = append(*actions, SyncAction{Action: SyncActionMkdir, Dst: stdpath.Join(dstMp, dstPath), IsDir: true})
+	}
+	for _, step := range steps {
+		name := step.obj.GetName()
+		fromStorage, fromPath, toStorage, toPath := srcStorage, srcPath, dstStorage, dstPath
+		fromMp, toMp := srcMp, dstMp
+		if step.reverse {
+			fromStorage, fromPath, toStorage, toPath = dstStorage, dstPath, srcStorage, srcPath
+			fromMp, toMp = dstMp, srcMp
+		}
+		if step.action == SyncActionCopy && step.obj.IsDir() {
+			err = syncPlan(ctx, args, fromStorage, stdpath.Join(fromPath, name), toStorage, stdpath.Join(toPath, name), actions)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		action := SyncAction{
+			Action: step.action,
+			Dst:    stdpath.Join(toMp, toPath, name),
+			IsDir:  step.obj.IsDir(),
+			Size:   step.obj.GetSize(),
+			Reason: step.reason,
+		}
+		if step.action != SyncActionDelete {
+			action.Src = stdpath.Join(fromMp, fromPath, name)
+		}
+		*actions = append(*actions, action)
+	}
+	return nil
+}
+
+// runSyncDir syncs the objs of the src dir to the dst dir, unlike other transfer types
+// the DstActualPath of a dir sync task is the dst dir itself and not its parent
+func (t *FileTransferTask) runSyncDir(f func(nextTask *FileTransferTask) error) error {
+	t.Status = "comparing src and dst objs"
+	steps, dstExists, err := syncDiff(t.Ctx(), t.Sync, t.SrcStorage, t.SrcActualPath, t.DstStorage, t.DstActualPath)
+	if err != nil {
+		return err
+	}
+	if !dstExists {
+		if err = op.MakeDir(t.Ctx(), t.DstStorage, t.DstActualPath); err != nil {
+			return errors.WithMessagef(err, "failed make dst dir [%s]", t.DstActualPath)
+		}
+	}
+	task_group.TransferCoordinator.AppendPayload(t.groupID, task_group.DstPathToHook(t.DstActualPath))
+	for _, step := range steps {
+		if err := t.Ctx().Err(); err != nil {
+			return err
+		}
+		name := step.obj.GetName()
+		switch step.action {
+		case SyncActionDelete:
+			t.Status = "removing " + name
+			if err = op.Remove(t.Ctx(), t.DstStorage, stdpath.Join(t.DstActualPath, name)); err != nil {
+				return errors.WithMessagef(err, "failed remove dst [%s]", stdpath.Join(t.DstActualPath, name))
+			}
+		case SyncActionCopy:
+			next := &FileTransferTask{
+				TaskType: synchronize,
+				TaskData: TaskData{
+					TaskExtension: task.TaskExtension{
+						Creator: t.Creator,
+						ApiUrl:  t.ApiUrl,
+					},
+					SrcStorage:    t.SrcStorage,
+					DstStorage:    t.DstStorage,
+					SrcActualPath: stdpath.Join(t.SrcActualPath, name),
+					DstActualPath: t.DstActualPath,
+					SrcStorageMp:  t.SrcStorageMp,
+					DstStorageMp:  t.DstStorageMp,
+				},
+				Sync:    t.Sync,
+				groupID: t.groupID,
+			}
+			if step.reverse {
+				next.SrcStorage, next.DstStorage = t.DstStorage, t.SrcStorage
+				next.SrcStorageMp, next.DstStorageMp = t.DstStorageMp, t.SrcStorageMp
+				next.SrcActualPath, next.DstActualPath = stdpath.Join(t.DstActualPath, name), t.SrcActualPath
+				next.groupID = stdpath.Join(t.SrcStorageMp, t.SrcActualPath)
+			}
+			if step.obj.IsDir() {
+				next.DstActualPath = stdpath.Join(next.DstActualPath, name)
+			}
+			if err = f(next); err != nil {
+				return err
+			}
+		}
+	}
+	t.Status = "added all sync tasks of objs"
+	return nil
+}
+
+// Sync synchronizes the objs of dstDirPath with srcDirPath according to args
+func Sync(ctx context.Context, srcDirPath, dstDirPath string, args SyncArgs) (task.TaskExtensionInfo, error) {
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	srcStorage, srcActualPath, err := op.GetStorageAndActualPath(srcDirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get src storage")
+	}
+	dstStorage, dstActualPath, err := op.GetStorageAndActualPath(dstDirPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed get dst storage")
+	}
+	srcObj, err := op.Get(ctx, srcStorage, srcActualPath)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed get src [%s]", srcDirPath)
+	}
+	if !srcObj.IsDir() {
+		return nil, errors.WithStack(errs.NotFolder)
+	}
+	t := &FileTransferTask{
+		TaskData: TaskData{
+			SrcStorage:    srcStorage,
+			DstStorage:    dstStorage,
+			SrcActualPath: srcActualPath,
+			DstActualPath: dstActualPath,
+			SrcStorageMp:  srcStorage.GetStorage().MountPath,
+			DstStorageMp:  dstStorage.GetStorage().MountPath,
+		},
+		TaskType: synchronize,
+		Sync:     &args,
+	}
+	t.groupID = stdpath.Join(t.DstStorageMp, t.DstActualPath)
+	task_group.TransferCoordinator.AddTask(t.groupID, nil)
+	t.Creator, _ = ctx.Value(conf.UserKey).(*model.User)
+	t.ApiUrl = common.GetApiUrl(ctx)
+	tracker, _ := ctx.Value(conf.TaskTrackerKey).(*TaskTracker)
+	tracker.add(t)
+	CopyTaskManager.Add(t)
+	return t, nil
+}
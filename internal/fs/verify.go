@@ -0,0 +1,148 @@
+package fs
+
+import (
+	"context"
+	"io"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the hashes computed while streaming when the source obj doesn't have them
+var verifyHashTypes = []*utils.HashType{utils.MD5, utils.SHA1, utils.SHA256}
+
+// verifyingStream returns a stream of the src link which computes the hashes missing in srcObj while being read,
+// the hasher is nil if srcObj has all of them and the stream is the usual seekable one
+func verifyingStream(ctx context.Context, srcObj model.Obj, link *model.Link) (*stream.SeekableStream, *utils.MultiHasher, error) {
+	var missing []*utils.HashType
+	srcHash := srcObj.GetHash()
+	for _, ht := range verifyHashTypes {
+		if srcHash.GetHash(ht) == "" {
+			missing = append(missing, ht)
+		}
+	}
+	if len(missing) == 0 {
+		ss, err := stream.NewSeekableStream(&stream.FileStream{Obj: srcObj, Ctx: ctx}, link)
+		return ss, nil, err
+	}
+	size := link.ContentLength
+	if size <= 0 {
+		size = srcObj.GetSize()
+	}
+	rr, err := stream.GetRangeReaderFromLink(size, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := rr.RangeRead(ctx, http_range.Range{Length: -1})
+	if err != nil {
+		return nil, nil, err
+	}
+	// the stream is read sequentially once, even if the driver caches it
+	hasher := utils.NewMultiHasher(missing)
+	ss, err := stream.NewSeekableStream(&stream.FileStream{
+		Obj:     srcObj,
+		Ctx:     ctx,
+		Reader:  io.TeeReader(rc, hasher),
+		Closers: utils.NewClosers(rc),
+	}, link)
+	if err != nil {
+		_ = rc.Close()
+		return nil, nil, err
+	}
+	return ss, hasher, nil
+}
+
+// errNoCommonHash means the size matches but the dst obj doesn't report any hash of the src
+var errNoCommonHash = errors.New("no common hash")
+
+// verify compares the size and the common hashes of srcObj and the re-fetched dst obj, the dst is read and hashed
+// if it reports no common hash. The dst obj is removed if it doesn't match so that a move never removes the src
+// of a broken copy.
+func (t *FileTransferTask) verify(srcObj model.Obj, hasher *utils.MultiHasher) error {
+	dstPath := stdpath.Join(t.DstActualPath, srcObj.GetName())
+	// the obj is refreshed if only the one assumed by op.Put is cached
+	dstObj, err := op.Get(t.Ctx(), t.DstStorage, dstPath, true)
+	if err != nil {
+		return errors.WithMessagef(err, "verify failed: failed get dst [%s]", dstPath)
+	}
+	srcHashes := make(map[*utils.HashType]string)
+	for ht, v := range srcObj.GetHash().All() {
+		srcHashes[ht] = v
+	}
+	// the computed hashes are only usable if the whole stream has been read
+	if hasher != nil && hasher.Size() == srcObj.GetSize() {
+		for ht, v := range hasher.GetHashInfo().All() {
+			srcHashes[ht] = v
+		}
+	}
+	err = compareObj(srcObj.GetSize(), srcHashes, dstObj)
+	if errors.Is(err, errNoCommonHash) {
+		err = t.verifyContent(dstPath, dstObj, srcHashes)
+	}
+	if err != nil {
+		if e := op.Remove(t.Ctx(), t.DstStorage, dstPath); e != nil {
+			log.Errorf("failed remove unverified dst [%s]: %+v", dstPath, e)
+		}
+		return errors.WithMessagef(err, "verify [%s] failed", dstPath)
+	}
+	return nil
+}
+
+// verifyContent reads the dst obj and compares its hash with the src one
+func (t *FileTransferTask) verifyContent(dstPath string, dstObj model.Obj, srcHashes map[*utils.HashType]string) error {
+	var ht *utils.HashType
+	for _, h := range verifyHashTypes {
+		if srcHashes[h] != "" {
+			ht = h
+			break
+		}
+	}
+	if ht == nil {
+		return errors.New("no hash of the src to verify the dst")
+	}
+	t.Status = "verifying the dst content"
+	link, _, err := op.Link(t.Ctx(), t.DstStorage, dstPath, model.LinkArgs{})
+	if err != nil {
+		return errors.WithMessage(err, "failed get dst link")
+	}
+	defer link.Close()
+	rr, err := stream.GetRangeReaderFromLink(dstObj.GetSize(), link)
+	if err != nil {
+		return err
+	}
+	rc, err := rr.RangeRead(t.Ctx(), http_range.Range{Length: -1})
+	if err != nil {
+		return errors.WithMessage(err, "failed read dst")
+	}
+	defer rc.Close()
+	dv, err := utils.HashReader(ht, rc)
+	if err != nil {
+		return errors.WithMessage(err, "failed read dst")
+	}
+	if sv := srcHashes[ht]; !strings.EqualFold(sv, dv) {
+		return errors.Errorf("%s mismatch, src: %s, dst: %s", ht.Name, sv, dv)
+	}
+	return nil
+}
+
+func compareObj(size int64, srcHashes map[*utils.HashType]string, dstObj model.Obj) error {
+	if dstObj.GetSize() != size {
+		return errors.Errorf("size mismatch, src: %d, dst: %d", size, dstObj.GetSize())
+	}
+	for ht, dv := range dstObj.GetHash().All() {
+		if sv := srcHashes[ht]; sv != "" && dv != "" {
+			if !strings.EqualFold(sv, dv) {
+				return errors.Errorf("%s mismatch, src: %s, dst: %s", ht.Name, sv, dv)
+			}
+			return nil
+		}
+	}
+	return errors.WithStack(errNoCommonHash)
+}
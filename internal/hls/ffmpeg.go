@@ -0,0 +1,129 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/pkg/errors"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// codecs returns the codecs of the output, the streams supported by the browsers in mpeg-ts are copied
+func codecs(m *media.Metadata) (string, string) {
+	vcodec, acodec := "libx264", "aac"
+	if m == nil {
+		return vcodec, acodec
+	}
+	if m.VideoCodec == "h264" {
+		vcodec = "copy"
+	}
+	switch m.AudioCodec {
+	case "aac", "mp3":
+		acodec = "copy"
+	}
+	return vcodec, acodec
+}
+
+// run runs ffmpeg of the job to write the segments from start
+func run(ctx context.Context, j *job, start int) error {
+	opts := j.opts
+	link, obj, err := fs.Link(ctx, j.path, model.LinkArgs{})
+	if err != nil {
+		return err
+	}
+	defer link.Close()
+	url, header, closer, err := source(link, obj)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	inputArgs := ffmpeg.KwArgs{}
+	if len(header) > 0 {
+		var sb strings.Builder
+		for k, vs := range header {
+			for _, v := range vs {
+				sb.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+			}
+		}
+		inputArgs["headers"] = sb.String()
+	}
+	globalArgs := []string{"-loglevel", "error"}
+	if start > 0 {
+		// the timestamps are kept to continue the segments before
+		inputArgs["ss"] = start * opts.segmentDuration
+		globalArgs = append(globalArgs, "-copyts")
+	}
+	vcodec, acodec := codecs(j.metadata)
+	outputArgs := ffmpeg.KwArgs{
+		"map":                  []string{"0:v:0", "0:a:0?"},
+		"c:v":                  vcodec,
+		"c:a":                  acodec,
+		"f":                    "hls",
+		"hls_time":             opts.segmentDuration,
+		"hls_list_size":        0,
+		"hls_playlist_type":    "event",
+		"hls_flags":            "temp_file",
+		"hls_segment_filename": filepath.Join(j.dir, "%d.ts"),
+		"start_number":         start,
+	}
+	if vcodec != "copy" {
+		outputArgs["preset"] = opts.preset
+		outputArgs["pix_fmt"] = "yuv420p"
+		// the key frames at the boundaries make the segments the same duration
+		outputArgs["force_key_frames"] = fmt.Sprintf("expr:gte(t,(n_forced+%d)*%d)", start, opts.segmentDuration)
+		if opts.height > 0 {
+			outputArgs["vf"] = fmt.Sprintf("scale=-2:'trunc(min(%d,ih)/2)*2'", opts.height)
+		}
+	}
+	if acodec != "copy" {
+		outputArgs["ac"] = 2
+		outputArgs["b:a"] = "160k"
+	}
+	var stderr bytes.Buffer
+	err = ffmpeg.OutputContext(ctx, []*ffmpeg.Stream{ffmpeg.Input(url, inputArgs)}, filepath.Join(j.dir, playlistName), outputArgs).
+		GlobalArgs(globalArgs...).SetFfmpegPath(opts.ffmpegPath).Silent(true).
+		WithErrorOutput(&stderr).Run()
+	if err != nil {
+		return errors.Wrapf(err, "ffmpeg: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// source returns the url read by ffmpeg, the links which can't be read by ffmpeg directly
+// are served by a http server listening on the loopback
+func source(link *model.Link, obj model.Obj) (string, http.Header, func(), error) {
+	if strings.HasPrefix(link.URL, "http") && link.RangeReader == nil && link.Concurrency < 1 && link.PartSize < 1 {
+		return link.URL, link.Header, func() {}, nil
+	}
+	size := link.ContentLength
+	if size <= 0 {
+		size = obj.GetSize()
+	}
+	rrf, err := stream.GetRangeReaderFromLink(size, link)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	l, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, nil, errors.WithStack(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = net.ServeHTTP(w, r, obj.GetName(), obj.ModTime(), size, &model.RangeReadCloser{RangeReader: rrf})
+	})}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	return fmt.Sprintf("http://%s/video", l.Addr()), nil, func() {
+		_ = srv.Close()
+	}, nil
+}
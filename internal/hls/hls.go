@@ -0,0 +1,366 @@
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	playlistName = "index.m3u8"
+	// the ffmpeg without requests for this long is killed, the player has stopped most likely
+	idleTimeout = 2 * time.Minute
+	// the segments without requests for this long are removed
+	cacheTimeout = time.Hour
+	// the segments within this count after the encoding one are waited for, instead of restarting ffmpeg at them
+	seekAhead = 3
+)
+
+var ErrBusy = errors.New("too many videos are being processed by ffmpeg")
+
+// the segments are named by their indexes without leading zeros, e.g. 0.ts and 12.ts
+var segmentName = regexp.MustCompile(`^(0|[1-9]\d{0,8})\.ts$`)
+
+type options struct {
+	ffmpegPath      string
+	segmentDuration int
+	height          int
+	preset          string
+}
+
+func getOptions() options {
+	return options{
+		ffmpegPath:      conf.Conf.FFmpegPath,
+		segmentDuration: max(setting.GetInt(conf.HLSSegmentDuration, 6), 1),
+		height:          setting.GetInt(conf.HLSTranscodeHeight, 1080),
+		preset:          setting.GetStr(conf.HLSTranscodePreset, "veryfast"),
+	}
+}
+
+// Enabled reports whether the hls endpoint is enabled
+func Enabled() bool {
+	return setting.GetBool(conf.HLSEnabled)
+}
+
+// Supported reports whether the object can be served as hls
+func Supported(obj model.Obj) bool {
+	return !obj.IsDir() && utils.GetFileType(obj.GetName()) == conf.VIDEO && utils.Ext(obj.GetName()) != "m3u8"
+}
+
+// job generates the playlist and the segments of a video in dir with ffmpeg
+type job struct {
+	dir      string
+	path     string
+	obj      model.Obj
+	opts     options
+	metadata *media.Metadata
+	access   atomic.Int64
+
+	mu  sync.Mutex
+	enc *encoder
+}
+
+// encoder is a running or finished ffmpeg which writes the segments from start
+type encoder struct {
+	start int
+	// next is the first segment not written yet, it's updated by seek
+	next   int
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (e *encoder) finished() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *job) touch() {
+	j.access.Store(time.Now().UnixNano())
+}
+
+func (j *job) idle() time.Duration {
+	return time.Since(time.Unix(0, j.access.Load()))
+}
+
+func (j *job) encoder() *encoder {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc
+}
+
+func (j *job) running() bool {
+	return !j.encoder().finished()
+}
+
+func (j *job) failed() bool {
+	e := j.encoder()
+	return e.finished() && e.err != nil
+}
+
+// seekable reports whether the segments have the same duration, so all of them are listed before
+// they are written, and ffmpeg can start at any of them. The copied video is split at its own key frames
+func (j *job) seekable() bool {
+	vcodec, _ := codecs(j.metadata)
+	return vcodec != "copy" && j.metadata != nil && j.metadata.Duration > 0
+}
+
+func (j *job) segments() int {
+	return segmentCount(j.metadata.Duration, j.opts.segmentDuration)
+}
+
+// written reports whether the segment is complete, ffmpeg writes the segments to temp files and renames them
+func (j *job) written(n int) bool {
+	_, err := os.Stat(filepath.Join(j.dir, strconv.Itoa(n)+".ts"))
+	return err == nil
+}
+
+// encode starts ffmpeg at the segment, the running one is killed, j.mu must be held
+func (j *job) encode(start int) {
+	if j.enc != nil {
+		j.enc.cancel()
+		<-j.enc.done
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &encoder{start: start, next: start, cancel: cancel, done: make(chan struct{})}
+	j.enc = e
+	go func() {
+		defer close(e.done)
+		e.err = run(ctx, j, start)
+		if e.err != nil && ctx.Err() == nil {
+			log.Errorf("failed to generate hls of %s from segment %d: %+v", j.path, start, e.err)
+		}
+	}()
+}
+
+// seek restarts ffmpeg at the segment if it's not written and it's not within seekAhead segments
+// after the encoding one, so a seek near the end doesn't wait for all the segments before
+func (j *job) seek(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e := j.enc
+	for j.written(e.next) {
+		e.next++
+	}
+	if j.written(n) || (!e.finished() && n >= e.start && n <= e.next+seekAhead) {
+		return
+	}
+	log.Debugf("restart ffmpeg of %s at segment %d, the encoding one is %d", j.path, n, e.next)
+	j.encode(n)
+}
+
+func (j *job) stop() {
+	e := j.encoder()
+	e.cancel()
+	<-e.done
+}
+
+// wait waits until ready, or ffmpeg exits
+func (j *job) wait(ctx context.Context, ready func() ([]byte, bool)) ([]byte, error) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		j.touch()
+		if data, ok := ready(); ok {
+			return data, nil
+		}
+		e := j.encoder()
+		select {
+		case <-e.done:
+			if data, ok := ready(); ok {
+				return data, nil
+			}
+			// restarted at another segment
+			if e != j.encoder() {
+				continue
+			}
+			if e.err != nil {
+				return nil, e.err
+			}
+			return nil, errs.ObjectNotFound
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+var (
+	jobsMu      sync.Mutex
+	jobs        = map[string]*job{}
+	janitorOnce sync.Once
+)
+
+func getJob(ctx context.Context, path string, obj model.Obj) (*job, error) {
+	opts := getOptions()
+	key := utils.HashData(utils.SHA1, []byte(fmt.Sprintf("%s\x00%d\x00%d\x00%+v", path, obj.GetSize(), obj.ModTime().UnixNano(), opts)))
+	jobsMu.Lock()
+	j, ok := jobs[key]
+	jobsMu.Unlock()
+	if ok && !j.failed() {
+		j.touch()
+		return j, nil
+	}
+	// read without the lock, it reads the remote file
+	var metadata *media.Metadata
+	if media.Supported(obj) {
+		metadata, _ = media.Get(ctx, path, obj)
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[key]; ok {
+		// the failed one is retried
+		if !j.failed() {
+			j.touch()
+			return j, nil
+		}
+		delete(jobs, key)
+	}
+	running := 0
+	for _, j := range jobs {
+		if j.running() {
+			running++
+		}
+	}
+	if running >= setting.GetInt(conf.HLSMaxConcurrency, 2) {
+		return nil, ErrBusy
+	}
+	dir := filepath.Join(conf.Conf.TempDir, "hls", key)
+	_ = os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	j = &job{dir: dir, path: path, obj: obj, opts: opts, metadata: metadata}
+	j.touch()
+	j.mu.Lock()
+	j.encode(0)
+	j.mu.Unlock()
+	jobs[key] = j
+	janitorOnce.Do(func() {
+		go janitor()
+	})
+	return j, nil
+}
+
+// janitor kills the idle ffmpeg and removes the expired segments
+func janitor() {
+	for range time.Tick(30 * time.Second) {
+		jobsMu.Lock()
+		for key, j := range jobs {
+			running := j.running()
+			if (!running && j.idle() > cacheTimeout) || (running && j.idle() > idleTimeout) {
+				j.stop()
+				_ = os.RemoveAll(j.dir)
+				delete(jobs, key)
+			}
+		}
+		jobsMu.Unlock()
+	}
+}
+
+// Release kills all the running ffmpeg
+func Release() {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for key, j := range jobs {
+		j.stop()
+		_ = os.RemoveAll(j.dir)
+		delete(jobs, key)
+	}
+}
+
+// Playlist returns the playlist of the video, the segments in it are the names to be passed to Segment.
+// All the segments are listed if seekable, otherwise it's an event playlist which grows until ffmpeg finishes
+func Playlist(ctx context.Context, path string, obj model.Obj) ([]byte, error) {
+	j, err := getJob(ctx, path, obj)
+	if err != nil {
+		return nil, err
+	}
+	if j.seekable() {
+		return vodPlaylist(j.metadata.Duration, j.opts.segmentDuration), nil
+	}
+	return j.wait(ctx, func() ([]byte, bool) {
+		// the playlist is renamed from a temp file by ffmpeg, so it's always complete
+		playlist, _ := os.ReadFile(filepath.Join(j.dir, playlistName))
+		return playlist, bytes.Contains(playlist, []byte("#EXTINF"))
+	})
+}
+
+// Segment returns the file of the segment, it waits until the segment is written by ffmpeg
+func Segment(ctx context.Context, path string, obj model.Obj, name string) (string, error) {
+	if !segmentName.MatchString(name) {
+		return "", errors.Errorf("invalid segment name: %s", name)
+	}
+	n, _ := strconv.Atoi(strings.TrimSuffix(name, ".ts"))
+	j, err := getJob(ctx, path, obj)
+	if err != nil {
+		return "", err
+	}
+	if j.seekable() {
+		if n >= j.segments() {
+			return "", errors.WithStack(errs.ObjectNotFound)
+		}
+		j.seek(n)
+	}
+	if _, err = j.wait(ctx, func() ([]byte, bool) {
+		return nil, j.written(n)
+	}); err != nil {
+		return "", err
+	}
+	return filepath.Join(j.dir, name), nil
+}
+
+// segmentCount returns the count of the segments of the duration, the last one may be shorter
+func segmentCount(duration float64, segmentDuration int) int {
+	return int(math.Ceil(duration / float64(segmentDuration)))
+}
+
+// vodPlaylist lists all the segments of the duration, they are written by ffmpeg on demand
+func vodPlaylist(duration float64, segmentDuration int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", segmentDuration)
+	for i := 0; i < segmentCount(duration, segmentDuration); i++ {
+		fmt.Fprintf(&buf, "#EXTINF:%.3f,\n%d.ts\n", min(float64(segmentDuration), duration-float64(i*segmentDuration)), i)
+	}
+	buf.WriteString("#EXT-X-ENDLIST\n")
+	return buf.Bytes()
+}
+
+// RewritePlaylist replaces the names of the segments in the playlist with their urls
+func RewritePlaylist(playlist []byte, segmentURL func(name string) string) []byte {
+	var buf bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(playlist))
+	for s.Scan() {
+		line := s.Text()
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = segmentURL(line)
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
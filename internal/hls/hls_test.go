@@ -0,0 +1,85 @@
+package hls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+func TestRewritePlaylist(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n\n#EXTINF:6.000,\n0.ts\n#EXTINF:2.500,\n1.ts\n#EXT-X-ENDLIST"
+	got := RewritePlaylist([]byte(playlist), func(name string) string {
+		return "/hls/a.mp4?segment=" + name + "&sign=x"
+	})
+	want := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n\n#EXTINF:6.000,\n/hls/a.mp4?segment=0.ts&sign=x\n" +
+		"#EXTINF:2.500,\n/hls/a.mp4?segment=1.ts&sign=x\n#EXT-X-ENDLIST\n"
+	if string(got) != want {
+		t.Errorf("wrong playlist:\n%s", got)
+	}
+}
+
+func TestVODPlaylist(t *testing.T) {
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXTINF:6.000,\n0.ts\n#EXTINF:6.000,\n1.ts\n#EXTINF:2.500,\n2.ts\n#EXT-X-ENDLIST\n"
+	if got := vodPlaylist(14.5, 6); string(got) != want {
+		t.Errorf("wrong playlist:\n%s", got)
+	}
+	if n := segmentCount(12, 6); n != 2 {
+		t.Errorf("wrong count %d of the segments", n)
+	}
+}
+
+func TestSegmentName(t *testing.T) {
+	for _, name := range []string{"../index.m3u8", "../0.ts", "0.ts.tmp", "a.ts", "01.ts", "-1.ts", "1234567890.ts", "index.m3u8", ""} {
+		// rejected before ffmpeg is started
+		if _, err := Segment(context.Background(), "/a.mp4", &model.Object{Name: "a.mp4"}, name); err == nil || !strings.Contains(err.Error(), "invalid segment name") {
+			t.Errorf("the segment name %q is not rejected: %v", name, err)
+		}
+	}
+	for _, name := range []string{"0.ts", "12.ts", "123456789.ts"} {
+		if !segmentName.MatchString(name) {
+			t.Errorf("the segment name %q is rejected", name)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(i)+".ts"), nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan struct{})
+	encoding := &encoder{cancel: func() { close(done) }, done: done}
+	j := &job{dir: dir, path: "/a.mp4", opts: options{segmentDuration: 6}, metadata: &media.Metadata{Duration: 600, VideoCodec: "hevc"}, enc: encoding}
+	if !j.seekable() || j.segments() != 100 {
+		t.Fatalf("the transcoded video of %d segments is not seekable", j.segments())
+	}
+	// the written segments and the ones soon to be encoded are waited for
+	for _, n := range []int{2, 5, 8} {
+		if j.seek(n); j.enc != encoding {
+			t.Fatalf("restarted at segment %d", n)
+		}
+	}
+	if encoding.next != 5 {
+		t.Errorf("wrong encoding segment %d", encoding.next)
+	}
+	// ffmpeg is restarted at the segment far ahead, and killed
+	j.seek(50)
+	if j.enc == encoding || j.enc.start != 50 || !encoding.finished() {
+		t.Errorf("not restarted at segment 50: %+v", j.enc)
+	}
+	<-j.enc.done
+	// the copied video is split at its own key frames
+	j.metadata.VideoCodec = "h264"
+	if j.seekable() {
+		t.Error("the copied video is seekable")
+	}
+}
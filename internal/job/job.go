@@ -0,0 +1,263 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the number of runs kept in the history of each job
+const historySize = 50
+
+type entry struct {
+	job      model.Job
+	schedule *cron.Schedule
+	next     time.Time
+	stop     chan struct{}
+	running  *atomic.Bool
+}
+
+var (
+	mu      sync.Mutex
+	entries = map[uint]*entry{}
+	// the running flags are kept across reschedules so that an updated job doesn't overlap its running run
+	runningFlags = map[uint]*atomic.Bool{}
+)
+
+// Init schedules all enabled jobs
+func Init() {
+	if err := db.FinishRunningJobRuns("interrupted by restart"); err != nil {
+		log.Errorf("failed finish interrupted job runs: %+v", err)
+	}
+	jobs, err := db.GetEnabledJobs()
+	if err != nil {
+		log.Errorf("failed get jobs: %+v", err)
+		return
+	}
+	for i := range jobs {
+		if err = Schedule(&jobs[i]); err != nil {
+			log.Errorf("failed schedule job [%s]: %+v", jobs[i].Name, err)
+		}
+	}
+}
+
+// Validate checks the cron expression and the args of the job
+func Validate(j *model.Job) error {
+	if _, err := cron.Parse(j.Cron); err != nil {
+		return err
+	}
+	_, err := newRunner(j)
+	return err
+}
+
+func runningFlag(id uint) *atomic.Bool {
+	f, ok := runningFlags[id]
+	if !ok {
+		f = &atomic.Bool{}
+		runningFlags[id] = f
+	}
+	return f
+}
+
+// Schedule (re)starts the timer of the job, a disabled job is only unscheduled
+func Schedule(j *model.Job) error {
+	mu.Lock()
+	defer mu.Unlock()
+	unschedule(j.ID)
+	if j.Disabled {
+		return nil
+	}
+	s, err := cron.Parse(j.Cron)
+	if err != nil {
+		return err
+	}
+	e := &entry{
+		job:      *j,
+		schedule: s,
+		stop:     make(chan struct{}),
+		running:  runningFlag(j.ID),
+	}
+	entries[j.ID] = e
+	go e.loop()
+	return nil
+}
+
+// Unschedule stops the timer of the job, a running run is not canceled
+func Unschedule(id uint) {
+	mu.Lock()
+	defer mu.Unlock()
+	unschedule(id)
+}
+
+func unschedule(id uint) {
+	if e, ok := entries[id]; ok {
+		close(e.stop)
+		delete(entries, id)
+	}
+}
+
+// NextRunAt returns the next time the job will be run, nil if it is not scheduled
+func NextRunAt(id uint) *time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+	e, ok := entries[id]
+	if !ok || e.next.IsZero() {
+		return nil
+	}
+	next := e.next
+	return &next
+}
+
+func (e *entry) loop() {
+	for {
+		now := time.Now()
+		next := e.schedule.Next(now)
+		mu.Lock()
+		e.next = next
+		mu.Unlock()
+		if next.IsZero() {
+			log.Warnf("job [%s] will never run with cron [%s]", e.job.Name, e.job.Cron)
+			return
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+			j := e.job
+			go start(&j, e.running, false)
+		case <-e.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// RunNow runs the job immediately, unless it is running
+func RunNow(j *model.Job) (*model.JobRun, error) {
+	mu.Lock()
+	running := runningFlag(j.ID)
+	mu.Unlock()
+	run := start(j, running, true)
+	if run.State == model.JobRunSkipped {
+		return run, errors.New("job is running")
+	}
+	return run, nil
+}
+
+// start records a run of the job and runs it in background, the run is skipped if the previous one is not finished
+func start(j *model.Job, running *atomic.Bool, manual bool) *model.JobRun {
+	run := &model.JobRun{
+		JobID:     j.ID,
+		Manual:    manual,
+		State:     model.JobRunRunning,
+		StartedAt: time.Now(),
+	}
+	if !running.CompareAndSwap(false, true) {
+		run.State = model.JobRunSkipped
+		run.Message = "the previous run is not finished"
+		run.FinishedAt = &run.StartedAt
+		log.Infof("job [%s] skipped: %s", j.Name, run.Message)
+		saveRun(j, run)
+		return run
+	}
+	saveRun(j, run)
+	snapshot := *run
+	go func() {
+		defer running.Store(false)
+		msg, err := execute(context.Background(), j)
+		now := time.Now()
+		run.FinishedAt = &now
+		run.State, run.Message = model.JobRunSucceeded, msg
+		if err != nil {
+			run.State, run.Message = model.JobRunFailed, err.Error()
+			log.Errorf("job [%s] failed: %+v", j.Name, err)
+		}
+		saveRun(j, run)
+	}()
+	return &snapshot
+}
+
+func saveRun(j *model.Job, run *model.JobRun) {
+	var err error
+	if run.ID == 0 {
+		err = db.CreateJobRun(run)
+		if err == nil {
+			err = db.DeleteOldJobRuns(j.ID, historySize)
+		}
+	} else {
+		err = db.UpdateJobRun(run)
+	}
+	if err != nil {
+		log.Errorf("failed save run of job [%s]: %+v", j.Name, err)
+	}
+	j.LastRunAt = &run.StartedAt
+	j.LastState = run.State
+	if err = db.UpdateJobLastRun(j); err != nil {
+		log.Errorf("failed update job [%s]: %+v", j.Name, err)
+	}
+}
+
+func GetJobs(pageIndex, pageSize int) ([]model.Job, int64, error) {
+	jobs, total, err := db.GetJobs(pageIndex, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range jobs {
+		jobs[i].NextRunAt = NextRunAt(jobs[i].ID)
+	}
+	return jobs, total, nil
+}
+
+func GetJobById(id uint) (*model.Job, error) {
+	j, err := db.GetJobById(id)
+	if err != nil {
+		return nil, err
+	}
+	j.NextRunAt = NextRunAt(j.ID)
+	return j, nil
+}
+
+func CreateJob(j *model.Job) error {
+	if err := Validate(j); err != nil {
+		return err
+	}
+	if err := db.CreateJob(j); err != nil {
+		return err
+	}
+	return Schedule(j)
+}
+
+// UpdateJob updates the definition of the job, the run state is kept
+func UpdateJob(j *model.Job) error {
+	old, err := db.GetJobById(j.ID)
+	if err != nil {
+		return err
+	}
+	if err = Validate(j); err != nil {
+		return err
+	}
+	j.CreatorId, j.LastRunAt, j.LastState = old.CreatorId, old.LastRunAt, old.LastState
+	if err = db.UpdateJob(j); err != nil {
+		return err
+	}
+	return Schedule(j)
+}
+
+func DeleteJobById(id uint) error {
+	mu.Lock()
+	unschedule(id)
+	// the running run keeps the flag it got
+	delete(runningFlags, id)
+	mu.Unlock()
+	return db.DeleteJobById(id)
+}
+
+func GetJobRuns(id uint, pageIndex, pageSize int) ([]model.JobRun, int64, error) {
+	return db.GetJobRuns(id, pageIndex, pageSize)
+}
@@ -0,0 +1,273 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/search"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/tache"
+	"github.com/pkg/errors"
+)
+
+// how often the state of the tasks or the scan launched by a run is checked
+var pollInterval = 5 * time.Second
+
+type runner func(ctx context.Context, user *model.User) (string, error)
+
+func newRunner(j *model.Job) (runner, error) {
+	unmarshal := func(v any) error {
+		if j.Args == "" {
+			return nil
+		}
+		return errors.WithMessage(utils.Json.UnmarshalFromString(j.Args, v), "invalid job args")
+	}
+	switch j.Type {
+	case model.JobCopy, model.JobMerge:
+		var args model.JobCopyArgs
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		if len(args.SrcPaths) == 0 || args.DstDir == "" {
+			return nil, errors.New("src paths and dst dir are required")
+		}
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runCopy(ctx, user, j.Type, &args)
+		}, nil
+	case model.JobSync:
+		var args model.JobSyncArgs
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		syncArgs := fs.SyncArgs{Mode: fs.SyncMode(args.Mode), Conflict: fs.SyncConflict(args.Conflict)}
+		if err := syncArgs.Validate(); err != nil {
+			return nil, err
+		}
+		if args.SrcDir == "" || args.DstDir == "" {
+			return nil, errors.New("src dir and dst dir are required")
+		}
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runSync(ctx, user, &args, syncArgs)
+		}, nil
+	case model.JobIndexBuild:
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runIndex(ctx, nil)
+		}, nil
+	case model.JobIndexUpdate:
+		var args model.JobIndexArgs
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		if len(args.Paths) == 0 {
+			return nil, errors.New("paths are required")
+		}
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runIndex(ctx, &args)
+		}, nil
+	case model.JobScan:
+		var args model.JobScanArgs
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		if args.Path == "" {
+			args.Path = "/"
+		}
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runScan(ctx, &args)
+		}, nil
+	case model.JobOfflineDownload:
+		var args model.JobOfflineDownloadArgs
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		if len(args.Urls) == 0 || args.DstDir == "" {
+			return nil, errors.New("urls and dst dir are required")
+		}
+		return func(ctx context.Context, user *model.User) (string, error) {
+			return runOfflineDownload(ctx, user, &args)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown job type [%s]", j.Type)
+	}
+}
+
+func execute(ctx context.Context, j *model.Job) (string, error) {
+	r, err := newRunner(j)
+	if err != nil {
+		return "", err
+	}
+	user, err := op.GetUserById(j.CreatorId)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed get job creator")
+	}
+	if user.Disabled {
+		return "", errors.New("job creator is disabled")
+	}
+	ctx = context.WithValue(ctx, conf.UserKey, user)
+	ctx = context.WithValue(ctx, conf.ApiUrlKey, common.GetApiUrlFromRequest(nil))
+	return r(ctx, user)
+}
+
+// waitTasks waits for the tasks launched by the run to finish and summarizes their outcome,
+// the tasks are got on every check since the tasks of the dirs launch more tasks
+func waitTasks(ctx context.Context, getTasks func() []task.TaskExtensionInfo) (string, error) {
+	for {
+		tasks := getTasks()
+		finished, failed := 0, 0
+		var errs []string
+		for _, t := range tasks {
+			switch t.GetState() {
+			case tache.StateSucceeded:
+				finished++
+			case tache.StateFailed, tache.StateCanceled:
+				finished++
+				failed++
+				if err := t.GetErr(); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", t.GetName(), err))
+				} else {
+					errs = append(errs, fmt.Sprintf("%s: canceled", t.GetName()))
+				}
+			}
+		}
+		if finished == len(tasks) {
+			if failed > 0 {
+				return "", errors.Errorf("%d of %d tasks failed: %s", failed, len(tasks), strings.Join(errs, "; "))
+			}
+			return fmt.Sprintf("%d tasks succeeded", len(tasks)), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func runCopy(ctx context.Context, user *model.User, typ string, args *model.JobCopyArgs) (string, error) {
+	if !user.CanCopy() {
+		return "", errors.New("permission denied")
+	}
+	dstDir, err := user.JoinPath(args.DstDir)
+	if err != nil {
+		return "", err
+	}
+	// the tasks of the objs in the dirs are waited as well
+	tracker := &fs.TaskTracker{}
+	ctx = context.WithValue(ctx, conf.TaskTrackerKey, tracker)
+	for _, p := range args.SrcPaths {
+		srcPath, err := user.JoinPath(p)
+		if err != nil {
+			return "", err
+		}
+		if typ == model.JobMerge {
+			_, err = fs.Merge(ctx, srcPath, dstDir)
+		} else {
+			_, err = fs.Copy(ctx, srcPath, dstDir)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return waitTasks(ctx, tracker.Tasks)
+}
+
+func runSync(ctx context.Context, user *model.User, args *model.JobSyncArgs, syncArgs fs.SyncArgs) (string, error) {
+	if !user.CanCopy() || (syncArgs.Mode == fs.SyncMirror && !user.CanRemove()) {
+		return "", errors.New("permission denied")
+	}
+	srcDir, err := user.JoinPath(args.SrcDir)
+	if err != nil {
+		return "", err
+	}
+	dstDir, err := user.JoinPath(args.DstDir)
+	if err != nil {
+		return "", err
+	}
+	tracker := &fs.TaskTracker{}
+	if _, err = fs.Sync(context.WithValue(ctx, conf.TaskTrackerKey, tracker), srcDir, dstDir, syncArgs); err != nil {
+		return "", err
+	}
+	return waitTasks(ctx, tracker.Tasks)
+}
+
+// runIndex rebuilds the whole index if args is nil, otherwise updates the index of the paths
+func runIndex(ctx context.Context, args *model.JobIndexArgs) (string, error) {
+	if search.Running() {
+		return "", errors.New("index is running")
+	}
+	if args == nil {
+		if err := search.Clear(ctx); err != nil {
+			return "", errors.WithMessage(err, "failed clear index")
+		}
+		err := search.BuildIndex(ctx, []string{"/"}, conf.SlicesMap[conf.IgnorePaths], setting.GetInt(conf.MaxIndexDepth, 20), true)
+		return "index rebuilt", err
+	}
+	for _, path := range args.Paths {
+		if err := search.Del(ctx, path); err != nil {
+			return "", errors.WithMessagef(err, "failed delete index on %s", path)
+		}
+	}
+	maxDepth := args.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = setting.GetInt(conf.MaxIndexDepth, 20)
+	}
+	err := search.BuildIndex(ctx, args.Paths, conf.SlicesMap[conf.IgnorePaths], maxDepth, false)
+	return fmt.Sprintf("index of %d paths updated", len(args.Paths)), err
+}
+
+func runScan(ctx context.Context, args *model.JobScanArgs) (string, error) {
+	if err := op.BeginManualScan(args.Path, args.Limit); err != nil {
+		return "", err
+	}
+	for op.ManualScanRunning() {
+		select {
+		case <-ctx.Done():
+			op.StopManualScan()
+			return "", ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return fmt.Sprintf("%d objs scanned", op.ScannedCount.Load()), nil
+}
+
+func runOfflineDownload(ctx context.Context, user *model.User, args *model.JobOfflineDownloadArgs) (string, error) {
+	if !user.CanAddOfflineDownloadTasks() {
+		return "", errors.New("permission denied")
+	}
+	dstDir, err := user.JoinPath(args.DstDir)
+	if err != nil {
+		return "", err
+	}
+	var tasks []task.TaskExtensionInfo
+	for _, url := range args.Urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		t, err := tool.AddURL(ctx, &tool.AddURLArgs{
+			URL:          url,
+			DstDirPath:   dstDir,
+			Tool:         args.Tool,
+			DeletePolicy: tool.DeletePolicy(args.DeletePolicy),
+		})
+		if err != nil {
+			return "", err
+		}
+		if t != nil {
+			tasks = append(tasks, t)
+		}
+	}
+	return waitTasks(ctx, func() []task.TaskExtensionInfo {
+		return tasks
+	})
+}
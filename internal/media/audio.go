@@ -0,0 +1,272 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+func extractAudio(r io.ReaderAt, size int64, m *Metadata) error {
+	readTags(r, size, m)
+	head, err := readAt(r, 0, int(min(size, 16)))
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return flacInfo(r, size, m)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return oggInfo(r, size, m)
+	case bytes.HasPrefix(head, []byte("RIFF")) && len(head) >= 12 && string(head[8:12]) == "WAVE":
+		return wavInfo(r, size, m)
+	default:
+		return mp3Info(r, size, m)
+	}
+}
+
+// readTags reads the tags of id3, vorbis comments and mp4, the files without tags are fine
+func readTags(r io.ReaderAt, size int64, m *Metadata) {
+	t, err := tag.ReadFrom(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return
+	}
+	m.Title = strings.TrimSpace(t.Title())
+	m.Artist = strings.TrimSpace(t.Artist())
+	m.Album = strings.TrimSpace(t.Album())
+	m.AlbumArtist = strings.TrimSpace(t.AlbumArtist())
+	m.Genre = strings.TrimSpace(t.Genre())
+	m.Year = t.Year()
+	m.Track, _ = t.Track()
+}
+
+func flacInfo(r io.ReaderAt, size int64, m *Metadata) error {
+	m.Container, m.AudioCodec = "flac", "flac"
+	// the STREAMINFO block is always the first one
+	b, err := readAt(r, 4, 4+34)
+	if err != nil {
+		return err
+	}
+	if b[0]&0x7F != 0 {
+		return errors.New("invalid flac stream info")
+	}
+	info := b[4:]
+	v := binary.BigEndian.Uint64(info[10:18])
+	m.SampleRate = int(v >> 44)
+	m.Channels = int(v>>41&0x7) + 1
+	samples := v & 0xFFFFFFFFF
+	if m.SampleRate > 0 {
+		m.Duration = float64(samples) / float64(m.SampleRate)
+	}
+	return nil
+}
+
+func oggInfo(r io.ReaderAt, size int64, m *Metadata) error {
+	m.Container = "ogg"
+	// the identification header is in the first page
+	b, err := readAt(r, 0, int(min(size, 512)))
+	if err != nil {
+		return err
+	}
+	if len(b) < 27 {
+		return errors.New("invalid ogg page")
+	}
+	packet := b[27+int(b[26]):]
+	rate, preSkip := 0, 0
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		m.AudioCodec = "vorbis"
+		m.Channels = int(packet[11])
+		rate = int(binary.LittleEndian.Uint32(packet[12:]))
+		m.SampleRate = rate
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 16:
+		m.AudioCodec = "opus"
+		m.Channels = int(packet[9])
+		preSkip = int(binary.LittleEndian.Uint16(packet[10:]))
+		m.SampleRate = int(binary.LittleEndian.Uint32(packet[12:]))
+		// the granule position of opus is always in 48kHz
+		rate = 48000
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")) && len(packet) >= 17+34:
+		// the STREAMINFO block follows the mapping header and the flac signature
+		m.AudioCodec = "flac"
+		v := binary.BigEndian.Uint64(packet[17+10:])
+		m.SampleRate = int(v >> 44)
+		m.Channels = int(v>>41&0x7) + 1
+		rate = m.SampleRate
+	default:
+		return nil
+	}
+	if rate == 0 {
+		return nil
+	}
+	// the granule position of the last page is the count of the samples
+	tailSize := min(size, 64*1024)
+	tail, err := readAt(r, size-tailSize, int(tailSize))
+	if err != nil {
+		return err
+	}
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i < 0 || i+14 > len(tail) {
+		return nil
+	}
+	granule := int64(binary.LittleEndian.Uint64(tail[i+6:]))
+	if granule > int64(preSkip) {
+		m.Duration = float64(granule-int64(preSkip)) / float64(rate)
+	}
+	return nil
+}
+
+func wavInfo(r io.ReaderAt, size int64, m *Metadata) error {
+	m.Container = "wav"
+	byteRate := 0
+	for off := int64(12); off+8 <= size; {
+		b, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		id, length := string(b[:4]), int64(binary.LittleEndian.Uint32(b[4:]))
+		switch id {
+		case "fmt ":
+			f, err := readAt(r, off+8, 16)
+			if err != nil {
+				return err
+			}
+			m.AudioCodec = wavCodec(binary.LittleEndian.Uint16(f[0:]))
+			m.Channels = int(binary.LittleEndian.Uint16(f[2:]))
+			m.SampleRate = int(binary.LittleEndian.Uint32(f[4:]))
+			byteRate = int(binary.LittleEndian.Uint32(f[8:]))
+		case "data":
+			if byteRate > 0 {
+				m.Duration = float64(min(length, size-off-8)) / float64(byteRate)
+			}
+			return nil
+		}
+		off += 8 + length + length&1
+	}
+	return nil
+}
+
+func wavCodec(format uint16) string {
+	switch format {
+	case 1, 0xFFFE:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	case 0x55:
+		return "mp3"
+	}
+	return ""
+}
+
+var (
+	// the bitrates in kbps of mpeg 1 and mpeg 2 by layer
+	mp3Bitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+func mp3Info(r io.ReaderAt, size int64, m *Metadata) error {
+	// skip the id3v2 tag
+	start := int64(0)
+	if b, err := readAt(r, 0, 10); err == nil && string(b[:3]) == "ID3" {
+		start = 10 + (int64(b[6]&0x7F)<<21 | int64(b[7]&0x7F)<<14 | int64(b[8]&0x7F)<<7 | int64(b[9]&0x7F))
+		if b[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	if start >= size {
+		return errors.New("no mp3 frame found")
+	}
+	b, err := readAt(r, start, int(min(size-start, 16*1024)))
+	if err != nil {
+		return err
+	}
+	i := 0
+	for ; i+4 <= len(b); i++ {
+		if b[i] == 0xFF && b[i+1]&0xE0 == 0xE0 && b[i+1]&0x18 != 0x08 && b[i+1]&0x06 != 0 &&
+			b[i+2]&0xF0 != 0xF0 && b[i+2]&0x0C != 0x0C {
+			break
+		}
+	}
+	if i+4 > len(b) {
+		return errors.New("no mp3 frame found")
+	}
+	h := b[i:]
+	version := (h[1] >> 3) & 0x3 // 3: mpeg 1, 2: mpeg 2, 0: mpeg 2.5
+	layer := 4 - int((h[1]>>1)&0x3)
+	v := 0
+	if version != 3 {
+		v = 1
+	}
+	bitrate := mp3Bitrates[v][layer-1][h[2]>>4] * 1000
+	sampleRate := mp3SampleRates[(h[2]>>2)&0x3]
+	switch version {
+	case 2:
+		sampleRate /= 2
+	case 0:
+		sampleRate /= 4
+	}
+	mono := h[3]>>6 == 3
+	m.Container = "mp3"
+	m.AudioCodec = [...]string{"", "mp1", "mp2", "mp3"}[layer]
+	m.SampleRate = sampleRate
+	m.Channels = 2
+	if mono {
+		m.Channels = 1
+	}
+	samplesPerFrame := 1152
+	switch {
+	case layer == 1:
+		samplesPerFrame = 384
+	case layer == 3 && version != 3:
+		samplesPerFrame = 576
+	}
+	// the frame count in the xing or vbri header of the first frame
+	sideInfo := 32
+	switch {
+	case version == 3 && mono:
+		sideInfo = 17
+	case version != 3 && !mono:
+		sideInfo = 17
+	case version != 3 && mono:
+		sideInfo = 9
+	}
+	frames := 0
+	if x := 4 + sideInfo; i+x+12 <= len(b) && (string(h[x:x+4]) == "Xing" || string(h[x:x+4]) == "Info") {
+		if binary.BigEndian.Uint32(h[x+4:])&0x1 != 0 {
+			frames = int(binary.BigEndian.Uint32(h[x+8:]))
+		}
+	} else if i+36+18 <= len(b) && string(h[36:40]) == "VBRI" {
+		frames = int(binary.BigEndian.Uint32(h[36+14:]))
+	}
+	if frames > 0 && sampleRate > 0 {
+		m.Duration = float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+		return nil
+	}
+	// the constant bitrate, the id3v1 tag at the end is excluded
+	if bitrate > 0 {
+		audioSize := size - start - int64(i)
+		if t, err := readAt(r, size-128, 3); err == nil && string(t) == "TAG" {
+			audioSize -= 128
+		}
+		m.Duration = float64(audioSize) * 8 / float64(bitrate)
+	}
+	return nil
+}
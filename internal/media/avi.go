@@ -0,0 +1,113 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+var aviCodecs = map[string]string{
+	"h264": "h264",
+	"avc1": "h264",
+	"x264": "h264",
+	"hevc": "hevc",
+	"h265": "hevc",
+	"xvid": "mpeg4",
+	"divx": "mpeg4",
+	"dx50": "mpeg4",
+	"fmp4": "mpeg4",
+	"mjpg": "mjpeg",
+}
+
+// riffChunks splits the chunks of riff, the lists are returned with the list type as the id
+func riffChunks(data []byte) []box {
+	var chunks []box
+	for len(data) >= 8 {
+		id, size := string(data[:4]), int(binary.LittleEndian.Uint32(data[4:]))
+		if size > len(data)-8 {
+			size = len(data) - 8
+		}
+		chunk := data[8 : 8+size]
+		if id == "LIST" && len(chunk) >= 4 {
+			id, chunk = string(chunk[:4]), chunk[4:]
+		}
+		chunks = append(chunks, box{typ: id, data: chunk})
+		data = data[min(8+size+size&1, len(data)):]
+	}
+	return chunks
+}
+
+func extractAVI(r io.ReaderAt, size int64, m *Metadata) error {
+	b, err := readAt(r, 0, int(min(size, 24)))
+	if err != nil {
+		return err
+	}
+	if len(b) < 24 || string(b[:4]) != "RIFF" || string(b[8:12]) != "AVI " || string(b[12:16]) != "LIST" ||
+		string(b[20:24]) != "hdrl" {
+		return errors.New("invalid avi header")
+	}
+	m.Container = "avi"
+	hdrlSize := int64(binary.LittleEndian.Uint32(b[16:]))
+	if hdrlSize > maxHeaderSize {
+		return errors.New("avi header is too large")
+	}
+	hdrl, err := readAt(r, 24, int(min(hdrlSize-4, size-24)))
+	if err != nil {
+		return err
+	}
+	for _, c := range riffChunks(hdrl) {
+		switch c.typ {
+		case "avih":
+			if len(c.data) < 40 {
+				continue
+			}
+			usPerFrame := binary.LittleEndian.Uint32(c.data[0:])
+			frames := binary.LittleEndian.Uint32(c.data[16:])
+			m.Duration = float64(usPerFrame) * float64(frames) / 1e6
+			m.Width = int(binary.LittleEndian.Uint32(c.data[32:]))
+			m.Height = int(binary.LittleEndian.Uint32(c.data[36:]))
+		case "strl":
+			var strh, strf []byte
+			for _, s := range riffChunks(c.data) {
+				switch s.typ {
+				case "strh":
+					strh = s.data
+				case "strf":
+					strf = s.data
+				}
+			}
+			if len(strh) < 8 {
+				continue
+			}
+			switch string(strh[:4]) {
+			case "vids":
+				if m.VideoCodec != "" {
+					continue
+				}
+				fourcc := string(strh[4:8])
+				if len(strf) >= 20 {
+					fourcc = string(strf[16:20])
+				}
+				fourcc = strings.ToLower(strings.TrimRight(fourcc, "\x00 "))
+				if codec, ok := aviCodecs[fourcc]; ok {
+					fourcc = codec
+				}
+				m.VideoCodec = fourcc
+			case "auds":
+				if m.AudioCodec != "" || len(strf) < 8 {
+					continue
+				}
+				m.AudioCodec = wavCodec(binary.LittleEndian.Uint16(strf[0:]))
+				if format := binary.LittleEndian.Uint16(strf[0:]); format == 0x2000 {
+					m.AudioCodec = "ac3"
+				} else if format == 0x50 {
+					m.AudioCodec = "mp2"
+				}
+				m.Channels = int(binary.LittleEndian.Uint16(strf[2:]))
+				m.SampleRate = int(binary.LittleEndian.Uint32(strf[4:]))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+func extractImage(r io.ReaderAt, size int64, m *Metadata) error {
+	cfg, format, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	m.Container, m.Width, m.Height = format, cfg.Width, cfg.Height
+	var base, length int64
+	switch format {
+	case "jpeg":
+		base, length, err = findJPEGExif(r, size)
+	case "tiff":
+		base, length = 0, size
+	case "png":
+		base, length, err = findChunk(r, 8, size, binary.BigEndian, "eXIf", 0)
+	case "webp":
+		base, length, err = findChunk(r, 12, size, binary.LittleEndian, "EXIF", 1)
+	}
+	if err != nil || length == 0 {
+		// the image without exif is fine
+		return nil
+	}
+	if format == "webp" {
+		// some writers keep the jpeg header of the exif
+		if b, err := readAt(r, base, 6); err == nil && bytes.Equal(b, []byte("Exif\x00\x00")) {
+			base, length = base+6, length-6
+		}
+	}
+	return parseTIFF(io.NewSectionReader(r, base, length), m)
+}
+
+// findJPEGExif returns the tiff data in the APP1 segment
+func findJPEGExif(r io.ReaderAt, size int64) (int64, int64, error) {
+	for off := int64(2); off+4 <= size; {
+		b, err := readAt(r, off, 4)
+		if err != nil {
+			return 0, 0, err
+		}
+		if b[0] != 0xFF {
+			return 0, 0, errors.New("invalid jpeg marker")
+		}
+		marker := b[1]
+		// the segments after the start of scan are the image data
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int64(binary.BigEndian.Uint16(b[2:]))
+		if marker == 0xE1 && length > 8 {
+			header, err := readAt(r, off+4, 6)
+			if err != nil {
+				return 0, 0, err
+			}
+			if bytes.Equal(header, []byte("Exif\x00\x00")) {
+				return off + 10, length - 8, nil
+			}
+		}
+		off += 2 + length
+	}
+	return 0, 0, nil
+}
+
+// findChunk finds the chunk of png or riff, pad is the alignment of the chunks
+func findChunk(r io.ReaderAt, off, size int64, order binary.ByteOrder, name string, pad int64) (int64, int64, error) {
+	for off+8 <= size {
+		b, err := readAt(r, off, 8)
+		if err != nil {
+			return 0, 0, err
+		}
+		var id string
+		var length int64
+		if order == binary.BigEndian {
+			length, id = int64(order.Uint32(b[0:])), string(b[4:8])
+		} else {
+			id, length = string(b[0:4]), int64(order.Uint32(b[4:]))
+		}
+		if id == name {
+			return off + 8, min(length, size-off-8), nil
+		}
+		off += 8 + length + (length & pad)
+		if order == binary.BigEndian {
+			// the crc of the png chunk
+			off += 4
+		}
+	}
+	return 0, 0, nil
+}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffReader struct {
+	r     *io.SectionReader
+	order binary.ByteOrder
+}
+
+// typeSizes is the size of the tiff types, the unknown types are 0
+var typeSizes = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+func (t *tiffReader) readIFD(off int64) (map[uint16]tiffEntry, error) {
+	b, err := readAt(t.r, off, 2)
+	if err != nil {
+		return nil, err
+	}
+	count := int(t.order.Uint16(b))
+	if count > 1000 {
+		return nil, errors.New("invalid tiff ifd")
+	}
+	data, err := readAt(t.r, off+2, count*12)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		e := data[i*12 : i*12+12]
+		typ := t.order.Uint16(e[2:])
+		n := t.order.Uint32(e[4:])
+		if int(typ) >= len(typeSizes) || typeSizes[typ] == 0 || n > 1<<16 {
+			continue
+		}
+		size := typeSizes[typ] * n
+		value := e[8:12]
+		if size > 4 {
+			if value, err = readAt(t.r, int64(t.order.Uint32(e[8:])), int(size)); err != nil {
+				continue
+			}
+		}
+		entries[t.order.Uint16(e[0:])] = tiffEntry{typ: typ, count: n, value: value[:size]}
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) string(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+func (t *tiffReader) uint(e tiffEntry) uint32 {
+	switch e.typ {
+	case 1, 7:
+		return uint32(e.value[0])
+	case 3:
+		return uint32(t.order.Uint16(e.value))
+	case 4:
+		return t.order.Uint32(e.value)
+	}
+	return 0
+}
+
+func (t *tiffReader) rationals(e tiffEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	ret := make([]float64, e.count)
+	for i := range ret {
+		num, den := t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:])
+		if den != 0 {
+			ret[i] = float64(num) / float64(den)
+		}
+	}
+	return ret
+}
+
+func parseTIFF(r *io.SectionReader, m *Metadata) error {
+	b, err := readAt(r, 0, 8)
+	if err != nil {
+		return err
+	}
+	t := &tiffReader{r: r}
+	switch string(b[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return errors.New("invalid tiff header")
+	}
+	ifd0, err := t.readIFD(int64(t.order.Uint32(b[4:])))
+	if err != nil {
+		return err
+	}
+	m.CameraMake = t.string(ifd0[tagMake])
+	m.CameraModel = t.string(ifd0[tagModel])
+	if e, ok := ifd0[tagOrientation]; ok {
+		m.Orientation = int(t.uint(e))
+	}
+	taken, offset := t.string(ifd0[tagDateTime]), ""
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if exif, err := t.readIFD(int64(t.uint(e))); err == nil {
+			if s := t.string(exif[tagDateTimeOriginal]); s != "" {
+				taken = s
+			}
+			offset = t.string(exif[tagOffsetTimeOriginal])
+		}
+	}
+	if ts, ok := parseExifTime(taken, offset); ok {
+		m.TakenAt = &ts
+	}
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.readIFD(int64(t.uint(e))); err == nil {
+			lat := gpsCoordinate(t.rationals(gps[tagGPSLatitude]), t.string(gps[tagGPSLatitudeRef]), "S")
+			lon := gpsCoordinate(t.rationals(gps[tagGPSLongitude]), t.string(gps[tagGPSLongitudeRef]), "W")
+			if lat != nil && lon != nil {
+				m.Latitude, m.Longitude = lat, lon
+			}
+		}
+	}
+	return nil
+}
+
+// parseExifTime parses the time of exif, which is the local time of the camera if there's no offset
+func parseExifTime(s, offset string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	loc := time.Local
+	if offset != "" {
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			loc = t.Location()
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, loc)
+	if err != nil || t.Year() < 1900 {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func gpsCoordinate(v []float64, ref, negative string) *float64 {
+	if len(v) != 3 {
+		return nil
+	}
+	c := v[0] + v[1]/60 + v[2]/3600
+	if strings.EqualFold(ref, negative) {
+		c = -c
+	}
+	if math.IsNaN(c) || math.Abs(c) > 180 {
+		return nil
+	}
+	c = math.Round(c*1e6) / 1e6
+	return &c
+}
@@ -0,0 +1,589 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	ebmlHeader       = 0x1A45DFA3
+	ebmlDocType      = 0x4282
+	mkvSegment       = 0x18538067
+	mkvSeekHead      = 0x114D9B74
+	mkvSeek          = 0x4DBB
+	mkvSeekID        = 0x53AB
+	mkvSeekPosition  = 0x53AC
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackNumber   = 0xD7
+	mkvTrackType     = 0x83
+	mkvName          = 0x536E
+	mkvLanguage      = 0x22B59C
+	mkvLanguageBCP47 = 0x22B59D
+	mkvCodecID       = 0x86
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvAudio         = 0xE1
+	mkvSamplingFreq  = 0xB5
+	mkvChannels      = 0x9F
+	mkvCluster       = 0x1F43B675
+	mkvClusterTime   = 0xE7
+	mkvSimpleBlock   = 0xA3
+	mkvBlockGroup    = 0xA0
+	mkvBlock         = 0xA1
+	mkvBlockDuration = 0x9B
+	mkvCues          = 0x1C53BB6B
+	mkvCuePoint      = 0xBB
+	mkvCueTime       = 0xB3
+	mkvCuePositions  = 0xB7
+	mkvCueTrack      = 0xF7
+	mkvCueCluster    = 0xF1
+	mkvCueRelative   = 0xF0
+	mkvCueDuration   = 0xB2
+)
+
+var matroskaCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MPEG2":          "mpeg2",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dts",
+	"A_FLAC":           "flac",
+	"A_MPEG/L3":        "mp3",
+	"A_TRUEHD":         "truehd",
+	"S_TEXT/UTF8":      "srt",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ssa",
+	"S_TEXT/WEBVTT":    "webvtt",
+}
+
+// readVint reads the variable length integer of ebml, the marker bit is kept for the ids
+func readVint(b []byte, keepMarker bool) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 8 || len(b) < n {
+		return 0, 0, false
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> n)
+	}
+	allOnes := v == uint64(0xFF>>n)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+		allOnes = allOnes && b[i] == 0xFF
+	}
+	if !keepMarker && allOnes {
+		// the unknown size
+		return math.MaxUint64, n, true
+	}
+	return v, n, true
+}
+
+// readElementHeader returns the id, the size of the data and the size of the header
+func readElementHeader(b []byte) (uint64, uint64, int, bool) {
+	id, n1, ok := readVint(b, true)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	size, n2, ok := readVint(b[n1:], false)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return id, size, n1 + n2, true
+}
+
+type ebmlElement struct {
+	id   uint64
+	data []byte
+}
+
+func ebmlElements(data []byte) []ebmlElement {
+	var elements []ebmlElement
+	for len(data) > 0 {
+		id, size, n, ok := readElementHeader(data)
+		if !ok || size > uint64(len(data)-n) {
+			break
+		}
+		elements = append(elements, ebmlElement{id: id, data: data[n : n+int(size)]})
+		data = data[n+int(size):]
+	}
+	return elements
+}
+
+func ebmlUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// matroska is the top level elements of the segment, the clusters are not read
+type matroska struct {
+	r         io.ReaderAt
+	size      int64
+	docType   string
+	segment   int64
+	positions map[uint64]int64
+}
+
+func openMatroska(r io.ReaderAt, size int64) (*matroska, error) {
+	b, err := readAt(r, 0, int(min(size, 1024)))
+	if err != nil {
+		return nil, err
+	}
+	id, headerSize, n, ok := readElementHeader(b)
+	if !ok || id != ebmlHeader || uint64(n)+headerSize > uint64(len(b)) {
+		return nil, errors.New("invalid ebml header")
+	}
+	mkv := &matroska{r: r, size: size, docType: "matroska", positions: map[uint64]int64{}}
+	for _, e := range ebmlElements(b[n : n+int(headerSize)]) {
+		if e.id == ebmlDocType {
+			mkv.docType = string(e.data)
+		}
+	}
+	// the segment follows the ebml header
+	off := int64(n) + int64(headerSize)
+	b, err = readAt(r, off, int(min(size-off, 12)))
+	if err != nil {
+		return nil, err
+	}
+	id, _, n, ok = readElementHeader(b)
+	if !ok || id != mkvSegment {
+		return nil, errors.New("matroska segment not found")
+	}
+	mkv.segment = off + int64(n)
+	// the top level elements before the first cluster, the others are found by the seek head
+	for off = mkv.segment; off < size; {
+		b, err = readAt(r, off, int(min(size-off, 12)))
+		if err != nil {
+			return nil, err
+		}
+		id, elementSize, n, ok := readElementHeader(b)
+		if !ok || elementSize == math.MaxUint64 {
+			break
+		}
+		if _, ok := mkv.positions[id]; !ok {
+			mkv.positions[id] = off
+		}
+		if id == mkvCluster {
+			break
+		}
+		if id == mkvSeekHead {
+			head, err := mkv.readData(off+int64(n), elementSize)
+			if err != nil {
+				return nil, err
+			}
+			for _, seek := range ebmlElements(head) {
+				if seek.id != mkvSeek {
+					continue
+				}
+				var seekID, pos uint64
+				for _, e := range ebmlElements(seek.data) {
+					switch e.id {
+					case mkvSeekID:
+						seekID = ebmlUint(e.data)
+					case mkvSeekPosition:
+						pos = ebmlUint(e.data)
+					}
+				}
+				if _, ok := mkv.positions[seekID]; !ok {
+					mkv.positions[seekID] = mkv.segment + int64(pos)
+				}
+			}
+		}
+		off += int64(n) + int64(elementSize)
+	}
+	return mkv, nil
+}
+
+func (mkv *matroska) readData(off int64, size uint64) ([]byte, error) {
+	if size > maxHeaderSize {
+		return nil, errors.New("matroska element is too large")
+	}
+	return readAt(mkv.r, off, int(size))
+}
+
+// element reads the data of the top level element, nil is returned if it's not found
+func (mkv *matroska) element(id uint64) []byte {
+	pos, ok := mkv.positions[id]
+	if !ok || pos >= mkv.size {
+		return nil
+	}
+	b, err := readAt(mkv.r, pos, int(min(mkv.size-pos, 12)))
+	if err != nil {
+		return nil
+	}
+	eid, elementSize, n, ok := readElementHeader(b)
+	if !ok || eid != id {
+		return nil
+	}
+	data, _ := mkv.readData(pos+int64(n), elementSize)
+	return data
+}
+
+// timecodeScale returns the nanoseconds of a timestamp unit
+func (mkv *matroska) timecodeScale() uint64 {
+	for _, e := range ebmlElements(mkv.element(mkvInfo)) {
+		if e.id == mkvTimecodeScale {
+			return ebmlUint(e.data)
+		}
+	}
+	return 1000000
+}
+
+func extractMatroska(r io.ReaderAt, size int64, m *Metadata) error {
+	mkv, err := openMatroska(r, size)
+	if err != nil {
+		return err
+	}
+	m.Container = mkv.docType
+	matroskaInfo(mkv.element(mkvInfo), m)
+	matroskaTracks(mkv.element(mkvTracks), m)
+	return nil
+}
+
+func matroskaInfo(info []byte, m *Metadata) {
+	scale, duration := uint64(1000000), 0.0
+	for _, e := range ebmlElements(info) {
+		switch e.id {
+		case mkvTimecodeScale:
+			scale = ebmlUint(e.data)
+		case mkvDuration:
+			duration = ebmlFloat(e.data)
+		}
+	}
+	m.Duration = duration * float64(scale) / 1e9
+}
+
+func matroskaTracks(tracks []byte, m *Metadata) {
+	for _, entry := range ebmlElements(tracks) {
+		if entry.id != mkvTrackEntry {
+			continue
+		}
+		var number, trackType uint64
+		var codec, name string
+		language, languageBCP47 := "eng", ""
+		var video, audio []byte
+		for _, e := range ebmlElements(entry.data) {
+			switch e.id {
+			case mkvTrackNumber:
+				number = ebmlUint(e.data)
+			case mkvTrackType:
+				trackType = ebmlUint(e.data)
+			case mkvName:
+				name = strings.TrimRight(string(e.data), "\x00")
+			case mkvLanguage:
+				language = strings.TrimRight(string(e.data), "\x00")
+			case mkvLanguageBCP47:
+				languageBCP47 = strings.TrimRight(string(e.data), "\x00")
+			case mkvCodecID:
+				codec = strings.TrimRight(string(e.data), "\x00")
+			case mkvVideo:
+				video = e.data
+			case mkvAudio:
+				audio = e.data
+			}
+		}
+		if name, ok := matroskaCodecs[codec]; ok {
+			codec = name
+		} else if strings.HasPrefix(codec, "A_AAC") {
+			codec = "aac"
+		} else if i := strings.IndexByte(codec, '_'); i >= 0 {
+			codec = strings.ToLower(codec[i+1:])
+		}
+		switch {
+		case trackType == 1 && m.VideoCodec == "":
+			m.VideoCodec = codec
+			for _, e := range ebmlElements(video) {
+				switch e.id {
+				case mkvPixelWidth:
+					m.Width = int(ebmlUint(e.data))
+				case mkvPixelHeight:
+					m.Height = int(ebmlUint(e.data))
+				}
+			}
+		case trackType == 17 && subtitleCodecs[codec]:
+			if languageBCP47 != "" {
+				language = languageBCP47
+			}
+			m.Subtitles = append(m.Subtitles, SubtitleTrack{ID: int(number), Codec: codec, Language: language, Name: name})
+		case trackType == 2 && m.AudioCodec == "":
+			m.AudioCodec = codec
+			for _, e := range ebmlElements(audio) {
+				switch e.id {
+				case mkvSamplingFreq:
+					m.SampleRate = int(ebmlFloat(e.data))
+				case mkvChannels:
+					m.Channels = int(ebmlUint(e.data))
+				}
+			}
+		}
+	}
+}
+
+// the clusters of the videos larger than this are not scanned for the subtitles without the cues
+const maxClusterScanSize = 1 << 30
+
+type subtitleBlock struct {
+	time     int64
+	duration uint64
+	data     []byte
+}
+
+// subtitleCues reads the blocks of the subtitle track by the cues, the clusters are scanned
+// if the positions of the blocks are not in the cues
+func (mkv *matroska) subtitleCues(track uint64, codec string) ([]cue, error) {
+	var blocks []subtitleBlock
+	read := map[int64]bool{}
+	var clusters []int64
+	// the number of the blocks of the track in the clusters to scan
+	want := map[int64]int{}
+	found := false
+	for _, point := range ebmlElements(mkv.element(mkvCues)) {
+		if point.id != mkvCuePoint {
+			continue
+		}
+		var cueTime int64
+		for _, e := range ebmlElements(point.data) {
+			if e.id == mkvCueTime {
+				cueTime = int64(ebmlUint(e.data))
+			}
+		}
+		for _, positions := range ebmlElements(point.data) {
+			if positions.id != mkvCuePositions {
+				continue
+			}
+			var cueTrack, cluster, duration uint64
+			relative := int64(-1)
+			for _, e := range ebmlElements(positions.data) {
+				switch e.id {
+				case mkvCueTrack:
+					cueTrack = ebmlUint(e.data)
+				case mkvCueCluster:
+					cluster = ebmlUint(e.data)
+				case mkvCueRelative:
+					relative = int64(ebmlUint(e.data))
+				case mkvCueDuration:
+					duration = ebmlUint(e.data)
+				}
+			}
+			if cueTrack != track {
+				continue
+			}
+			found = true
+			pos := mkv.segment + int64(cluster)
+			if relative < 0 {
+				if !read[pos] {
+					read[pos] = true
+					clusters = append(clusters, pos)
+				}
+				want[pos]++
+				continue
+			}
+			// the relative position is from the data of the cluster
+			b, err := readAt(mkv.r, pos, int(min(mkv.size-pos, 12)))
+			if err != nil {
+				return nil, err
+			}
+			_, _, n, ok := readElementHeader(b)
+			if !ok || read[pos+int64(n)+relative] {
+				continue
+			}
+			read[pos+int64(n)+relative] = true
+			block, ok, err := mkv.readBlock(pos+int64(n)+relative, track)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				block.time = cueTime
+				if block.duration == 0 {
+					block.duration = duration
+				}
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	if !found {
+		if mkv.size > maxClusterScanSize {
+			return nil, errors.New("the subtitle track is not in the cues of the large video")
+		}
+		for pos := mkv.positions[mkvCluster]; pos > 0 && pos < mkv.size; {
+			b, err := readAt(mkv.r, pos, int(min(mkv.size-pos, 12)))
+			if err != nil {
+				return nil, err
+			}
+			id, size, n, ok := readElementHeader(b)
+			if !ok || size == math.MaxUint64 {
+				break
+			}
+			if id == mkvCluster {
+				clusters = append(clusters, pos)
+			}
+			pos += int64(n) + int64(size)
+		}
+	}
+	for _, pos := range clusters {
+		clusterBlocks, err := mkv.scanCluster(pos, track, want[pos])
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, clusterBlocks...)
+	}
+	scale := time.Duration(mkv.timecodeScale())
+	cues := make([]cue, 0, len(blocks))
+	for _, b := range blocks {
+		c := cue{start: time.Duration(b.time) * scale, text: matroskaSubtitleText(codec, b.data)}
+		if b.duration > 0 {
+			c.end = c.start + time.Duration(b.duration)*scale
+		}
+		cues = append(cues, c)
+	}
+	return cues, nil
+}
+
+// readBlock reads the SimpleBlock or the BlockGroup at the offset if it's of the track,
+// the time of the block is relative to the cluster
+func (mkv *matroska) readBlock(off int64, track uint64) (subtitleBlock, bool, error) {
+	// the header of the element, the header of the block in the group and the track number
+	b, err := readAt(mkv.r, off, int(min(mkv.size-off, 32)))
+	if err != nil {
+		return subtitleBlock{}, false, err
+	}
+	id, size, n, ok := readElementHeader(b)
+	if !ok || (id != mkvSimpleBlock && id != mkvBlockGroup) {
+		return subtitleBlock{}, false, nil
+	}
+	head := b[n:]
+	if id == mkvBlockGroup {
+		// the block is the first element of the group mostly
+		blockID, _, m, ok := readElementHeader(head)
+		if !ok || blockID != mkvBlock {
+			return subtitleBlock{}, false, nil
+		}
+		head = head[m:]
+	}
+	if t, _, ok := readVint(head, false); !ok || t != track {
+		return subtitleBlock{}, false, nil
+	}
+	data, err := mkv.readData(off+int64(n), size)
+	if err != nil {
+		return subtitleBlock{}, false, err
+	}
+	var block subtitleBlock
+	if id == mkvBlockGroup {
+		for _, e := range ebmlElements(data) {
+			switch e.id {
+			case mkvBlock:
+				data = e.data
+			case mkvBlockDuration:
+				block.duration = ebmlUint(e.data)
+			}
+		}
+	}
+	_, tn, _ := readVint(data, false)
+	// the subtitles are never laced
+	if len(data) < tn+3 || data[tn+2]&0x06 != 0 {
+		return subtitleBlock{}, false, nil
+	}
+	block.time = int64(int16(binary.BigEndian.Uint16(data[tn:])))
+	block.data = data[tn+3:]
+	return block, true, nil
+}
+
+// scanCluster reads the blocks of the track in the cluster, the scan stops once the wanted number of blocks
+// are read, or the whole cluster is scanned if the number is 0
+func (mkv *matroska) scanCluster(pos int64, track uint64, want int) ([]subtitleBlock, error) {
+	b, err := readAt(mkv.r, pos, int(min(mkv.size-pos, 12)))
+	if err != nil {
+		return nil, err
+	}
+	id, size, n, ok := readElementHeader(b)
+	if !ok || id != mkvCluster || size == math.MaxUint64 {
+		return nil, nil
+	}
+	var blocks []subtitleBlock
+	var clusterTime int64
+	end := min(pos+int64(n)+int64(size), mkv.size)
+	for off := pos + int64(n); off < end; {
+		b, err := readAt(mkv.r, off, int(min(end-off, 12)))
+		if err != nil {
+			return nil, err
+		}
+		id, size, n, ok := readElementHeader(b)
+		if !ok || size == math.MaxUint64 {
+			break
+		}
+		switch id {
+		case mkvClusterTime:
+			if size <= 8 {
+				data, err := readAt(mkv.r, off+int64(n), int(size))
+				if err != nil {
+					return nil, err
+				}
+				clusterTime = int64(ebmlUint(data))
+			}
+		case mkvSimpleBlock, mkvBlockGroup:
+			block, ok, err := mkv.readBlock(off, track)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				block.time += clusterTime
+				blocks = append(blocks, block)
+				if len(blocks) == want {
+					return blocks, nil
+				}
+			}
+		}
+		off += int64(n) + int64(size)
+	}
+	return blocks, nil
+}
+
+func matroskaSubtitleText(codec string, data []byte) string {
+	text := strings.TrimRight(string(data), "\x00")
+	switch codec {
+	case "srt":
+		return srtText(text)
+	case "ass", "ssa":
+		// ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+		fields := strings.SplitN(text, ",", 9)
+		if len(fields) != 9 {
+			return ""
+		}
+		return assText(fields[8])
+	}
+	return strings.TrimSpace(text)
+}
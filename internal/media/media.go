@@ -0,0 +1,179 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	gocache "github.com/OpenListTeam/go-cache"
+	"github.com/pkg/errors"
+)
+
+// Metadata is the information of the image, audio or video, the fields unknown are empty
+type Metadata struct {
+	Container  string  `json:"container,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Duration   float64 `json:"duration,omitempty"` // in seconds
+	VideoCodec string  `json:"video_codec,omitempty"`
+	AudioCodec string  `json:"audio_codec,omitempty"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+
+	// the tags of the audio
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Track       int    `json:"track,omitempty"`
+
+	// the exif of the image
+	CameraMake  string     `json:"camera_make,omitempty"`
+	CameraModel string     `json:"camera_model,omitempty"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Orientation int        `json:"orientation,omitempty"`
+
+	// the text subtitle tracks embedded in the video
+	Subtitles []SubtitleTrack `json:"subtitles,omitempty"`
+}
+
+// WithoutGPS returns a copy of the metadata without the gps coordinates
+func (m *Metadata) WithoutGPS() *Metadata {
+	ret := *m
+	ret.Latitude, ret.Longitude = nil, nil
+	return &ret
+}
+
+// Keywords returns the text of the metadata to be searched, the gps coordinates are included if gps is true
+func (m *Metadata) Keywords(gps bool) string {
+	var words []string
+	for _, s := range []string{m.Title, m.Artist, m.Album, m.AlbumArtist, m.Genre, m.CameraMake, m.CameraModel,
+		m.VideoCodec, m.AudioCodec} {
+		if s != "" {
+			words = append(words, s)
+		}
+	}
+	if m.Year != 0 {
+		words = append(words, strconv.Itoa(m.Year))
+	}
+	if m.TakenAt != nil {
+		words = append(words, m.TakenAt.Format("2006-01-02"))
+	}
+	if m.Width != 0 && m.Height != 0 {
+		words = append(words, fmt.Sprintf("%dx%d", m.Width, m.Height))
+	}
+	if gps && m.Latitude != nil && m.Longitude != nil {
+		words = append(words, fmt.Sprintf("%g,%g", *m.Latitude, *m.Longitude))
+	}
+	return strings.Join(words, " ")
+}
+
+// the headers larger than this are not read, they are broken files most likely
+const maxHeaderSize = 16 * 1024 * 1024
+
+// extractor fills the metadata by the file, only the bytes needed are read from the reader
+type extractor func(r io.ReaderAt, size int64, m *Metadata) error
+
+var extractors = map[string]extractor{
+	"jpg":  extractImage,
+	"jpeg": extractImage,
+	"png":  extractImage,
+	"gif":  extractImage,
+	"bmp":  extractImage,
+	"webp": extractImage,
+	"tif":  extractImage,
+	"tiff": extractImage,
+	"mp3":  extractAudio,
+	"flac": extractAudio,
+	"ogg":  extractAudio,
+	"oga":  extractAudio,
+	"opus": extractAudio,
+	"wav":  extractAudio,
+	"m4a":  extractMP4,
+	"m4b":  extractMP4,
+	"mp4":  extractMP4,
+	"m4v":  extractMP4,
+	"mov":  extractMP4,
+	"3gp":  extractMP4,
+	"mkv":  extractMatroska,
+	"mka":  extractMatroska,
+	"webm": extractMatroska,
+	"avi":  extractAVI,
+}
+
+// Enabled reports whether the metadata is returned by fs/get
+func Enabled() bool {
+	return setting.GetBool(conf.MediaMetadataEnabled)
+}
+
+// GPSEnabled reports whether the gps coordinates of the images are returned by fs/get and indexed
+func GPSEnabled() bool {
+	return setting.GetBool(conf.MediaMetadataGPS)
+}
+
+// Supported reports whether the metadata can be extracted from the object
+func Supported(obj model.Obj) bool {
+	if obj.IsDir() || obj.GetSize() == 0 {
+		return false
+	}
+	_, ok := extractors[utils.Ext(obj.GetName())]
+	return ok
+}
+
+var (
+	metadataCache = gocache.NewMemCache(gocache.WithShards[*Metadata](16))
+	metadataG     singleflight.Group[*Metadata]
+)
+
+// Get returns the metadata of the object at the path, which is cached until the object is changed
+func Get(ctx context.Context, path string, obj model.Obj) (*Metadata, error) {
+	extract, ok := extractors[utils.Ext(obj.GetName())]
+	if !ok || obj.IsDir() || obj.GetSize() == 0 {
+		return nil, errors.New("metadata is not supported for the file")
+	}
+	key := fmt.Sprintf("%s\x00%d\x00%d", path, obj.GetSize(), obj.ModTime().UnixNano())
+	if m, ok := metadataCache.Get(key); ok {
+		return m, nil
+	}
+	m, err, _ := metadataG.Do(key, func() (*Metadata, error) {
+		m := &Metadata{}
+		err := readObject(ctx, path, func(r io.ReaderAt, obj model.Obj) error {
+			return extract(r, obj.GetSize(), m)
+		})
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to extract metadata of %s", path)
+		}
+		metadataCache.Set(key, m, gocache.WithEx[*Metadata](24*time.Hour))
+		return m, nil
+	})
+	return m, err
+}
+
+// readObject reads the object at the path by the range requests
+func readObject(ctx context.Context, path string, fn func(r io.ReaderAt, obj model.Obj) error) error {
+	link, obj, err := fs.Link(ctx, path, model.LinkArgs{})
+	if err != nil {
+		return err
+	}
+	defer link.Close()
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Ctx: ctx, Obj: obj}, link)
+	if err != nil {
+		return err
+	}
+	defer ss.Close()
+	return fn(newRangeReaderAt(ss), obj)
+}
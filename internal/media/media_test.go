@@ -0,0 +1,182 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+	// the index of the ifd pointed by the entry
+	ifd int
+}
+
+func asciiEntry(tag uint16, s string) ifdEntry {
+	return ifdEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func rationalEntry(tag uint16, v ...uint32) ifdEntry {
+	var data []byte
+	for _, n := range v {
+		data = binary.LittleEndian.AppendUint32(data, n)
+	}
+	return ifdEntry{tag: tag, typ: 5, count: uint32(len(v) / 2), data: data}
+}
+
+// buildTIFF builds the little endian tiff with the ifds in order, the first one is the ifd0
+func buildTIFF(ifds ...[]ifdEntry) []byte {
+	order := binary.LittleEndian
+	offsets := make([]uint32, len(ifds))
+	off := uint32(8)
+	for i, ifd := range ifds {
+		offsets[i] = off
+		off += uint32(2 + 12*len(ifd) + 4)
+	}
+	out := append([]byte("II*\x00"), order.AppendUint32(nil, 8)...)
+	var extra []byte
+	for _, ifd := range ifds {
+		out = order.AppendUint16(out, uint16(len(ifd)))
+		for _, e := range ifd {
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, e.typ)
+			out = order.AppendUint32(out, e.count)
+			switch {
+			case e.ifd > 0:
+				out = order.AppendUint32(out, offsets[e.ifd])
+			case len(e.data) <= 4:
+				out = append(out, append(e.data, make([]byte, 4-len(e.data))...)...)
+			default:
+				out = order.AppendUint32(out, off+uint32(len(extra)))
+				extra = append(extra, e.data...)
+			}
+		}
+		out = order.AppendUint32(out, 0)
+	}
+	return append(out, extra...)
+}
+
+func testTIFF() []byte {
+	return buildTIFF(
+		[]ifdEntry{
+			asciiEntry(tagMake, "Canon"),
+			asciiEntry(tagModel, "EOS R5"),
+			{tag: tagOrientation, typ: 3, count: 1, data: []byte{6, 0}},
+			{tag: tagExifIFD, typ: 4, count: 1, ifd: 1},
+			{tag: tagGPSIFD, typ: 4, count: 1, ifd: 2},
+		},
+		[]ifdEntry{
+			asciiEntry(tagDateTimeOriginal, "2024:05:06 07:08:09"),
+			asciiEntry(tagOffsetTimeOriginal, "+02:00"),
+		},
+		[]ifdEntry{
+			asciiEntry(tagGPSLatitudeRef, "N"),
+			rationalEntry(tagGPSLatitude, 35, 1, 39, 1, 3000, 100),
+			asciiEntry(tagGPSLongitudeRef, "W"),
+			rationalEntry(tagGPSLongitude, 139, 1, 45, 1, 0, 1),
+		},
+	)
+}
+
+func testJPEG() []byte {
+	exif := append([]byte("Exif\x00\x00"), testTIFF()...)
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	b = binary.BigEndian.AppendUint16(b, uint16(2+len(exif)))
+	b = append(b, exif...)
+	// the baseline frame of 640x480 in one component, and the start of scan
+	b = append(b, 0xFF, 0xC0, 0, 11, 8, 0x01, 0xE0, 0x02, 0x80, 1, 1, 0x11, 0)
+	return append(b, 0xFF, 0xDA, 0, 8, 1, 1, 0, 0, 0x3F, 0)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(append(b, typ...), data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func testPNG() []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, 32)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 16)
+	ihdr = append(ihdr, 8, 0, 0, 0, 0)
+	return bytes.Join([][]byte{[]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr), pngChunk("eXIf", testTIFF()),
+		pngChunk("IEND", nil)}, nil)
+}
+
+// testMP3 has an id3v2.3 tag and one second of the mp3 in 128 kbps
+func testMP3() []byte {
+	var frames []byte
+	for _, f := range [][2]string{{"TIT2", "Song"}, {"TPE1", "Artist"}, {"TALB", "Album"}, {"TCON", "Rock"},
+		{"TYER", "2020"}, {"TRCK", "3/10"}} {
+		frames = append(frames, f[0]...)
+		frames = binary.BigEndian.AppendUint32(frames, uint32(1+len(f[1])))
+		frames = append(append(frames, 0, 0, 0), f[1]...)
+	}
+	n := len(frames)
+	b := append([]byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}, frames...)
+	audio := make([]byte, 16000)
+	copy(audio, []byte{0xFF, 0xFB, 0x90, 0x64})
+	return append(b, audio...)
+}
+
+func TestExtract(t *testing.T) {
+	lat, lon := 35.658333, -139.75
+	taken := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("", 2*3600))
+	exif := Metadata{CameraMake: "Canon", CameraModel: "EOS R5", Orientation: 6, TakenAt: &taken,
+		Latitude: &lat, Longitude: &lon}
+	withExif := func(container string, width, height int) Metadata {
+		m := exif
+		m.Container, m.Width, m.Height = container, width, height
+		return m
+	}
+	mp4, _ := testMP4()
+	mkv, _ := testMatroska()
+	tests := []struct {
+		ext  string
+		data []byte
+		want Metadata
+	}{
+		{ext: "jpg", data: testJPEG(), want: withExif("jpeg", 640, 480)},
+		{ext: "png", data: testPNG(), want: withExif("png", 32, 16)},
+		{ext: "mp3", data: testMP3(), want: Metadata{Container: "mp3", AudioCodec: "mp3", SampleRate: 44100,
+			Channels: 2, Duration: 1, Title: "Song", Artist: "Artist", Album: "Album", Genre: "Rock", Year: 2020, Track: 3}},
+		{ext: "mp4", data: mp4, want: Metadata{Container: "mp4", Duration: 3, VideoCodec: "h264", Width: 320, Height: 240,
+			Subtitles: []SubtitleTrack{{ID: 2, Codec: "mov_text", Language: "eng"}}}},
+		{ext: "mkv", data: mkv, want: Metadata{Container: "matroska", Duration: 4, VideoCodec: "vp9", Width: 640, Height: 360,
+			Subtitles: []SubtitleTrack{{ID: 2, Codec: "srt", Language: "ger", Name: "German"}}}},
+	}
+	for _, tt := range tests {
+		var m Metadata
+		if err := extractors[tt.ext](bytes.NewReader(tt.data), int64(len(tt.data)), &m); err != nil {
+			t.Errorf("failed to extract %s: %+v", tt.ext, err)
+			continue
+		}
+		if m.TakenAt != nil && tt.want.TakenAt != nil && m.TakenAt.Equal(*tt.want.TakenAt) {
+			m.TakenAt = tt.want.TakenAt
+		}
+		if !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("wrong metadata of %s: %+v", tt.ext, m)
+		}
+	}
+}
+
+func TestGPS(t *testing.T) {
+	lat, lon := 35.658333, -139.75
+	m := &Metadata{CameraMake: "Canon", Latitude: &lat, Longitude: &lon}
+	if got := m.Keywords(false); got != "Canon" {
+		t.Errorf("wrong keywords without gps: %s", got)
+	}
+	if got := m.Keywords(true); got != "Canon 35.658333,-139.75" {
+		t.Errorf("wrong keywords with gps: %s", got)
+	}
+	if c := m.WithoutGPS(); c.Latitude != nil || c.Longitude != nil || c.CameraMake != "Canon" {
+		t.Errorf("wrong metadata without gps: %+v", c)
+	}
+	if m.Latitude == nil {
+		t.Error("the original metadata is changed")
+	}
+}
@@ -0,0 +1,369 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// the moov box larger than this is not read
+const maxMoovSize = 64 * 1024 * 1024
+
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"alac": "alac",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"tx3g": "mov_text",
+	"wvtt": "webvtt",
+}
+
+// box is the box of mp4 or the chunk of riff
+type box struct {
+	typ  string
+	data []byte
+}
+
+// boxes splits the children boxes in the data
+func boxes(data []byte) []box {
+	var boxes []box
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		header := 8
+		if size == 1 && len(data) >= 16 {
+			size, header = int(binary.BigEndian.Uint64(data[8:])), 16
+		} else if size == 0 {
+			size = len(data)
+		}
+		if size < header || size > len(data) {
+			break
+		}
+		boxes = append(boxes, box{typ: string(data[4:8]), data: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+func findBox(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		found := false
+		for _, b := range boxes(data) {
+			if b.typ == typ {
+				data, found = b.data, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+// readMoov reads the moov box and the container by the ftyp box
+func readMoov(r io.ReaderAt, size int64) ([]byte, string, error) {
+	container := ""
+	for off := int64(0); off+8 <= size; {
+		b, err := readAt(r, off, int(min(16, size-off)))
+		if err != nil {
+			return nil, "", err
+		}
+		boxSize, header := int64(binary.BigEndian.Uint32(b)), int64(8)
+		typ := string(b[4:8])
+		if boxSize == 1 && len(b) == 16 {
+			boxSize, header = int64(binary.BigEndian.Uint64(b[8:])), 16
+		} else if boxSize == 0 {
+			boxSize = size - off
+		}
+		if boxSize < header {
+			return nil, "", errors.New("invalid mp4 box")
+		}
+		switch typ {
+		case "ftyp":
+			container = "mp4"
+			if len(b) >= 12 && string(b[8:12]) == "qt  " {
+				container = "mov"
+			}
+		case "moov":
+			if boxSize > maxMoovSize {
+				return nil, "", errors.New("mp4 moov box is too large")
+			}
+			moov, err := readAt(r, off+header, int(boxSize-header))
+			return moov, container, err
+		}
+		off += boxSize
+	}
+	return nil, "", errors.New("mp4 moov box not found")
+}
+
+// trackID returns the id of the trak in the tkhd box
+func trackID(trak []byte) int {
+	tkhd := findBox(trak, "tkhd")
+	if len(tkhd) >= 24 && tkhd[0] == 1 {
+		return int(binary.BigEndian.Uint32(tkhd[20:]))
+	} else if len(tkhd) >= 16 {
+		return int(binary.BigEndian.Uint32(tkhd[12:]))
+	}
+	return 0
+}
+
+// trackLanguage returns the iso 639-2 language in the mdhd box
+func trackLanguage(trak []byte) string {
+	mdhd := findBox(trak, "mdia", "mdhd")
+	i := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		i = 32
+	}
+	if len(mdhd) < i+2 {
+		return ""
+	}
+	v := binary.BigEndian.Uint16(mdhd[i:])
+	lang := []byte{byte(v>>10&0x1F) + 0x60, byte(v>>5&0x1F) + 0x60, byte(v&0x1F) + 0x60}
+	if lang[0] < 'a' || lang[0] > 'z' {
+		return ""
+	}
+	return string(lang)
+}
+
+func extractMP4(r io.ReaderAt, size int64, m *Metadata) error {
+	readTags(r, size, m)
+	moov, container, err := readMoov(r, size)
+	if container != "" {
+		m.Container = container
+	}
+	if err != nil {
+		return err
+	}
+	if mvhd := findBox(moov, "mvhd"); len(mvhd) >= 32 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 {
+			timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[20:])), binary.BigEndian.Uint64(mvhd[24:])
+		} else {
+			timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[12:])), uint64(binary.BigEndian.Uint32(mvhd[16:]))
+		}
+		if timescale > 0 {
+			m.Duration = float64(duration) / float64(timescale)
+		}
+	}
+	for _, b := range boxes(moov) {
+		if b.typ != "trak" {
+			continue
+		}
+		hdlr := findBox(b.data, "mdia", "hdlr")
+		stsd := findBox(b.data, "mdia", "minf", "stbl", "stsd")
+		if len(hdlr) < 12 || len(stsd) < 16 {
+			continue
+		}
+		// the first sample entry after the version, flags and the entry count
+		entry := stsd[8:]
+		format := string(entry[4:8])
+		codec, ok := mp4Codecs[format]
+		if !ok {
+			codec = format
+		}
+		switch string(hdlr[8:12]) {
+		case "vide":
+			if m.VideoCodec != "" {
+				continue
+			}
+			m.VideoCodec = codec
+			if len(entry) >= 36 {
+				m.Width = int(binary.BigEndian.Uint16(entry[32:]))
+				m.Height = int(binary.BigEndian.Uint16(entry[34:]))
+			}
+		case "sbtl", "text", "subt":
+			if subtitleCodecs[codec] {
+				m.Subtitles = append(m.Subtitles, SubtitleTrack{ID: trackID(b.data), Codec: codec, Language: trackLanguage(b.data)})
+			}
+		case "soun":
+			if m.AudioCodec != "" {
+				continue
+			}
+			m.AudioCodec = codec
+			if len(entry) >= 36 {
+				m.Channels = int(binary.BigEndian.Uint16(entry[24:]))
+				m.SampleRate = int(binary.BigEndian.Uint32(entry[32:]) >> 16)
+			}
+		}
+	}
+	return nil
+}
+
+// the samples more than this are not read
+const maxSubtitleSamples = 100000
+
+// the subtitle samples closer than the gap are read by one request, unless the request is larger than the span
+const (
+	maxSampleGap  = 256 * 1024
+	maxSampleSpan = 4 * 1024 * 1024
+)
+
+type mp4Sample struct {
+	offset, size int64
+	start, end   uint64
+}
+
+// mp4SubtitleCues reads the samples of the subtitle track by the sample tables
+func mp4SubtitleCues(r io.ReaderAt, size int64, id int, codec string) ([]cue, error) {
+	moov, _, err := readMoov(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var trak []byte
+	for _, b := range boxes(moov) {
+		if b.typ == "trak" && trackID(b.data) == id {
+			trak = b.data
+		}
+	}
+	if trak == nil {
+		return nil, errors.New("mp4 track not found")
+	}
+	var timescale uint64
+	if mdhd := findBox(trak, "mdia", "mdhd"); len(mdhd) >= 24 && mdhd[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(mdhd[20:]))
+	} else if len(mdhd) >= 16 {
+		timescale = uint64(binary.BigEndian.Uint32(mdhd[12:]))
+	}
+	if timescale == 0 {
+		return nil, errors.New("invalid mp4 timescale")
+	}
+	stbl := findBox(trak, "mdia", "minf", "stbl")
+	offsets, sizes, err := mp4SampleOffsets(stbl)
+	if err != nil {
+		return nil, err
+	}
+	stts := findBox(stbl, "stts")
+	if len(stts) < 8 {
+		return nil, errors.New("invalid mp4 stts box")
+	}
+	var samples []mp4Sample
+	var t uint64
+	i := 0
+	for e, n := 0, int(binary.BigEndian.Uint32(stts[4:])); e < n && 8+e*8+8 <= len(stts); e++ {
+		count := int(binary.BigEndian.Uint32(stts[8+e*8:]))
+		delta := uint64(binary.BigEndian.Uint32(stts[8+e*8+4:]))
+		for j := 0; j < count && i < len(offsets); j, i = j+1, i+1 {
+			start, end := t, t+delta
+			t = end
+			// the empty samples are the gaps between the subtitles
+			if sizes[i] <= 2 || sizes[i] > 64*1024 || offsets[i]+sizes[i] > size {
+				continue
+			}
+			samples = append(samples, mp4Sample{offset: offsets[i], size: sizes[i], start: start, end: end})
+		}
+	}
+	var cues []cue
+	for i := 0; i < len(samples); {
+		start, end := samples[i].offset, samples[i].offset+samples[i].size
+		j := i + 1
+		for ; j < len(samples); j++ {
+			s := samples[j]
+			if s.offset < start || s.offset > end+maxSampleGap || s.offset+s.size-start > maxSampleSpan {
+				break
+			}
+			end = max(end, s.offset+s.size)
+		}
+		data, err := readAt(r, start, int(end-start))
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range samples[i:j] {
+			text := mp4SubtitleText(codec, data[s.offset-start:s.offset-start+s.size])
+			if text == "" {
+				continue
+			}
+			cues = append(cues, cue{
+				start: time.Duration(s.start * uint64(time.Second) / timescale),
+				end:   time.Duration(s.end * uint64(time.Second) / timescale),
+				text:  text,
+			})
+		}
+		i = j
+	}
+	return cues, nil
+}
+
+// mp4SampleOffsets returns the offsets and the sizes of the samples by the stsz, stsc and stco boxes
+func mp4SampleOffsets(stbl []byte) ([]int64, []int64, error) {
+	stsz, stsc := findBox(stbl, "stsz"), findBox(stbl, "stsc")
+	if len(stsz) < 12 || len(stsc) < 8 {
+		return nil, nil, errors.New("invalid mp4 sample table")
+	}
+	count := int(binary.BigEndian.Uint32(stsz[8:]))
+	if count > maxSubtitleSamples {
+		return nil, nil, errors.New("too many mp4 samples")
+	}
+	sizes := make([]int64, count)
+	for i := range sizes {
+		if sampleSize := binary.BigEndian.Uint32(stsz[4:]); sampleSize != 0 {
+			sizes[i] = int64(sampleSize)
+		} else if 12+i*4+4 <= len(stsz) {
+			sizes[i] = int64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+		}
+	}
+	var chunks []int64
+	if stco := findBox(stbl, "stco"); len(stco) >= 8 {
+		for i, n := 0, int(binary.BigEndian.Uint32(stco[4:])); i < n && 8+i*4+4 <= len(stco); i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(stco[8+i*4:])))
+		}
+	} else if co64 := findBox(stbl, "co64"); len(co64) >= 8 {
+		for i, n := 0, int(binary.BigEndian.Uint32(co64[4:])); i < n && 8+i*8+8 <= len(co64); i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(co64[8+i*8:])))
+		}
+	}
+	offsets := make([]int64, 0, count)
+	entries := int(binary.BigEndian.Uint32(stsc[4:]))
+	for e := 0; e < entries && 8+e*12+12 <= len(stsc); e++ {
+		// the chunks from the first chunk of the entry to the first chunk of the next entry
+		first := int(binary.BigEndian.Uint32(stsc[8+e*12:]))
+		perChunk := int(binary.BigEndian.Uint32(stsc[8+e*12+4:]))
+		last := len(chunks)
+		if e+1 < entries && 8+(e+1)*12+4 <= len(stsc) {
+			last = int(binary.BigEndian.Uint32(stsc[8+(e+1)*12:])) - 1
+		}
+		for c := first; c <= last && c <= len(chunks) && c >= 1; c++ {
+			off := chunks[c-1]
+			for s := 0; s < perChunk && len(offsets) < count; s++ {
+				offsets = append(offsets, off)
+				off += sizes[len(offsets)-1]
+			}
+		}
+	}
+	return offsets, sizes[:len(offsets)], nil
+}
+
+func mp4SubtitleText(codec string, data []byte) string {
+	switch codec {
+	case "mov_text":
+		// the length of the text, the style boxes follow the text
+		n := int(binary.BigEndian.Uint16(data))
+		if n == 0 || 2+n > len(data) {
+			return ""
+		}
+		return srtText(decodeText(data[2 : 2+n]))
+	case "webvtt":
+		var lines []string
+		for _, b := range boxes(data) {
+			if b.typ == "vttc" {
+				if payload := findBox(b.data, "payl"); payload != nil {
+					lines = append(lines, string(payload))
+				}
+			}
+		}
+		return strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	return ""
+}
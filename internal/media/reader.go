@@ -0,0 +1,105 @@
+package media
+
+import (
+	"io"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+const (
+	blockSize = 64 * 1024
+	maxBlocks = 64
+)
+
+// rangeReaderAt reads the aligned blocks of the file by bounded range requests,
+// so only the bytes needed by the extractors are downloaded
+type rangeReaderAt struct {
+	ss     *stream.SeekableStream
+	size   int64
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func newRangeReaderAt(ss *stream.SeekableStream) *rangeReaderAt {
+	return &rangeReaderAt{ss: ss, size: ss.GetSize(), blocks: make(map[int64][]byte)}
+}
+
+func (r *rangeReaderAt) block(index int64) ([]byte, error) {
+	if b, ok := r.blocks[index]; ok {
+		return b, nil
+	}
+	start := index * blockSize
+	length := min(int64(blockSize), r.size-start)
+	rr, err := r.ss.RangeRead(http_range.Range{Start: start, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, length)
+	if _, err = io.ReadFull(rr, b); err != nil {
+		return nil, err
+	}
+	if len(r.order) >= maxBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[index] = b
+	r.order = append(r.order, index)
+	return b, nil
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= r.size {
+		return 0, io.EOF
+	}
+	// the large reads are done by one request without the blocks
+	if len(p) > blockSize {
+		return r.readRange(p, off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) && off < r.size {
+		b, err := r.block(off / blockSize)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], b[off%blockSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rangeReaderAt) readRange(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	length := min(int64(len(p)), r.size-off)
+	rr, err := r.ss.RangeRead(http_range.Range{Start: off, Length: length})
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(rr, p[:length])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAt reads n bytes at the offset, io.ErrUnexpectedEOF is returned if the file is shorter
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if m == n {
+		return b, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
@@ -0,0 +1,408 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	gocache "github.com/OpenListTeam/go-cache"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// SubtitleTrack is a text subtitle track embedded in the video, the id is the track number of the container
+type SubtitleTrack struct {
+	ID       int    `json:"id"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// the codecs of the embedded subtitles which can be converted to webvtt
+var subtitleCodecs = map[string]bool{
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"mov_text": true,
+}
+
+var subtitleExts = []string{"srt", "ass", "ssa", "vtt", "sub"}
+
+// IsSubtitle reports whether the file is a subtitle which can be converted to webvtt
+func IsSubtitle(name string) bool {
+	return utils.SliceContains(subtitleExts, utils.Ext(name))
+}
+
+type cue struct {
+	start, end time.Duration
+	text       string
+}
+
+var (
+	vttCache = gocache.NewMemCache(gocache.WithShards[[]byte](16))
+	vttG     singleflight.Group[[]byte]
+)
+
+func cachedVTT(path string, obj model.Obj, track int, fn func() ([]byte, error)) ([]byte, error) {
+	key := fmt.Sprintf("%s\x00%d\x00%d\x00%d", path, obj.GetSize(), obj.ModTime().UnixNano(), track)
+	if vtt, ok := vttCache.Get(key); ok {
+		return vtt, nil
+	}
+	vtt, err, _ := vttG.Do(key, func() ([]byte, error) {
+		vtt, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		vttCache.Set(key, vtt, gocache.WithEx[[]byte](24*time.Hour))
+		return vtt, nil
+	})
+	return vtt, err
+}
+
+// SubtitleVTT converts the subtitle file to webvtt
+func SubtitleVTT(ctx context.Context, path string, obj model.Obj) ([]byte, error) {
+	if !IsSubtitle(obj.GetName()) {
+		return nil, errors.New("not a subtitle file")
+	}
+	if obj.GetSize() > maxHeaderSize {
+		return nil, errors.New("the subtitle file is too large")
+	}
+	return cachedVTT(path, obj, -1, func() ([]byte, error) {
+		var data []byte
+		err := readObject(ctx, path, func(r io.ReaderAt, obj model.Obj) (err error) {
+			data, err = readAt(r, 0, int(obj.GetSize()))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ToVTT(obj.GetName(), data)
+	})
+}
+
+// EmbeddedSubtitleVTT extracts the subtitle track embedded in the video and converts it to webvtt,
+// only the blocks of the track are read if the video has the index of them
+func EmbeddedSubtitleVTT(ctx context.Context, path string, obj model.Obj, track int) ([]byte, error) {
+	m, err := Get(ctx, path, obj)
+	if err != nil {
+		return nil, err
+	}
+	var t *SubtitleTrack
+	for i := range m.Subtitles {
+		if m.Subtitles[i].ID == track {
+			t = &m.Subtitles[i]
+		}
+	}
+	if t == nil {
+		return nil, errors.WithMessagef(errs.ObjectNotFound, "subtitle track %d", track)
+	}
+	return cachedVTT(path, obj, track, func() ([]byte, error) {
+		var cues []cue
+		err := readObject(ctx, path, func(r io.ReaderAt, obj model.Obj) (err error) {
+			if m.Container == "mp4" || m.Container == "mov" {
+				cues, err = mp4SubtitleCues(r, obj.GetSize(), t.ID, t.Codec)
+				return err
+			}
+			mkv, err := openMatroska(r, obj.GetSize())
+			if err != nil {
+				return err
+			}
+			cues, err = mkv.subtitleCues(uint64(t.ID), t.Codec)
+			return err
+		})
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to extract subtitle track %d of %s", track, path)
+		}
+		return writeVTT(cues), nil
+	})
+}
+
+// ToVTT converts the subtitle in srt, ass, ssa, microdvd or webvtt to webvtt by the extension of the name
+func ToVTT(name string, data []byte) ([]byte, error) {
+	text := strings.ReplaceAll(decodeText(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	switch utils.Ext(name) {
+	case "vtt":
+		if !strings.HasPrefix(text, "WEBVTT") {
+			return nil, errors.New("invalid webvtt file")
+		}
+		return []byte(text), nil
+	case "srt":
+		return writeVTT(parseSRT(text)), nil
+	case "ass", "ssa":
+		return writeVTT(parseASS(text)), nil
+	case "sub":
+		cues, err := parseMicroDVD(text)
+		if err != nil {
+			return nil, err
+		}
+		return writeVTT(cues), nil
+	}
+	return nil, errors.New("not a subtitle file")
+}
+
+// decodeText decodes the subtitle in utf-8 or utf-16 with the bom, or in the encoding of the setting
+func decodeText(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) ||
+		bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) {
+		if s, _, err := transform.Bytes(unicode.BOMOverride(unicode.UTF8.NewDecoder()), data); err == nil {
+			return string(s)
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if enc, err := ianaindex.IANA.Encoding(setting.GetStr(conf.SubtitleEncoding)); err == nil && enc != nil {
+		if s, _, err := transform.Bytes(enc.NewDecoder(), data); err == nil {
+			return string(s)
+		}
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+func writeVTT(cues []cue) []byte {
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n\n")
+	for i, c := range cues {
+		if c.text == "" {
+			continue
+		}
+		// the cues without the end last until the next one
+		if c.end <= c.start {
+			c.end = c.start + 5*time.Second
+			if i+1 < len(cues) && cues[i+1].start > c.start {
+				c.end = min(c.end, cues[i+1].start)
+			}
+		}
+		buf.WriteString(fmt.Sprintf("%s --> %s\n%s\n\n", vttTime(c.start), vttTime(c.end), c.text))
+	}
+	return buf.Bytes()
+}
+
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// parseTime parses the time like 01:02:03,456 of srt, 0:01:02.34 of ass or 01:02.345 of webvtt
+func parseTime(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var d time.Duration
+	for _, p := range parts[:len(parts)-1] {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, false
+		}
+		d = d*60 + time.Duration(v)
+	}
+	d *= time.Minute
+	sec, frac, _ := strings.Cut(strings.ReplaceAll(parts[len(parts)-1], ",", "."), ".")
+	v, err := strconv.Atoi(sec)
+	if err != nil {
+		return 0, false
+	}
+	d += time.Duration(v) * time.Second
+	if frac != "" {
+		frac = (frac + "00")[:3]
+		v, err = strconv.Atoi(frac)
+		if err != nil {
+			return 0, false
+		}
+		d += time.Duration(v) * time.Millisecond
+	}
+	return d, true
+}
+
+func parseSRT(text string) []cue {
+	var cues []cue
+	var c *cue
+	var lines []string
+	flush := func() {
+		if c != nil {
+			c.text = srtText(strings.Join(lines, "\n"))
+			cues = append(cues, *c)
+		}
+		c, lines = nil, nil
+	}
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if from, to, ok := strings.Cut(line, "-->"); ok {
+			// the coordinates may follow the end time
+			to, _, _ = strings.Cut(strings.TrimSpace(to), " ")
+			start, ok1 := parseTime(from)
+			end, ok2 := parseTime(to)
+			if ok1 && ok2 {
+				flush()
+				c = &cue{start: start, end: end}
+				continue
+			}
+		}
+		if line == "" {
+			flush()
+			continue
+		}
+		if c != nil {
+			lines = append(lines, line)
+		}
+	}
+	flush()
+	return cues
+}
+
+var (
+	assOverride = regexp.MustCompile(`\{[^}]*\}`)
+	htmlTag     = regexp.MustCompile(`</?([a-zA-Z]+)[^>]*>`)
+)
+
+// srtText keeps the tags supported by webvtt and escapes the others
+func srtText(s string) string {
+	s = assOverride.ReplaceAllString(s, "")
+	var sb strings.Builder
+	last := 0
+	for _, m := range htmlTag.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(escapeVTT(s[last:m[0]]))
+		switch tag := strings.ToLower(s[m[2]:m[3]]); tag {
+		case "b", "i", "u":
+			if s[m[0]+1] == '/' {
+				sb.WriteString("</" + tag + ">")
+			} else {
+				sb.WriteString("<" + tag + ">")
+			}
+		}
+		last = m[1]
+	}
+	sb.WriteString(escapeVTT(s[last:]))
+	return strings.TrimSpace(sb.String())
+}
+
+func escapeVTT(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	return strings.ReplaceAll(s, ">", "&gt;")
+}
+
+var assDrawing = regexp.MustCompile(`\\p[1-9]`)
+
+// assText removes the override tags of ass, the drawings are dropped
+func assText(s string) string {
+	for _, o := range assOverride.FindAllString(s, -1) {
+		if assDrawing.MatchString(o) {
+			return ""
+		}
+	}
+	s = assOverride.ReplaceAllString(s, "")
+	s = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(s)
+	return strings.TrimSpace(escapeVTT(s))
+}
+
+func parseASS(text string) []cue {
+	var cues []cue
+	inEvents := false
+	// the default format of the events
+	start, end, textField, fields := 1, 2, 9, 10
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Format":
+			names := strings.Split(value, ",")
+			fields = len(names)
+			for i, name := range names {
+				switch strings.TrimSpace(name) {
+				case "Start":
+					start = i
+				case "End":
+					end = i
+				case "Text":
+					textField = i
+				}
+			}
+		case "Dialogue":
+			values := strings.SplitN(value, ",", fields)
+			if len(values) != fields || max(start, end, textField) >= fields {
+				continue
+			}
+			t1, ok1 := parseTime(values[start])
+			t2, ok2 := parseTime(values[end])
+			if ok1 && ok2 {
+				cues = append(cues, cue{start: t1, end: t2, text: assText(values[textField])})
+			}
+		}
+	}
+	return cues
+}
+
+var microDVDLine = regexp.MustCompile(`^\{(\d+)\}\{(\d*)\}(.*)$`)
+
+// parseMicroDVD parses the subtitle timed by the frames, the frame rate is in the first line or 23.976 by default
+func parseMicroDVD(text string) ([]cue, error) {
+	var cues []cue
+	fps := 23.976
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Buffer(nil, 1024*1024)
+	for i := 0; s.Scan(); i++ {
+		m := microDVDLine.FindStringSubmatch(strings.TrimSpace(s.Text()))
+		if m == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		end, _ := strconv.Atoi(m[2])
+		if i == 0 && start <= 1 && end <= 1 {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(m[3]), 64); err == nil && v > 0 {
+				fps = v
+				continue
+			}
+		}
+		c := cue{start: frameTime(start, fps), text: srtText(strings.ReplaceAll(m[3], "|", "\n"))}
+		if m[2] != "" {
+			c.end = frameTime(end, fps)
+		}
+		cues = append(cues, c)
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("not a microdvd subtitle")
+	}
+	return cues, nil
+}
+
+func frameTime(frame int, fps float64) time.Duration {
+	return time.Duration(float64(frame) / fps * float64(time.Second))
+}
@@ -0,0 +1,266 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestToVTT(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "a.srt",
+			input: "1\r\n00:00:01,000 --> 00:00:02,500\r\nHello <b>world</b>\r\n\r\n" +
+				"2\r\n00:00:03,000 --> 00:00:04,000 X1:10\r\n<font color=\"red\">a & b</font>\r\nline2\r\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello <b>world</b>\n\n" +
+				"00:00:03.000 --> 00:00:04.000\na &amp; b\nline2\n\n",
+		},
+		{
+			name:  "bom.srt",
+			input: "\xEF\xBB\xBF1\n00:01:00,100 --> 00:01:01,000\nbom\n",
+			want:  "WEBVTT\n\n00:01:00.100 --> 00:01:01.000\nbom\n\n",
+		},
+		{
+			name: "a.ass",
+			input: "[Script Info]\nTitle: test\n\n[Events]\n" +
+				"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\p1}m 0 0 l 10 10{\\p0}\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\\i1}Hello{\\i0}\\Nworld, <again>\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\nworld, &lt;again&gt;\n\n",
+		},
+		{
+			name:  "a.sub",
+			input: "{1}{1}25\n{25}{50}Hello|<i>world</i>\n{100}{}Last\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n<i>world</i>\n\n00:00:04.000 --> 00:00:09.000\nLast\n\n",
+		},
+		{
+			name:  "a.vtt",
+			input: "WEBVTT\r\n\r\n00:01.000 --> 00:02.000\r\nHi\r\n",
+			want:  "WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := ToVTT(tt.name, []byte(tt.input))
+		if err != nil {
+			t.Errorf("failed to convert %s: %+v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("wrong webvtt of %s:\n%q\nwant:\n%q", tt.name, got, tt.want)
+		}
+	}
+	for _, name := range []string{"bad.vtt", "bad.sub", "a.txt"} {
+		if _, err := ToVTT(name, []byte("not a subtitle")); err == nil {
+			t.Errorf("no error for %s", name)
+		}
+	}
+}
+
+// readRecorder records the reads of the data
+type readRecorder struct {
+	data []byte
+	mu   sync.Mutex
+	offs []int64
+}
+
+func (r *readRecorder) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	r.offs = append(r.offs, off)
+	r.mu.Unlock()
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+func u32(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+func mp4Box(typ string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	return append(append(u32(uint32(8+len(body))), typ...), body...)
+}
+
+// mp4Trak builds the track with the sample entry of the format and the sample tables
+func mp4Trak(id uint32, handler, format string, entry []byte, stbl ...[]byte) []byte {
+	// eng in iso 639-2
+	lang := uint32('e'-0x60)<<10 | uint32('n'-0x60)<<5 | uint32('g'-0x60)
+	return mp4Box("trak",
+		mp4Box("tkhd", u32(0, 0, 0, id, 0)),
+		mp4Box("mdia",
+			mp4Box("mdhd", u32(0, 0, 0, 1000, 3000, lang<<16)),
+			mp4Box("hdlr", u32(0, 0), []byte(handler), make([]byte, 13)),
+			mp4Box("minf", mp4Box("stbl", append([][]byte{
+				mp4Box("stsd", u32(0, 1), mp4Box(format, entry)),
+			}, stbl...)...)),
+		),
+	)
+}
+
+// testMP4 has a h264 video track and a mov_text track, the subtitle samples are in two groups far away
+func testMP4() ([]byte, []int64) {
+	samples := [][]byte{{0, 0}, append([]byte{0, 5}, "hello"...), {0, 0}, append([]byte{0, 12}, "<i>world</i>"...)}
+	chunks := []int64{0, 100, 400000, 400100}
+	video := make([]byte, 28)
+	binary.BigEndian.PutUint16(video[24:], 320)
+	binary.BigEndian.PutUint16(video[26:], 240)
+	build := func(mdat int64) []byte {
+		var sizes, offsets []uint32
+		for i, s := range samples {
+			sizes = append(sizes, uint32(len(s)))
+			offsets = append(offsets, uint32(mdat+chunks[i]))
+		}
+		return mp4Box("moov",
+			mp4Box("mvhd", u32(0, 0, 0, 1000, 3000), make([]byte, 80)),
+			mp4Trak(1, "vide", "avc1", video),
+			mp4Trak(2, "sbtl", "tx3g", make([]byte, 40),
+				mp4Box("stts", u32(0, 4, 1, 500, 1, 1000, 1, 500, 1, 1000)),
+				mp4Box("stsc", u32(0, 1, 1, 1, 1)),
+				mp4Box("stsz", u32(0, 0, 4), u32(sizes...)),
+				mp4Box("stco", u32(0, 4), u32(offsets...)),
+			),
+		)
+	}
+	ftyp := mp4Box("ftyp", []byte("isom"), u32(0))
+	mdat := int64(len(ftyp)+len(build(0))) + 8
+	data := make([]byte, chunks[len(chunks)-1]+100)
+	var offsets []int64
+	for i, s := range samples {
+		copy(data[chunks[i]:], s)
+		offsets = append(offsets, mdat+chunks[i])
+	}
+	return bytes.Join([][]byte{ftyp, build(mdat), mp4Box("mdat", data)}, nil), offsets
+}
+
+func TestMP4Subtitles(t *testing.T) {
+	data, samples := testMP4()
+	r := &readRecorder{data: data}
+	var m Metadata
+	if err := extractMP4(r, int64(len(data)), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{Container: "mp4", Duration: 3, VideoCodec: "h264", Width: 320, Height: 240,
+		Subtitles: []SubtitleTrack{{ID: 2, Codec: "mov_text", Language: "eng"}}}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("wrong metadata: %+v", m)
+	}
+	r.offs = nil
+	cues, err := mp4SubtitleCues(r, int64(len(data)), 2, "mov_text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vtt := "WEBVTT\n\n00:00:00.500 --> 00:00:01.500\nhello\n\n00:00:02.000 --> 00:00:03.000\n<i>world</i>\n\n"
+	if got := string(writeVTT(cues)); got != vtt {
+		t.Errorf("wrong cues: %q", got)
+	}
+	// the samples close to each other are read together
+	var reads []int64
+	for _, off := range r.offs {
+		if off >= samples[0] {
+			reads = append(reads, off)
+		}
+	}
+	if !reflect.DeepEqual(reads, []int64{samples[1], samples[3]}) {
+		t.Errorf("wrong reads of the samples: %v", reads)
+	}
+}
+
+func ebml(id uint64, data ...[]byte) []byte {
+	var b []byte
+	for v := id; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	body := bytes.Join(data, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	// the size in 8 bytes
+	size[0] = 0x01
+	return append(append(b, size...), body...)
+}
+
+func ebmlU(id, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return ebml(id, b)
+}
+
+// blockData builds the data of the block of the track with the timecode relative to the cluster
+func blockData(track byte, timecode int16, data string) []byte {
+	return append([]byte{0x80 | track, byte(timecode >> 8), byte(timecode), 0}, data...)
+}
+
+// testMatroska has a vp9 video track and a srt track, the subtitle in the first cluster is indexed
+// by the relative position, and the one in the second cluster is indexed by the cluster only
+func testMatroska() ([]byte, int64) {
+	head := ebml(ebmlHeader, ebml(ebmlDocType, []byte("matroska")))
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, 0x40AF400000000000) // 4000.0
+	info := ebml(mkvInfo, ebmlU(mkvTimecodeScale, 1000000), ebml(mkvDuration, duration))
+	tracks := ebml(mkvTracks,
+		ebml(mkvTrackEntry, ebmlU(mkvTrackNumber, 1), ebmlU(mkvTrackType, 1), ebml(mkvCodecID, []byte("V_VP9")),
+			ebml(mkvVideo, ebmlU(mkvPixelWidth, 640), ebmlU(mkvPixelHeight, 360))),
+		ebml(mkvTrackEntry, ebmlU(mkvTrackNumber, 2), ebmlU(mkvTrackType, 17), ebml(mkvCodecID, []byte("S_TEXT/UTF8")),
+			ebml(mkvLanguage, []byte("ger")), ebml(mkvName, []byte("German"))),
+	)
+	firstBlock := ebml(mkvSimpleBlock, blockData(1, 0, "video"))
+	cluster1 := ebml(mkvCluster, ebmlU(mkvClusterTime, 0), firstBlock,
+		ebml(mkvBlockGroup, ebml(mkvBlock, blockData(2, 1000, "first")), ebmlU(mkvBlockDuration, 500)))
+	lastBlock := ebml(mkvSimpleBlock, blockData(1, 500, "video"))
+	cluster2 := ebml(mkvCluster, ebmlU(mkvClusterTime, 3000),
+		ebml(mkvBlockGroup, ebml(mkvBlock, blockData(2, 0, "<b>second</b>")), ebmlU(mkvBlockDuration, 500)), lastBlock)
+	cues := func(pos1, rel, pos2 uint64) []byte {
+		return ebml(mkvCues,
+			ebml(mkvCuePoint, ebmlU(mkvCueTime, 1000),
+				ebml(mkvCuePositions, ebmlU(mkvCueTrack, 2), ebmlU(mkvCueCluster, pos1), ebmlU(mkvCueRelative, rel))),
+			ebml(mkvCuePoint, ebmlU(mkvCueTime, 3000),
+				ebml(mkvCuePositions, ebmlU(mkvCueTrack, 2), ebmlU(mkvCueCluster, pos2))),
+		)
+	}
+	pos1 := uint64(len(info) + len(tracks) + len(cues(0, 0, 0)))
+	pos2 := pos1 + uint64(len(cluster1))
+	rel := uint64(len(ebmlU(mkvClusterTime, 0)) + len(firstBlock))
+	segment := ebml(mkvSegment, info, tracks, cues(pos1, rel, pos2), cluster1, cluster2)
+	data := append(head, segment...)
+	return data, int64(len(data) - len(lastBlock))
+}
+
+func TestMatroskaSubtitles(t *testing.T) {
+	data, last := testMatroska()
+	r := &readRecorder{data: data}
+	var m Metadata
+	if err := extractMatroska(r, int64(len(data)), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{Container: "matroska", Duration: 4, VideoCodec: "vp9", Width: 640, Height: 360,
+		Subtitles: []SubtitleTrack{{ID: 2, Codec: "srt", Language: "ger", Name: "German"}}}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("wrong metadata: %+v", m)
+	}
+	mkv, err := openMatroska(r, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.offs = nil
+	cues, err := mkv.subtitleCues(2, "srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vtt := "WEBVTT\n\n00:00:01.000 --> 00:00:01.500\nfirst\n\n00:00:03.000 --> 00:00:03.500\n<b>second</b>\n\n"
+	if got := string(writeVTT(cues)); got != vtt {
+		t.Errorf("wrong cues: %q", got)
+	}
+	// the scan of the second cluster stops at the indexed subtitle
+	for _, off := range r.offs {
+		if off >= last {
+			t.Errorf("the block after the subtitle is read at %d", off)
+		}
+	}
+}
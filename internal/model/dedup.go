@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// DedupEntry is a file or folder of a Dedup storage, the data of the file is the blob of Hash
+type DedupEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StorageID uint      `json:"storage_id" gorm:"index"`
+	Parent    string    `json:"parent" gorm:"index"`
+	Name      string    `json:"name"`
+	IsDir     bool      `json:"is_dir"`
+	Hash      string    `json:"hash" gorm:"size:64;index"`
+	Size      int64     `json:"size"`
+	Modified  time.Time `json:"modified"`
+	Created   time.Time `json:"created"`
+}
+
+// DedupBlob is the data stored once for all the entries of the same SHA-256
+type DedupBlob struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	StorageID uint   `json:"storage_id" gorm:"index"`
+	Hash      string `json:"hash" gorm:"size:64;index"`
+	Size      int64  `json:"size"`
+	RefCount  int64  `json:"ref_count"`
+}
+
+type DedupStats struct {
+	Files       int64 `json:"files"`
+	Dirs        int64 `json:"dirs"`
+	LogicalSize int64 `json:"logical_size"`
+	Blobs       int64 `json:"blobs"`
+	StoredSize  int64 `json:"stored_size"`
+	SavedSize   int64 `json:"saved_size"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type Feed struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" binding:"required"`
+	URL          string     `json:"url" binding:"required"`
+	Interval     int        `json:"interval"` // minutes between the polls
+	Include      string     `json:"include"`  // regexp matching the titles of the items to download
+	Exclude      string     `json:"exclude"`  // regexp matching the titles of the items to skip
+	DstDir       string     `json:"dst_dir" binding:"required"`
+	Tool         string     `json:"tool" binding:"required"`
+	DeletePolicy string     `json:"delete_policy"`
+	Disabled     bool       `json:"disabled"`
+	CreatorId    uint       `json:"creator_id"` // the tasks are created as the creator
+	LastCheckAt  *time.Time `json:"last_check_at"`
+	LastError    string     `json:"last_error" gorm:"type:text"`
+}
+
+// FeedItem is an item of the feed which has been enqueued, the failed ones are retried on the next poll
+type FeedItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	FeedID    uint      `json:"feed_id" gorm:"uniqueIndex:idx_feed_item_guid"`
+	GUID      string    `json:"guid" gorm:"uniqueIndex:idx_feed_item_guid;size:512"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url" gorm:"type:text"`
+	TaskID    string    `json:"task_id"`
+	Error     string    `json:"error" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
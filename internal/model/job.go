@@ -0,0 +1,72 @@
+package model
+
+import "time"
+
+const (
+	JobCopy            = "copy"
+	JobMerge           = "merge"
+	JobSync            = "sync"
+	JobIndexBuild      = "index_build"
+	JobIndexUpdate     = "index_update"
+	JobScan            = "scan"
+	JobOfflineDownload = "offline_download"
+)
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+	JobRunSkipped   = "skipped"
+)
+
+type Job struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" binding:"required"`
+	Cron      string     `json:"cron" binding:"required"`
+	Type      string     `json:"type" binding:"required"`
+	Args      string     `json:"args" gorm:"type:text"` // json args of the job type
+	Disabled  bool       `json:"disabled"`
+	CreatorId uint       `json:"creator_id"` // the job is run as the creator
+	LastRunAt *time.Time `json:"last_run_at"`
+	LastState string     `json:"last_state"`
+	NextRunAt *time.Time `json:"next_run_at" gorm:"-"`
+}
+
+type JobRun struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	JobID      uint       `json:"job_id" gorm:"index"`
+	Manual     bool       `json:"manual"`
+	State      string     `json:"state"`
+	Message    string     `json:"message" gorm:"type:text"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+type JobCopyArgs struct {
+	SrcPaths []string `json:"src_paths"`
+	DstDir   string   `json:"dst_dir"`
+}
+
+type JobSyncArgs struct {
+	SrcDir   string `json:"src_dir"`
+	DstDir   string `json:"dst_dir"`
+	Mode     string `json:"mode"`
+	Conflict string `json:"conflict"`
+}
+
+type JobIndexArgs struct {
+	Paths    []string `json:"paths"`
+	MaxDepth int      `json:"max_depth"`
+}
+
+type JobScanArgs struct {
+	Path  string  `json:"path"`
+	Limit float64 `json:"limit"`
+}
+
+type JobOfflineDownloadArgs struct {
+	Urls         []string `json:"urls"`
+	DstDir       string   `json:"dst_dir"`
+	Tool         string   `json:"tool"`
+	DeletePolicy string   `json:"delete_policy"`
+}
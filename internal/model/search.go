@@ -25,6 +25,8 @@ type SearchNode struct {
 	Name   string `json:"name"`
 	IsDir  bool   `json:"is_dir"`
 	Size   int64  `json:"size"`
+	// the keywords of the media metadata, empty if it's not indexed
+	Media string `json:"media"`
 }
 
 func (p *SearchReq) Validate() error {
@@ -1,12 +1,36 @@
 package model
 
-import "time"
+import (
+	"crypto/subtle"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/OpenListTeam/go-cache"
+	"github.com/pkg/errors"
+)
+
+// MaskedSharingPwd is returned instead of the password of a sharing,
+// updating a sharing with it keeps the password unchanged
+const MaskedSharingPwd = "********"
+
+// SharingAuthCache counts the failed password attempts of client ips and sharings
+var SharingAuthCache = cache.NewMemCache[int]()
+
+var (
+	DefaultMaxSharingAuthRetries           = 5
+	DefaultMaxSharingAuthRetriesPerSharing = 20
+	SharingTokenDuration                   = time.Hour * 2
+)
 
 type SharingDB struct {
 	ID          string     `json:"id" gorm:"type:char(12);primaryKey"`
 	FilesRaw    string     `json:"-" gorm:"type:text"`
 	Expires     *time.Time `json:"expires"`
-	Pwd         string     `json:"pwd"`
+	Pwd         string     `json:"-"` // salted hash, or clear text if PwdSalt is empty (before migrated)
+	PwdSalt     string     `json:"-"`
 	Accessed    int        `json:"accessed"`
 	MaxAccessed int        `json:"max_accessed"`
 	CreatorId   uint       `json:"-"`
@@ -15,12 +39,61 @@ type SharingDB struct {
 	Readme      string     `json:"readme" gorm:"type:text"`
 	Header      string     `json:"header" gorm:"type:text"`
 	Sort
+	// file request (upload-only) mode, the only file is the target folder
+	FileRequest  bool   `json:"file_request"`
+	HideContent  bool   `json:"hide_content"`
+	MaxFileSize  int64  `json:"max_file_size"`
+	MaxFileCount int    `json:"max_file_count"`
+	Uploaded     int    `json:"uploaded"`
+	AllowedExts  string `json:"allowed_exts"` // comma separated, empty means any
+	// the maximum downloads of every single file, 0 means unlimited
+	FileMaxDownloads int `json:"file_max_downloads"`
+	// restrict the sharing to specific users or sso identities of some domains
+	AllowedUsersRaw string `json:"-" gorm:"type:text"`
+	AllowedDomains  string `json:"allowed_domains"` // comma separated, e.g. example.com
+}
+
+const (
+	SharingAccessList     = "list"
+	SharingAccessGet      = "get"
+	SharingAccessDownload = "download"
+	SharingAccessArchive  = "archive"
+	SharingAccessUpload   = "upload"
+)
+
+// SharingAccess is an access event of a sharing
+type SharingAccess struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SharingID string    `json:"sharing_id" gorm:"type:char(12);index"`
+	Type      string    `json:"type"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Path      string    `json:"path"`
+	Bytes     int64     `json:"bytes"`
+	Time      time.Time `json:"time" gorm:"index"`
+}
+
+type SharingFileStat struct {
+	Path      string `json:"path"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type SharingStats struct {
+	Views      int64             `json:"views"`
+	Downloads  int64             `json:"downloads"`
+	Uploads    int64             `json:"uploads"`
+	Bytes      int64             `json:"bytes"`
+	UniqueIPs  int64             `json:"unique_ips"`
+	LastAccess *time.Time        `json:"last_access"`
+	Files      []SharingFileStat `json:"files"`
 }
 
 type Sharing struct {
 	*SharingDB
-	Files   []string `json:"files"`
-	Creator *User    `json:"-"`
+	Files        []string `json:"files"`
+	AllowedUsers []string `json:"allowed_users"`
+	Creator      *User    `json:"-"`
 }
 
 func (s *Sharing) Valid() bool {
@@ -30,7 +103,7 @@ func (s *Sharing) Valid() bool {
 	if s.MaxAccessed > 0 && s.Accessed >= s.MaxAccessed {
 		return false
 	}
-	if len(s.Files) == 0 {
+	if len(s.Files) == 0 || (s.FileRequest && len(s.Files) != 1) {
 		return false
 	}
 	if s.Creator == nil || !s.Creator.CanShare() {
@@ -42,6 +115,89 @@ func (s *Sharing) Valid() bool {
 	return true
 }
 
+func (s *Sharing) HasPwd() bool {
+	return s.Pwd != ""
+}
+
+// SetPwd sets the password of the sharing, an empty pwd removes the password
+func (s *Sharing) SetPwd(pwd string) {
+	if pwd == "" {
+		s.Pwd, s.PwdSalt = "", ""
+		return
+	}
+	s.PwdSalt = random.String(16)
+	s.Pwd = TwoHashPwd(pwd, s.PwdSalt)
+}
+
 func (s *Sharing) Verify(pwd string) bool {
-	return s.Pwd == "" || s.Pwd == pwd
+	if s.Pwd == "" {
+		return true
+	}
+	if s.PwdSalt == "" {
+		return subtle.ConstantTimeCompare([]byte(s.Pwd), []byte(pwd)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(s.Pwd), []byte(TwoHashPwd(pwd, s.PwdSalt))) == 1
+}
+
+// Restricted reports whether only specific users can access the sharing
+func (s *Sharing) Restricted() bool {
+	return len(s.AllowedUsers) > 0 || strings.TrimSpace(s.AllowedDomains) != ""
+}
+
+// AllowUser reports whether the user can access the sharing, u is nil if not logged in
+func (s *Sharing) AllowUser(u *User) bool {
+	if !s.Restricted() {
+		return true
+	}
+	if u == nil || u.IsGuest() || u.Disabled {
+		return false
+	}
+	if u.IsAdmin() || u.ID == s.CreatorId {
+		return true
+	}
+	for _, name := range s.AllowedUsers {
+		if name == u.Username {
+			return true
+		}
+	}
+	if u.SsoID == "" {
+		return false
+	}
+	ssoID := strings.ToLower(u.SsoID)
+	for _, d := range strings.Split(s.AllowedDomains, ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" && strings.HasSuffix(ssoID, "@"+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanBrowse reports whether the content of the sharing can be listed or downloaded
+func (s *Sharing) CanBrowse() bool {
+	return !s.FileRequest || !s.HideContent
+}
+
+// CheckUpload checks whether a file with given name and size can be uploaded to the sharing
+// while the given number of files are still being uploaded to it
+func (s *Sharing) CheckUpload(name string, size int64, uploading int) error {
+	if !s.FileRequest {
+		return errors.WithStack(errs.SharingUploadNotAllowed)
+	}
+	if s.MaxFileCount > 0 && s.Uploaded+uploading >= s.MaxFileCount {
+		return errors.WithMessagef(errs.SharingUploadLimitExceeded, "at most %d files can be uploaded", s.MaxFileCount)
+	}
+	if s.MaxFileSize > 0 && (size < 0 || size > s.MaxFileSize) {
+		return errors.WithMessagef(errs.SharingUploadLimitExceeded, "file size must not exceed %d bytes", s.MaxFileSize)
+	}
+	if strings.TrimSpace(s.AllowedExts) == "" {
+		return nil
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, e := range strings.Split(s.AllowedExts, ",") {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), ".")) == ext {
+			return nil
+		}
+	}
+	return errors.WithMessagef(errs.SharingUploadNotAllowed, "file extension [%s] is not allowed", ext)
 }
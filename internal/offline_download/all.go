@@ -6,9 +6,11 @@ import (
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/123"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/123_open"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/aria2"
+	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/bittorrent"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/http"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/pikpak"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/qbit"
+	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/remote"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/thunder"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/thunder_browser"
 	_ "github.com/OpenListTeam/OpenList/v4/internal/offline_download/thunderx"
@@ -0,0 +1,218 @@
+package bittorrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/torrent"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the max size of a .torrent file
+const maxTorrentSize = 16 << 20
+
+type BitTorrent struct {
+	mu        sync.Mutex
+	ready     bool
+	cfg       torrent.Config
+	seedRatio float64
+	seedTime  time.Duration
+	client    *torrent.Client
+	torrents  map[string]*torrent.Torrent
+}
+
+func (b *BitTorrent) Run(task *tool.DownloadTask) error {
+	return errs.NotSupport
+}
+
+func (b *BitTorrent) Name() string {
+	return "BitTorrent"
+}
+
+func (b *BitTorrent) Items() []model.SettingItem {
+	// bittorrent settings
+	return []model.SettingItem{
+		{Key: conf.BitTorrentListenPort, Value: "0", Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentDHT, Value: "true", Type: conf.TypeBool, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentMaxPeers, Value: "50", Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentSeedRatio, Value: "0", Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentSeedtime, Value: "0", Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+	}
+}
+
+// Init reads the settings, the client is started with the first download and stopped with the last one,
+// so the new listen port and DHT settings take effect once the running downloads are finished
+func (b *BitTorrent) Init() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	port := setting.GetInt(conf.BitTorrentListenPort, 0)
+	if port < 0 || port > 65535 {
+		b.ready = false
+		return "", errors.Errorf("invalid bittorrent listen port: %d", port)
+	}
+	b.cfg = torrent.Config{
+		ListenPort: port,
+		DHT:        setting.GetBool(conf.BitTorrentDHT),
+		MaxPeers:   setting.GetInt(conf.BitTorrentMaxPeers, 50),
+		HTTPClient: net.NewHttpClient(),
+	}
+	b.seedRatio = setting.GetFloat(conf.BitTorrentSeedRatio, 0)
+	b.seedTime = time.Duration(setting.GetInt(conf.BitTorrentSeedtime, 0)) * time.Minute
+	if b.torrents == nil {
+		b.torrents = make(map[string]*torrent.Torrent)
+	}
+	b.ready = true
+	return "ok", nil
+}
+
+func (b *BitTorrent) IsReady() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ready
+}
+
+// AddURL adds a magnet uri or a http url of .torrent file,
+// the files to download are selected by the so parameter of the magnet uri or the #so= fragment of the url, e.g. so=0,2,4-6
+func (b *BitTorrent) AddURL(args *tool.AddUrlArgs) (string, error) {
+	var spec *torrent.Spec
+	var err error
+	if strings.HasPrefix(strings.ToLower(args.Url), "magnet:") {
+		spec, err = torrent.ParseMagnet(args.Url)
+	} else {
+		spec, err = b.fetchTorrent(args.Url)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		b.client, err = torrent.NewClient(b.cfg)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to start bittorrent client")
+		}
+		log.Infof("bittorrent client listening on port %d", b.client.Port())
+	}
+	t, err := b.client.AddTorrent(spec, args.TempDir)
+	if err != nil {
+		b.closeIfIdle()
+		return "", err
+	}
+	gid := spec.InfoHash.String()
+	b.torrents[gid] = t
+	return gid, nil
+}
+
+func (b *BitTorrent) fetchTorrent(u string) (*torrent.Spec, error) {
+	endpoint, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse torrent url")
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, errors.Errorf("unsupported torrent url: %s", u)
+	}
+	var sel []int
+	if fragment, err := url.ParseQuery(endpoint.Fragment); err == nil && fragment.Has("so") {
+		if sel, err = torrent.ParseSelect(fragment.Get("so")); err != nil {
+			return nil, err
+		}
+		endpoint.Fragment = ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", base.UserAgent)
+	resp, err := b.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get .torrent file")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get .torrent file: http status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get .torrent file")
+	}
+	if len(data) > maxTorrentSize {
+		return nil, errors.New(".torrent file too large")
+	}
+	spec, err := torrent.ParseTorrent(data)
+	if err != nil {
+		return nil, err
+	}
+	spec.Select = sel
+	return spec, nil
+}
+
+func (b *BitTorrent) Remove(task *tool.DownloadTask) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.torrents[task.GID]; ok {
+		delete(b.torrents, task.GID)
+		t.Drop()
+	}
+	b.closeIfIdle()
+	return nil
+}
+
+// closeIfIdle stops the client if there are no torrents, the caller must hold the lock
+func (b *BitTorrent) closeIfIdle() {
+	if b.client != nil && b.client.NumTorrents() == 0 {
+		_ = b.client.Close()
+		b.client = nil
+	}
+}
+
+func (b *BitTorrent) Status(task *tool.DownloadTask) (*tool.Status, error) {
+	b.mu.Lock()
+	t, ok := b.torrents[task.GID]
+	seedRatio, seedTime := b.seedRatio, b.seedTime
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("failed get status, wrong gid: %s", task.GID)
+	}
+	stats := t.Stats()
+	s := &tool.Status{
+		TotalBytes: stats.TotalBytes,
+		Status:     fmt.Sprintf("[bittorrent] %s, %d peers", stats.State, stats.Peers),
+	}
+	if stats.TotalBytes > 0 {
+		s.Progress = float64(stats.CompletedBytes) / float64(stats.TotalBytes) * 100
+	}
+	switch stats.State {
+	case torrent.StateSeeding:
+		s.Completed = true
+		s.Progress = 100
+		// keep seeding until all the configured limits are met, the negative seed time means forever
+		s.Seeding = seedTime < 0 || (seedTime > 0 && time.Since(stats.CompletedAt) < seedTime) ||
+			(seedRatio > 0 && stats.TotalBytes > 0 && float64(stats.Uploaded)/float64(stats.TotalBytes) < seedRatio)
+	case torrent.StateError, torrent.StateClosed:
+		s.Err = errors.Errorf("[bittorrent] failed to download %s: %v", task.GID, stats.Err)
+	}
+	return s, nil
+}
+
+var _ tool.Tool = (*BitTorrent)(nil)
+
+func init() {
+	tool.Tools.Add(&BitTorrent{})
+}
@@ -1,20 +1,25 @@
 package http
 
 import (
+	"context"
 	"fmt"
-	"math/rand/v2"
+	"io"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
 	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 type SimpleHttp struct {
@@ -26,7 +31,9 @@ func (s SimpleHttp) Name() string {
 }
 
 func (s SimpleHttp) Items() []model.SettingItem {
-	return nil
+	return []model.SettingItem{
+		{Key: conf.SimpleHttpConcurrency, Value: "4", Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+	}
 }
 
 func (s SimpleHttp) Init() (string, error) {
@@ -49,20 +56,36 @@ func (s SimpleHttp) Status(task *tool.DownloadTask) (*tool.Status, error) {
 	panic("should not be called")
 }
 
+// Run downloads the url to the temp dir, the download is split into ranged requests if the server supports,
+// and resumed from the partially downloaded file of the last run.
+// The expected checksum can be supplied with the fragment of the url, e.g. #checksum=sha256:<hex>
 func (s SimpleHttp) Run(task *tool.DownloadTask) error {
+	return s.run(task, false)
+}
+
+func (s SimpleHttp) run(task *tool.DownloadTask, restarted bool) error {
 	streamPut := task.DeletePolicy == tool.UploadDownloadStream
+	u, checksum, err := parseURL(task.Url)
+	if err != nil {
+		return err
+	}
+	header := task.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", base.UserAgent)
+	}
 	method := http.MethodGet
 	if streamPut {
 		method = http.MethodHead
 	}
-	req, err := http.NewRequestWithContext(task.Ctx(), method, task.Url, nil)
+	req, err := http.NewRequestWithContext(task.Ctx(), method, u, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("User-Agent", base.UserAgent)
-	if streamPut {
-		req.Header.Set("Range", "bytes=0-")
-	}
+	req.Header = header.Clone()
+	req.Header.Set("Range", "bytes=0-")
 	resp, err := s.client.Do(req)
 	if err != nil {
 		return err
@@ -76,15 +99,18 @@ func (s SimpleHttp) Run(task *tool.DownloadTask) error {
 		filename = path.Base(resp.Request.URL.Path)
 	}
 	filename = strings.Trim(filename, "/")
-	if len(filename) == 0 {
-		filename = fmt.Sprintf("%s-%d-%x", strings.ReplaceAll(req.URL.Host, ".", "_"), time.Now().UnixMilli(), rand.Uint32())
+	if len(filename) == 0 || filename == "." {
+		// the same name for the retries, so the download can be resumed
+		filename = fmt.Sprintf("%s-%s", strings.ReplaceAll(req.URL.Host, ".", "_"), utils.GetMD5EncodeStr(u)[:16])
 	}
 	fileSize := resp.ContentLength
-	if streamPut {
-		if fileSize == 0 {
-			start, end, _ := http_range.ParseContentRange(resp.Header.Get("Content-Range"))
-			fileSize = start + end
+	ranged := resp.StatusCode == http.StatusPartialContent
+	if ranged {
+		if size, err := parseContentRangeSize(resp.Header.Get("Content-Range")); err == nil {
+			fileSize = size
 		}
+	}
+	if streamPut {
 		task.SetTotalBytes(fileSize)
 		task.TempDir = filename
 		return nil
@@ -93,13 +119,110 @@ func (s SimpleHttp) Run(task *tool.DownloadTask) error {
 	// save to temp dir
 	_ = os.MkdirAll(task.TempDir, os.ModePerm)
 	filePath := filepath.Join(task.TempDir, filename)
+	if ranged && fileSize > 0 {
+		_ = resp.Body.Close()
+		err = s.downloadRanges(task, u, header, filePath, fileSize, rangeValidator(resp.Header))
+		if errors.Is(err, errRemoteChanged) {
+			_ = os.Remove(filePath)
+			task.Validator = ""
+			if !restarted {
+				log.Infof("%s has been changed while downloading, download it again", u)
+				return s.run(task, true)
+			}
+		}
+	} else {
+		task.Validator = ""
+		err = s.downloadStream(task, resp, filePath, fileSize)
+	}
+	if err != nil {
+		return err
+	}
+	if checksum.HashType != nil {
+		if err = checksum.verify(filePath); err != nil {
+			// download again from the beginning on retry
+			_ = os.Remove(filePath)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s SimpleHttp) downloadStream(task *tool.DownloadTask, resp *http.Response, filePath string, fileSize int64) error {
 	file, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	err = utils.CopyWithCtx(task.Ctx(), file, resp.Body, fileSize, task.SetProgress)
-	return err
+	return utils.CopyWithCtx(task.Ctx(), file, resp.Body, fileSize, task.SetProgress)
+}
+
+// errRemoteChanged is returned if the ranged request is answered with the whole file,
+// which means the file doesn't match the If-Range any more
+var errRemoteChanged = errors.New("the remote file has been changed")
+
+// downloadRanges downloads the rest of the file with multiple connections,
+// the parts are written in order, so the file is always a prefix of the remote one.
+// The download is resumed only if the validator is the same as the one of the partial file
+func (s SimpleHttp) downloadRanges(task *tool.DownloadTask, u string, header http.Header, filePath string, fileSize int64, validator string) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if offset > fileSize || validator == "" || validator != task.Validator {
+		// the remote file has been changed or can't be checked
+		offset = 0
+	}
+	task.Validator = validator
+	if err = file.Truncate(offset); err != nil {
+		return err
+	}
+	if offset == fileSize {
+		task.SetProgress(100)
+		return nil
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if offset > 0 {
+		log.Infof("resume downloading %s from %d", u, offset)
+	}
+	d := net.NewDownloader(func(d *net.Downloader) {
+		d.Concurrency = max(setting.GetInt(conf.SimpleHttpConcurrency, 4), 1)
+		// the limit is for proxying, not the offline downloads
+		d.ConcurrencyLimit = nil
+		d.HttpClient = func(ctx context.Context, params *net.HttpRequestParams) (*http.Response, error) {
+			resp, err := net.DefaultHttpRequestFunc(ctx, params)
+			if err == nil && resp.StatusCode != http.StatusPartialContent {
+				_ = resp.Body.Close()
+				return nil, errors.WithStack(errRemoteChanged)
+			}
+			return resp, err
+		}
+	})
+	header = header.Clone()
+	if validator != "" {
+		header.Set("If-Range", validator)
+	}
+	rc, err := d.Download(task.Ctx(), &net.HttpRequestParams{
+		URL:       u,
+		Range:     http_range.Range{Start: offset, Length: fileSize - offset},
+		HeaderRef: header,
+		Size:      fileSize,
+	})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	rest := fileSize - offset
+	return utils.CopyWithCtx(task.Ctx(), file, rc, rest, func(p float64) {
+		task.SetProgress(float64(offset)*100/float64(fileSize) + p*float64(rest)/float64(fileSize))
+	})
 }
 
 func init() {
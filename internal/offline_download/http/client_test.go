@@ -0,0 +1,151 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/offline_download/tool"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+// remoteFile serves the data with the ETag, the If-Range is handled by http.ServeContent
+type remoteFile struct {
+	mu      sync.Mutex
+	data    []byte
+	etag    string
+	version int
+	// changeAfter changes the data after the number of requests, to change it while downloading
+	changeAfter int
+	requests    []http.Header
+}
+
+func newRemoteFile(t *testing.T, size int) (*remoteFile, string) {
+	f := &remoteFile{}
+	f.change(size)
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv.URL + "/file.bin"
+}
+
+func (f *remoteFile) change(size int) {
+	f.version++
+	f.data = make([]byte, size)
+	rand.New(rand.NewSource(int64(f.version))).Read(f.data)
+	f.etag = `"v` + strconv.Itoa(f.version) + `"`
+}
+
+func (f *remoteFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	if f.changeAfter > 0 && len(f.requests) == f.changeAfter {
+		f.change(len(f.data))
+	}
+	f.requests = append(f.requests, r.Header.Clone())
+	data, etag := f.data, f.etag
+	f.mu.Unlock()
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "file.bin", time.Unix(1700000000, 0), bytes.NewReader(data))
+}
+
+// rangeStarts returns the starts of the ranges requested with the If-Range
+func (f *remoteFile) rangeStarts(t *testing.T, ifRange string) []int64 {
+	var starts []int64
+	for _, h := range f.requests[1:] {
+		if h.Get("If-Range") != ifRange {
+			t.Errorf("wrong If-Range %q of %s", h.Get("If-Range"), h.Get("Range"))
+		}
+		start, _, _ := strings.Cut(strings.TrimPrefix(h.Get("Range"), "bytes="), "-")
+		n, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			t.Errorf("wrong Range %q", h.Get("Range"))
+		}
+		starts = append(starts, n)
+	}
+	return starts
+}
+
+func newTask(t *testing.T, url, validator string, partial []byte) *tool.DownloadTask {
+	task := &tool.DownloadTask{Url: url, TempDir: t.TempDir(), Validator: validator}
+	task.SetCtx(context.Background())
+	if partial != nil {
+		if err := os.WriteFile(filepath.Join(task.TempDir, "file.bin"), partial, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return task
+}
+
+func checkFile(t *testing.T, task *tool.DownloadTask, want []byte) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(task.TempDir, "file.bin"))
+	if err != nil || !bytes.Equal(data, want) {
+		t.Errorf("wrong downloaded file of %d bytes: %v", len(data), err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	f, url := newRemoteFile(t, 3<<20)
+	const offset = 1 << 20
+	task := newTask(t, url, f.etag, f.data[:offset])
+	if err := (SimpleHttp{}).Run(task); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, task, f.data)
+	// the parts before the offset are not downloaded again
+	for _, start := range f.rangeStarts(t, f.etag) {
+		if start < offset {
+			t.Errorf("downloaded again from %d", start)
+		}
+	}
+	if task.Validator != f.etag {
+		t.Errorf("wrong validator %s", task.Validator)
+	}
+}
+
+func TestResumeOtherValidator(t *testing.T) {
+	f, url := newRemoteFile(t, 1<<20)
+	// the partial file of another version is downloaded again
+	task := newTask(t, url, `"v0"`, bytes.Repeat([]byte{1}, 1000))
+	if err := (SimpleHttp{}).Run(task); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, task, f.data)
+	if starts := f.rangeStarts(t, f.etag); len(starts) == 0 || starts[0] != 0 {
+		t.Errorf("not downloaded from the start: %v", starts)
+	}
+}
+
+func TestRemoteChanged(t *testing.T) {
+	f, url := newRemoteFile(t, 1<<20)
+	// the data is changed after the first request, the ranges with the If-Range of it get the whole new file
+	f.changeAfter = 1
+	task := newTask(t, url, "", nil)
+	if err := (SimpleHttp{}).Run(task); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, task, f.data)
+	if task.Validator != f.etag || f.version != 2 {
+		t.Errorf("wrong validator %s of version %d", task.Validator, f.version)
+	}
+}
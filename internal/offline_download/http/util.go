@@ -3,6 +3,13 @@ package http
 import (
 	"fmt"
 	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 )
 
 func parseFilenameFromContentDisposition(contentDisposition string) (string, error) {
@@ -19,3 +26,62 @@ func parseFilenameFromContentDisposition(contentDisposition string) (string, err
 	}
 	return filename, nil
 }
+
+// parseContentRangeSize returns the complete length of the Content-Range, e.g. bytes 0-99/1000
+func parseContentRangeSize(contentRange string) (int64, error) {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid Content-Range: [%s]", contentRange)
+	}
+	return strconv.ParseInt(strings.TrimSpace(contentRange[i+1:]), 10, 64)
+}
+
+// rangeValidator returns the validator of the response to resume the download with If-Range,
+// the weak ETag can't be used since it never matches the If-Range
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+type checksum struct {
+	*utils.HashType
+	expected string
+}
+
+// parseURL removes the checksum=<hash type>:<hex> from the fragment of the url
+func parseURL(rawURL string) (string, checksum, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", checksum{}, err
+	}
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err != nil || !fragment.Has("checksum") {
+		return rawURL, checksum{}, nil
+	}
+	name, expected, _ := strings.Cut(fragment.Get("checksum"), ":")
+	ht, ok := utils.GetHashByName(strings.ToLower(name))
+	if !ok || len(expected) != ht.Width {
+		return "", checksum{}, fmt.Errorf("invalid checksum: %s", fragment.Get("checksum"))
+	}
+	fragment.Del("checksum")
+	u.Fragment = fragment.Encode()
+	return u.String(), checksum{HashType: ht, expected: strings.ToLower(expected)}, nil
+}
+
+func (c checksum) verify(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	actual, err := utils.HashReader(c.HashType, file)
+	if err != nil {
+		return err
+	}
+	if actual != c.expected {
+		return fmt.Errorf("%s checksum mismatch, expected %s, got %s", c.Name, c.expected, actual)
+	}
+	return nil
+}
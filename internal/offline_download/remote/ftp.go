@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/url"
+	stdpath "path"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+type ftpSource struct {
+	conn *ftp.ServerConn
+}
+
+func newFTP(ctx context.Context, u *url.URL) (source, error) {
+	opts := []ftp.DialOption{ftp.DialWithShutTimeout(10 * time.Second), ftp.DialWithContext(ctx)}
+	if u.Scheme == "ftps" {
+		opts = append(opts, ftp.DialWithExplicitTLS(&tls.Config{ServerName: u.Hostname()}))
+	}
+	conn, err := ftp.Dial(hostPort(u, "21"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	user, password := "anonymous", "anonymous"
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if err = conn.Login(user, password); err != nil {
+		_ = conn.Quit()
+		return nil, err
+	}
+	return &ftpSource{conn: conn}, nil
+}
+
+func (s *ftpSource) stat(ctx context.Context, path string) (*entry, error) {
+	e := &entry{path: path, name: stdpath.Base(path)}
+	if err := s.conn.ChangeDir(path); err == nil {
+		e.isDir = true
+		return e, nil
+	}
+	size, err := s.conn.FileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	e.size = size
+	return e, nil
+}
+
+func (s *ftpSource) list(ctx context.Context, dir string) ([]*entry, error) {
+	entries, err := s.conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []*entry
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." || e.Type == ftp.EntryTypeLink {
+			continue
+		}
+		res = append(res, &entry{
+			path:  stdpath.Join(dir, e.Name),
+			name:  e.Name,
+			size:  int64(e.Size),
+			isDir: e.Type == ftp.EntryTypeFolder,
+		})
+	}
+	return res, nil
+}
+
+func (s *ftpSource) open(ctx context.Context, e *entry, offset int64) (io.ReadCloser, error) {
+	return s.conn.RetrFrom(e.path, uint64(offset))
+}
+
+func (s *ftpSource) close() error {
+	return s.conn.Quit()
+}
@@ -0,0 +1,155 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	stdpath "path"
+
+	"github.com/OpenListTeam/OpenList/v4/drivers/base"
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+)
+
+// openListSource reads the files from another OpenList instance by its api,
+// the password of the path is given by the password query of the url
+type openListSource struct {
+	client   *http.Client
+	address  string
+	token    string
+	password string
+}
+
+type openListObj struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	IsDir  bool   `json:"is_dir"`
+	RawURL string `json:"raw_url"`
+}
+
+func newOpenList(ctx context.Context, u *url.URL) (source, error) {
+	scheme := "http"
+	if u.Scheme == "openlists" {
+		scheme = "https"
+	}
+	s := &openListSource{
+		client:   net.NewHttpClient(),
+		address:  scheme + "://" + u.Host,
+		password: u.Query().Get("password"),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		var resp struct {
+			Token string `json:"token"`
+		}
+		err := s.request(ctx, "/api/auth/login", map[string]any{
+			"username": u.User.Username(),
+			"password": password,
+		}, &resp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to login: %w", err)
+		}
+		s.token = resp.Token
+	}
+	return s, nil
+}
+
+func (s *openListSource) request(ctx context.Context, api string, body any, data any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.address+api, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", base.UserAgent)
+	if s.token != "" {
+		req.Header.Set("Authorization", s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("request failed, status: %s", res.Status)
+	}
+	resp := common.Resp[json.RawMessage]{}
+	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("request failed, code: %d, message: %s", resp.Code, resp.Message)
+	}
+	return json.Unmarshal(resp.Data, data)
+}
+
+func (s *openListSource) stat(ctx context.Context, path string) (*entry, error) {
+	var obj openListObj
+	err := s.request(ctx, "/api/fs/get", map[string]any{"path": path, "password": s.password}, &obj)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{path: path, name: stdpath.Base(path), size: obj.Size, isDir: obj.IsDir}, nil
+}
+
+func (s *openListSource) list(ctx context.Context, dir string) ([]*entry, error) {
+	var resp struct {
+		Content []openListObj `json:"content"`
+	}
+	err := s.request(ctx, "/api/fs/list", map[string]any{
+		"path":     dir,
+		"password": s.password,
+		"page":     1,
+		"per_page": 0,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*entry, 0, len(resp.Content))
+	for _, obj := range resp.Content {
+		res = append(res, &entry{
+			path:  stdpath.Join(dir, obj.Name),
+			name:  obj.Name,
+			size:  obj.Size,
+			isDir: obj.IsDir,
+		})
+	}
+	return res, nil
+}
+
+func (s *openListSource) open(ctx context.Context, e *entry, offset int64) (io.ReadCloser, error) {
+	// the raw url is signed, so it's got just before downloading
+	var obj openListObj
+	err := s.request(ctx, "/api/fs/get", map[string]any{"path": e.path, "password": s.password}, &obj)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, obj.RawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", base.UserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 || (offset > 0 && res.StatusCode != http.StatusPartialContent) {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("failed to download %s, status: %s", e.path, res.Status)
+	}
+	return res.Body, nil
+}
+
+func (s *openListSource) close() error {
+	return nil
+}
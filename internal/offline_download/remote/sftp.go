@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	stdpath "path"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+type sftpSource struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func newSFTP(ctx context.Context, u *url.URL) (source, error) {
+	config := &ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if u.User != nil {
+		config.User = u.User.Username()
+		password, _ := u.User.Password()
+		config.Auth = []ssh.AuthMethod{ssh.Password(password)}
+	}
+	addr := hostPort(u, "22")
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	conn := ssh.NewClient(c, chans, reqs)
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &sftpSource{conn: conn, client: client}, nil
+}
+
+func (s *sftpSource) stat(ctx context.Context, path string) (*entry, error) {
+	info, err := s.client.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{path: path, name: stdpath.Base(path), size: info.Size(), isDir: info.IsDir()}, nil
+}
+
+func (s *sftpSource) list(ctx context.Context, dir string) ([]*entry, error) {
+	infos, err := s.client.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*entry, 0, len(infos))
+	for _, info := range infos {
+		res = append(res, &entry{
+			path:  stdpath.Join(dir, info.Name()),
+			name:  info.Name(),
+			size:  info.Size(),
+			isDir: info.IsDir(),
+		})
+	}
+	return res, nil
+}
+
+func (s *sftpSource) open(ctx context.Context, e *entry, offset int64) (io.ReadCloser, error) {
+	f, err := s.client.Open(e.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *sftpSource) close() error {
+	_ = s.client.Close()
+	return s.conn.Close()
+}
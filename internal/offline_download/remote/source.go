@@ -0,0 +1,77 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+)
+
+type entry struct {
+	// the path on the remote
+	path  string
+	name  string
+	size  int64
+	isDir bool
+}
+
+// source is a connection to a remote of the url
+type source interface {
+	stat(ctx context.Context, path string) (*entry, error)
+	list(ctx context.Context, dir string) ([]*entry, error)
+	// open reads the file from the offset
+	open(ctx context.Context, e *entry, offset int64) (io.ReadCloser, error)
+	close() error
+}
+
+// newSource connects to the remote of the url, and returns the path of the url on the remote
+func newSource(ctx context.Context, u *url.URL) (source, string, error) {
+	if u.User == nil {
+		u.User = savedCredential(u)
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	var s source
+	var err error
+	switch strings.ToLower(u.Scheme) {
+	case "ftp", "ftps":
+		s, err = newFTP(ctx, u)
+	case "sftp":
+		s, err = newSFTP(ctx, u)
+	case "webdav", "webdavs":
+		s, err = newWebDAV(u)
+	case "openlist", "openlists":
+		s, err = newOpenList(ctx, u)
+	default:
+		return nil, "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	return s, p, err
+}
+
+// savedCredential finds the credential of the url's scheme and host in the saved ones
+func savedCredential(u *url.URL) *url.Userinfo {
+	for _, line := range strings.Split(setting.GetStr(conf.RemoteCredentials), "\n") {
+		saved, err := url.Parse(strings.TrimSpace(line))
+		if err != nil || saved.User == nil {
+			continue
+		}
+		if strings.EqualFold(saved.Scheme, u.Scheme) && strings.EqualFold(saved.Host, u.Host) {
+			return saved.User
+		}
+	}
+	return nil
+}
+
+// hostPort returns the host of the url with the default port if it's missing
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return u.Hostname() + ":" + defaultPort
+}
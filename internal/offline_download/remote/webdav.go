@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/url"
+	stdpath "path"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/net"
+	"github.com/OpenListTeam/OpenList/v4/pkg/gowebdav"
+)
+
+type webdavSource struct {
+	client *gowebdav.Client
+}
+
+func newWebDAV(u *url.URL) (source, error) {
+	scheme := "http"
+	if u.Scheme == "webdavs" {
+		scheme = "https"
+	}
+	var user, password string
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	client := gowebdav.NewClient(scheme+"://"+u.Host, user, password)
+	client.SetTransport(net.NewHttpClient().Transport)
+	return &webdavSource{client: client}, nil
+}
+
+func (s *webdavSource) stat(ctx context.Context, path string) (*entry, error) {
+	info, err := s.client.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{path: path, name: stdpath.Base(path), size: info.Size(), isDir: info.IsDir()}, nil
+}
+
+func (s *webdavSource) list(ctx context.Context, dir string) ([]*entry, error) {
+	infos, err := s.client.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*entry, 0, len(infos))
+	for _, info := range infos {
+		res = append(res, &entry{
+			path:  stdpath.Join(dir, info.Name()),
+			name:  info.Name(),
+			size:  info.Size(),
+			isDir: info.IsDir(),
+		})
+	}
+	return res, nil
+}
+
+func (s *webdavSource) open(ctx context.Context, e *entry, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		rc, _, err := s.client.ReadStream(e.path, nil)
+		return rc, err
+	}
+	return s.client.ReadStreamRange(e.path, offset, e.size-offset)
+}
+
+func (s *webdavSource) close() error {
+	return nil
+}
@@ -2,9 +2,11 @@ package tool
 
 import (
 	"context"
+	"net/http"
 	"net/url"
 	stdpath "path"
 	"path/filepath"
+	"strings"
 
 	_115 "github.com/OpenListTeam/OpenList/v4/drivers/115"
 	_115_open "github.com/OpenListTeam/OpenList/v4/drivers/115_open"
@@ -41,6 +43,8 @@ type AddURLArgs struct {
 	DstDirPath   string
 	Tool         string
 	DeletePolicy DeletePolicy
+	// Header is sent with the requests of the url, only supported by SimpleHttp
+	Header http.Header
 }
 
 func AddURL(ctx context.Context, args *AddURLArgs) (task.TaskExtensionInfo, error) {
@@ -65,8 +69,14 @@ func AddURL(ctx context.Context, args *AddURLArgs) (task.TaskExtensionInfo, erro
 			return nil, errors.WithStack(errs.NotFolder)
 		}
 	}
+	// the urls other than http are only downloaded by the remote tool chosen explicitly,
+	// since the saved credentials of the remotes may be used
+	if u, err := url.Parse(args.URL); err == nil && args.Tool == "SimpleHttp" &&
+		!strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https") {
+		return nil, errors.Errorf("unsupported scheme %s for SimpleHttp, use the Remote tool instead", u.Scheme)
+	}
 	// try putting url
-	if args.Tool == "SimpleHttp" {
+	if args.Tool == "SimpleHttp" && len(args.Header) == 0 {
 		err = tryPutUrl(ctx, args.DstDirPath, args.URL)
 		if err == nil || !errors.Is(err, errs.NotImplement) {
 			return nil, err
@@ -151,6 +161,8 @@ func AddURL(ctx context.Context, args *AddURLArgs) (task.TaskExtensionInfo, erro
 			ApiUrl:  common.GetApiUrl(ctx),
 		},
 		Url:          args.URL,
+		Header:       args.Header,
+		HasHeader:    len(args.Header) > 0,
 		DstDirPath:   args.DstDirPath,
 		TempDir:      tempDir,
 		DeletePolicy: deletePolicy,
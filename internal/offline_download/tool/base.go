@@ -16,6 +16,7 @@ type Status struct {
 	Progress   float64
 	NewGID     string
 	Completed  bool
+	Seeding    bool
 	Status     string
 	Err        error
 }
@@ -2,6 +2,8 @@ package tool
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"path"
 	"time"
 
@@ -18,9 +20,17 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// errHeaderLost is returned by the task restored without its request headers,
+// which may contain credentials and are never persisted
+var errHeaderLost = errors.New("the request headers are lost after restart, add the download again")
+
 type DownloadTask struct {
 	task.TaskExtension
-	Url               string       `json:"url"`
+	Url       string      `json:"url"`
+	Header    http.Header `json:"-"`
+	HasHeader bool        `json:"has_header,omitempty"`
+	// Validator is the ETag or Last-Modified of the partially downloaded file, used by SimpleHttp to resume it
+	Validator         string       `json:"validator,omitempty"`
 	DstDirPath        string       `json:"dst_dir_path"`
 	TempDir           string       `json:"temp_dir"`
 	DeletePolicy      DeletePolicy `json:"delete_policy"`
@@ -36,6 +46,9 @@ func (t *DownloadTask) Run() error {
 	t.ClearEndTime()
 	t.SetStartTime(time.Now())
 	defer func() { t.SetEndTime(time.Now()) }()
+	if t.HasHeader && t.Header == nil {
+		return errors.WithStack(errHeaderLost)
+	}
 	if t.tool == nil {
 		tool, err := Tools.Get(t.Toolname)
 		if err != nil {
@@ -138,6 +151,27 @@ outer:
 			}
 		}
 	}
+
+	if t.tool.Name() == "BitTorrent" {
+		// the built-in client seeds until the ratio or the seed time is reached
+		t.Status = "offline download completed, seeding"
+	seeding:
+		for {
+			info, err := t.tool.Status(t)
+			if err != nil || !info.Seeding {
+				break
+			}
+			select {
+			case <-t.CtxDone():
+				break seeding
+			case <-time.After(time.Second * 10):
+			}
+		}
+		err := t.tool.Remove(t)
+		if err != nil {
+			log.Errorln(err.Error())
+		}
+	}
 	return nil
 }
 
@@ -201,6 +235,8 @@ func (t *DownloadTask) Transfer() error {
 			},
 			DeletePolicy: t.DeletePolicy,
 			Url:          t.Url,
+			Header:       t.Header,
+			HasHeader:    t.HasHeader,
 		}
 		tsk.SetTotalBytes(t.GetTotalBytes())
 		tsk.groupID = path.Join(tsk.DstStorageMp, tsk.DstActualPath)
@@ -212,7 +248,16 @@ func (t *DownloadTask) Transfer() error {
 }
 
 func (t *DownloadTask) GetName() string {
-	return fmt.Sprintf("download %s to (%s)", t.Url, t.DstDirPath)
+	return fmt.Sprintf("download %s to (%s)", redactURL(t.Url), t.DstDirPath)
+}
+
+// redactURL hides the password in the url, the urls of the remotes may carry the credentials
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
 }
 
 func (t *DownloadTask) GetStatus() string {
@@ -220,3 +265,17 @@ func (t *DownloadTask) GetStatus() string {
 }
 
 var DownloadTaskManager *tache.Manager[*DownloadTask]
+
+// UnfinishedTempDirs returns the temp dirs of the download tasks not succeeded or canceled,
+// the partially downloaded files in them are resumed when the tasks run again
+func UnfinishedTempDirs() []string {
+	tasks := DownloadTaskManager.GetByCondition(func(t *DownloadTask) bool {
+		state := t.GetState()
+		return t.TempDir != "" && state != tache.StateSucceeded && state != tache.StateCanceled
+	})
+	dirs := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		dirs = append(dirs, t.TempDir)
+	}
+	return dirs
+}
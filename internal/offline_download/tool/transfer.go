@@ -3,6 +3,7 @@ package tool
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
 	stdpath "path"
@@ -28,6 +29,8 @@ type TransferTask struct {
 	fs.TaskData
 	DeletePolicy DeletePolicy `json:"delete_policy"`
 	Url          string       `json:"url"`
+	Header       http.Header  `json:"-"`
+	HasHeader    bool         `json:"has_header,omitempty"`
 	groupID      string       `json:"-"`
 }
 
@@ -51,7 +54,10 @@ func (t *TransferTask) Run() error {
 	defer func() { t.SetEndTime(time.Now()) }()
 	if t.SrcStorage == nil {
 		if t.DeletePolicy == UploadDownloadStream {
-			rr, err := stream.GetRangeReaderFromLink(t.GetTotalBytes(), &model.Link{URL: t.Url})
+			if t.HasHeader && t.Header == nil {
+				return errors.WithStack(errHeaderLost)
+			}
+			rr, err := stream.GetRangeReaderFromLink(t.GetTotalBytes(), &model.Link{URL: t.Url, Header: t.Header})
 			if err != nil {
 				return err
 			}
@@ -82,7 +88,7 @@ func (t *TransferTask) Run() error {
 
 func (t *TransferTask) GetName() string {
 	if t.DeletePolicy == UploadDownloadStream {
-		return fmt.Sprintf("upload [%s](%s) to [%s](%s)", t.SrcActualPath, t.Url, t.DstStorageMp, t.DstActualPath)
+		return fmt.Sprintf("upload [%s](%s) to [%s](%s)", t.SrcActualPath, redactURL(t.Url), t.DstStorageMp, t.DstActualPath)
 	}
 	return fmt.Sprintf("transfer [%s](%s) to [%s](%s)", t.SrcStorageMp, t.SrcActualPath, t.DstStorageMp, t.DstActualPath)
 }
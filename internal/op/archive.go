@@ -16,6 +16,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
 	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	gocache "github.com/OpenListTeam/go-cache"
@@ -172,6 +173,14 @@ func getArchiveMeta(ctx context.Context, storage driver.Driver, path string, arg
 			return obj, archiveMetaProvider, err
 		}
 	}
+	if !args.Refresh {
+		if obj, err := GetUnwrap(ctx, storage, path); err == nil && !obj.IsDir() {
+			if idx := loadArchiveIndex(storage, path, obj); idx != nil {
+				log.Debugf("use archive index when get %s archive meta", path)
+				return obj, newToolArchiveMetaProvider(storage, idx.Meta()), nil
+			}
+		}
+	}
 	obj, t, ss, err := GetArchiveToolAndStream(ctx, storage, path, args.LinkArgs)
 	if err != nil {
 		return nil, nil, err
@@ -185,10 +194,25 @@ func getArchiveMeta(ctx context.Context, storage driver.Driver, path string, arg
 			log.Errorf("failed to close file streamer, %v", e)
 		}
 	}()
-	meta, err := t.GetMeta(ss, args.ArchiveArgs)
-	if err != nil {
-		return nil, nil, err
+	var meta model.ArchiveMeta
+	if indexer, ok := t.(tool.Indexer); ok {
+		idx, err := indexer.Index(ss, args.ArchiveArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		saveArchiveIndex(storage, path, obj, idx)
+		meta = idx.Meta()
+	} else {
+		meta, err = t.GetMeta(ss, args.ArchiveArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		saveArchiveIndex(storage, path, obj, tool.IndexFromMeta(meta))
 	}
+	return obj, newToolArchiveMetaProvider(storage, meta), nil
+}
+
+func newToolArchiveMetaProvider(storage driver.Driver, meta model.ArchiveMeta) *model.ArchiveMetaProvider {
 	archiveMetaProvider := &model.ArchiveMetaProvider{ArchiveMeta: meta, DriverProviding: false}
 	if meta.GetTree() != nil {
 		archiveMetaProvider.Sort = &storage.GetStorage().Sort
@@ -197,7 +221,7 @@ func getArchiveMeta(ctx context.Context, storage driver.Driver, path string, arg
 		Expiration := time.Minute * time.Duration(storage.GetStorage().CacheExpiration)
 		archiveMetaProvider.Expiration = &Expiration
 	}
-	return obj, archiveMetaProvider, err
+	return archiveMetaProvider
 }
 
 var (
@@ -263,6 +287,28 @@ func _listArchive(ctx context.Context, storage driver.Driver, path string, args
 			return files, err
 		}
 	}
+	// the full tree of the meta is preferred, the archive index is used directly if it's up to date,
+	// otherwise the meta is got to build a new one
+	if !args.Refresh {
+		if obj, err := GetUnwrap(ctx, storage, path); err == nil && !obj.IsDir() {
+			if idx := loadArchiveIndex(storage, path, obj); idx != nil {
+				if meta := idx.Meta(); meta.GetTree() != nil {
+					log.Debugf("use archive index when list archive [%s]%s", path, args.InnerPath)
+					return getChildrenFromArchiveMeta(meta, args.InnerPath)
+				}
+			}
+		}
+	}
+	meta, err := GetArchiveMeta(ctx, storage, path, model.ArchiveMetaArgs{
+		ArchiveArgs: args.ArchiveArgs,
+		Refresh:     args.Refresh,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if meta.GetTree() != nil {
+		return getChildrenFromArchiveMeta(meta, args.InnerPath)
+	}
 	_, t, ss, err := GetArchiveToolAndStream(ctx, storage, path, args.LinkArgs)
 	if err != nil {
 		return nil, err
@@ -471,6 +517,9 @@ func (s *streamWithParent) Close() error {
 }
 
 func InternalExtract(ctx context.Context, storage driver.Driver, path string, args model.ArchiveInnerArgs) (io.ReadCloser, int64, error) {
+	if rc, size, ok := extractFromIndex(ctx, storage, path, args); ok {
+		return rc, size, nil
+	}
 	_, t, ss, err := GetArchiveToolAndStream(ctx, storage, path, args.LinkArgs)
 	if err != nil {
 		return nil, 0, err
@@ -490,6 +539,39 @@ func InternalExtract(ctx context.Context, storage driver.Driver, path string, ar
 	return &streamWithParent{rc: rc, parents: ss}, size, nil
 }
 
+// extractFromIndex reads the stored entry from the archive directly by the offset of the archive index,
+// false is returned if the entry can't be read in this way
+func extractFromIndex(ctx context.Context, storage driver.Driver, path string, args model.ArchiveInnerArgs) (io.ReadCloser, int64, bool) {
+	obj, err := GetUnwrap(ctx, storage, path)
+	if err != nil || obj.IsDir() {
+		return nil, 0, false
+	}
+	idx := loadArchiveIndex(storage, path, obj)
+	if idx == nil {
+		return nil, 0, false
+	}
+	entry := idx.Find(args.InnerPath)
+	if entry == nil || entry.IsDir || entry.Offset < 0 || entry.Offset+entry.Size > obj.GetSize() {
+		return nil, 0, false
+	}
+	l, obj, err := Link(ctx, storage, path, args.LinkArgs)
+	if err != nil {
+		return nil, 0, false
+	}
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Ctx: ctx, Obj: obj}, l)
+	if err != nil {
+		_ = l.Close()
+		return nil, 0, false
+	}
+	r, err := ss.RangeRead(http_range.Range{Start: entry.Offset, Length: entry.Size})
+	if err != nil {
+		_ = ss.Close()
+		return nil, 0, false
+	}
+	log.Debugf("extract [%s]%s by the archive index", path, args.InnerPath)
+	return &streamWithParent{rc: io.NopCloser(r), parents: []*stream.SeekableStream{ss}}, entry.Size, true
+}
+
 func ArchiveDecompress(ctx context.Context, storage driver.Driver, srcPath, dstDirPath string, args model.ArchiveDecompressArgs, lazyCache ...bool) error {
 	if storage.Config().CheckStatus && storage.GetStorage().Status != WORK {
 		return errors.WithMessagef(errs.StorageNotInit, "storage status: %s", storage.GetStorage().Status)
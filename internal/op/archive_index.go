@@ -0,0 +1,166 @@
+package op
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/archive/tool"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	gocache "github.com/OpenListTeam/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// the version of the index file, the files of other versions are ignored
+const archiveIndexVersion = 1
+
+// archiveIndexCache keeps the recently used indexes to find the entries to extract
+var archiveIndexCache = gocache.NewMemCache(gocache.WithShards[*tool.Index](16))
+
+type archiveIndexFile struct {
+	Version  int         `json:"version"`
+	Path     string      `json:"path"`
+	Size     int64       `json:"size"`
+	Modified time.Time   `json:"modified"`
+	Index    *tool.Index `json:"index"`
+}
+
+// archiveIndexPath returns the file of the archive index, which is keyed by the path, size, modified time and hashes
+// of the archive, so the index is never used once the archive is changed. The archive without the modified time
+// or any hash is not indexed, since a change keeping its size can't be found
+func archiveIndexPath(storage driver.Driver, path string, obj model.Obj) string {
+	if conf.Conf.ArchiveIndexDir == "" {
+		return ""
+	}
+	hasHash := len(obj.GetHash().Export()) > 0
+	if !hasHash && obj.ModTime().IsZero() {
+		return ""
+	}
+	h := sha1.New()
+	h.Write([]byte(Key(storage, path)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(obj.GetSize(), 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(obj.ModTime().UnixNano(), 10)))
+	if hasHash {
+		h.Write([]byte{0})
+		h.Write([]byte(obj.GetHash().String()))
+	}
+	name := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(conf.Conf.ArchiveIndexDir, name[:2], name+".json.gz")
+}
+
+func loadArchiveIndex(storage driver.Driver, path string, obj model.Obj) *tool.Index {
+	p := archiveIndexPath(storage, path, obj)
+	if p == "" {
+		return nil
+	}
+	if idx, ok := archiveIndexCache.Get(p); ok {
+		return idx
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		log.Warnf("failed to read archive index of %s: %+v", path, err)
+		return nil
+	}
+	var data archiveIndexFile
+	if err = utils.Json.NewDecoder(zr).Decode(&data); err != nil {
+		log.Warnf("failed to read archive index of %s: %+v", path, err)
+		return nil
+	}
+	if data.Version != archiveIndexVersion || data.Index == nil || data.Path != Key(storage, path) {
+		return nil
+	}
+	// the modified time is used to clean the indexes not used for a long time
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	archiveIndexCache.Set(p, data.Index, gocache.WithEx[*tool.Index](10*time.Minute))
+	return data.Index
+}
+
+// saveArchiveIndex writes the index to the disk, the indexes of the encrypted archives are not saved
+// since the entries may be different with another password
+func saveArchiveIndex(storage driver.Driver, path string, obj model.Obj, idx *tool.Index) {
+	p := archiveIndexPath(storage, path, obj)
+	if p == "" || idx == nil || idx.Encrypted {
+		return
+	}
+	err := writeArchiveIndex(p, &archiveIndexFile{
+		Version:  archiveIndexVersion,
+		Path:     Key(storage, path),
+		Size:     obj.GetSize(),
+		Modified: obj.ModTime(),
+		Index:    idx,
+	})
+	if err != nil {
+		log.Warnf("failed to save archive index of %s: %+v", path, err)
+		return
+	}
+	archiveIndexCache.Set(p, idx, gocache.WithEx[*tool.Index](10*time.Minute))
+}
+
+func writeArchiveIndex(p string, data *archiveIndexFile) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+		return err
+	}
+	// written to a temp file first, so a broken index is never read
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	zw := gzip.NewWriter(f)
+	err = utils.Json.NewEncoder(zw).Encode(data)
+	if err == nil {
+		err = zw.Close()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// CleanArchiveIndex deletes the archive indexes not used within the max age
+func CleanArchiveIndex(maxAge time.Duration) {
+	dir := conf.Conf.ArchiveIndexDir
+	if dir == "" {
+		return
+	}
+	deadline := time.Now().Add(-maxAge)
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			return nil
+		}
+		if err = os.Remove(p); err == nil {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("failed to clean archive index: %+v", err)
+	}
+	if count > 0 {
+		log.Infof("deleted %d expired archive indexes", count)
+	}
+}
@@ -0,0 +1,110 @@
+package op_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	_ "github.com/OpenListTeam/OpenList/v4/internal/archive/archives"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+func writeTestTar(t *testing.T, w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), ModTime: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveIndex(t *testing.T) {
+	files := map[string]string{
+		"a.txt":     "hello",
+		"dir/b.txt": string(bytes.Repeat([]byte("openlist"), 1000)),
+	}
+	root := t.TempDir()
+	var buf bytes.Buffer
+	writeTestTar(t, &buf, files)
+	if err := os.WriteFile(filepath.Join(root, "test.tar"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	zw := gzip.NewWriter(&buf)
+	writeTestTar(t, zw, files)
+	_ = zw.Close()
+	if err := os.WriteFile(filepath.Join(root, "test.tar.gz"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conf.Conf.ArchiveIndexDir = t.TempDir()
+
+	ctx := context.Background()
+	_, err := op.CreateStorage(ctx, model.Storage{Driver: "Local", MountPath: "/archive_index", Addition: `{"root_folder_path":"` + root + `"}`})
+	if err != nil {
+		t.Fatalf("failed to create storage: %+v", err)
+	}
+	storage, err := op.GetStorageByMountPath("/archive_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/test.tar", "/test.tar.gz"} {
+		meta, err := op.GetArchiveMeta(ctx, storage, name, model.ArchiveMetaArgs{})
+		if err != nil {
+			t.Fatalf("failed to get meta of %s: %+v", name, err)
+		}
+		if tree := meta.GetTree(); len(tree) != 2 {
+			t.Fatalf("unexpected tree of %s: %+v", name, tree)
+		}
+		objs, err := op.ListArchive(ctx, storage, name, model.ArchiveListArgs{
+			ArchiveInnerArgs: model.ArchiveInnerArgs{InnerPath: "/dir"},
+		})
+		if err != nil || len(objs) != 1 || objs[0].GetName() != "b.txt" || objs[0].GetSize() != int64(len(files["dir/b.txt"])) {
+			t.Fatalf("unexpected list of %s: %+v, %+v", name, objs, err)
+		}
+		for inner, content := range files {
+			rc, size, err := op.InternalExtract(ctx, storage, name, model.ArchiveInnerArgs{InnerPath: "/" + inner})
+			if err != nil {
+				t.Fatalf("failed to extract %s of %s: %+v", inner, name, err)
+			}
+			data, err := io.ReadAll(rc)
+			_ = rc.Close()
+			if err != nil || size != int64(len(content)) || string(data) != content {
+				t.Fatalf("unexpected content of %s in %s: %v", inner, name, err)
+			}
+		}
+	}
+	countIndexes := func() int {
+		count := 0
+		_ = filepath.WalkDir(conf.Conf.ArchiveIndexDir, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				count++
+			}
+			return nil
+		})
+		return count
+	}
+	if n := countIndexes(); n != 2 {
+		t.Fatalf("expected 2 archive indexes, got %d", n)
+	}
+	op.CleanArchiveIndex(-time.Minute)
+	if n := countIndexes(); n != 0 {
+		t.Fatalf("expected archive indexes cleaned, got %d", n)
+	}
+}
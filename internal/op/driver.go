@@ -23,6 +23,22 @@ func RegisterDriver(driver DriverConstructor) {
 	driverMap[tempConfig.Name] = driver
 }
 
+// RegisterDriverWithItems registers a driver whose additional items are given instead of reflected from its addition,
+// e.g. the driver of a plugin
+func RegisterDriverWithItems(constructor DriverConstructor, additional []driver.Item) error {
+	config := constructor().Config()
+	if _, ok := driverMap[config.Name]; ok {
+		return errors.Errorf("driver [%s] is already registered", config.Name)
+	}
+	driverInfoMap[config.Name] = driver.Info{
+		Common:     getMainItems(config),
+		Additional: additional,
+		Config:     config,
+	}
+	driverMap[config.Name] = constructor
+	return nil
+}
+
 func GetDriver(name string) (DriverConstructor, error) {
 	n, ok := driverMap[name]
 	if !ok {
@@ -190,12 +206,13 @@ func getAdditionalItems(t reflect.Type, defaultRoot string) []driver.Item {
 			continue
 		}
 		item := driver.Item{
-			Name:     name,
-			Type:     strings.ToLower(field.Type.Name()),
-			Default:  tag.Get("default"),
-			Options:  tag.Get("options"),
-			Required: tag.Get("required") == "true",
-			Help:     tag.Get("help"),
+			Name:         name,
+			Type:         strings.ToLower(field.Type.Name()),
+			Default:      tag.Get("default"),
+			Options:      tag.Get("options"),
+			Required:     tag.Get("required") == "true",
+			Help:         tag.Get("help"),
+			Confidential: tag.Get("confidential") == "true",
 		}
 		if tag.Get("type") != "" {
 			item.Type = tag.Get("type")
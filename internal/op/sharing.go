@@ -32,13 +32,36 @@ func makeJoined(sdb []model.SharingDB) []model.Sharing {
 			files = make([]string, 0)
 		}
 		return model.Sharing{
-			SharingDB: &s,
-			Files:     files,
-			Creator:   c,
+			SharingDB:    &s,
+			Files:        files,
+			AllowedUsers: unmarshalAllowedUsers(s.AllowedUsersRaw),
+			Creator:      c,
 		}
 	})
 }
 
+func unmarshalAllowedUsers(raw string) []string {
+	var users []string
+	if raw == "" || utils.Json.UnmarshalFromString(raw, &users) != nil {
+		return make([]string, 0)
+	}
+	return users
+}
+
+func marshalSharing(sharing *model.Sharing) (err error) {
+	sharing.CreatorId = sharing.Creator.ID
+	sharing.FilesRaw, err = utils.Json.MarshalToString(utils.MustSliceConvert(sharing.Files, utils.FixAndCleanPath))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(sharing.AllowedUsers) == 0 {
+		sharing.AllowedUsersRaw = ""
+		return nil
+	}
+	sharing.AllowedUsersRaw, err = utils.Json.MarshalToString(sharing.AllowedUsers)
+	return errors.WithStack(err)
+}
+
 var sharingCache = cache.NewMemCache(cache.WithShards[*model.Sharing](8))
 var sharingG singleflight.Group[*model.Sharing]
 
@@ -63,9 +86,10 @@ func GetSharingById(id string, refresh ...bool) (*model.Sharing, error) {
 			files = make([]string, 0)
 		}
 		return &model.Sharing{
-			SharingDB: s,
-			Files:     files,
-			Creator:   creator,
+			SharingDB:    s,
+			Files:        files,
+			AllowedUsers: unmarshalAllowedUsers(s.AllowedUsersRaw),
+			Creator:      creator,
 		}, nil
 	})
 	return sharing, err
@@ -113,20 +137,16 @@ func GetSharingUnwrapPath(sharing *model.Sharing, path string) (unwrapPath strin
 }
 
 func CreateSharing(sharing *model.Sharing) (id string, err error) {
-	sharing.CreatorId = sharing.Creator.ID
-	sharing.FilesRaw, err = utils.Json.MarshalToString(utils.MustSliceConvert(sharing.Files, utils.FixAndCleanPath))
-	if err != nil {
-		return "", errors.WithStack(err)
+	if err = marshalSharing(sharing); err != nil {
+		return "", err
 	}
 	return db.CreateSharing(sharing.SharingDB)
 }
 
 func UpdateSharing(sharing *model.Sharing, skipMarshal ...bool) (err error) {
 	if !utils.IsBool(skipMarshal...) {
-		sharing.CreatorId = sharing.Creator.ID
-		sharing.FilesRaw, err = utils.Json.MarshalToString(utils.MustSliceConvert(sharing.Files, utils.FixAndCleanPath))
-		if err != nil {
-			return errors.WithStack(err)
+		if err = marshalSharing(sharing); err != nil {
+			return err
 		}
 	}
 	sharingCache.Del(sharing.ID)
@@ -135,9 +155,32 @@ func UpdateSharing(sharing *model.Sharing, skipMarshal ...bool) (err error) {
 
 func DeleteSharing(sid string) error {
 	sharingCache.Del(sid)
+	if err := db.DeleteSharingAccesses(sid); err != nil {
+		return err
+	}
 	return db.DeleteSharingById(sid)
 }
 
 func DeleteSharingsByCreatorId(creatorId uint) error {
 	return db.DeleteSharingsByCreatorId(creatorId)
 }
+
+func CreateSharingAccess(access *model.SharingAccess) error {
+	return db.CreateSharingAccess(access)
+}
+
+func AddSharingAccessBytes(id uint, bytes int64) error {
+	return db.AddSharingAccessBytes(id, bytes)
+}
+
+func GetSharingAccesses(sid string, pageIndex, pageSize int) ([]model.SharingAccess, int64, error) {
+	return db.GetSharingAccesses(sid, pageIndex, pageSize)
+}
+
+func GetSharingStats(sid string) (*model.SharingStats, error) {
+	return db.GetSharingStats(sid)
+}
+
+func CountSharingFileDownloads(sid, path string) (int64, error) {
+	return db.CountSharingFileDownloads(sid, path)
+}
@@ -56,6 +56,9 @@ func CreateStorage(ctx context.Context, storage model.Storage) (uint, error) {
 		return 0, errors.WithMessage(err, "failed get driver new")
 	}
 	storageDriver := driverNew()
+	if err = EncryptStorageAddition(&storage); err != nil {
+		return 0, errors.WithMessage(err, "failed encrypt confidential fields")
+	}
 	// insert storage to database
 	err = db.CreateStorage(&storage)
 	if err != nil {
@@ -108,7 +111,11 @@ func initStorage(ctx context.Context, storage model.Storage, storageDriver drive
 		}
 	}()
 	// Unmarshal Addition
-	err = utils.Json.UnmarshalFromString(driverStorage.Addition, storageDriver.GetAddition())
+	var addition string
+	addition, err = DecryptStorageAddition(driverStorage)
+	if err == nil {
+		err = utils.Json.UnmarshalFromString(addition, storageDriver.GetAddition())
+	}
 	if err == nil {
 		if ref, ok := storageDriver.(driver.Reference); ok {
 			if strings.HasPrefix(driverStorage.Remark, "ref:/") {
@@ -229,6 +236,14 @@ func UpdateStorage(ctx context.Context, storage model.Storage) error {
 	}
 	storage.Modified = time.Now()
 	storage.MountPath = utils.FixAndCleanPath(storage.MountPath)
+	// the masked confidential fields are unchanged
+	storage.Addition, err = restoreMaskedAddition(storage.Driver, storage.Addition, oldStorage.Addition)
+	if err != nil {
+		return err
+	}
+	if err = EncryptStorageAddition(&storage); err != nil {
+		return errors.WithMessage(err, "failed encrypt confidential fields")
+	}
 	err = db.UpdateStorage(&storage)
 	if err != nil {
 		return errors.WithMessage(err, "failed update storage in database")
@@ -301,6 +316,9 @@ func saveDriverStorage(driver driver.Driver) error {
 		return errors.Wrap(err, "error while marshal addition")
 	}
 	storage.Addition = str
+	if err = EncryptStorageAddition(storage); err != nil {
+		return errors.WithMessage(err, "failed encrypt confidential fields")
+	}
 	err = db.UpdateStorage(storage)
 	if err != nil {
 		return errors.WithMessage(err, "failed update storage in database")
@@ -0,0 +1,192 @@
+package op
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// MaskedConfidential replaces the confidential addition values in responses,
+// an update with this value keeps the stored one
+const MaskedConfidential = "********"
+
+const encryptedPrefix = "enc:v1:"
+
+// ConfidentialKey derives the key encrypting the confidential addition values from the master secret
+func ConfidentialKey(secret string) []byte {
+	key := make([]byte, 32)
+	r := hkdf.New(sha256.New, []byte(secret), nil, []byte("openlist storage confidential"))
+	_, _ = io.ReadFull(r, key)
+	return key
+}
+
+func encryptValue(key []byte, value string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+func decryptValue(key []byte, value string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed decrypt confidential value, the master secret may have been changed")
+	}
+	return string(plain), nil
+}
+
+func confidentialFields(driverName string) []string {
+	var fields []string
+	for _, item := range driverInfoMap[driverName].Additional {
+		if item.Confidential {
+			fields = append(fields, item.Name)
+		}
+	}
+	return fields
+}
+
+// mapConfidential calls f on every non-empty confidential string value of the addition
+func mapConfidential(driverName, addition string, f func(name, value string) (string, error)) (string, error) {
+	fields := confidentialFields(driverName)
+	if len(fields) == 0 || addition == "" {
+		return addition, nil
+	}
+	var m map[string]any
+	if err := utils.Json.UnmarshalFromString(addition, &m); err != nil {
+		return "", errors.Wrap(err, "error while unmarshal addition")
+	}
+	changed := false
+	for _, name := range fields {
+		v, ok := m[name].(string)
+		if !ok || v == "" {
+			continue
+		}
+		nv, err := f(name, v)
+		if err != nil {
+			return "", errors.WithMessagef(err, "confidential field [%s]", name)
+		}
+		if nv != v {
+			m[name] = nv
+			changed = true
+		}
+	}
+	if !changed {
+		return addition, nil
+	}
+	str, err := utils.Json.MarshalToString(m)
+	return str, errors.Wrap(err, "error while marshal addition")
+}
+
+func encryptAddition(key []byte, driverName, addition string) (string, error) {
+	return mapConfidential(driverName, addition, func(_, v string) (string, error) {
+		if strings.HasPrefix(v, encryptedPrefix) {
+			return v, nil
+		}
+		return encryptValue(key, v)
+	})
+}
+
+func decryptAddition(key []byte, driverName, addition string) (string, error) {
+	return mapConfidential(driverName, addition, func(_, v string) (string, error) {
+		if !strings.HasPrefix(v, encryptedPrefix) {
+			// stored before the field was encrypted
+			return v, nil
+		}
+		return decryptValue(key, v)
+	})
+}
+
+// EncryptStorageAddition encrypts the plain confidential values of the storage addition
+func EncryptStorageAddition(storage *model.Storage) error {
+	addition, err := encryptAddition(ConfidentialKey(conf.Conf.MasterSecret), storage.Driver, storage.Addition)
+	if err != nil {
+		return err
+	}
+	storage.Addition = addition
+	return nil
+}
+
+// DecryptStorageAddition returns the storage addition with the confidential values decrypted
+func DecryptStorageAddition(storage *model.Storage) (string, error) {
+	return decryptAddition(ConfidentialKey(conf.Conf.MasterSecret), storage.Driver, storage.Addition)
+}
+
+// MaskStorageAddition replaces the confidential values of the storage addition with MaskedConfidential
+func MaskStorageAddition(storage *model.Storage) {
+	addition, err := mapConfidential(storage.Driver, storage.Addition, func(_, _ string) (string, error) {
+		return MaskedConfidential, nil
+	})
+	if err == nil {
+		storage.Addition = addition
+	}
+}
+
+// restoreMaskedAddition replaces the masked confidential values of the new addition with the old stored ones
+func restoreMaskedAddition(driverName, addition, oldAddition string) (string, error) {
+	var old map[string]any
+	return mapConfidential(driverName, addition, func(name, v string) (string, error) {
+		if v != MaskedConfidential {
+			return v, nil
+		}
+		if old == nil {
+			if err := utils.Json.UnmarshalFromString(oldAddition, &old); err != nil {
+				return "", errors.Wrap(err, "error while unmarshal old addition")
+			}
+		}
+		ov, _ := old[name].(string)
+		return ov, nil
+	})
+}
+
+// RotateStorageAddition re-encrypts the confidential values of the storage addition
+// from the key of oldSecret to the key of newSecret
+func RotateStorageAddition(storage *model.Storage, oldSecret, newSecret string) error {
+	// the confidential fields are unknown without the driver, e.g. the driver of a plugin not loaded
+	if _, ok := driverInfoMap[storage.Driver]; !ok {
+		return errors.Errorf("driver [%s] is not loaded", storage.Driver)
+	}
+	addition, err := decryptAddition(ConfidentialKey(oldSecret), storage.Driver, storage.Addition)
+	if err != nil {
+		return err
+	}
+	addition, err = encryptAddition(ConfidentialKey(newSecret), storage.Driver, addition)
+	if err != nil {
+		return err
+	}
+	storage.Addition = addition
+	return nil
+}
@@ -0,0 +1,145 @@
+package op
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+const confidentialDriver = "ConfidentialTest"
+
+func setupConfidentialDriver(t *testing.T) {
+	driverInfoMap[confidentialDriver] = driver.Info{Additional: []driver.Item{
+		{Name: "username"},
+		{Name: "password", Confidential: true},
+		{Name: "token", Confidential: true},
+	}}
+	t.Cleanup(func() {
+		delete(driverInfoMap, confidentialDriver)
+	})
+	if conf.Conf == nil {
+		conf.Conf = conf.DefaultConfig("data")
+	}
+	secret := conf.Conf.MasterSecret
+	conf.Conf.MasterSecret = "test secret"
+	t.Cleanup(func() {
+		conf.Conf.MasterSecret = secret
+	})
+}
+
+func additionMap(t *testing.T, addition string) map[string]any {
+	var m map[string]any
+	if err := utils.Json.UnmarshalFromString(addition, &m); err != nil {
+		t.Fatalf("failed to unmarshal addition %s: %+v", addition, err)
+	}
+	return m
+}
+
+func TestConfidentialRoundTrip(t *testing.T) {
+	setupConfidentialDriver(t)
+	plain := `{"username":"user","password":"pass","token":""}`
+	storage := &model.Storage{Driver: confidentialDriver, Addition: plain}
+	if err := EncryptStorageAddition(storage); err != nil {
+		t.Fatal(err)
+	}
+	m := additionMap(t, storage.Addition)
+	if m["username"] != "user" || m["token"] != "" {
+		t.Errorf("the other values are changed: %s", storage.Addition)
+	}
+	if v, _ := m["password"].(string); !strings.HasPrefix(v, encryptedPrefix) || strings.Contains(v, "pass") {
+		t.Errorf("the password is not encrypted: %s", storage.Addition)
+	}
+	addition, err := DecryptStorageAddition(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m = additionMap(t, addition); m["password"] != "pass" || m["username"] != "user" {
+		t.Errorf("wrong decrypted addition: %s", addition)
+	}
+	MaskStorageAddition(storage)
+	if m = additionMap(t, storage.Addition); m["password"] != MaskedConfidential || m["username"] != "user" ||
+		m["token"] != "" {
+		t.Errorf("wrong masked addition: %s", storage.Addition)
+	}
+}
+
+func TestConfidentialEncrypted(t *testing.T) {
+	setupConfidentialDriver(t)
+	key := ConfidentialKey(conf.Conf.MasterSecret)
+	encrypted, err := encryptValue(key, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &model.Storage{Driver: confidentialDriver,
+		Addition: `{"password":"` + encrypted + `","token":"plain"}`}
+	if err = EncryptStorageAddition(storage); err != nil {
+		t.Fatal(err)
+	}
+	m := additionMap(t, storage.Addition)
+	if m["password"] != encrypted {
+		t.Errorf("the encrypted value is encrypted again: %s", storage.Addition)
+	}
+	if v, _ := m["token"].(string); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("the plain value is not encrypted: %s", storage.Addition)
+	}
+	// the values stored before the field was confidential are kept
+	addition, err := DecryptStorageAddition(&model.Storage{Driver: confidentialDriver, Addition: `{"password":"pass"}`})
+	if err != nil || additionMap(t, addition)["password"] != "pass" {
+		t.Errorf("wrong decrypted plain value: %s, %v", addition, err)
+	}
+}
+
+func TestConfidentialRotate(t *testing.T) {
+	setupConfidentialDriver(t)
+	storage := &model.Storage{Driver: confidentialDriver, Addition: `{"username":"user","password":"pass"}`}
+	addition, err := encryptAddition(ConfidentialKey("old"), confidentialDriver, storage.Addition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Addition = addition
+	if err = RotateStorageAddition(storage, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = decryptAddition(ConfidentialKey("old"), confidentialDriver, storage.Addition); err == nil {
+		t.Error("decrypted with the old secret after the rotation")
+	}
+	addition, err = decryptAddition(ConfidentialKey("new"), confidentialDriver, storage.Addition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := additionMap(t, addition); m["password"] != "pass" || m["username"] != "user" {
+		t.Errorf("wrong rotated addition: %s", addition)
+	}
+	if err = RotateStorageAddition(storage, "old", "new"); err == nil {
+		t.Error("rotated with the wrong old secret")
+	}
+	if err = RotateStorageAddition(&model.Storage{Driver: "NotLoaded", Addition: addition}, "old", "new"); err == nil {
+		t.Error("rotated the storage of the driver not loaded")
+	}
+}
+
+func TestConfidentialRestoreMasked(t *testing.T) {
+	setupConfidentialDriver(t)
+	old := `{"username":"user","password":"enc:v1:old","token":"enc:v1:token"}`
+	addition, err := restoreMaskedAddition(confidentialDriver,
+		`{"username":"other","password":"`+MaskedConfidential+`","token":"new"}`, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := additionMap(t, addition)
+	if m["password"] != "enc:v1:old" {
+		t.Errorf("the masked value is not restored: %s", addition)
+	}
+	if m["token"] != "new" || m["username"] != "other" {
+		t.Errorf("the updated values are not kept: %s", addition)
+	}
+	// the masked value of a field not in the old addition is cleared
+	addition, err = restoreMaskedAddition(confidentialDriver, `{"password":"`+MaskedConfidential+`"}`, `{}`)
+	if err != nil || additionMap(t, addition)["password"] != "" {
+		t.Errorf("wrong addition without the old value: %s, %v", addition, err)
+	}
+}
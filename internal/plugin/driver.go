@@ -0,0 +1,324 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	protocol "github.com/OpenListTeam/OpenList/v4/pkg/plugin"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// Addition keeps the raw values of the additional items, they are only known by the plugin
+type Addition map[string]json.RawMessage
+
+// Driver forwards the calls of a storage to the plugin
+type Driver struct {
+	model.Storage
+	Addition
+	plugin *Plugin
+}
+
+func (p *Plugin) newDriver() driver.Driver {
+	return &Driver{plugin: p}
+}
+
+func (d *Driver) Config() driver.Config {
+	c := d.plugin.info.Config
+	return driver.Config{
+		Name:        c.Name,
+		LocalSort:   c.LocalSort,
+		OnlyProxy:   c.OnlyProxy,
+		NoCache:     c.NoCache,
+		NoUpload:    c.NoUpload,
+		DefaultRoot: c.DefaultRoot,
+		Alert:       c.Alert,
+		PreferProxy: c.PreferProxy,
+		NoLinkURL:   c.NoLinkURL,
+	}
+}
+
+func (d *Driver) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Driver) Init(ctx context.Context) error {
+	c, err := d.plugin.getClient()
+	if err != nil {
+		return err
+	}
+	addition, err := utils.Json.Marshal(d.Addition)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	reply, err := c.Init(ctx, &protocol.InitRequest{
+		StorageRequest: d.storageRequest(),
+		MountPath:      d.MountPath,
+		Addition:       addition,
+	})
+	if err != nil {
+		return convertErr(err)
+	}
+	if len(reply.Addition) > 0 {
+		var newAddition Addition
+		if err = utils.Json.Unmarshal(reply.Addition, &newAddition); err != nil {
+			return errors.Wrap(err, "invalid addition returned by plugin")
+		}
+		d.Addition = newAddition
+		op.MustSaveDriverStorage(d)
+	}
+	return nil
+}
+
+func (d *Driver) Drop(ctx context.Context) error {
+	c, err := d.plugin.getClient()
+	if err != nil {
+		return nil
+	}
+	return convertErr(c.Drop(ctx, d.ID))
+}
+
+func (d *Driver) storageRequest() protocol.StorageRequest {
+	return protocol.StorageRequest{Storage: d.ID}
+}
+
+// call calls f with the client of the plugin,
+// the storage is initialized again and f retried if the plugin has lost it, e.g. after a restart
+func (d *Driver) call(ctx context.Context, f func(c *protocol.Client) error) error {
+	c, err := d.plugin.getClient()
+	if err != nil {
+		return err
+	}
+	err = f(c)
+	if errors.Is(err, protocol.ErrNotInitialized) {
+		if err = d.Init(ctx); err != nil {
+			return errors.WithMessage(err, "failed init storage again")
+		}
+		if c, err = d.plugin.getClient(); err != nil {
+			return err
+		}
+		err = f(c)
+	}
+	return convertErr(err)
+}
+
+func (d *Driver) GetRoot(ctx context.Context) (model.Obj, error) {
+	var obj *protocol.Obj
+	err := d.call(ctx, func(c *protocol.Client) (err error) {
+		obj, err = c.GetRoot(ctx, d.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, errors.New("plugin returned no root")
+	}
+	return toObj(obj), nil
+}
+
+func (d *Driver) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	var objs []protocol.Obj
+	err := d.call(ctx, func(c *protocol.Client) (err error) {
+		objs, err = c.List(ctx, &protocol.ListRequest{
+			StorageRequest: d.storageRequest(),
+			Dir:            fromObj(dir),
+			Refresh:        args.Refresh,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Obj, len(objs))
+	for i := range objs {
+		res[i] = toObj(&objs[i])
+	}
+	return res, nil
+}
+
+func (d *Driver) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	f := fromObj(file)
+	var reply *protocol.LinkReply
+	err := d.call(ctx, func(c *protocol.Client) (err error) {
+		reply, err = c.Link(ctx, &protocol.LinkRequest{
+			StorageRequest: d.storageRequest(),
+			File:           f,
+			IP:             args.IP,
+			Header:         protocol.Header(args.Header),
+			Type:           args.Type,
+			Redirect:       args.Redirect,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	link := &model.Link{
+		URL:           reply.URL,
+		Header:        http.Header(reply.Header),
+		ContentLength: reply.ContentLength,
+	}
+	if reply.Expiration > 0 {
+		exp := time.Duration(reply.Expiration) * time.Second
+		link.Expiration = &exp
+	}
+	if reply.Stream {
+		link.URL = ""
+		link.RangeReader = stream.RateLimitRangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+			var rc io.ReadCloser
+			err := d.call(ctx, func(c *protocol.Client) (err error) {
+				rc, err = c.Read(ctx, &protocol.ReadRequest{
+					StorageRequest: d.storageRequest(),
+					File:           f,
+					Offset:         httpRange.Start,
+					Length:         httpRange.Length,
+				})
+				return err
+			})
+			return rc, err
+		})
+	}
+	return link, nil
+}
+
+// objCall calls a method returning an optional obj
+func (d *Driver) objCall(ctx context.Context, f func(c *protocol.Client) (*protocol.Obj, error)) (model.Obj, error) {
+	var obj *protocol.Obj
+	err := d.call(ctx, func(c *protocol.Client) (err error) {
+		obj, err = f(c)
+		return err
+	})
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	return toObj(obj), nil
+}
+
+func (d *Driver) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	return d.objCall(ctx, func(c *protocol.Client) (*protocol.Obj, error) {
+		return c.MakeDir(ctx, &protocol.MakeDirRequest{
+			StorageRequest: d.storageRequest(),
+			Parent:         fromObj(parentDir),
+			Name:           dirName,
+		})
+	})
+}
+
+func (d *Driver) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	return d.objCall(ctx, func(c *protocol.Client) (*protocol.Obj, error) {
+		return c.Move(ctx, &protocol.MoveRequest{
+			StorageRequest: d.storageRequest(),
+			Src:            fromObj(srcObj),
+			DstDir:         fromObj(dstDir),
+		})
+	})
+}
+
+func (d *Driver) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	return d.objCall(ctx, func(c *protocol.Client) (*protocol.Obj, error) {
+		return c.Rename(ctx, &protocol.RenameRequest{
+			StorageRequest: d.storageRequest(),
+			Src:            fromObj(srcObj),
+			NewName:        newName,
+		})
+	})
+}
+
+func (d *Driver) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	return d.objCall(ctx, func(c *protocol.Client) (*protocol.Obj, error) {
+		return c.Copy(ctx, &protocol.MoveRequest{
+			StorageRequest: d.storageRequest(),
+			Src:            fromObj(srcObj),
+			DstDir:         fromObj(dstDir),
+		})
+	})
+}
+
+func (d *Driver) Remove(ctx context.Context, obj model.Obj) error {
+	return d.call(ctx, func(c *protocol.Client) error {
+		return c.Remove(ctx, &protocol.RemoveRequest{
+			StorageRequest: d.storageRequest(),
+			Obj:            fromObj(obj),
+		})
+	})
+}
+
+func (d *Driver) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	c, err := d.plugin.getClient()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := c.Put(ctx, &protocol.PutHeader{
+		StorageRequest: d.storageRequest(),
+		DstDir:         fromObj(dstDir),
+		Name:           file.GetName(),
+		Size:           file.GetSize(),
+		Mimetype:       file.GetMimetype(),
+		Modified:       file.ModTime(),
+		Hashes:         fromHashInfo(file.GetHash()),
+	}, driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	}))
+	if errors.Is(err, protocol.ErrNotInitialized) {
+		// the stream is partly consumed, so the upload can't be retried here
+		if e := d.Init(ctx); e != nil {
+			return nil, errors.WithMessage(e, "failed init storage again")
+		}
+		return nil, errors.New("the storage has been initialized again by the plugin, please retry")
+	}
+	if err != nil || obj == nil {
+		return nil, convertErr(err)
+	}
+	return toObj(obj), nil
+}
+
+func (d *Driver) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	var reply *protocol.DetailsReply
+	err := d.call(ctx, func(c *protocol.Client) (err error) {
+		reply, err = c.GetDetails(ctx, d.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.StorageDetails{
+		DiskUsage: model.DiskUsage{
+			TotalSpace: reply.TotalSpace,
+			UsedSpace:  reply.UsedSpace,
+		},
+	}, nil
+}
+
+// convertErr converts the errors of the protocol to the errors of errs
+func convertErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, protocol.ErrNotImplement):
+		return errs.NotImplement
+	case errors.Is(err, protocol.ErrObjectNotFound):
+		return errs.ObjectNotFound
+	}
+	return err
+}
+
+var _ driver.Driver = (*Driver)(nil)
+var _ driver.GetRooter = (*Driver)(nil)
+var _ driver.MkdirResult = (*Driver)(nil)
+var _ driver.MoveResult = (*Driver)(nil)
+var _ driver.RenameResult = (*Driver)(nil)
+var _ driver.CopyResult = (*Driver)(nil)
+var _ driver.Remove = (*Driver)(nil)
+var _ driver.PutResult = (*Driver)(nil)
+var _ driver.WithDetails = (*Driver)(nil)
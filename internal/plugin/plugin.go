@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	protocol "github.com/OpenListTeam/OpenList/v4/pkg/plugin"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// how long the host waits for the handshake line of a launched plugin
+	handshakeTimeout = 30 * time.Second
+	// the max delay between the restarts of a crashed plugin
+	maxRestartDelay = time.Minute
+)
+
+// Plugin is an external driver, either launched and restarted by the host or running on its own
+type Plugin struct {
+	conf conf.Plugin
+	name string
+	info *protocol.InfoReply
+
+	mu      sync.RWMutex
+	client  *protocol.Client
+	cmd     *exec.Cmd
+	stopped bool
+}
+
+var plugins []*Plugin
+
+// Init starts the configured plugins and registers their drivers, it must be called before the storages are loaded
+func Init() {
+	for _, c := range conf.Conf.Plugins {
+		if c.Disabled {
+			continue
+		}
+		p := &Plugin{conf: c, name: c.Name}
+		if p.name == "" {
+			p.name = c.Path
+			if p.name == "" {
+				p.name = c.Address
+			}
+		}
+		if err := p.register(); err != nil {
+			log.Errorf("failed load plugin [%s]: %+v", p.name, err)
+			p.stop()
+			continue
+		}
+		plugins = append(plugins, p)
+		log.Infof("plugin [%s] loaded with driver [%s]", p.name, p.info.Config.Name)
+	}
+}
+
+// Release stops the launched plugins
+func Release() {
+	for _, p := range plugins {
+		p.stop()
+	}
+	plugins = nil
+}
+
+func (p *Plugin) register() error {
+	if err := p.start(); err != nil {
+		return err
+	}
+	c, err := p.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	info, err := c.Info(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "failed get driver info")
+	}
+	if info.ProtocolVersion != protocol.ProtocolVersion {
+		return errors.Errorf("unsupported protocol version %d, expected %d", info.ProtocolVersion, protocol.ProtocolVersion)
+	}
+	if info.Config.Name == "" {
+		return errors.New("the driver has no name")
+	}
+	p.info = info
+	additional := make([]driver.Item, len(info.Additional))
+	for i, item := range info.Additional {
+		additional[i] = driver.Item{
+			Name:         item.Name,
+			Type:         item.Type,
+			Default:      item.Default,
+			Options:      item.Options,
+			Required:     item.Required,
+			Help:         item.Help,
+			Confidential: item.Confidential,
+		}
+	}
+	return op.RegisterDriverWithItems(p.newDriver, additional)
+}
+
+func (p *Plugin) getClient() (*protocol.Client, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.client == nil {
+		return nil, errors.Errorf("plugin [%s] is not running", p.name)
+	}
+	return p.client, nil
+}
+
+// start connects to the plugin, launching it first if it has a path
+func (p *Plugin) start() error {
+	if p.conf.Path == "" {
+		network, address := "tcp", p.conf.Address
+		if strings.HasPrefix(address, "unix://") {
+			network, address = "unix", strings.TrimPrefix(address, "unix://")
+		}
+		if address == "" {
+			return errors.New("either path or address is required")
+		}
+		return p.connect(network, address, p.conf.Token)
+	}
+	token := p.conf.Token
+	if token == "" {
+		token = random.String(32)
+	}
+	cmd := exec.Command(p.conf.Path, p.conf.Args...)
+	cmd.Env = append(os.Environ(), p.conf.Env...)
+	cmd.Env = append(cmd.Env,
+		protocol.EnvMagic+"="+protocol.MagicValue,
+		protocol.EnvToken+"="+token,
+	)
+	cmd.Stderr = log.WithField("plugin", p.name).WriterLevel(log.WarnLevel)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed launch plugin")
+	}
+	network, address, err := readHandshake(p.name, stdout)
+	if err == nil {
+		err = p.connect(network, address, token)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	p.mu.Lock()
+	p.cmd = cmd
+	p.mu.Unlock()
+	go p.watch(cmd)
+	return nil
+}
+
+// readHandshake waits for the handshake line, the other lines of stdout are logged
+func readHandshake(name string, stdout io.Reader) (string, string, error) {
+	type handshake struct {
+		network, address string
+		err              error
+	}
+	ch := make(chan handshake, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		done := false
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !done {
+				network, address, ok, err := protocol.ParseHandshake(line)
+				if ok {
+					done = true
+					ch <- handshake{network, address, err}
+					continue
+				}
+			}
+			log.WithField("plugin", name).Info(line)
+		}
+		if !done {
+			ch <- handshake{err: errors.New("plugin exited before handshake")}
+		}
+	}()
+	select {
+	case h := <-ch:
+		return h.network, h.address, h.err
+	case <-time.After(handshakeTimeout):
+		return "", "", errors.New("timeout waiting for the handshake of plugin")
+	}
+}
+
+func (p *Plugin) connect(network, address, token string) error {
+	client, err := protocol.Dial(network, address, token)
+	if err != nil {
+		return errors.Wrapf(err, "failed connect plugin at %s", address)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		_ = p.client.Close()
+	}
+	p.client = client
+	return nil
+}
+
+// watch restarts the launched plugin if it exits, the storages are initialized again on their next call
+func (p *Plugin) watch(cmd *exec.Cmd) {
+	err := cmd.Wait()
+	p.mu.Lock()
+	if p.stopped || p.cmd != cmd {
+		p.mu.Unlock()
+		return
+	}
+	p.cmd = nil
+	if p.client != nil {
+		_ = p.client.Close()
+		p.client = nil
+	}
+	p.mu.Unlock()
+	log.Errorf("plugin [%s] exited unexpectedly: %v, restarting", p.name, err)
+	delay := time.Second
+	for {
+		time.Sleep(delay)
+		p.mu.RLock()
+		stopped := p.stopped
+		p.mu.RUnlock()
+		if stopped {
+			return
+		}
+		err = p.start()
+		if err == nil {
+			log.Infof("plugin [%s] restarted", p.name)
+			return
+		}
+		log.Errorf("failed restart plugin [%s]: %+v", p.name, err)
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+func (p *Plugin) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.client != nil {
+		_ = p.client.Close()
+		p.client = nil
+	}
+	if p.cmd != nil && p.cmd.Process != nil {
+		if err := p.cmd.Process.Kill(); err != nil {
+			log.Warnf("failed kill plugin [%s]: %v", p.name, err)
+		}
+		p.cmd = nil
+	}
+}
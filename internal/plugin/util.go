@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	protocol "github.com/OpenListTeam/OpenList/v4/pkg/plugin"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+func fromHashInfo(hi utils.HashInfo) map[string]string {
+	var hashes map[string]string
+	for ht, v := range hi.All() {
+		if hashes == nil {
+			hashes = make(map[string]string)
+		}
+		hashes[ht.Name] = v
+	}
+	return hashes
+}
+
+func fromObj(obj model.Obj) protocol.Obj {
+	o := protocol.Obj{
+		ID:       obj.GetID(),
+		Path:     obj.GetPath(),
+		Name:     obj.GetName(),
+		Size:     obj.GetSize(),
+		Modified: obj.ModTime(),
+		Created:  obj.CreateTime(),
+		IsFolder: obj.IsDir(),
+		Hashes:   fromHashInfo(obj.GetHash()),
+	}
+	o.Thumb, _ = model.GetThumb(obj)
+	return o
+}
+
+func toObj(o *protocol.Obj) model.Obj {
+	hashes := make(map[*utils.HashType]string, len(o.Hashes))
+	for name, v := range o.Hashes {
+		if ht, ok := utils.GetHashByName(name); ok {
+			hashes[ht] = v
+		}
+	}
+	obj := model.Object{
+		ID:       o.ID,
+		Path:     o.Path,
+		Name:     o.Name,
+		Size:     o.Size,
+		Modified: o.Modified,
+		Ctime:    o.Created,
+		IsFolder: o.IsFolder,
+		HashInfo: utils.NewHashInfoByMap(hashes),
+	}
+	if o.Thumb == "" {
+		return &obj
+	}
+	return &model.ObjThumb{
+		Object:    obj,
+		Thumbnail: model.Thumbnail{Thumbnail: o.Thumb},
+	}
+}
@@ -27,9 +27,11 @@ func (b *Bleve) Config() searcher.Config {
 
 func (b *Bleve) Search(ctx context.Context, req model.SearchReq) ([]model.SearchNode, int64, error) {
 	var queries []query2.Query
-	query := bleve.NewMatchQuery(req.Keywords)
-	query.SetField("name")
-	queries = append(queries, query)
+	nameQuery := bleve.NewMatchQuery(req.Keywords)
+	nameQuery.SetField("name")
+	mediaQuery := bleve.NewMatchQuery(req.Keywords)
+	mediaQuery.SetField("media")
+	queries = append(queries, bleve.NewDisjunctionQuery(nameQuery, mediaQuery))
 	if req.Scope != 0 {
 		isDir := req.Scope == 1
 		isDirQuery := bleve.NewBoolFieldQuery(isDir)
@@ -47,11 +49,14 @@ func (b *Bleve) Search(ctx context.Context, req model.SearchReq) ([]model.Search
 		return nil, 0, err
 	}
 	res, err := utils.SliceConvert(searchResults.Hits, func(src *search2.DocumentMatch) (model.SearchNode, error) {
+		// the nodes indexed before have no media field
+		media, _ := src.Fields["media"].(string)
 		return model.SearchNode{
 			Parent: src.Fields["parent"].(string),
 			Name:   src.Fields["name"].(string),
 			IsDir:  src.Fields["is_dir"].(bool),
 			Size:   int64(src.Fields["size"].(float64)),
+			Media:  media,
 		}, nil
 	})
 	return res, int64(searchResults.Total), nil
@@ -31,7 +31,7 @@ func init() {
 			IndexUid: indexUid,
 			FilterableAttributes: []string{"parent", "is_dir", "name",
 				"parent_hash", "parent_path_hashes"},
-			SearchableAttributes: []string{"name"},
+			SearchableAttributes: []string{"name", "media"},
 		}
 
 		_, err := m.Client.GetIndex(m.IndexUid)
@@ -65,11 +65,13 @@ func (m *Meilisearch) Search(ctx context.Context, req model.SearchReq) ([]model.
 	}
 	nodes, err := utils.SliceConvert(search.Hits, func(src any) (model.SearchNode, error) {
 		srcMap := src.(map[string]any)
+		media, _ := srcMap["media"].(string)
 		return model.SearchNode{
 			Parent: srcMap["parent"].(string),
 			Name:   srcMap["name"].(string),
 			IsDir:  srcMap["is_dir"].(bool),
 			Size:   int64(srcMap["size"].(float64)),
+			Media:  media,
 		}, nil
 	})
 	if err != nil {
@@ -18,6 +18,7 @@ func buildSearchDocumentFromResults(results map[string]any) *searchDocument {
 	document.SearchNode.Parent, _ = results["parent"].(string)
 	document.SearchNode.Name, _ = results["name"].(string)
 	document.SearchNode.IsDir, _ = results["is_dir"].(bool)
+	document.SearchNode.Media, _ = results["media"].(string)
 	// JSON numbers are typically float64, not int64
 	if size, ok := results["size"].(float64); ok {
 		document.SearchNode.Size = int64(size)
@@ -3,12 +3,15 @@ package search
 import (
 	"context"
 	"fmt"
+	"path"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/search/searcher"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -55,12 +58,7 @@ func Index(ctx context.Context, parent string, obj model.Obj) error {
 	if instance == nil {
 		return errs.SearchNotAvailable
 	}
-	return instance.Index(ctx, model.SearchNode{
-		Parent: parent,
-		Name:   obj.GetName(),
-		IsDir:  obj.IsDir(),
-		Size:   obj.GetSize(),
-	})
+	return instance.Index(ctx, toSearchNode(ctx, parent, obj))
 }
 
 type ObjWithParent struct {
@@ -77,16 +75,29 @@ func BatchIndex(ctx context.Context, objs []ObjWithParent) error {
 	}
 	var searchNodes []model.SearchNode
 	for i := range objs {
-		searchNodes = append(searchNodes, model.SearchNode{
-			Parent: objs[i].Parent,
-			Name:   objs[i].GetName(),
-			IsDir:  objs[i].IsDir(),
-			Size:   objs[i].GetSize(),
-		})
+		searchNodes = append(searchNodes, toSearchNode(ctx, objs[i].Parent, objs[i].Obj))
 	}
 	return instance.BatchIndex(ctx, searchNodes)
 }
 
+func toSearchNode(ctx context.Context, parent string, obj model.Obj) model.SearchNode {
+	node := model.SearchNode{
+		Parent: parent,
+		Name:   obj.GetName(),
+		IsDir:  obj.IsDir(),
+		Size:   obj.GetSize(),
+	}
+	if setting.GetBool(conf.IndexMediaMetadata) && media.Supported(obj) {
+		m, err := media.Get(ctx, path.Join(parent, obj.GetName()), obj)
+		if err != nil {
+			log.Warnf("failed to get media metadata of %s: %+v", path.Join(parent, obj.GetName()), err)
+		} else {
+			node.Media = m.Keywords(media.GPSEnabled())
+		}
+	}
+	return node
+}
+
 func init() {
 	op.RegisterSettingItemHook(conf.SearchIndex, func(item *model.SettingItem) error {
 		log.Debugf("searcher init, mode: %s", item.Value)
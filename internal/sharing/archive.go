@@ -18,8 +18,14 @@ func archiveMeta(ctx context.Context, sid, path string, args model.SharingArchiv
 	if !sharing.Valid() {
 		return sharing, nil, errors.WithStack(errs.InvalidSharing)
 	}
-	if !sharing.Verify(args.Pwd) {
-		return sharing, nil, errors.WithStack(errs.WrongShareCode)
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, err
+	}
+	if !sharing.CanBrowse() {
+		return sharing, nil, errors.WithStack(errs.PermissionDenied)
 	}
 	path = utils.FixAndCleanPath(path)
 	if len(sharing.Files) == 1 || path != "/" {
@@ -45,8 +51,14 @@ func archiveList(ctx context.Context, sid, path string, args model.SharingArchiv
 	if !sharing.Valid() {
 		return sharing, nil, errors.WithStack(errs.InvalidSharing)
 	}
-	if !sharing.Verify(args.Pwd) {
-		return sharing, nil, errors.WithStack(errs.WrongShareCode)
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, err
+	}
+	if !sharing.CanBrowse() {
+		return sharing, nil, errors.WithStack(errs.PermissionDenied)
 	}
 	path = utils.FixAndCleanPath(path)
 	if len(sharing.Files) == 1 || path != "/" {
@@ -20,11 +20,17 @@ func get(ctx context.Context, sid, path string, args model.SharingListArgs) (*mo
 	if !sharing.Valid() {
 		return sharing, nil, errors.WithStack(errs.InvalidSharing)
 	}
-	if !sharing.Verify(args.Pwd) {
-		return sharing, nil, errors.WithStack(errs.WrongShareCode)
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, err
 	}
 	path = utils.FixAndCleanPath(path)
-	if len(sharing.Files) == 1 || path != "/" {
+	if !sharing.CanBrowse() && path != "/" {
+		return sharing, nil, errors.WithStack(errs.PermissionDenied)
+	}
+	if (len(sharing.Files) == 1 && sharing.CanBrowse()) || path != "/" {
 		unwrapPath, err := op.GetSharingUnwrapPath(sharing, path)
 		if err != nil {
 			return nil, nil, errors.WithMessage(err, "failed get sharing unwrap path")
@@ -20,8 +20,14 @@ func link(ctx context.Context, sid, path string, args *LinkArgs) (*model.Sharing
 	if !sharing.Valid() {
 		return sharing, nil, nil, errors.WithStack(errs.InvalidSharing)
 	}
-	if !sharing.Verify(args.Pwd) {
-		return sharing, nil, nil, errors.WithStack(errs.WrongShareCode)
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, nil, err
+	}
+	if !sharing.CanBrowse() {
+		return sharing, nil, nil, errors.WithStack(errs.PermissionDenied)
 	}
 	path = utils.FixAndCleanPath(path)
 	if len(sharing.Files) == 1 || path != "/" {
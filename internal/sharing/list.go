@@ -19,8 +19,14 @@ func list(ctx context.Context, sid, path string, args model.SharingListArgs) (*m
 	if !sharing.Valid() {
 		return sharing, nil, errors.WithStack(errs.InvalidSharing)
 	}
-	if !sharing.Verify(args.Pwd) {
-		return sharing, nil, errors.WithStack(errs.WrongShareCode)
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, err
+	}
+	if !sharing.CanBrowse() {
+		return sharing, []model.Obj{}, nil
 	}
 	path = utils.FixAndCleanPath(path)
 	if len(sharing.Files) == 1 || path != "/" {
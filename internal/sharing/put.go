@@ -0,0 +1,163 @@
+package sharing
+
+import (
+	"context"
+	"io"
+	stdpath "path"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// uploadMu serializes the check and update of the uploads of sharings
+	uploadMu sync.Mutex
+	// uploading is the destination paths of the files being uploaded to each sharing
+	uploading = make(map[string]map[string]struct{})
+)
+
+// reserveUpload reserves the destination path of an upload to the sharing,
+// a concurrent upload of the same path would overwrite the file
+func reserveUpload(sharing *model.Sharing, path string, size int64) error {
+	uploadMu.Lock()
+	defer uploadMu.Unlock()
+	paths := uploading[sharing.ID]
+	if _, ok := paths[path]; ok {
+		return existsError(sharing)
+	}
+	if err := sharing.CheckUpload(stdpath.Base(path), size, len(paths)); err != nil {
+		return err
+	}
+	if paths == nil {
+		paths = make(map[string]struct{})
+		uploading[sharing.ID] = paths
+	}
+	paths[path] = struct{}{}
+	return nil
+}
+
+// releaseUpload releases the reserved destination path, uploadMu must be held
+func releaseUpload(sid, path string) {
+	delete(uploading[sid], path)
+	if len(uploading[sid]) == 0 {
+		delete(uploading, sid)
+	}
+}
+
+func existsError(sharing *model.Sharing) error {
+	if !sharing.CanBrowse() {
+		// don't reveal the existence of the files which can't be listed
+		return errors.WithStack(errs.SharingUploadRejected)
+	}
+	return errors.WithStack(errs.ObjectAlreadyExists)
+}
+
+// maxSizeReader fails once more than n bytes are read,
+// the declared size of an anonymous upload can't be trusted
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.r.Read(p)
+	if r.n -= int64(n); r.n < 0 {
+		return n, errors.WithStack(errs.SharingUploadLimitExceeded)
+	}
+	return n, err
+}
+
+// sharingUpload counts the file as uploaded to the sharing only after the upload task succeeds
+type sharingUpload struct {
+	*stream.FileStream
+	sid        string
+	path       string
+	onUploaded func()
+}
+
+func (u *sharingUpload) OnUploaded(succeeded bool) {
+	uploadMu.Lock()
+	defer uploadMu.Unlock()
+	releaseUpload(u.sid, u.path)
+	if !succeeded {
+		return
+	}
+	sharing, err := op.GetSharingById(u.sid, true)
+	if err != nil {
+		log.Warnf("failed count the upload of %s to sharing %s: %+v", u.GetName(), u.sid, err)
+		return
+	}
+	sharing.Uploaded += 1
+	if err = op.UpdateSharing(sharing, true); err != nil {
+		log.Warnf("failed count the upload of %s to sharing %s: %+v", u.GetName(), u.sid, err)
+	}
+	if u.onUploaded != nil {
+		u.onUploaded()
+	}
+}
+
+func put(ctx context.Context, sid, dirPath string, file *stream.FileStream, args model.SharingListArgs, onUploaded func()) (*model.Sharing, task.TaskExtensionInfo, error) {
+	sharing, err := op.GetSharingById(sid, args.Refresh)
+	if err != nil {
+		return nil, nil, errors.WithStack(errs.SharingNotFound)
+	}
+	if !sharing.Valid() {
+		return sharing, nil, errors.WithStack(errs.InvalidSharing)
+	}
+	if err = checkUser(ctx, sharing); err != nil {
+		return sharing, nil, err
+	}
+	if err = Verify(ctx, sharing, args.Pwd); err != nil {
+		return sharing, nil, err
+	}
+	name := file.GetName()
+	dstDirPath, err := op.GetSharingUnwrapPath(sharing, utils.FixAndCleanPath(dirPath))
+	if err != nil {
+		return sharing, nil, errors.WithMessage(err, "failed get sharing unwrap path")
+	}
+	creator := sharing.Creator
+	if !creator.CanWrite() {
+		meta, err := op.GetNearestMeta(dstDirPath)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			return sharing, nil, err
+		}
+		if !common.CanWrite(meta, dstDirPath) {
+			return sharing, nil, errors.WithStack(errs.PermissionDenied)
+		}
+	}
+	dstPath := stdpath.Join(dstDirPath, name)
+	if err = reserveUpload(sharing, dstPath, file.GetSize()); err != nil {
+		return sharing, nil, err
+	}
+	// the uploader is anonymous, never overwrite anything
+	if res, _ := fs.Get(ctx, dstPath, &fs.GetArgs{NoLog: true}); res != nil {
+		uploadMu.Lock()
+		releaseUpload(sid, dstPath)
+		uploadMu.Unlock()
+		return sharing, nil, existsError(sharing)
+	}
+	if sharing.MaxFileSize > 0 {
+		file.Reader = &maxSizeReader{r: file.Reader, n: sharing.MaxFileSize}
+	}
+	upload := &sharingUpload{FileStream: file, sid: sid, path: dstPath, onUploaded: onUploaded}
+	// the file is uploaded as the creator of the sharing
+	t, err := fs.PutAsTask(context.WithValue(ctx, conf.UserKey, creator), dstDirPath, upload)
+	if err != nil {
+		upload.OnUploaded(false)
+		return sharing, nil, err
+	}
+	return sharing, t, nil
+}
@@ -2,11 +2,75 @@ package sharing
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/sign"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/internal/task"
+	"github.com/OpenListTeam/go-cache"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// Token generates a short-lived session token of the sharing, which can be
+// used instead of the password. Changing the password invalidates the token.
+func Token(sharing *model.Sharing) string {
+	return sign.WithDurationSharing(tokenData(sharing), model.SharingTokenDuration)
+}
+
+func tokenData(sharing *model.Sharing) string {
+	return fmt.Sprintf("%s:%s", sharing.ID, sharing.Pwd)
+}
+
+// Verify checks the password or the session token of the sharing, wrong passwords are limited
+// per client ip and per sharing, and no password is accepted while either of them is locked
+func Verify(ctx context.Context, sharing *model.Sharing, pwd string) error {
+	if !sharing.HasPwd() {
+		return nil
+	}
+	if pwd == "" {
+		return errors.WithStack(errs.WrongShareCode)
+	}
+	if sign.VerifySharing(tokenData(sharing), pwd) == nil {
+		return nil
+	}
+	ip, _ := ctx.Value(conf.ClientIPKey).(string)
+	ipKey := "ip:" + ip
+	sidKey := "sid:" + sharing.ID
+	ipCount, _ := model.SharingAuthCache.Get(ipKey)
+	sidCount, _ := model.SharingAuthCache.Get(sidKey)
+	if ipCount >= model.DefaultMaxSharingAuthRetries {
+		model.SharingAuthCache.Expire(ipKey, model.DefaultLockDuration)
+		return errors.WithStack(errs.SharingAuthLimit)
+	}
+	if sidCount >= model.DefaultMaxSharingAuthRetriesPerSharing {
+		model.SharingAuthCache.Expire(sidKey, model.DefaultLockDuration)
+		return errors.WithStack(errs.SharingAuthLimit)
+	}
+	if !sharing.Verify(pwd) {
+		model.SharingAuthCache.Set(ipKey, ipCount+1, cache.WithEx[int](model.DefaultLockDuration))
+		model.SharingAuthCache.Set(sidKey, sidCount+1, cache.WithEx[int](model.DefaultLockDuration))
+		return errors.WithStack(errs.WrongShareCode)
+	}
+	model.SharingAuthCache.Del(ipKey)
+	return nil
+}
+
+// checkUser checks whether the user in ctx is allowed to access a restricted sharing
+func checkUser(ctx context.Context, sharing *model.Sharing) error {
+	user, _ := ctx.Value(conf.UserKey).(*model.User)
+	if sharing.AllowUser(user) {
+		return nil
+	}
+	if user == nil || user.IsGuest() {
+		return errors.WithStack(errs.SharingNeedLogin)
+	}
+	return errors.WithStack(errs.PermissionDenied)
+}
+
 func List(ctx context.Context, sid, path string, args model.SharingListArgs) (*model.Sharing, []model.Obj, error) {
 	sharing, res, err := list(ctx, sid, path, args)
 	if err != nil {
@@ -56,3 +120,14 @@ func Link(ctx context.Context, sid, path string, args *LinkArgs) (*model.Sharing
 	}
 	return sharing, res, file, nil
 }
+
+// Put uploads the file to the sharing as a task, onUploaded is called after the task succeeds
+func Put(ctx context.Context, sid, dirPath string, file *stream.FileStream, args model.SharingListArgs, onUploaded func()) (*model.Sharing, task.TaskExtensionInfo, error) {
+	sharing, t, err := put(ctx, sid, dirPath, file, args, onUploaded)
+	if err != nil {
+		log.Warnf("failed put %s to sharing %s/%s: %s", file.GetName(), sid, dirPath, err)
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return sharing, t, nil
+}
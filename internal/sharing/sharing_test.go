@@ -0,0 +1,89 @@
+package sharing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+}
+
+func testSharing(id string) *model.Sharing {
+	s := &model.Sharing{SharingDB: &model.SharingDB{ID: id}}
+	s.SetPwd("right")
+	return s
+}
+
+func ipContext(ip string) context.Context {
+	return context.WithValue(context.Background(), conf.ClientIPKey, ip)
+}
+
+func TestVerifyLock(t *testing.T) {
+	s := testSharing("lock")
+	ctx := ipContext("10.0.0.1")
+	for i := 0; i < model.DefaultMaxSharingAuthRetries; i++ {
+		if err := Verify(ctx, s, "wrong"); !errors.Is(err, errs.WrongShareCode) {
+			t.Fatalf("wrong error of attempt %d: %v", i, err)
+		}
+	}
+	if err := Verify(ctx, s, "wrong"); !errors.Is(err, errs.SharingAuthLimit) {
+		t.Errorf("the client is not locked: %v", err)
+	}
+	// the right password is rejected while locked, otherwise the lock doesn't stop guessing
+	if err := Verify(ctx, s, "right"); !errors.Is(err, errs.SharingAuthLimit) {
+		t.Errorf("the right password is accepted while locked: %v", err)
+	}
+	if err := Verify(ipContext("10.0.0.2"), s, "right"); err != nil {
+		t.Errorf("the other client is locked: %v", err)
+	}
+	// the session token is not limited
+	if err := Verify(ctx, s, Token(s)); err != nil {
+		t.Errorf("the token is rejected: %v", err)
+	}
+}
+
+func TestVerifySharingLock(t *testing.T) {
+	s := testSharing("exhaust")
+	for i := 0; i < model.DefaultMaxSharingAuthRetriesPerSharing; i++ {
+		// every ip stays under its own limit
+		ctx := ipContext(fmt.Sprintf("10.1.0.%d", i))
+		if err := Verify(ctx, s, "wrong"); !errors.Is(err, errs.WrongShareCode) {
+			t.Fatalf("wrong error of attempt %d: %v", i, err)
+		}
+	}
+	if err := Verify(ipContext("10.2.0.1"), s, "right"); !errors.Is(err, errs.SharingAuthLimit) {
+		t.Errorf("the sharing is not locked: %v", err)
+	}
+	if err := Verify(ipContext("10.2.0.1"), testSharing("other"), "right"); err != nil {
+		t.Errorf("the other sharing is locked: %v", err)
+	}
+}
+
+func TestVerifyReset(t *testing.T) {
+	s := testSharing("reset")
+	ctx := ipContext("10.3.0.1")
+	for i := 0; i < model.DefaultMaxSharingAuthRetries-1; i++ {
+		_ = Verify(ctx, s, "wrong")
+	}
+	if err := Verify(ctx, s, "right"); err != nil {
+		t.Fatalf("the right password is rejected: %v", err)
+	}
+	if err := Verify(ctx, s, "wrong"); !errors.Is(err, errs.WrongShareCode) {
+		t.Errorf("the attempts are not reset by the right password: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package sign
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/sign"
+)
+
+var onceSharing sync.Once
+var instanceSharing sign.Sign
+
+func WithDurationSharing(data string, d time.Duration) string {
+	onceSharing.Do(InstanceSharing)
+	return instanceSharing.Sign(data, time.Now().Add(d).Unix())
+}
+
+func VerifySharing(data string, sign string) error {
+	onceSharing.Do(InstanceSharing)
+	return instanceSharing.Verify(data, sign)
+}
+
+func InstanceSharing() {
+	instanceSharing = sign.NewHMACSign([]byte(setting.GetStr(conf.Token) + "-sharing"))
+}
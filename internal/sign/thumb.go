@@ -0,0 +1,41 @@
+package sign
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/sign"
+)
+
+var onceThumb sync.Once
+var instanceThumb sign.Sign
+
+func SignThumb(data string) string {
+	expire := setting.GetInt(conf.LinkExpiration, 0)
+	if expire == 0 {
+		return NotExpiredThumb(data)
+	} else {
+		return WithDurationThumb(data, time.Duration(expire)*time.Hour)
+	}
+}
+
+func WithDurationThumb(data string, d time.Duration) string {
+	onceThumb.Do(InstanceThumb)
+	return instanceThumb.Sign(data, time.Now().Add(d).Unix())
+}
+
+func NotExpiredThumb(data string) string {
+	onceThumb.Do(InstanceThumb)
+	return instanceThumb.Sign(data, 0)
+}
+
+func VerifyThumb(data string, sign string) error {
+	onceThumb.Do(InstanceThumb)
+	return instanceThumb.Verify(data, sign)
+}
+
+func InstanceThumb() {
+	instanceThumb = sign.NewHMACSign([]byte(setting.GetStr(conf.Token) + "-thumb"))
+}
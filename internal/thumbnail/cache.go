@@ -0,0 +1,114 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	iofs "io/fs"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	log "github.com/sirupsen/logrus"
+)
+
+func loadCache(ctx context.Context, key string, opts options) ([]byte, bool) {
+	name := cacheName(key, opts)
+	if opts.cacheStorage != "" {
+		p := stdpath.Join(opts.cacheStorage, name)
+		obj, err := fs.Get(ctx, p, &fs.GetArgs{NoLog: true})
+		if err != nil {
+			return nil, false
+		}
+		link, obj, err := fs.Link(ctx, p, model.LinkArgs{})
+		if err != nil {
+			return nil, false
+		}
+		defer link.Close()
+		data, err := readHead(ctx, link, obj, obj.GetSize())
+		return data, err == nil
+	}
+	if conf.Conf.ThumbnailDir == "" {
+		return nil, false
+	}
+	p := filepath.Join(conf.Conf.ThumbnailDir, filepath.FromSlash(name))
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	// the modified time is used to clean the thumbnails not used for a long time
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return data, true
+}
+
+func saveCache(ctx context.Context, key string, data []byte, opts options) error {
+	name := cacheName(key, opts)
+	if opts.cacheStorage != "" {
+		p := stdpath.Join(opts.cacheStorage, name)
+		return fs.PutDirectly(ctx, stdpath.Dir(p), &stream.FileStream{
+			Obj: &model.Object{
+				Name:     stdpath.Base(p),
+				Size:     int64(len(data)),
+				Modified: time.Now(),
+			},
+			Reader:   bytes.NewReader(data),
+			Mimetype: opts.contentType(),
+		}, true)
+	}
+	if conf.Conf.ThumbnailDir == "" {
+		return nil
+	}
+	p := filepath.Join(conf.Conf.ThumbnailDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+		return err
+	}
+	// written to a temp file first, so a broken thumbnail is never read
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Clean deletes the thumbnails in the local folder not used within the max age,
+// the thumbnails in the cache storage are kept
+func Clean(maxAge time.Duration) {
+	dir := conf.Conf.ThumbnailDir
+	if dir == "" {
+		return
+	}
+	deadline := time.Now().Add(-maxAge)
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			return nil
+		}
+		if err = os.Remove(p); err == nil {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("failed to clean thumbnails: %+v", err)
+	}
+	if count > 0 {
+		log.Infof("deleted %d expired thumbnails", count)
+	}
+}
@@ -0,0 +1,59 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/pkg/errors"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// the frame which represents the video best is picked from the first frames,
+// so the black frames at the beginning are skipped
+var snapshotArgs = ffmpeg.KwArgs{"vf": "thumbnail", "frames:v": 1, "format": "image2", "vcodec": "mjpeg"}
+
+func runFFmpeg(ctx context.Context, input *ffmpeg.Stream, in io.Reader, args ffmpeg.KwArgs) ([]byte, error) {
+	var out, stderr bytes.Buffer
+	s := ffmpeg.OutputContext(ctx, []*ffmpeg.Stream{input}, "pipe:", args).
+		GlobalArgs("-loglevel", "error").SetFfmpegPath(conf.Conf.FFmpegPath).Silent(true).
+		WithOutput(&out, &stderr)
+	if in != nil {
+		s = s.WithInput(in)
+	}
+	if err := s.Run(); err != nil {
+		return nil, errors.Wrapf(err, "ffmpeg: %s", strings.TrimSpace(stderr.String()))
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("ffmpeg: no frame is output")
+	}
+	return out.Bytes(), nil
+}
+
+func snapshotURL(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	kwargs := ffmpeg.KwArgs{}
+	if len(header) > 0 {
+		var sb strings.Builder
+		for k, vs := range header {
+			for _, v := range vs {
+				sb.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+			}
+		}
+		kwargs["headers"] = sb.String()
+	}
+	return runFFmpeg(ctx, ffmpeg.Input(url, kwargs), nil, snapshotArgs)
+}
+
+func snapshotReader(ctx context.Context, r io.Reader) ([]byte, error) {
+	return runFFmpeg(ctx, ffmpeg.Input("pipe:"), r, snapshotArgs)
+}
+
+// encodeWebP converts the jpeg thumbnail to webp, since there's no webp encoder in go
+func encodeWebP(ctx context.Context, data []byte, quality int) ([]byte, error) {
+	return runFFmpeg(ctx, ffmpeg.Input("pipe:", ffmpeg.KwArgs{"f": "image2pipe", "vcodec": "mjpeg"}), bytes.NewReader(data),
+		ffmpeg.KwArgs{"f": "webp", "vcodec": "libwebp", "quality": quality})
+}
@@ -0,0 +1,236 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	stdpath "path"
+	"runtime"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/singleflight"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	_ "golang.org/x/image/webp"
+)
+
+// the image formats which can be decoded without ffmpeg
+var imageExts = []string{"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp"}
+
+// maxImagePixels limits the memory to decode an image, about 4 bytes per pixel
+var maxImagePixels int64 = 100e6
+
+type Thumb struct {
+	Data        []byte
+	ContentType string
+}
+
+type options struct {
+	size          int
+	format        string
+	quality       int
+	maxImageSize  int64
+	videoHeadSize int64
+	cacheStorage  string
+}
+
+func getOptions() options {
+	return options{
+		size:          max(setting.GetInt(conf.ThumbnailSize, 320), 16),
+		format:        setting.GetStr(conf.ThumbnailFormat, "jpeg"),
+		quality:       min(max(setting.GetInt(conf.ThumbnailQuality, 80), 1), 100),
+		maxImageSize:  int64(setting.GetInt(conf.ThumbnailMaxImageSize, 20)) << 20,
+		videoHeadSize: int64(setting.GetInt(conf.ThumbnailVideoHeadSize, 16)) << 20,
+		cacheStorage:  cacheStorage(),
+	}
+}
+
+// cacheStorage returns the path to store the thumbnails, empty for the local folder
+func cacheStorage() string {
+	storage := setting.GetStr(conf.ThumbnailCacheStorage)
+	if storage == "" {
+		return ""
+	}
+	return utils.FixAndCleanPath(storage)
+}
+
+func (o options) contentType() string {
+	if o.format == "webp" {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+func (o options) ext() string {
+	if o.format == "webp" {
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// Enabled reports whether the thumbnails are generated for the objects without a thumbnail
+func Enabled() bool {
+	return setting.GetBool(conf.ThumbnailEnabled)
+}
+
+// Supported reports whether a thumbnail can be generated for the object at the path
+func Supported(path string, obj model.Obj) bool {
+	if obj.IsDir() || obj.GetSize() == 0 {
+		return false
+	}
+	// the thumbnails of the thumbnails are never generated
+	if storage := cacheStorage(); storage != "" && utils.IsSubPath(storage, path) {
+		return false
+	}
+	ext := utils.Ext(obj.GetName())
+	switch utils.GetFileType(obj.GetName()) {
+	case conf.IMAGE:
+		return utils.SliceContains(imageExts, ext)
+	case conf.VIDEO:
+		return ext != "m3u8"
+	}
+	return false
+}
+
+var (
+	thumbG singleflight.Group[*Thumb]
+	// limits the thumbnails generated at the same time, decoding the images takes a lot of memory
+	generating = make(chan struct{}, max(runtime.NumCPU()/2, 1))
+)
+
+// Get returns the thumbnail of the object at the path, it's generated if not cached
+func Get(ctx context.Context, path string, obj model.Obj) (*Thumb, error) {
+	if !Supported(path, obj) {
+		return nil, errors.New("thumbnail is not supported for the file")
+	}
+	opts := getOptions()
+	key := cacheKey(path, obj, opts)
+	thumb, err, _ := thumbG.Do(key, func() (*Thumb, error) {
+		if data, ok := loadCache(ctx, key, opts); ok {
+			return &Thumb{Data: data, ContentType: opts.contentType()}, nil
+		}
+		select {
+		case generating <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		data, err := generate(ctx, path, obj, opts)
+		<-generating
+		if err != nil {
+			return nil, err
+		}
+		if err := saveCache(ctx, key, data, opts); err != nil {
+			log.Warnf("failed to save thumbnail of %s: %+v", path, err)
+		}
+		return &Thumb{Data: data, ContentType: opts.contentType()}, nil
+	})
+	return thumb, err
+}
+
+// cacheKey changes with the file and the thumbnail options, so the outdated thumbnails are never used
+func cacheKey(path string, obj model.Obj, opts options) string {
+	h := sha1.Sum([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%s\x00%d",
+		path, obj.GetSize(), obj.ModTime().UnixNano(), opts.size, opts.format, opts.quality)))
+	return hex.EncodeToString(h[:])
+}
+
+func generate(ctx context.Context, path string, obj model.Obj, opts options) ([]byte, error) {
+	link, obj, err := fs.Link(ctx, path, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	defer link.Close()
+	var img image.Image
+	if utils.GetFileType(obj.GetName()) == conf.VIDEO {
+		img, err = videoFrame(ctx, link, obj, opts)
+	} else {
+		img, err = decodeImage(ctx, link, obj, opts)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to generate thumbnail of %s", path)
+	}
+	img = imaging.Fit(img, opts.size, opts.size, imaging.Lanczos)
+	var buf bytes.Buffer
+	if err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(opts.quality)); err != nil {
+		return nil, err
+	}
+	if opts.format == "webp" {
+		return encodeWebP(ctx, buf.Bytes(), opts.quality)
+	}
+	return buf.Bytes(), nil
+}
+
+// readHead reads the first n bytes of the object
+func readHead(ctx context.Context, link *model.Link, obj model.Obj, n int64) ([]byte, error) {
+	ss, err := stream.NewSeekableStream(&stream.FileStream{Ctx: ctx, Obj: obj}, link)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+	r, err := ss.RangeRead(http_range.Range{Start: 0, Length: min(n, obj.GetSize())})
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func decodeImage(ctx context.Context, link *model.Link, obj model.Obj, opts options) (image.Image, error) {
+	if obj.GetSize() > opts.maxImageSize {
+		return nil, fmt.Errorf("the image is larger than %d MB", opts.maxImageSize>>20)
+	}
+	data, err := readHead(ctx, link, obj, obj.GetSize())
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// decode decodes the image if its pixels are within maxImagePixels, the size of the file doesn't limit them,
+// e.g. a png of a few KB can be decoded to GBs
+func decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > maxImagePixels {
+		return nil, fmt.Errorf("the image of %dx%d pixels is larger than %d megapixels", cfg.Width, cfg.Height, maxImagePixels/1e6)
+	}
+	return imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+}
+
+// videoFrame grabs a frame with ffmpeg, which seeks in the url by itself, or reads the head of the video if there's no url
+func videoFrame(ctx context.Context, link *model.Link, obj model.Obj, opts options) (image.Image, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(link.URL, "http") && link.RangeReader == nil {
+		data, err = snapshotURL(ctx, link.URL, link.Header)
+	} else {
+		var head []byte
+		head, err = readHead(ctx, link, obj, opts.videoHeadSize)
+		if err != nil {
+			return nil, err
+		}
+		data, err = snapshotReader(ctx, bytes.NewReader(head))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// cacheName returns the name of the cached thumbnail relative to the cache folder
+func cacheName(key string, opts options) string {
+	return stdpath.Join(key[:2], key+opts.ext())
+}
@@ -0,0 +1,144 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/OpenListTeam/OpenList/v4/drivers/local"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig("data")
+	db.Init(dB)
+	// loaded from the settings on start
+	conf.SlicesMap[conf.ImageTypes] = []string{"jpg", "png", "svg"}
+	conf.SlicesMap[conf.VideoTypes] = []string{"mp4", "m3u8"}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodePixels(t *testing.T) {
+	defer func(pixels int64) { maxImagePixels = pixels }(maxImagePixels)
+	maxImagePixels = 10000
+	img, err := decode(encodePNG(t, 100, 100))
+	if err != nil || img.Bounds().Dx() != 100 || img.Bounds().Dy() != 100 {
+		t.Fatalf("failed decode the image within the budget: %v", err)
+	}
+	// the png of a few hundred bytes is rejected by its pixels
+	data := encodePNG(t, 1000, 11)
+	if _, err = decode(data); err == nil || !strings.Contains(err.Error(), "1000x11") {
+		t.Errorf("decoded the image of %d bytes over the budget: %v", len(data), err)
+	}
+	if _, err = decode([]byte("not an image")); err == nil {
+		t.Error("decoded the broken image")
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for _, tt := range []struct {
+		obj  *model.Object
+		want bool
+	}{
+		{&model.Object{Name: "a.PNG", Size: 1}, true},
+		{&model.Object{Name: "a.mp4", Size: 1}, true},
+		{&model.Object{Name: "a.m3u8", Size: 1}, false},
+		{&model.Object{Name: "a.svg", Size: 1}, false},
+		{&model.Object{Name: "a.txt", Size: 1}, false},
+		{&model.Object{Name: "a.png"}, false},
+		{&model.Object{Name: "a.png", Size: 1, IsFolder: true}, false},
+	} {
+		if got := Supported("/"+tt.obj.Name, tt.obj); got != tt.want {
+			t.Errorf("wrong support of %+v: %v", tt.obj, got)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	obj := &model.Object{Name: "a.png", Size: 1, Modified: time.Unix(1700000000, 0)}
+	opts := options{size: 320, format: "jpeg", quality: 80}
+	key := cacheKey("/a.png", obj, opts)
+	changed := *obj
+	changed.Modified = changed.Modified.Add(time.Second)
+	webp := opts
+	webp.format = "webp"
+	for _, other := range []string{
+		cacheKey("/b.png", obj, opts),
+		cacheKey("/a.png", &changed, opts),
+		cacheKey("/a.png", obj, webp),
+	} {
+		if other == key {
+			t.Error("the key is not changed")
+		}
+	}
+	if name := cacheName(key, webp); name != key[:2]+"/"+key+".webp" {
+		t.Errorf("wrong cache name %s", name)
+	}
+}
+
+func TestGet(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.png"), encodePNG(t, 1000, 500), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	conf.Conf.ThumbnailDir = t.TempDir()
+	ctx := context.Background()
+	_, err := op.CreateStorage(ctx, model.Storage{Driver: "Local", MountPath: "/thumbnail", Addition: `{"root_folder_path":"` + root + `"}`})
+	if err != nil {
+		t.Fatalf("failed to create storage: %+v", err)
+	}
+	obj := &model.Object{Name: "a.png", Size: 1000, Modified: time.Unix(1700000000, 0)}
+	thumb, err := Get(ctx, "/thumbnail/a.png", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb.Data))
+	if err != nil || format != "jpeg" || thumb.ContentType != "image/jpeg" || cfg.Width != 320 || cfg.Height != 160 {
+		t.Errorf("wrong thumbnail %s of %dx%d: %v", format, cfg.Width, cfg.Height, err)
+	}
+	// the thumbnail is read from the cache after the file is removed
+	if err = os.Remove(filepath.Join(root, "a.png")); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := Get(ctx, "/thumbnail/a.png", obj)
+	if err != nil || !bytes.Equal(cached.Data, thumb.Data) {
+		t.Errorf("the thumbnail is not cached: %v", err)
+	}
+
+	// the thumbnails not used within the max age are cleaned
+	Clean(time.Hour)
+	if _, ok := loadCache(ctx, cacheKey("/thumbnail/a.png", obj, getOptions()), getOptions()); !ok {
+		t.Error("the thumbnail used recently is cleaned")
+	}
+	Clean(-time.Hour)
+	if _, err = Get(ctx, "/thumbnail/a.png", obj); err == nil {
+		t.Error("the thumbnail is not cleaned")
+	}
+}
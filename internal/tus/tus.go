@@ -0,0 +1,333 @@
+package tus
+
+import (
+	"io"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/cron"
+	"github.com/OpenListTeam/OpenList/v4/pkg/generic_sync"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TempDirName is the folder in conf.Conf.TempDir where uploads are staged,
+// it is kept when cleaning the temp dir so that uploads can be resumed after restart
+const TempDirName = "tus"
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrLocked         = errors.New("upload is being written by another request")
+	ErrSizeExceeded   = errors.New("upload exceeds its declared length")
+	ErrNotComplete    = errors.New("upload is not complete")
+)
+
+// Info is the persisted state of an upload session
+type Info struct {
+	ID        string            `json:"id"`
+	UserID    uint              `json:"user_id"`
+	Path      string            `json:"path"` // the destination file path
+	Size      int64             `json:"size"`
+	Offset    int64             `json:"offset"`
+	Partial   bool              `json:"partial"`
+	Modified  time.Time         `json:"modified"`
+	Mimetype  string            `json:"mimetype"`
+	Hash      map[string]string `json:"hash"`
+	Metadata  map[string]string `json:"metadata"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type Session struct {
+	Info
+	mu      sync.Mutex
+	writing bool
+	// the upload is handed over to an upload task, it's kept until the task succeeds
+	handed bool
+}
+
+var (
+	sessions  generic_sync.MapOf[string, *Session]
+	cleanCron *cron.Cron
+)
+
+func dir() string {
+	return filepath.Join(conf.Conf.TempDir, TempDirName)
+}
+
+func (s *Session) dataPath() string {
+	return filepath.Join(dir(), s.ID+".bin")
+}
+
+func (s *Session) infoPath() string {
+	return filepath.Join(dir(), s.ID+".info")
+}
+
+func expiration() time.Duration {
+	return time.Duration(setting.GetInt(conf.TusUploadExpiration, 24)) * time.Hour
+}
+
+// Init loads the unfinished uploads and starts removing the expired ones periodically
+func Init() {
+	if err := os.MkdirAll(dir(), 0o777); err != nil {
+		log.Errorf("failed create tus upload dir: %+v", err)
+		return
+	}
+	entries, err := os.ReadDir(dir())
+	if err != nil {
+		log.Errorf("failed list tus upload dir: %+v", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".info" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		s := &Session{}
+		if err = utils.Json.Unmarshal(data, &s.Info); err != nil || s.ID == "" {
+			log.Warnf("invalid tus upload info %s, removed", entry.Name())
+			_ = os.Remove(filepath.Join(dir(), entry.Name()))
+			continue
+		}
+		// the data written after the last saved offset is discarded
+		if fi, err := os.Stat(s.dataPath()); err != nil || fi.Size() < s.Offset {
+			s.remove()
+			continue
+		}
+		sessions.Store(s.ID, s)
+	}
+	Clean()
+	if cleanCron != nil {
+		cleanCron.Stop()
+	}
+	cleanCron = cron.NewCron(time.Hour)
+	cleanCron.Do(Clean)
+}
+
+// Clean removes the uploads which are not updated before they expire
+func Clean() {
+	now := time.Now()
+	sessions.Range(func(id string, s *Session) bool {
+		if s.ExpiresAt.Before(now) && s.mu.TryLock() {
+			if !s.writing && !s.handed {
+				log.Infof("tus upload %s to %s expired", id, s.Path)
+				Terminate(s)
+			}
+			s.mu.Unlock()
+		}
+		return true
+	})
+}
+
+func Create(info Info) (*Session, error) {
+	info.ID = strings.ReplaceAll(uuid.NewString(), "-", "")
+	info.ExpiresAt = time.Now().Add(expiration())
+	s := &Session{Info: info}
+	f, err := os.Create(s.dataPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	_ = f.Close()
+	if err = s.save(); err != nil {
+		s.remove()
+		return nil, err
+	}
+	sessions.Store(s.ID, s)
+	return s, nil
+}
+
+func Get(id string) (*Session, error) {
+	s, ok := sessions.Load(id)
+	if !ok {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return s, nil
+}
+
+// Terminate removes the upload and its staged data
+func Terminate(s *Session) {
+	sessions.Delete(s.ID)
+	s.remove()
+}
+
+func (s *Session) remove() {
+	_ = os.Remove(s.dataPath())
+	_ = os.Remove(s.infoPath())
+}
+
+func (s *Session) save() error {
+	data, err := utils.Json.Marshal(&s.Info)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(s.infoPath(), data, 0o666))
+}
+
+func (s *Session) Complete() bool {
+	return s.Offset == s.Size
+}
+
+// Write appends the data of r at offset, the offset is saved even if reading r fails
+// so that the client can resume from where the connection dropped
+func (s *Session) Write(offset int64, r io.Reader) (int64, error) {
+	s.mu.Lock()
+	if s.writing || s.handed {
+		s.mu.Unlock()
+		return 0, errors.WithStack(ErrLocked)
+	}
+	if offset != s.Offset {
+		s.mu.Unlock()
+		return 0, errors.WithStack(ErrOffsetMismatch)
+	}
+	s.writing = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.writing = false
+		s.mu.Unlock()
+	}()
+	f, err := os.OpenFile(s.dataPath(), os.O_WRONLY, 0o666)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	// read one more byte to detect the data exceeding the declared length
+	n, err := utils.CopyWithBuffer(f, io.LimitReader(r, s.Size-offset+1))
+	if n > s.Size-offset {
+		n = s.Size - offset
+		// drop the extra byte written
+		if err = f.Truncate(s.Size); err == nil {
+			err = ErrSizeExceeded
+		}
+	}
+	s.mu.Lock()
+	s.Offset = offset + n
+	s.ExpiresAt = time.Now().Add(expiration())
+	saveErr := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return n, errors.WithStack(err)
+	}
+	return n, saveErr
+}
+
+// Concat creates a completed upload from the data of the partial uploads,
+// the partial uploads are removed
+func Concat(info Info, partials []*Session) (*Session, error) {
+	info.Size = 0
+	for _, p := range partials {
+		if !p.Complete() {
+			return nil, errors.WithMessagef(ErrNotComplete, "partial upload %s", p.ID)
+		}
+		info.Size += p.Size
+	}
+	s, err := Create(info)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.dataPath(), os.O_WRONLY|os.O_APPEND, 0o666)
+	if err != nil {
+		Terminate(s)
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+	for _, p := range partials {
+		pf, err := os.Open(p.dataPath())
+		if err != nil {
+			Terminate(s)
+			return nil, errors.WithStack(err)
+		}
+		_, err = utils.CopyWithBuffer(f, pf)
+		_ = pf.Close()
+		if err != nil {
+			Terminate(s)
+			return nil, errors.WithStack(err)
+		}
+	}
+	s.Offset = s.Size
+	if err = s.save(); err != nil {
+		Terminate(s)
+		return nil, err
+	}
+	for _, p := range partials {
+		Terminate(p)
+	}
+	return s, nil
+}
+
+// Upload is the completed upload handed over to an upload task
+type Upload struct {
+	*stream.FileStream
+	s *Session
+}
+
+// OnUploaded removes the upload once it's uploaded, otherwise the upload is kept
+// so that it can be finished again
+func (u *Upload) OnUploaded(succeeded bool) {
+	if succeeded {
+		Terminate(u.s)
+		return
+	}
+	u.s.mu.Lock()
+	u.s.handed = false
+	u.s.mu.Unlock()
+}
+
+// Stream returns the completed upload as a file stream, no more data is accepted until
+// the stream is reported by OnUploaded
+func (s *Session) Stream() (*Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.Complete() || s.Partial {
+		return nil, errors.WithStack(ErrNotComplete)
+	}
+	if s.writing || s.handed {
+		return nil, errors.WithStack(ErrLocked)
+	}
+	f, err := os.Open(s.dataPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s.handed = true
+	h := make(map[*utils.HashType]string)
+	for name, v := range s.Hash {
+		if ht, ok := utils.GetHashByName(name); ok {
+			h[ht] = v
+		}
+	}
+	name := stdpath.Base(s.Path)
+	mimetype := s.Mimetype
+	if mimetype == "" {
+		mimetype = utils.GetMimeType(name)
+	}
+	return &Upload{
+		FileStream: &stream.FileStream{
+			Obj: &model.Object{
+				Name:     name,
+				Size:     s.Size,
+				Modified: s.Modified,
+				HashInfo: utils.NewHashInfoByMap(h),
+			},
+			Reader:   f,
+			Mimetype: mimetype,
+			Closers:  utils.NewClosers(f),
+		},
+		s: s,
+	}, nil
+}
@@ -14,3 +14,36 @@ func TestCron(t *testing.T) {
 	c.Stop()
 	c.Stop()
 }
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, 2, 28, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 2, 28, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 2, 28, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 2, 29, 2, 0, 0, 0, time.UTC)},
+		{"30 8 1 * *", time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 2, 28, 11, 0, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2024, 2, 28, 11, 47, 30, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("next of %s = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 1ms"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("parse %q should fail", spec)
+		}
+	}
+}
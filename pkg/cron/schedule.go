@@ -0,0 +1,177 @@
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the standard five fields
+// (minute, hour, day of month, month, day of week), or an @every interval
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	every                         time.Duration
+}
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{min: 0, max: 6, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression like "*/15 2-6 * * mon-fri", "@daily" or "@every 1h30m"
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval of [%s]: %w", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("interval of [%s] is less than a second", spec)
+		}
+		return &Schedule{every: d}, nil
+	}
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression [%s], got %d", spec, len(fields))
+	}
+	s := &Schedule{}
+	var err error
+	for i, p := range []struct {
+		bits *uint64
+		f    field
+	}{{&s.minute, minuteField}, {&s.hour, hourField}, {&s.dom, domField}, {&s.month, monthField}, {&s.dow, dowField}} {
+		if *p.bits, err = parseField(fields[i], p.f); err != nil {
+			return nil, fmt.Errorf("invalid cron expression [%s]: %w", spec, err)
+		}
+	}
+	return s, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value [%s]", s)
+	}
+	// 7 is sunday as well
+	if f.max == 6 && v == 7 {
+		v = 0
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value [%s] out of range %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var res uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step [%s]", stepStr)
+			}
+		}
+		start, end := f.min, f.max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseValue(lo, f); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseValue(hi, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = f.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range [%s]", rng)
+			}
+		}
+		for v := start; v <= end; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
+
+func (s *Schedule) has(bitsSet uint64, v int) bool {
+	return bitsSet&(1<<uint(v)) != 0
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	// like the classic cron, when both day of month and day of week are restricted, either of them matches
+	domAll := bits.OnesCount64(s.dom) == domField.max-domField.min+1
+	dowAll := bits.OnesCount64(s.dow) == dowField.max-dowField.min+1
+	domMatch, dowMatch := s.has(s.dom, t.Day()), s.has(s.dow, int(t.Weekday()))
+	if domAll || dowAll {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first time matched by the schedule after t, or zero time if there is none
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Second)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a matching time must exist in the next few years, or never (e.g. Feb 30)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
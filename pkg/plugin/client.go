@@ -0,0 +1,193 @@
+package plugin
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client calls the methods of a plugin
+type Client struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// Dial connects to the plugin listening on the address, network is tcp or unix
+func Dial(network, address, token string) (*Client, error) {
+	target := "passthrough:///" + address
+	if network == "unix" {
+		target = "unix://" + address
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, token: token}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) withToken(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TokenMetadata, c.token)
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, reply any) error {
+	return fromStatus(c.conn.Invoke(c.withToken(ctx), FullMethod(method), req, reply))
+}
+
+func (c *Client) Info(ctx context.Context) (*InfoReply, error) {
+	var reply InfoReply
+	return &reply, c.invoke(ctx, MethodInfo, &Empty{}, &reply)
+}
+
+func (c *Client) Init(ctx context.Context, req *InitRequest) (*InitReply, error) {
+	var reply InitReply
+	return &reply, c.invoke(ctx, MethodInit, req, &reply)
+}
+
+func (c *Client) Drop(ctx context.Context, storage uint) error {
+	return c.invoke(ctx, MethodDrop, &StorageRequest{Storage: storage}, &Empty{})
+}
+
+func (c *Client) GetRoot(ctx context.Context, storage uint) (*Obj, error) {
+	var reply ObjReply
+	return reply.Obj, c.invoke(ctx, MethodGetRoot, &StorageRequest{Storage: storage}, &reply)
+}
+
+func (c *Client) List(ctx context.Context, req *ListRequest) ([]Obj, error) {
+	var reply ListReply
+	return reply.Objs, c.invoke(ctx, MethodList, req, &reply)
+}
+
+func (c *Client) Link(ctx context.Context, req *LinkRequest) (*LinkReply, error) {
+	var reply LinkReply
+	return &reply, c.invoke(ctx, MethodLink, req, &reply)
+}
+
+func (c *Client) MakeDir(ctx context.Context, req *MakeDirRequest) (*Obj, error) {
+	var reply ObjReply
+	return reply.Obj, c.invoke(ctx, MethodMakeDir, req, &reply)
+}
+
+func (c *Client) Move(ctx context.Context, req *MoveRequest) (*Obj, error) {
+	var reply ObjReply
+	return reply.Obj, c.invoke(ctx, MethodMove, req, &reply)
+}
+
+func (c *Client) Rename(ctx context.Context, req *RenameRequest) (*Obj, error) {
+	var reply ObjReply
+	return reply.Obj, c.invoke(ctx, MethodRename, req, &reply)
+}
+
+func (c *Client) Copy(ctx context.Context, req *MoveRequest) (*Obj, error) {
+	var reply ObjReply
+	return reply.Obj, c.invoke(ctx, MethodCopy, req, &reply)
+}
+
+func (c *Client) Remove(ctx context.Context, req *RemoveRequest) error {
+	return c.invoke(ctx, MethodRemove, req, &Empty{})
+}
+
+func (c *Client) GetDetails(ctx context.Context, storage uint) (*DetailsReply, error) {
+	var reply DetailsReply
+	return &reply, c.invoke(ctx, MethodGetDetails, &StorageRequest{Storage: storage}, &reply)
+}
+
+// Read returns a reader of the data streamed by the plugin, it must be closed to release the stream
+func (c *Client) Read(ctx context.Context, req *ReadRequest) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.conn.NewStream(c.withToken(ctx), &grpc.StreamDesc{
+		StreamName:    MethodRead,
+		ServerStreams: true,
+	}, FullMethod(MethodRead))
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	if err = stream.SendMsg(req); err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	return &chunkReader{stream: stream, cancel: cancel}, nil
+}
+
+type chunkReader struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	chunk  Chunk
+	off    int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.off >= len(r.chunk.Data) {
+		if err := r.stream.RecvMsg(&r.chunk); err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, fromStatus(err)
+		}
+		r.off = 0
+	}
+	n := copy(p, r.chunk.Data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// Put sends the header and then the data of r to the plugin
+func (c *Client) Put(ctx context.Context, header *PutHeader, r io.Reader) (*Obj, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.conn.NewStream(c.withToken(ctx), &grpc.StreamDesc{
+		StreamName:    MethodPut,
+		ClientStreams: true,
+	}, FullMethod(MethodPut))
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	// SendMsg returns io.EOF if the stream is aborted by the plugin, the error is then got by RecvMsg
+	err = stream.SendMsg(header)
+	for err == nil {
+		// the message must not be modified after SendMsg, so every chunk has its own buffer
+		buf := make([]byte, ChunkSize)
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			err = stream.SendMsg(&Chunk{Data: buf[:n]})
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+	}
+	if err != nil && err != io.EOF {
+		return nil, fromStatus(err)
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, fromStatus(err)
+	}
+	var reply ObjReply
+	if err = stream.RecvMsg(&reply); err != nil {
+		return nil, fromStatus(err)
+	}
+	return reply.Obj, nil
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotImplement is returned by the plugin if the driver doesn't support the method
+	ErrNotImplement = errors.New("not implement")
+	// ErrObjectNotFound is returned by the plugin if the obj doesn't exist
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrNotInitialized is returned by the plugin if the storage is not initialized, e.g. after a restart,
+	// the host initializes it again and retries
+	ErrNotInitialized = errors.New("storage is not initialized")
+	// ErrUnauthorized is returned by the plugin if the token is wrong
+	ErrUnauthorized = errors.New("wrong plugin token")
+)
+
+var errCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{ErrNotImplement, codes.Unimplemented},
+	{ErrObjectNotFound, codes.NotFound},
+	{ErrNotInitialized, codes.FailedPrecondition},
+	{ErrUnauthorized, codes.Unauthenticated},
+}
+
+// toStatus converts the error returned by the driver of the plugin to a gRPC status error
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for _, ec := range errCodes {
+		if errors.Is(err, ec.err) {
+			return status.Error(ec.code, err.Error())
+		}
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus converts the gRPC status error to the errors of the package if possible
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, ec := range errCodes {
+		if st.Code() == ec.code {
+			return &codeError{err: ec.err, msg: st.Message()}
+		}
+	}
+	return errors.New(st.Message())
+}
+
+// codeError keeps the message of the plugin and matches the error of its code with errors.Is
+type codeError struct {
+	err error
+	msg string
+}
+
+func (e *codeError) Error() string {
+	return e.msg
+}
+
+func (e *codeError) Unwrap() error {
+	return e.err
+}
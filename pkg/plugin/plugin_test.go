@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+type memStorage struct {
+	files map[string][]byte
+}
+
+func (s *memStorage) Init(ctx context.Context, mountPath string, addition json.RawMessage) (json.RawMessage, error) {
+	s.files = map[string][]byte{"a.txt": bytes.Repeat([]byte("0123456789"), ChunkSize/5)}
+	return nil, nil
+}
+
+func (s *memStorage) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (s *memStorage) GetRoot(ctx context.Context) (*Obj, error) {
+	return &Obj{ID: "/", Path: "/", IsFolder: true}, nil
+}
+
+func (s *memStorage) List(ctx context.Context, dir Obj, refresh bool) ([]Obj, error) {
+	var objs []Obj
+	for name, data := range s.files {
+		objs = append(objs, Obj{ID: name, Name: name, Size: int64(len(data))})
+	}
+	return objs, nil
+}
+
+func (s *memStorage) Link(ctx context.Context, req *LinkRequest) (*LinkReply, error) {
+	return &LinkReply{Stream: true}, nil
+}
+
+func (s *memStorage) Read(ctx context.Context, file Obj, offset, length int64) (io.ReadCloser, error) {
+	data, ok := s.files[file.ID]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	data = data[offset:]
+	if length >= 0 {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStorage) Put(ctx context.Context, header *PutHeader, r io.Reader) (*Obj, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.files[header.Name] = data
+	return &Obj{ID: header.Name, Name: header.Name, Size: int64(len(data))}, nil
+}
+
+func TestPlugin(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(InfoReply{Config: Config{Name: "Mem"}}, func() Storage { return &memStorage{} })
+	srv.token = "token"
+	go srv.Serve(lis)
+	ctx := context.Background()
+
+	c, err := Dial("tcp", lis.Addr().String(), "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Info(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	c.Close()
+
+	c, err = Dial("tcp", lis.Addr().String(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	info, err := c.Info(ctx)
+	if err != nil || info.Config.Name != "Mem" || info.ProtocolVersion != ProtocolVersion {
+		t.Fatalf("unexpected info %+v: %v", info, err)
+	}
+	if _, err = c.List(ctx, &ListRequest{StorageRequest: StorageRequest{Storage: 1}}); !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("expected not initialized, got %v", err)
+	}
+	if _, err = c.Init(ctx, &InitRequest{StorageRequest: StorageRequest{Storage: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := c.Read(ctx, &ReadRequest{StorageRequest: StorageRequest{Storage: 1}, File: Obj{ID: "a.txt"}, Offset: 5, Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || len(data) != ChunkSize/5*10-5 || !bytes.HasPrefix(data, []byte("56789")) {
+		t.Fatalf("unexpected read of %d bytes: %v", len(data), err)
+	}
+
+	content := bytes.Repeat([]byte("x"), ChunkSize+1)
+	obj, err := c.Put(ctx, &PutHeader{StorageRequest: StorageRequest{Storage: 1}, Name: "b.txt"}, bytes.NewReader(content))
+	if err != nil || obj == nil || obj.Size != int64(len(content)) {
+		t.Fatalf("unexpected put obj %+v: %v", obj, err)
+	}
+	objs, err := c.List(ctx, &ListRequest{StorageRequest: StorageRequest{Storage: 1}})
+	if err != nil || len(objs) != 2 {
+		t.Fatalf("unexpected objs %+v: %v", objs, err)
+	}
+	if _, err = c.MakeDir(ctx, &MakeDirRequest{StorageRequest: StorageRequest{Storage: 1}, Name: "c"}); !errors.Is(err, ErrNotImplement) {
+		t.Fatalf("expected not implement, got %v", err)
+	}
+}
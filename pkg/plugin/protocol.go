@@ -0,0 +1,294 @@
+// Package plugin defines the gRPC protocol between OpenList and the out-of-process storage driver plugins,
+// and the helpers to implement a plugin in Go.
+//
+// The service and the messages are defined in driver.proto. The messages are encoded in the proto3 JSON
+// format with the proto field names, except the data chunks of Read and Put which are sent as raw bytes,
+// so that a plugin can be implemented in any language with a gRPC library and a custom codec.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ProtocolVersion is bumped on incompatible changes of the protocol
+	ProtocolVersion = 1
+	// ServiceName is the full name of the gRPC service implemented by the plugins
+	ServiceName = "openlist.driver.v1.Driver"
+	// CodecName is the content subtype of the messages
+	CodecName = "openlist-json"
+
+	// EnvMagic is set by the host when it launches a plugin, a plugin started by hand should exit
+	EnvMagic = "OPENLIST_PLUGIN_MAGIC"
+	// MagicValue is the value of EnvMagic
+	MagicValue = "2c6d3f0b-openlist-driver-plugin"
+	// EnvToken is the token the host sends in the TokenMetadata of every call
+	EnvToken = "OPENLIST_PLUGIN_TOKEN"
+	// EnvAddress makes the plugin listen on the address instead of a random local port
+	EnvAddress = "OPENLIST_PLUGIN_ADDRESS"
+	// TokenMetadata is the metadata key of the token
+	TokenMetadata = "openlist-plugin-token"
+	// HandshakePrefix starts the line the plugin prints to stdout once it is listening:
+	// OPENLIST_PLUGIN|<protocol version>|<network>|<address>
+	HandshakePrefix = "OPENLIST_PLUGIN"
+)
+
+// the methods of the service
+const (
+	MethodInfo       = "Info"
+	MethodInit       = "Init"
+	MethodDrop       = "Drop"
+	MethodGetRoot    = "GetRoot"
+	MethodList       = "List"
+	MethodLink       = "Link"
+	MethodRead       = "Read"
+	MethodMakeDir    = "MakeDir"
+	MethodMove       = "Move"
+	MethodRename     = "Rename"
+	MethodCopy       = "Copy"
+	MethodRemove     = "Remove"
+	MethodPut        = "Put"
+	MethodGetDetails = "GetDetails"
+)
+
+// FullMethod returns the full gRPC method name of the method
+func FullMethod(method string) string {
+	return "/" + ServiceName + "/" + method
+}
+
+// ChunkSize is the max size of the data chunks sent by Read and Put
+const ChunkSize = 1024 * 1024
+
+// Config mirrors the driver config shown in the admin UI
+type Config struct {
+	Name        string `json:"name"`
+	LocalSort   bool   `json:"local_sort"`
+	OnlyProxy   bool   `json:"only_proxy"`
+	NoCache     bool   `json:"no_cache"`
+	NoUpload    bool   `json:"no_upload"`
+	DefaultRoot string `json:"default_root"`
+	Alert       string `json:"alert"`
+	PreferProxy bool   `json:"prefer_proxy"`
+	// NoLinkURL should be set if Link streams the data instead of returning a URL
+	NoLinkURL bool `json:"no_link_url"`
+}
+
+// Item is an additional item of the driver, Type is one of string, bool, number, text and select
+type Item struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Default      string `json:"default"`
+	Options      string `json:"options"`
+	Required     bool   `json:"required"`
+	Help         string `json:"help"`
+	Confidential bool   `json:"confidential,omitempty"`
+}
+
+type Empty struct{}
+
+type InfoReply struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	Config          Config `json:"config"`
+	Additional      []Item `json:"additional"`
+}
+
+// Obj is a file or a folder, the ID is given back to the plugin as it is
+type Obj struct {
+	ID       string            `json:"id"`
+	Path     string            `json:"path"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size,string"`
+	Modified time.Time         `json:"modified"`
+	Created  time.Time         `json:"created"`
+	IsFolder bool              `json:"is_folder"`
+	Hashes   map[string]string `json:"hashes,omitempty"`
+	Thumb    string            `json:"thumb,omitempty"`
+}
+
+// StorageRequest identifies the storage, a plugin serves all storages of its driver
+type StorageRequest struct {
+	Storage uint `json:"storage,string"`
+}
+
+type InitRequest struct {
+	StorageRequest
+	MountPath string          `json:"mount_path"`
+	Addition  json.RawMessage `json:"addition"`
+}
+
+type InitReply struct {
+	// Addition is saved by the host if not empty, e.g. with a refreshed token
+	Addition json.RawMessage `json:"addition,omitempty"`
+}
+
+type ObjReply struct {
+	Obj *Obj `json:"obj,omitempty"`
+}
+
+type ListRequest struct {
+	StorageRequest
+	Dir     Obj  `json:"dir"`
+	Refresh bool `json:"refresh"`
+}
+
+type ListReply struct {
+	Objs []Obj `json:"objs"`
+}
+
+type LinkRequest struct {
+	StorageRequest
+	File     Obj    `json:"file"`
+	IP       string `json:"ip"`
+	Header   Header `json:"header,omitempty"`
+	Type     string `json:"type"`
+	Redirect bool   `json:"redirect"`
+}
+
+type LinkReply struct {
+	URL    string `json:"url,omitempty"`
+	Header Header `json:"header,omitempty"`
+	// Expiration in seconds of the link in the link cache, 0 for the default
+	Expiration    int64 `json:"expiration,omitempty,string"`
+	ContentLength int64 `json:"content_length,omitempty,string"`
+	// Stream is true if the data should be read with the Read method instead of the URL
+	Stream bool `json:"stream,omitempty"`
+}
+
+// ReadRequest reads Length bytes from Offset, a negative Length reads to the end
+type ReadRequest struct {
+	StorageRequest
+	File   Obj   `json:"file"`
+	Offset int64 `json:"offset,string"`
+	Length int64 `json:"length,string"`
+}
+
+// Chunk is a piece of file data, it is sent as raw bytes
+type Chunk struct {
+	Data []byte
+}
+
+type MakeDirRequest struct {
+	StorageRequest
+	Parent Obj    `json:"parent"`
+	Name   string `json:"name"`
+}
+
+// MoveRequest is the request of both Move and Copy
+type MoveRequest struct {
+	StorageRequest
+	Src    Obj `json:"src"`
+	DstDir Obj `json:"dst_dir"`
+}
+
+type RenameRequest struct {
+	StorageRequest
+	Src     Obj    `json:"src"`
+	NewName string `json:"new_name"`
+}
+
+type RemoveRequest struct {
+	StorageRequest
+	Obj Obj `json:"obj"`
+}
+
+// PutHeader is the first message of Put, it is followed by the chunks of the file
+type PutHeader struct {
+	StorageRequest
+	DstDir   Obj               `json:"dst_dir"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size,string"`
+	Mimetype string            `json:"mimetype"`
+	Modified time.Time         `json:"modified"`
+	Hashes   map[string]string `json:"hashes,omitempty"`
+}
+
+type DetailsReply struct {
+	TotalSpace int64 `json:"total_space,string"`
+	UsedSpace  int64 `json:"used_space,string"`
+}
+
+// Header is a http header, it is encoded as the map of the names to the HeaderValues messages
+type Header http.Header
+
+type headerValues struct {
+	Values []string `json:"values"`
+}
+
+func (h Header) MarshalJSON() ([]byte, error) {
+	if h == nil {
+		return []byte("null"), nil
+	}
+	m := make(map[string]headerValues, len(h))
+	for k, v := range h {
+		m[k] = headerValues{Values: v}
+	}
+	return json.Marshal(m)
+}
+
+func (h *Header) UnmarshalJSON(data []byte) error {
+	var m map[string]headerValues
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m == nil {
+		*h = nil
+		return nil
+	}
+	*h = make(Header, len(m))
+	for k, v := range m {
+		(*h)[k] = v.Values
+	}
+	return nil
+}
+
+// Codec encodes Chunk as raw bytes and the other messages as JSON
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	if c, ok := v.(*Chunk); ok {
+		return c.Data, nil
+	}
+	return json.Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v any) error {
+	if c, ok := v.(*Chunk); ok {
+		// the buffer may be reused by grpc
+		c.Data = append(c.Data[:0], data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (Codec) Name() string {
+	return CodecName
+}
+
+// FormatHandshake returns the line a plugin prints to stdout once it is listening
+func FormatHandshake(network, address string) string {
+	return fmt.Sprintf("%s|%d|%s|%s", HandshakePrefix, ProtocolVersion, network, address)
+}
+
+// ParseHandshake parses the handshake line printed by the plugin, ok is false if it is not a handshake line
+func ParseHandshake(line string) (network, address string, ok bool, err error) {
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 4)
+	if len(parts) != 4 || parts[0] != HandshakePrefix {
+		return "", "", false, nil
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", "", true, fmt.Errorf("invalid protocol version [%s]", parts[1])
+	}
+	if version != ProtocolVersion {
+		return "", "", true, fmt.Errorf("unsupported protocol version %d, expected %d", version, ProtocolVersion)
+	}
+	if parts[2] != "tcp" && parts[2] != "unix" {
+		return "", "", true, fmt.Errorf("unsupported network [%s]", parts[2])
+	}
+	return parts[2], parts[3], true, nil
+}
@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type protoField struct {
+	typ, name string
+}
+
+type protoRPC struct {
+	req, reply                  string
+	clientStreams, serverStream bool
+}
+
+var (
+	messageRe = regexp.MustCompile(`(?s)\nmessage (\w+) \{(.*?)\n\}`)
+	fieldRe   = regexp.MustCompile(`(?m)^\s+(?:repeated )?([\w.]+|map<\w+, \w+>) (\w+) = \d+;`)
+	rpcRe     = regexp.MustCompile(`rpc (\w+)\((stream )?([\w.]+)\) returns \((stream )?([\w.]+)\);`)
+)
+
+// parseProto parses the messages and the rpcs of driver.proto
+func parseProto(t *testing.T) (map[string][]protoField, map[string]protoRPC) {
+	data, err := os.ReadFile("driver.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string][]protoField)
+	for _, m := range messageRe.FindAllStringSubmatch(string(data), -1) {
+		for _, f := range fieldRe.FindAllStringSubmatch(m[2], -1) {
+			messages[m[1]] = append(messages[m[1]], protoField{typ: f[1], name: f[2]})
+		}
+	}
+	rpcs := make(map[string]protoRPC)
+	for _, r := range rpcRe.FindAllStringSubmatch(string(data), -1) {
+		rpcs[r[1]] = protoRPC{req: r[3], reply: r[5], clientStreams: r[2] != "", serverStream: r[4] != ""}
+	}
+	return messages, rpcs
+}
+
+// jsonFields returns the json names and the options of the fields of the struct, including the embedded ones
+func jsonFields(typ reflect.Type, fields map[string]reflect.StructField) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous {
+			jsonFields(f.Type, fields)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+}
+
+func TestSchemaMessages(t *testing.T) {
+	messages, _ := parseProto(t)
+	goTypes := map[string]any{
+		"Config": Config{}, "Item": Item{}, "InfoReply": InfoReply{}, "Obj": Obj{}, "StorageRequest": StorageRequest{},
+		"InitRequest": InitRequest{}, "InitReply": InitReply{}, "ObjReply": ObjReply{}, "ListRequest": ListRequest{},
+		"ListReply": ListReply{}, "HeaderValues": headerValues{}, "LinkRequest": LinkRequest{}, "LinkReply": LinkReply{},
+		"ReadRequest": ReadRequest{}, "Chunk": Chunk{}, "MakeDirRequest": MakeDirRequest{}, "MoveRequest": MoveRequest{},
+		"RenameRequest": RenameRequest{}, "RemoveRequest": RemoveRequest{}, "PutHeader": PutHeader{},
+		"DetailsReply": DetailsReply{},
+	}
+	if len(messages) != len(goTypes) {
+		t.Errorf("%d messages in the schema, %d in go", len(messages), len(goTypes))
+	}
+	for name, fields := range messages {
+		v, ok := goTypes[name]
+		if !ok {
+			t.Errorf("message %s is not defined in go", name)
+			continue
+		}
+		goFields := make(map[string]reflect.StructField)
+		jsonFields(reflect.TypeOf(v), goFields)
+		if len(goFields) != len(fields) {
+			t.Errorf("message %s has %d fields in the schema, %d in go", name, len(fields), len(goFields))
+		}
+		for _, f := range fields {
+			gf, ok := goFields[f.name]
+			if !ok {
+				t.Errorf("field %s.%s is not defined in go", name, f.name)
+				continue
+			}
+			// the 64-bit integers are strings in the proto3 JSON format
+			quoted := strings.Contains(gf.Tag.Get("json"), ",string")
+			if (f.typ == "int64" || f.typ == "uint64") != quoted {
+				t.Errorf("field %s.%s of %s is quoted: %v", name, f.name, f.typ, quoted)
+			}
+		}
+	}
+}
+
+func TestSchemaService(t *testing.T) {
+	_, rpcs := parseProto(t)
+	desc := (&Server{}).serviceDesc()
+	if desc.ServiceName != ServiceName || !strings.HasPrefix(ServiceName, "openlist.driver.v1.") {
+		t.Errorf("wrong service name %s", desc.ServiceName)
+	}
+	var methods []string
+	for _, m := range desc.Methods {
+		methods = append(methods, m.MethodName)
+		if r := rpcs[m.MethodName]; r.clientStreams || r.serverStream {
+			t.Errorf("rpc %s is a stream in the schema", m.MethodName)
+		}
+	}
+	for _, s := range desc.Streams {
+		methods = append(methods, s.StreamName)
+		if r := rpcs[s.StreamName]; r.clientStreams != s.ClientStreams || r.serverStream != s.ServerStreams {
+			t.Errorf("wrong stream of rpc %s in the schema: %+v", s.StreamName, r)
+		}
+	}
+	var names []string
+	for name := range rpcs {
+		names = append(names, name)
+	}
+	sort.Strings(methods)
+	sort.Strings(names)
+	if !reflect.DeepEqual(methods, names) {
+		t.Errorf("the rpcs of the schema %v don't match the methods %v", names, methods)
+	}
+}
+
+// TestSchemaJSON decodes the messages encoded by a proto3 JSON encoder with the proto field names
+func TestSchemaJSON(t *testing.T) {
+	var req LinkRequest
+	err := Codec{}.Unmarshal([]byte(`{"storage":"3","file":{"id":"f","size":"1024","modified":"2024-05-06T07:08:09Z",
+		"is_folder":false,"hashes":{"md5":"abc"}},"header":{"Range":{"values":["bytes=0-1"]}},"redirect":true}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if req.Storage != 3 || req.File.ID != "f" || req.File.Size != 1024 || !req.File.Modified.Equal(modified) ||
+		req.File.Hashes["md5"] != "abc" || http.Header(req.Header).Get("Range") != "bytes=0-1" || !req.Redirect {
+		t.Errorf("wrong link request: %+v", req)
+	}
+
+	data, err := Codec{}.Marshal(&LinkReply{URL: "http://a", Header: Header{"Cookie": {"a", "b"}}, ContentLength: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]any
+	if err = json.Unmarshal(data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"url":            "http://a",
+		"header":         map[string]any{"Cookie": map[string]any{"values": []any{"a", "b"}}},
+		"content_length": "5",
+	}
+	if !reflect.DeepEqual(reply, want) {
+		t.Errorf("wrong link reply: %s", data)
+	}
+}
@@ -0,0 +1,359 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Storage is the driver of a plugin for one storage,
+// it may implement the optional interfaces below, the other methods return ErrNotImplement
+type Storage interface {
+	// Init initializes the storage with the addition set in the admin UI,
+	// the returned addition is saved by the host if not nil
+	Init(ctx context.Context, mountPath string, addition json.RawMessage) (json.RawMessage, error)
+	Drop(ctx context.Context) error
+	GetRoot(ctx context.Context) (*Obj, error)
+	List(ctx context.Context, dir Obj, refresh bool) ([]Obj, error)
+	// Link returns the URL of the file, or sets Stream so that the host reads the file with Reader
+	Link(ctx context.Context, req *LinkRequest) (*LinkReply, error)
+}
+
+type Reader interface {
+	// Read returns the data of the file from offset, a negative length reads to the end
+	Read(ctx context.Context, file Obj, offset, length int64) (io.ReadCloser, error)
+}
+
+type MakeDir interface {
+	MakeDir(ctx context.Context, parent Obj, name string) (*Obj, error)
+}
+
+type Move interface {
+	Move(ctx context.Context, src, dstDir Obj) (*Obj, error)
+}
+
+type Rename interface {
+	Rename(ctx context.Context, src Obj, newName string) (*Obj, error)
+}
+
+type Copy interface {
+	Copy(ctx context.Context, src, dstDir Obj) (*Obj, error)
+}
+
+type Remove interface {
+	Remove(ctx context.Context, obj Obj) error
+}
+
+type Put interface {
+	Put(ctx context.Context, header *PutHeader, r io.Reader) (*Obj, error)
+}
+
+type Details interface {
+	GetDetails(ctx context.Context) (*DetailsReply, error)
+}
+
+// Server serves the storages of a driver
+type Server struct {
+	info       InfoReply
+	newStorage func() Storage
+	token      string
+
+	mu       sync.RWMutex
+	storages map[uint]Storage
+}
+
+func NewServer(info InfoReply, newStorage func() Storage) *Server {
+	info.ProtocolVersion = ProtocolVersion
+	return &Server{
+		info:       info,
+		newStorage: newStorage,
+		token:      os.Getenv(EnvToken),
+		storages:   map[uint]Storage{},
+	}
+}
+
+// Serve starts the plugin: it listens on EnvAddress or a random local port,
+// prints the handshake line to stdout and serves until the listener fails
+func Serve(info InfoReply, newStorage func() Storage) error {
+	network, address := "tcp", "127.0.0.1:0"
+	if addr := os.Getenv(EnvAddress); addr != "" {
+		if strings.HasPrefix(addr, "unix://") {
+			network, address = "unix", strings.TrimPrefix(addr, "unix://")
+		} else {
+			address = addr
+		}
+	} else if os.Getenv(EnvMagic) != MagicValue {
+		return errors.New("this is an OpenList driver plugin, it is launched by OpenList, " +
+			"or set " + EnvAddress + " to listen on an address")
+	}
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	fmt.Println(FormatHandshake(network, lis.Addr().String()))
+	return NewServer(info, newStorage).Serve(lis)
+}
+
+// Serve serves the gRPC service on the listener
+func (s *Server) Serve(lis net.Listener) error {
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(Codec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.auth(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.auth(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	srv.RegisterService(s.serviceDesc(), s)
+	return srv.Serve(lis)
+}
+
+func (s *Server) auth(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(TokenMetadata); len(v) == 0 || v[0] != s.token {
+		return toStatus(ErrUnauthorized)
+	}
+	return nil
+}
+
+func (s *Server) storage(id uint) (Storage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.storages[id]
+	if !ok {
+		return nil, ErrNotInitialized
+	}
+	return st, nil
+}
+
+// unary makes a handler of a unary method from a function of the request
+func unary[Req any](f func(s *Server, ctx context.Context, req *Req) (any, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			reply, err := f(srv.(*Server), ctx, req.(*Req))
+			return reply, toStatus(err)
+		}
+		if interceptor == nil {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv}, handler)
+	}
+}
+
+// objMethod makes a handler of a method implemented by an optional interface of the storage
+func objMethod[Req any, I any](storage func(*Req) uint, f func(i I, ctx context.Context, req *Req) (*Obj, error)) grpc.MethodHandler {
+	return unary(func(s *Server, ctx context.Context, req *Req) (any, error) {
+		st, err := s.storage(storage(req))
+		if err != nil {
+			return nil, err
+		}
+		i, ok := st.(I)
+		if !ok {
+			return nil, ErrNotImplement
+		}
+		obj, err := f(i, ctx, req)
+		return &ObjReply{Obj: obj}, err
+	})
+}
+
+func (s *Server) serviceDesc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: MethodInfo, Handler: unary(func(s *Server, ctx context.Context, _ *Empty) (any, error) {
+				return &s.info, nil
+			})},
+			{MethodName: MethodInit, Handler: unary((*Server).init)},
+			{MethodName: MethodDrop, Handler: unary((*Server).drop)},
+			{MethodName: MethodGetRoot, Handler: unary(func(s *Server, ctx context.Context, req *StorageRequest) (any, error) {
+				st, err := s.storage(req.Storage)
+				if err != nil {
+					return nil, err
+				}
+				obj, err := st.GetRoot(ctx)
+				return &ObjReply{Obj: obj}, err
+			})},
+			{MethodName: MethodList, Handler: unary(func(s *Server, ctx context.Context, req *ListRequest) (any, error) {
+				st, err := s.storage(req.Storage)
+				if err != nil {
+					return nil, err
+				}
+				objs, err := st.List(ctx, req.Dir, req.Refresh)
+				return &ListReply{Objs: objs}, err
+			})},
+			{MethodName: MethodLink, Handler: unary(func(s *Server, ctx context.Context, req *LinkRequest) (any, error) {
+				st, err := s.storage(req.Storage)
+				if err != nil {
+					return nil, err
+				}
+				return st.Link(ctx, req)
+			})},
+			{MethodName: MethodMakeDir, Handler: objMethod(func(r *MakeDirRequest) uint { return r.Storage },
+				func(i MakeDir, ctx context.Context, r *MakeDirRequest) (*Obj, error) {
+					return i.MakeDir(ctx, r.Parent, r.Name)
+				})},
+			{MethodName: MethodMove, Handler: objMethod(func(r *MoveRequest) uint { return r.Storage },
+				func(i Move, ctx context.Context, r *MoveRequest) (*Obj, error) {
+					return i.Move(ctx, r.Src, r.DstDir)
+				})},
+			{MethodName: MethodRename, Handler: objMethod(func(r *RenameRequest) uint { return r.Storage },
+				func(i Rename, ctx context.Context, r *RenameRequest) (*Obj, error) {
+					return i.Rename(ctx, r.Src, r.NewName)
+				})},
+			{MethodName: MethodCopy, Handler: objMethod(func(r *MoveRequest) uint { return r.Storage },
+				func(i Copy, ctx context.Context, r *MoveRequest) (*Obj, error) {
+					return i.Copy(ctx, r.Src, r.DstDir)
+				})},
+			{MethodName: MethodRemove, Handler: objMethod(func(r *RemoveRequest) uint { return r.Storage },
+				func(i Remove, ctx context.Context, r *RemoveRequest) (*Obj, error) {
+					return nil, i.Remove(ctx, r.Obj)
+				})},
+			{MethodName: MethodGetDetails, Handler: unary(func(s *Server, ctx context.Context, req *StorageRequest) (any, error) {
+				st, err := s.storage(req.Storage)
+				if err != nil {
+					return nil, err
+				}
+				d, ok := st.(Details)
+				if !ok {
+					return nil, ErrNotImplement
+				}
+				return d.GetDetails(ctx)
+			})},
+		},
+		Streams: []grpc.StreamDesc{
+			{StreamName: MethodRead, ServerStreams: true, Handler: func(srv any, stream grpc.ServerStream) error {
+				return toStatus(srv.(*Server).read(stream))
+			}},
+			{StreamName: MethodPut, ClientStreams: true, Handler: func(srv any, stream grpc.ServerStream) error {
+				return toStatus(srv.(*Server).put(stream))
+			}},
+		},
+	}
+}
+
+func (s *Server) init(ctx context.Context, req *InitRequest) (any, error) {
+	st := s.newStorage()
+	addition, err := st.Init(ctx, req.MountPath, req.Addition)
+	if err != nil {
+		_ = st.Drop(ctx)
+		return nil, err
+	}
+	s.mu.Lock()
+	old := s.storages[req.Storage]
+	s.storages[req.Storage] = st
+	s.mu.Unlock()
+	if old != nil {
+		_ = old.Drop(ctx)
+	}
+	return &InitReply{Addition: addition}, nil
+}
+
+func (s *Server) drop(ctx context.Context, req *StorageRequest) (any, error) {
+	s.mu.Lock()
+	st, ok := s.storages[req.Storage]
+	delete(s.storages, req.Storage)
+	s.mu.Unlock()
+	if !ok {
+		return &Empty{}, nil
+	}
+	return &Empty{}, st.Drop(ctx)
+}
+
+func (s *Server) read(stream grpc.ServerStream) error {
+	var req ReadRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	st, err := s.storage(req.Storage)
+	if err != nil {
+		return err
+	}
+	r, ok := st.(Reader)
+	if !ok {
+		return ErrNotImplement
+	}
+	rc, err := r.Read(stream.Context(), req.File, req.Offset, req.Length)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	for {
+		// the message must not be modified after SendMsg, so every chunk has its own buffer
+		buf := make([]byte, ChunkSize)
+		n, err := io.ReadFull(rc, buf)
+		if n > 0 {
+			if err := stream.SendMsg(&Chunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamReader reads the chunks sent after the PutHeader
+type streamReader struct {
+	stream grpc.ServerStream
+	chunk  Chunk
+	off    int
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for r.off >= len(r.chunk.Data) {
+		if err := r.stream.RecvMsg(&r.chunk); err != nil {
+			return 0, err
+		}
+		r.off = 0
+	}
+	n := copy(p, r.chunk.Data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (s *Server) put(stream grpc.ServerStream) error {
+	var header PutHeader
+	if err := stream.RecvMsg(&header); err != nil {
+		return err
+	}
+	st, err := s.storage(header.Storage)
+	if err != nil {
+		return err
+	}
+	p, ok := st.(Put)
+	if !ok {
+		return ErrNotImplement
+	}
+	obj, err := p.Put(stream.Context(), &header, &streamReader{stream: stream})
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(&ObjReply{Obj: obj})
+}
@@ -41,7 +41,7 @@ func (s HMACSign) Verify(data, sign string) error {
 		return ErrSignExpired
 	}
 	// verify sign
-	if s.Sign(data, expires) != sign {
+	if !hmac.Equal([]byte(s.Sign(data, expires)), []byte(sign)) {
 		return ErrSignInvalid
 	}
 	return nil
@@ -0,0 +1,205 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// the nesting limit of the bencoded lists and dicts
+const maxDepth = 64
+
+var errInvalidBencode = errors.New("invalid bencode")
+
+// Decode decodes the bencoded value, the dicts are decoded to map[string]any,
+// the lists to []any, the integers to int64 and the strings to string
+func Decode(data []byte) (any, error) {
+	v, n, err := decodeValue(data, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, fmt.Errorf("%w: trailing data at %d", errInvalidBencode, n)
+	}
+	return v, nil
+}
+
+// decodePrefix decodes the bencoded value at the start of data, and returns the length decoded
+func decodePrefix(data []byte) (any, int, error) {
+	return decodeValue(data, 0, 0)
+}
+
+func decodeValue(data []byte, pos, depth int) (any, int, error) {
+	if pos >= len(data) {
+		return nil, pos, fmt.Errorf("%w: unexpected end", errInvalidBencode)
+	}
+	if depth > maxDepth {
+		return nil, pos, fmt.Errorf("%w: too deep", errInvalidBencode)
+	}
+	switch c := data[pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(data[pos:], 'e')
+		if end < 0 {
+			return nil, pos, fmt.Errorf("%w: unterminated integer", errInvalidBencode)
+		}
+		n, err := strconv.ParseInt(string(data[pos+1:pos+end]), 10, 64)
+		if err != nil {
+			return nil, pos, fmt.Errorf("%w: %v", errInvalidBencode, err)
+		}
+		return n, pos + end + 1, nil
+	case c == 'l':
+		list := make([]any, 0)
+		pos++
+		for pos < len(data) && data[pos] != 'e' {
+			v, next, err := decodeValue(data, pos, depth+1)
+			if err != nil {
+				return nil, next, err
+			}
+			list = append(list, v)
+			pos = next
+		}
+		if pos >= len(data) {
+			return nil, pos, fmt.Errorf("%w: unterminated list", errInvalidBencode)
+		}
+		return list, pos + 1, nil
+	case c == 'd':
+		dict := make(map[string]any)
+		pos++
+		for pos < len(data) && data[pos] != 'e' {
+			k, next, err := decodeString(data, pos)
+			if err != nil {
+				return nil, next, err
+			}
+			v, next, err := decodeValue(data, next, depth+1)
+			if err != nil {
+				return nil, next, err
+			}
+			dict[k] = v
+			pos = next
+		}
+		if pos >= len(data) {
+			return nil, pos, fmt.Errorf("%w: unterminated dict", errInvalidBencode)
+		}
+		return dict, pos + 1, nil
+	case '0' <= c && c <= '9':
+		return decodeString(data, pos)
+	default:
+		return nil, pos, fmt.Errorf("%w: unexpected %q at %d", errInvalidBencode, c, pos)
+	}
+}
+
+func decodeString(data []byte, pos int) (string, int, error) {
+	colon := bytes.IndexByte(data[pos:], ':')
+	if colon < 0 {
+		return "", pos, fmt.Errorf("%w: invalid string", errInvalidBencode)
+	}
+	n, err := strconv.Atoi(string(data[pos : pos+colon]))
+	start := pos + colon + 1
+	if err != nil || n < 0 || n > len(data)-start {
+		return "", pos, fmt.Errorf("%w: invalid string length", errInvalidBencode)
+	}
+	return string(data[start : start+n]), start + n, nil
+}
+
+// rawDictValue returns the raw bencoded bytes of the value of the key in the dict,
+// it's for the info dict of which the hash is calculated on the raw bytes
+func rawDictValue(data []byte, key string) ([]byte, error) {
+	if len(data) == 0 || data[0] != 'd' {
+		return nil, fmt.Errorf("%w: not a dict", errInvalidBencode)
+	}
+	pos := 1
+	for pos < len(data) && data[pos] != 'e' {
+		k, next, err := decodeString(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		_, end, err := decodeValue(data, next, 1)
+		if err != nil {
+			return nil, err
+		}
+		if k == key {
+			return data[next:end], nil
+		}
+		pos = end
+	}
+	return nil, fmt.Errorf("key %s not found", key)
+}
+
+// Encode encodes the value, the supported types are string, []byte, int, int64, bool, []any, []string and map[string]any
+func Encode(v any) []byte {
+	var buf bytes.Buffer
+	encodeValue(&buf, v)
+	return buf.Bytes()
+}
+
+func encodeValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.WriteString(v)
+	case []byte:
+		encodeValue(buf, string(v))
+	case int:
+		encodeValue(buf, int64(v))
+	case int64:
+		buf.WriteByte('i')
+		buf.WriteString(strconv.FormatInt(v, 10))
+		buf.WriteByte('e')
+	case bool:
+		if v {
+			encodeValue(buf, int64(1))
+		} else {
+			encodeValue(buf, int64(0))
+		}
+	case []string:
+		buf.WriteByte('l')
+		for _, s := range v {
+			encodeValue(buf, s)
+		}
+		buf.WriteByte('e')
+	case []any:
+		buf.WriteByte('l')
+		for _, e := range v {
+			encodeValue(buf, e)
+		}
+		buf.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// the keys must be sorted as raw strings
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, k := range keys {
+			encodeValue(buf, k)
+			encodeValue(buf, v[k])
+		}
+		buf.WriteByte('e')
+	default:
+		panic(fmt.Sprintf("bencode: unsupported type %T", v))
+	}
+}
+
+func dictString(d map[string]any, key string) string {
+	s, _ := d[key].(string)
+	return s
+}
+
+func dictInt(d map[string]any, key string) int64 {
+	n, _ := d[key].(int64)
+	return n
+}
+
+func dictDict(d map[string]any, key string) map[string]any {
+	m, _ := d[key].(map[string]any)
+	return m
+}
+
+func dictList(d map[string]any, key string) []any {
+	l, _ := d[key].([]any)
+	return l
+}
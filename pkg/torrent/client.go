@@ -0,0 +1,176 @@
+package torrent
+
+import (
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var DefaultDHTBootstrap = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+	"router.utorrent.com:6881",
+	"dht.libtorrent.org:25401",
+}
+
+type Config struct {
+	// the port to listen for the peers and the DHT, a random one if 0
+	ListenPort int
+	DHT        bool
+	// the bootstrap nodes of the DHT, DefaultDHTBootstrap if nil
+	DHTBootstrap []string
+	// the peers to connect of each torrent
+	MaxPeers int
+	// the peers to upload to at the same time of each torrent
+	MaxUploads int
+	HTTPClient *http.Client
+}
+
+// Client is a BitTorrent client which shares the listener and the DHT between the torrents
+type Client struct {
+	cfg      Config
+	peerID   [20]byte
+	listener net.Listener
+	port     int
+	dht      *dht
+
+	mu       sync.Mutex
+	torrents map[Hash]*Torrent
+	closed   bool
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = 50
+	}
+	if cfg.MaxUploads <= 0 {
+		cfg.MaxUploads = 8
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: time.Minute}
+	}
+	if cfg.DHTBootstrap == nil {
+		cfg.DHTBootstrap = DefaultDHTBootstrap
+	}
+	c := &Client{
+		cfg:      cfg,
+		torrents: make(map[Hash]*Torrent),
+	}
+	copy(c.peerID[:], "-OL4000-")
+	if _, err := rand.Read(c.peerID[8:]); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.ListenPort))
+	if err != nil {
+		return nil, err
+	}
+	c.listener = l
+	c.port = l.Addr().(*net.TCPAddr).Port
+	if cfg.DHT {
+		conn, err := net.ListenPacket("udp", ":"+strconv.Itoa(c.port))
+		if err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+		c.dht = newDHT(conn, cfg.DHTBootstrap)
+	}
+	go c.acceptLoop()
+	return c, nil
+}
+
+// Port returns the port listening for the peers
+func (c *Client) Port() int {
+	return c.port
+}
+
+// AddTorrent starts downloading the torrent to the dir
+func (c *Client) AddTorrent(spec *Spec, dir string) (*Torrent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errors.New("client closed")
+	}
+	if _, ok := c.torrents[spec.InfoHash]; ok {
+		return nil, errors.New("torrent already added")
+	}
+	t := newTorrent(c, spec, dir)
+	c.torrents[spec.InfoHash] = t
+	t.start()
+	return t, nil
+}
+
+// NumTorrents returns the number of the torrents running
+func (c *Client) NumTorrents() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.torrents)
+}
+
+func (c *Client) removeTorrent(t *Torrent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.torrents[t.infoHash] == t {
+		delete(c.torrents, t.infoHash)
+	}
+}
+
+// Close drops all the torrents and stops the client
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	torrents := make([]*Torrent, 0, len(c.torrents))
+	for _, t := range c.torrents {
+		torrents = append(torrents, t)
+	}
+	clear(c.torrents)
+	c.mu.Unlock()
+	for _, t := range torrents {
+		t.close()
+	}
+	if c.dht != nil {
+		c.dht.close()
+	}
+	return c.listener.Close()
+}
+
+func (c *Client) acceptLoop() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		go c.handleIncoming(conn)
+	}
+}
+
+func (c *Client) handleIncoming(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	infoHash, peerID, err := readHandshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	c.mu.Lock()
+	t := c.torrents[infoHash]
+	c.mu.Unlock()
+	if t == nil {
+		_ = conn.Close()
+		return
+	}
+	if err = writeHandshake(conn, infoHash, c.peerID, c.dht != nil); err != nil {
+		_ = conn.Close()
+		return
+	}
+	log.Debugf("torrent %s: incoming peer %s", infoHash, conn.RemoteAddr())
+	t.runPeer(conn, peerID)
+}
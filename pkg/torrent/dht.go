@@ -0,0 +1,265 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// the queries in flight of a lookup
+	dhtAlpha = 8
+	// the closest nodes to announce to
+	dhtK            = 8
+	dhtQueryTimeout = 5 * time.Second
+	dhtMaxNodes     = 512
+)
+
+// dht is a read-only node of the mainline DHT of BEP 5 and BEP 43,
+// it only looks up the peers of the torrents and announces itself, the queries are never answered
+type dht struct {
+	conn      net.PacketConn
+	id        Hash
+	bootstrap []string
+
+	mu      sync.Mutex
+	tid     uint16
+	pending map[string]chan map[string]any
+	// the nodes responded recently, by address
+	nodes  map[string]Hash
+	closed chan struct{}
+}
+
+func newDHT(conn net.PacketConn, bootstrap []string) *dht {
+	d := &dht{
+		conn:      conn,
+		bootstrap: bootstrap,
+		pending:   make(map[string]chan map[string]any),
+		nodes:     make(map[string]Hash),
+		closed:    make(chan struct{}),
+	}
+	_, _ = rand.Read(d.id[:])
+	go d.readLoop()
+	return d
+}
+
+func (d *dht) close() {
+	close(d.closed)
+	_ = d.conn.Close()
+}
+
+func (d *dht) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-d.closed:
+				return
+			default:
+				continue
+			}
+		}
+		v, err := Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		msg, _ := v.(map[string]any)
+		if msg == nil {
+			continue
+		}
+		y := dictString(msg, "y")
+		if y != "r" && y != "e" {
+			continue
+		}
+		d.mu.Lock()
+		ch := d.pending[addr.String()+"/"+dictString(msg, "t")]
+		d.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// query sends the query to the node and waits for the response
+func (d *dht) query(ctx context.Context, addr *net.UDPAddr, method string, args map[string]any) (map[string]any, error) {
+	args["id"] = string(d.id[:])
+	d.mu.Lock()
+	d.tid++
+	tid := string(binary.BigEndian.AppendUint16(nil, d.tid))
+	key := addr.String() + "/" + tid
+	ch := make(chan map[string]any, 1)
+	d.pending[key] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, key)
+		d.mu.Unlock()
+	}()
+	msg := Encode(map[string]any{"t": tid, "y": "q", "q": method, "a": args, "ro": 1})
+	if _, err := d.conn.WriteTo(msg, addr); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dhtQueryTimeout)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case resp := <-ch:
+		if dictString(resp, "y") == "e" {
+			return nil, errors.New("dht error response")
+		}
+		r := dictDict(resp, "r")
+		if r == nil {
+			return nil, errors.New("invalid dht response")
+		}
+		var id Hash
+		if rid := dictString(r, "id"); len(rid) == 20 {
+			copy(id[:], rid)
+			d.mu.Lock()
+			if len(d.nodes) < dhtMaxNodes {
+				d.nodes[addr.String()] = id
+			}
+			d.mu.Unlock()
+		}
+		return r, nil
+	}
+}
+
+type dhtNode struct {
+	id       Hash
+	addr     *net.UDPAddr
+	known    bool
+	queried  bool
+	token    string
+	distance Hash
+}
+
+func xorDistance(a, b Hash) Hash {
+	var d Hash
+	for i := range d {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// getPeers looks up the peers of the info hash iteratively, and announces the port to the closest nodes
+func (d *dht) getPeers(ctx context.Context, infoHash Hash, port int, found func([]string)) {
+	seen := make(map[string]struct{})
+	var nodes []*dhtNode
+	add := func(n *dhtNode) {
+		if _, ok := seen[n.addr.String()]; ok {
+			return
+		}
+		seen[n.addr.String()] = struct{}{}
+		n.distance = xorDistance(n.id, infoHash)
+		if !n.known {
+			// the bootstrap nodes are the farthest
+			for i := range n.distance {
+				n.distance[i] = 0xFF
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	d.mu.Lock()
+	for addr, id := range d.nodes {
+		if udpAddr, err := net.ResolveUDPAddr("udp", addr); err == nil {
+			add(&dhtNode{id: id, addr: udpAddr, known: true})
+		}
+	}
+	d.mu.Unlock()
+	for _, addr := range d.bootstrap {
+		if udpAddr, err := net.ResolveUDPAddr("udp", addr); err == nil {
+			add(&dhtNode{addr: udpAddr})
+		}
+	}
+
+	var responded []*dhtNode
+	for round := 0; round < 16 && ctx.Err() == nil; round++ {
+		sort.Slice(nodes, func(i, j int) bool {
+			return bytes.Compare(nodes[i].distance[:], nodes[j].distance[:]) < 0
+		})
+		var batch []*dhtNode
+		for _, n := range nodes {
+			if len(batch) >= dhtAlpha {
+				break
+			}
+			if !n.queried {
+				n.queried = true
+				batch = append(batch, n)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for _, n := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, err := d.query(ctx, n.addr, "get_peers", map[string]any{"info_hash": string(infoHash[:])})
+				if err != nil {
+					return
+				}
+				var peers []string
+				for _, v := range dictList(r, "values") {
+					if s, ok := v.(string); ok {
+						peers = append(peers, parseCompactPeers([]byte(s), net.IPv4len)...)
+					}
+				}
+				if len(peers) > 0 {
+					found(peers)
+				}
+				compact := dictString(r, "nodes")
+				mu.Lock()
+				defer mu.Unlock()
+				n.token = dictString(r, "token")
+				responded = append(responded, n)
+				for i := 0; i+26 <= len(compact); i += 26 {
+					var id Hash
+					copy(id[:], compact[i:i+20])
+					addr := &net.UDPAddr{
+						IP:   net.IP([]byte(compact[i+20 : i+24])),
+						Port: int(binary.BigEndian.Uint16([]byte(compact[i+24 : i+26]))),
+					}
+					if addr.Port != 0 {
+						add(&dhtNode{id: id, addr: addr, known: true})
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	sort.Slice(responded, func(i, j int) bool {
+		return bytes.Compare(responded[i].distance[:], responded[j].distance[:]) < 0
+	})
+	announced := 0
+	for _, n := range responded {
+		if announced >= dhtK || ctx.Err() != nil {
+			break
+		}
+		if n.token == "" {
+			continue
+		}
+		announced++
+		go func() {
+			_, _ = d.query(context.WithoutCancel(ctx), n.addr, "announce_peer", map[string]any{
+				"info_hash":    string(infoHash[:]),
+				"port":         port,
+				"token":        n.token,
+				"implied_port": 0,
+			})
+		}()
+	}
+}
@@ -0,0 +1,270 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// the max length of the pieces accepted, the largest ones created by the common clients are 64 MiB
+const maxPieceLength = 64 << 20
+
+type Hash [20]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+type File struct {
+	// the slash separated path, which starts with the name of the torrent for the multi-file ones
+	Path   string
+	Length int64
+	// the offset in the concatenated data of all the files
+	Offset int64
+	// the padding files of BEP 47 are all zeros and never stored
+	Padding bool
+}
+
+type Info struct {
+	Name        string
+	PieceLength int64
+	Pieces      []Hash
+	Files       []File
+	Length      int64
+	// the bencoded info dict, which is the metadata exchanged with the peers
+	Raw []byte
+}
+
+func (info *Info) NumPieces() int {
+	return len(info.Pieces)
+}
+
+func (info *Info) PieceSize(index int) int64 {
+	if index == len(info.Pieces)-1 {
+		return info.Length - int64(index)*info.PieceLength
+	}
+	return info.PieceLength
+}
+
+// Spec is what's needed to start a torrent, parsed from the .torrent file or the magnet link
+type Spec struct {
+	InfoHash Hash
+	// nil if it's from a magnet link, the metadata is fetched from the peers then
+	Info        *Info
+	DisplayName string
+	Trackers    []string
+	Peers       []string
+	// the indexes of the files to download, all the files if empty
+	Select []int
+}
+
+func (s *Spec) Name() string {
+	if s.Info != nil {
+		return s.Info.Name
+	}
+	if s.DisplayName != "" {
+		return s.DisplayName
+	}
+	return s.InfoHash.String()
+}
+
+// ParseTorrent parses the .torrent file
+func ParseTorrent(data []byte) (*Spec, error) {
+	v, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metainfo isn't a dict", errInvalidBencode)
+	}
+	raw, err := rawDictValue(data, "info")
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseInfo(raw)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{
+		InfoHash: sha1.Sum(raw),
+		Info:     info,
+	}
+	seen := map[string]struct{}{}
+	addTracker := func(tr string) {
+		if _, ok := seen[tr]; tr != "" && !ok {
+			seen[tr] = struct{}{}
+			spec.Trackers = append(spec.Trackers, tr)
+		}
+	}
+	addTracker(dictString(d, "announce"))
+	for _, tier := range dictList(d, "announce-list") {
+		list, _ := tier.([]any)
+		for _, tr := range list {
+			s, _ := tr.(string)
+			addTracker(s)
+		}
+	}
+	return spec, nil
+}
+
+// ParseInfo parses the bencoded info dict
+func ParseInfo(raw []byte) (*Info, error) {
+	v, err := Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: info isn't a dict", errInvalidBencode)
+	}
+	info := &Info{
+		Name:        sanitizeName(dictString(d, "name")),
+		PieceLength: dictInt(d, "piece length"),
+		Raw:         raw,
+	}
+	if name, ok := d["name.utf-8"].(string); ok && name != "" {
+		info.Name = sanitizeName(name)
+	}
+	// the pieces are held in memory while downloading
+	if info.PieceLength <= 0 || info.PieceLength > maxPieceLength {
+		return nil, fmt.Errorf("invalid piece length: %d", info.PieceLength)
+	}
+	pieces := dictString(d, "pieces")
+	if len(pieces)%20 != 0 {
+		return nil, errors.New("invalid pieces")
+	}
+	info.Pieces = make([]Hash, len(pieces)/20)
+	for i := range info.Pieces {
+		copy(info.Pieces[i][:], pieces[i*20:])
+	}
+	if files := dictList(d, "files"); files != nil {
+		for _, f := range files {
+			fd, ok := f.(map[string]any)
+			if !ok {
+				return nil, errors.New("invalid files")
+			}
+			pathList := dictList(fd, "path.utf-8")
+			if pathList == nil {
+				pathList = dictList(fd, "path")
+			}
+			parts := []string{info.Name}
+			for _, p := range pathList {
+				s, _ := p.(string)
+				parts = append(parts, sanitizeName(s))
+			}
+			if len(parts) == 1 {
+				return nil, errors.New("invalid file path")
+			}
+			length := dictInt(fd, "length")
+			if length < 0 {
+				return nil, errors.New("invalid file length")
+			}
+			info.Files = append(info.Files, File{
+				Path:    strings.Join(parts, "/"),
+				Length:  length,
+				Offset:  info.Length,
+				Padding: strings.Contains(dictString(fd, "attr"), "p"),
+			})
+			info.Length += length
+		}
+	} else {
+		info.Length = dictInt(d, "length")
+		if info.Length < 0 {
+			return nil, errors.New("invalid length")
+		}
+		info.Files = []File{{Path: info.Name, Length: info.Length}}
+	}
+	if n := (info.Length + info.PieceLength - 1) / info.PieceLength; n != int64(len(info.Pieces)) {
+		return nil, fmt.Errorf("expect %d pieces but got %d", n, len(info.Pieces))
+	}
+	return info, nil
+}
+
+// sanitizeName makes the path component safe to be a file name
+func sanitizeName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", "\x00", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// ParseMagnet parses the magnet link, the select-only param of BEP 53 is supported
+func ParseMagnet(uri string) (*Spec, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "magnet" {
+		return nil, errors.New("not a magnet link")
+	}
+	q := u.Query()
+	spec := &Spec{
+		DisplayName: q.Get("dn"),
+		Trackers:    q["tr"],
+		Peers:       q["x.pe"],
+	}
+	found := false
+	for _, xt := range q["xt"] {
+		h, ok := strings.CutPrefix(xt, "urn:btih:")
+		if !ok {
+			continue
+		}
+		var b []byte
+		switch len(h) {
+		case 40:
+			b, err = hex.DecodeString(h)
+		case 32:
+			b, err = base32.StdEncoding.DecodeString(strings.ToUpper(h))
+		default:
+			err = errors.New("invalid length")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid info hash %s: %w", h, err)
+		}
+		copy(spec.InfoHash[:], b)
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("no btih info hash in the magnet link")
+	}
+	if so := q.Get("so"); so != "" {
+		if spec.Select, err = ParseSelect(so); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+// ParseSelect parses the file indexes like 0,2,4-6
+func ParseSelect(s string) ([]int, error) {
+	var indexes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid file index %s", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start || end-start > 1<<16 {
+				return nil, fmt.Errorf("invalid file index range %s", part)
+			}
+		}
+		for i := start; i <= end; i++ {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
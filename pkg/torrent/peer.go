@@ -0,0 +1,308 @@
+package torrent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	msgChoke         = 0
+	msgUnchoke       = 1
+	msgInterested    = 2
+	msgNotInterested = 3
+	msgHave          = 4
+	msgBitfield      = 5
+	msgRequest       = 6
+	msgPiece         = 7
+	msgCancel        = 8
+	msgPort          = 9
+	msgExtended      = 20
+
+	protocol       = "BitTorrent protocol"
+	blockSize      = 16 * 1024
+	maxMessageSize = 4 << 20
+	// the outstanding block requests to a peer
+	maxPendingRequests = 32
+	// the queued messages to a peer, the peer is dropped if it doesn't read fast enough
+	maxOutQueue = 512
+	// the id of ut_metadata in our extended handshake
+	extMetadataID = 1
+	// the max size of the metadata accepted
+	maxMetadataSize = 32 << 20
+
+	handshakeTimeout = 10 * time.Second
+	readTimeout      = 3 * time.Minute
+	writeTimeout     = time.Minute
+)
+
+type bitfield []byte
+
+func newBitfield(n int) bitfield {
+	return make(bitfield, (n+7)/8)
+}
+
+func (b bitfield) has(i int) bool {
+	return i >= 0 && i/8 < len(b) && b[i/8]&(0x80>>(i%8)) != 0
+}
+
+func (b *bitfield) set(i int) {
+	for i/8 >= len(*b) {
+		*b = append(*b, 0)
+	}
+	(*b)[i/8] |= 0x80 >> (i % 8)
+}
+
+type block struct {
+	piece int
+	begin int64
+}
+
+// peerConn is a connection to a peer, the fields except the channels and conn are protected by the torrent's mutex
+type peerConn struct {
+	t      *Torrent
+	conn   net.Conn
+	addr   string
+	peerID [20]byte
+
+	bitfield bitfield
+	// whether the peer chokes us
+	choked bool
+	// whether we're interested in the peer
+	interested     bool
+	amChoking      bool
+	peerInterested bool
+	pending        map[block]time.Time
+	// the id of ut_metadata in the peer's extended handshake, 0 if not supported
+	utMetadata   int
+	metadataSize int
+	lastActive   time.Time
+
+	out       chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPeerConn(t *Torrent, conn net.Conn, peerID [20]byte) *peerConn {
+	return &peerConn{
+		t:          t,
+		conn:       conn,
+		addr:       conn.RemoteAddr().String(),
+		peerID:     peerID,
+		choked:     true,
+		amChoking:  true,
+		pending:    make(map[block]time.Time),
+		lastActive: time.Now(),
+		out:        make(chan []byte, maxOutQueue),
+		done:       make(chan struct{}),
+	}
+}
+
+func writeHandshake(w io.Writer, infoHash Hash, peerID [20]byte, dht bool) error {
+	b := make([]byte, 68)
+	b[0] = byte(len(protocol))
+	copy(b[1:], protocol)
+	// the extension protocol of BEP 10
+	b[25] |= 0x10
+	if dht {
+		b[27] |= 0x01
+	}
+	copy(b[28:], infoHash[:])
+	copy(b[48:], peerID[:])
+	_, err := w.Write(b)
+	return err
+}
+
+func readHandshake(r io.Reader) (infoHash Hash, peerID [20]byte, err error) {
+	b := make([]byte, 68)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return
+	}
+	if b[0] != byte(len(protocol)) || string(b[1:20]) != protocol {
+		err = errors.New("invalid handshake")
+		return
+	}
+	copy(infoHash[:], b[28:48])
+	copy(peerID[:], b[48:68])
+	return
+}
+
+func encodeMessage(id byte, payload ...[]byte) []byte {
+	n := 1
+	for _, p := range payload {
+		n += len(p)
+	}
+	b := make([]byte, 4, 4+n)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	b = append(b, id)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func uint32s(vs ...int64) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[4*i:], uint32(v))
+	}
+	return b
+}
+
+// send queues the message, the peer is closed if the queue is full
+func (p *peerConn) send(id byte, payload ...[]byte) {
+	select {
+	case p.out <- encodeMessage(id, payload...):
+	case <-p.done:
+	default:
+		p.close()
+	}
+}
+
+func (p *peerConn) sendExtended(extID int, payload []byte) {
+	p.send(msgExtended, []byte{byte(extID)}, payload)
+}
+
+func (p *peerConn) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		_ = p.conn.Close()
+	})
+}
+
+func (p *peerConn) writeLoop() {
+	w := bufio.NewWriter(p.conn)
+	for {
+		select {
+		case <-p.done:
+			return
+		case msg := <-p.out:
+			_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := w.Write(msg); err != nil {
+				p.close()
+				return
+			}
+			// flush once the queue is drained
+			if len(p.out) == 0 {
+				if err := w.Flush(); err != nil {
+					p.close()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *peerConn) readLoop() error {
+	r := bufio.NewReaderSize(p.conn, 64*1024)
+	lenBuf := make([]byte, 4)
+	for {
+		_ = p.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
+			return err
+		}
+		n := binary.BigEndian.Uint32(lenBuf)
+		if n == 0 {
+			// keep alive
+			continue
+		}
+		if n > maxMessageSize {
+			return fmt.Errorf("message too large: %d", n)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return err
+		}
+		if err := p.handle(msg[0], msg[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *peerConn) handle(id byte, payload []byte) error {
+	t := p.t
+	switch id {
+	case msgChoke, msgUnchoke, msgInterested, msgNotInterested:
+		if len(payload) != 0 {
+			return errors.New("invalid message")
+		}
+		t.onPeerState(p, id)
+	case msgHave:
+		if len(payload) != 4 {
+			return errors.New("invalid have")
+		}
+		t.onHave(p, int(binary.BigEndian.Uint32(payload)))
+	case msgBitfield:
+		t.onBitfield(p, payload)
+	case msgRequest:
+		if len(payload) != 12 {
+			return errors.New("invalid request")
+		}
+		t.onRequest(p, int(binary.BigEndian.Uint32(payload)),
+			int64(binary.BigEndian.Uint32(payload[4:])), int64(binary.BigEndian.Uint32(payload[8:])))
+	case msgPiece:
+		if len(payload) < 8 {
+			return errors.New("invalid piece")
+		}
+		return t.onPiece(p, int(binary.BigEndian.Uint32(payload)), int64(binary.BigEndian.Uint32(payload[4:])), payload[8:])
+	case msgCancel, msgPort:
+		// the requests are served at once, and the nodes of the DHT are from the lookups
+	case msgExtended:
+		if len(payload) < 1 {
+			return errors.New("invalid extended message")
+		}
+		return p.handleExtended(payload[0], payload[1:])
+	}
+	return nil
+}
+
+func (p *peerConn) sendExtHandshake(metadataSize int, port int) {
+	m := map[string]any{
+		"m":    map[string]any{"ut_metadata": extMetadataID},
+		"v":    "OpenList",
+		"reqq": maxOutQueue / 2,
+		"p":    port,
+	}
+	if metadataSize > 0 {
+		m["metadata_size"] = metadataSize
+	}
+	p.sendExtended(0, Encode(m))
+}
+
+func (p *peerConn) handleExtended(extID byte, payload []byte) error {
+	t := p.t
+	switch extID {
+	case 0:
+		v, err := Decode(payload)
+		if err != nil {
+			return err
+		}
+		d, _ := v.(map[string]any)
+		if d == nil {
+			return errors.New("invalid extended handshake")
+		}
+		t.onExtHandshake(p, int(dictInt(dictDict(d, "m"), "ut_metadata")), int(dictInt(d, "metadata_size")))
+	case extMetadataID:
+		v, n, err := decodePrefix(payload)
+		if err != nil {
+			return err
+		}
+		d, _ := v.(map[string]any)
+		if d == nil {
+			return errors.New("invalid metadata message")
+		}
+		piece := int(dictInt(d, "piece"))
+		switch dictInt(d, "msg_type") {
+		case 0:
+			t.onMetadataRequest(p, piece)
+		case 1:
+			t.onMetadataPiece(piece, payload[n:])
+		}
+	}
+	return nil
+}
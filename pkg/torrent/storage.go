@@ -0,0 +1,209 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var errPieceNotStored = errors.New("piece isn't stored")
+
+// span is the part of a piece in a file
+type span struct {
+	file   int
+	offset int64
+	length int64
+}
+
+// storage maps the pieces to the files in the dir, only the selected files are written,
+// so the pieces across the unselected files are never stored completely
+type storage struct {
+	dir      string
+	info     *Info
+	selected []bool
+
+	mu     sync.Mutex
+	files  []*os.File
+	closed bool
+}
+
+func newStorage(dir string, info *Info, sel []int) (*storage, error) {
+	s := &storage{
+		dir:      dir,
+		info:     info,
+		selected: make([]bool, len(info.Files)),
+		files:    make([]*os.File, len(info.Files)),
+	}
+	for _, i := range sel {
+		if i < 0 || i >= len(info.Files) {
+			return nil, errors.New("selected file index out of range")
+		}
+		s.selected[i] = true
+	}
+	for i, f := range info.Files {
+		if len(sel) == 0 {
+			s.selected[i] = true
+		}
+		if f.Padding {
+			s.selected[i] = false
+		}
+		// the empty files have no pieces
+		if s.selected[i] && f.Length == 0 {
+			if _, err := s.open(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// spans returns the parts of the range of the piece in the files
+func (s *storage) spans(index int, begin, length int64) []span {
+	start := int64(index)*s.info.PieceLength + begin
+	end := start + length
+	var spans []span
+	for i, f := range s.info.Files {
+		if f.Offset+f.Length <= start || f.Length == 0 {
+			continue
+		}
+		if f.Offset >= end {
+			break
+		}
+		off := max(start, f.Offset)
+		spans = append(spans, span{
+			file:   i,
+			offset: off - f.Offset,
+			length: min(end, f.Offset+f.Length) - off,
+		})
+	}
+	return spans
+}
+
+// wanted reports whether the piece has any data of the selected files
+func (s *storage) wanted(index int) bool {
+	for _, sp := range s.spans(index, 0, s.info.PieceSize(index)) {
+		if s.selected[sp.file] {
+			return true
+		}
+	}
+	return false
+}
+
+// stored reports whether the piece is stored completely once it's downloaded
+func (s *storage) stored(index int) bool {
+	for _, sp := range s.spans(index, 0, s.info.PieceSize(index)) {
+		if !s.selected[sp.file] && !s.info.Files[sp.file].Padding {
+			return false
+		}
+	}
+	return true
+}
+
+// wantedBytes returns the bytes of the selected files in the piece
+func (s *storage) wantedBytes(index int) int64 {
+	var n int64
+	for _, sp := range s.spans(index, 0, s.info.PieceSize(index)) {
+		if s.selected[sp.file] {
+			n += sp.length
+		}
+	}
+	return n
+}
+
+func (s *storage) open(i int) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+	if s.files[i] != nil {
+		return s.files[i], nil
+	}
+	name := filepath.Join(s.dir, filepath.FromSlash(s.info.Files[i].Path))
+	if err := os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	s.files[i] = f
+	return f, nil
+}
+
+// writePiece writes the verified piece to the selected files
+func (s *storage) writePiece(index int, data []byte) error {
+	var pos int64
+	for _, sp := range s.spans(index, 0, int64(len(data))) {
+		if s.selected[sp.file] {
+			f, err := s.open(sp.file)
+			if err != nil {
+				return err
+			}
+			if _, err = f.WriteAt(data[pos:pos+sp.length], sp.offset); err != nil {
+				return err
+			}
+		}
+		pos += sp.length
+	}
+	return nil
+}
+
+// readPiece reads the range of the stored piece
+func (s *storage) readPiece(index int, begin, length int64) ([]byte, error) {
+	data := make([]byte, length)
+	var pos int64
+	for _, sp := range s.spans(index, begin, length) {
+		switch {
+		case s.info.Files[sp.file].Padding:
+			// already zeros
+		case s.selected[sp.file]:
+			f, err := s.open(sp.file)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = f.ReadAt(data[pos:pos+sp.length], sp.offset); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errPieceNotStored
+		}
+		pos += sp.length
+	}
+	return data, nil
+}
+
+// verify checks the stored piece on the disk, it's for resuming the download
+func (s *storage) verify(index int) bool {
+	if !s.stored(index) {
+		return false
+	}
+	for _, sp := range s.spans(index, 0, s.info.PieceSize(index)) {
+		if s.info.Files[sp.file].Padding {
+			continue
+		}
+		name := filepath.Join(s.dir, filepath.FromSlash(s.info.Files[sp.file].Path))
+		if fi, err := os.Stat(name); err != nil || fi.Size() < sp.offset+sp.length {
+			return false
+		}
+	}
+	data, err := s.readPiece(index, 0, s.info.PieceSize(index))
+	if err != nil {
+		return false
+	}
+	return sha1.Sum(data) == s.info.Pieces[index]
+}
+
+func (s *storage) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for i, f := range s.files {
+		if f != nil {
+			_ = f.Close()
+			s.files[i] = nil
+		}
+	}
+}
@@ -0,0 +1,802 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type State string
+
+const (
+	StateMetadata    State = "fetching metadata"
+	StateChecking    State = "checking"
+	StateDownloading State = "downloading"
+	StateSeeding     State = "seeding"
+	StateError       State = "error"
+	StateClosed      State = "closed"
+)
+
+type Stats struct {
+	Name  string
+	State State
+	// the size of the selected files
+	TotalBytes     int64
+	CompletedBytes int64
+	Downloaded     int64
+	Uploaded       int64
+	Peers          int
+	CompletedAt    time.Time
+	Err            error
+}
+
+type pieceProgress struct {
+	data     []byte
+	received []bool
+	// the outstanding requests of each block
+	pending []int
+	count   int
+}
+
+type Torrent struct {
+	c        *Client
+	spec     *Spec
+	infoHash Hash
+	dir      string
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu    sync.Mutex
+	state State
+	err   error
+	info  *Info
+	st    *storage
+	// the verified pieces
+	have       bitfield
+	wanted     []bool
+	avail      []int
+	inProgress map[int]*pieceProgress
+	total      int64
+	completed  int64
+	// the payload bytes
+	downloaded  int64
+	uploaded    int64
+	completedAt time.Time
+	// closed once all the selected files are downloaded
+	completedCh chan struct{}
+
+	peers       map[*peerConn]struct{}
+	dialing     int
+	candidates  []string
+	attempted   map[string]time.Time
+	unchoked    int
+	metadata    [][]byte
+	metadataLen int
+}
+
+func newTorrent(c *Client, spec *Spec, dir string) *Torrent {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Torrent{
+		c:           c,
+		spec:        spec,
+		infoHash:    spec.InfoHash,
+		dir:         dir,
+		ctx:         ctx,
+		cancel:      cancel,
+		state:       StateMetadata,
+		inProgress:  make(map[int]*pieceProgress),
+		completedCh: make(chan struct{}),
+		peers:       make(map[*peerConn]struct{}),
+		attempted:   make(map[string]time.Time),
+	}
+	return t
+}
+
+func (t *Torrent) InfoHash() Hash {
+	return t.infoHash
+}
+
+// Completed returns the channel closed once all the selected files are downloaded
+func (t *Torrent) Completed() <-chan struct{} {
+	return t.completedCh
+}
+
+func (t *Torrent) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := Stats{
+		Name:           t.spec.Name(),
+		State:          t.state,
+		TotalBytes:     t.total,
+		CompletedBytes: t.completed,
+		Downloaded:     t.downloaded,
+		Uploaded:       t.uploaded,
+		Peers:          len(t.peers),
+		CompletedAt:    t.completedAt,
+		Err:            t.err,
+	}
+	if t.info != nil {
+		s.Name = t.info.Name
+	}
+	return s
+}
+
+// Drop stops the torrent and removes it from the client, the downloaded files are kept
+func (t *Torrent) Drop() {
+	t.c.removeTorrent(t)
+	t.close()
+}
+
+func (t *Torrent) close() {
+	t.cancel()
+	t.mu.Lock()
+	peers := make([]*peerConn, 0, len(t.peers))
+	for p := range t.peers {
+		peers = append(peers, p)
+	}
+	if t.state != StateError {
+		t.state = StateClosed
+	}
+	st := t.st
+	t.mu.Unlock()
+	for _, p := range peers {
+		p.close()
+	}
+	if st != nil {
+		st.close()
+	}
+}
+
+func (t *Torrent) start() {
+	if t.spec.Info != nil {
+		go t.setInfo(t.spec.Info)
+	}
+	t.addPeers(t.spec.Peers)
+	for _, tr := range t.spec.Trackers {
+		go t.trackerLoop(tr)
+	}
+	if t.c.dht != nil {
+		go t.dhtLoop()
+	}
+	go t.tickLoop()
+}
+
+func (t *Torrent) fail(err error) {
+	t.mu.Lock()
+	if t.state != StateClosed {
+		t.state = StateError
+		t.err = err
+	}
+	t.mu.Unlock()
+	log.Errorf("torrent %s: %v", t.infoHash, err)
+	t.close()
+}
+
+// setInfo prepares the storage once the info is known, and checks the existing data
+func (t *Torrent) setInfo(info *Info) {
+	st, err := newStorage(t.dir, info, t.spec.Select)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	t.mu.Lock()
+	if t.info != nil || t.ctx.Err() != nil {
+		t.mu.Unlock()
+		st.close()
+		return
+	}
+	t.info = info
+	t.st = st
+	t.state = StateChecking
+	t.metadata = nil
+	n := info.NumPieces()
+	t.have = newBitfield(n)
+	t.wanted = make([]bool, n)
+	t.avail = make([]int, n)
+	for i := 0; i < n; i++ {
+		t.wanted[i] = st.wanted(i)
+		if t.wanted[i] {
+			t.total += st.wantedBytes(i)
+		}
+	}
+	for p := range t.peers {
+		for i := 0; i < n; i++ {
+			if p.bitfield.has(i) {
+				t.avail[i]++
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	// resume from the existing data
+	var verified []int
+	for i := 0; i < n && t.ctx.Err() == nil; i++ {
+		if t.wanted[i] && st.verify(i) {
+			verified = append(verified, i)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ctx.Err() != nil {
+		return
+	}
+	for _, i := range verified {
+		t.have.set(i)
+		t.completed += st.wantedBytes(i)
+	}
+	t.state = StateDownloading
+	for p := range t.peers {
+		// the bitfield can only be the first message, so the pieces are told one by one
+		for _, i := range verified {
+			p.send(msgHave, uint32s(int64(i)))
+		}
+		p.sendExtHandshake(len(info.Raw), t.c.port)
+		t.updateInterest(p)
+		t.fillRequests(p)
+	}
+	t.checkCompleted()
+}
+
+func (t *Torrent) checkCompleted() {
+	if t.state != StateDownloading || t.completed < t.total {
+		return
+	}
+	for i, w := range t.wanted {
+		if w && !t.have.has(i) {
+			return
+		}
+	}
+	t.state = StateSeeding
+	t.completedAt = time.Now()
+	close(t.completedCh)
+	for p := range t.peers {
+		if p.interested {
+			p.interested = false
+			p.send(msgNotInterested)
+		}
+	}
+}
+
+// addPeers adds the addresses to connect
+func (t *Torrent) addPeers(addrs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, addr := range addrs {
+		if last, ok := t.attempted[addr]; ok && time.Since(last) < 5*time.Minute {
+			continue
+		}
+		t.candidates = append(t.candidates, addr)
+	}
+	// keep the latest ones
+	if len(t.candidates) > 1000 {
+		t.candidates = t.candidates[len(t.candidates)-1000:]
+	}
+	t.connectPeers()
+}
+
+// connectPeers dials the candidates until the peers are enough
+func (t *Torrent) connectPeers() {
+	for len(t.candidates) > 0 && len(t.peers)+t.dialing < t.c.cfg.MaxPeers && t.ctx.Err() == nil {
+		if t.state == StateSeeding || t.state == StateError {
+			// the leechers connect to us
+			return
+		}
+		addr := t.candidates[len(t.candidates)-1]
+		t.candidates = t.candidates[:len(t.candidates)-1]
+		if last, ok := t.attempted[addr]; ok && time.Since(last) < 5*time.Minute {
+			continue
+		}
+		t.attempted[addr] = time.Now()
+		t.dialing++
+		go func() {
+			conn, peerID, err := t.dial(addr)
+			t.mu.Lock()
+			t.dialing--
+			t.mu.Unlock()
+			if err != nil {
+				log.Debugf("torrent %s: failed connect %s: %v", t.infoHash, addr, err)
+				return
+			}
+			t.runPeer(conn, peerID)
+		}()
+	}
+}
+
+func (t *Torrent) dial(addr string) (net.Conn, [20]byte, error) {
+	var peerID [20]byte
+	d := net.Dialer{Timeout: handshakeTimeout}
+	conn, err := d.DialContext(t.ctx, "tcp", addr)
+	if err != nil {
+		return nil, peerID, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err = writeHandshake(conn, t.infoHash, t.c.peerID, t.c.dht != nil); err != nil {
+		_ = conn.Close()
+		return nil, peerID, err
+	}
+	infoHash, peerID, err := readHandshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, peerID, err
+	}
+	if infoHash != t.infoHash {
+		_ = conn.Close()
+		return nil, peerID, errors.New("info hash mismatch")
+	}
+	return conn, peerID, nil
+}
+
+// runPeer runs the connection after the handshake, until it's closed
+func (t *Torrent) runPeer(conn net.Conn, peerID [20]byte) {
+	if peerID == t.c.peerID {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	p := newPeerConn(t, conn, peerID)
+	t.mu.Lock()
+	if t.ctx.Err() != nil || len(t.peers) >= t.c.cfg.MaxPeers*2 {
+		t.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	t.peers[p] = struct{}{}
+	metadataSize := 0
+	if t.info != nil {
+		metadataSize = len(t.info.Raw)
+	}
+	if t.state == StateDownloading || t.state == StateSeeding {
+		p.send(msgBitfield, t.have)
+	}
+	p.sendExtHandshake(metadataSize, t.c.port)
+	t.mu.Unlock()
+
+	go p.writeLoop()
+	err := p.readLoop()
+	log.Debugf("torrent %s: peer %s closed: %v", t.infoHash, p.addr, err)
+	p.close()
+	t.dropPeer(p)
+}
+
+func (t *Torrent) dropPeer(p *peerConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.peers[p]; !ok {
+		return
+	}
+	delete(t.peers, p)
+	t.releasePending(p)
+	for i := range t.avail {
+		if p.bitfield.has(i) {
+			t.avail[i]--
+		}
+	}
+	if !p.amChoking {
+		t.unchoked--
+		t.unchokeOthers()
+	}
+	t.connectPeers()
+}
+
+// releasePending gives up the outstanding requests to the peer, so that they're requested from the others
+func (t *Torrent) releasePending(p *peerConn) {
+	for b := range p.pending {
+		if pp := t.inProgress[b.piece]; pp != nil {
+			pp.pending[b.begin/blockSize]--
+		}
+	}
+	clear(p.pending)
+}
+
+func (t *Torrent) onPeerState(p *peerConn, id byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch id {
+	case msgChoke:
+		p.choked = true
+		t.releasePending(p)
+	case msgUnchoke:
+		p.choked = false
+		t.fillRequests(p)
+	case msgInterested:
+		p.peerInterested = true
+		if p.amChoking && t.unchoked < t.c.cfg.MaxUploads {
+			p.amChoking = false
+			t.unchoked++
+			p.send(msgUnchoke)
+		}
+	case msgNotInterested:
+		p.peerInterested = false
+		if !p.amChoking {
+			p.amChoking = true
+			t.unchoked--
+			p.send(msgChoke)
+			t.unchokeOthers()
+		}
+	}
+}
+
+// unchokeOthers unchokes the interested peers if the slots are available
+func (t *Torrent) unchokeOthers() {
+	for p := range t.peers {
+		if t.unchoked >= t.c.cfg.MaxUploads {
+			return
+		}
+		if p.peerInterested && p.amChoking {
+			p.amChoking = false
+			t.unchoked++
+			p.send(msgUnchoke)
+		}
+	}
+}
+
+func (t *Torrent) onHave(p *peerConn, index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.info != nil && index >= t.info.NumPieces() {
+		return
+	}
+	if p.bitfield.has(index) {
+		return
+	}
+	p.bitfield.set(index)
+	if t.info == nil {
+		return
+	}
+	t.avail[index]++
+	if !p.interested && t.state == StateDownloading && t.wanted[index] && !t.have.has(index) {
+		p.interested = true
+		p.send(msgInterested)
+	}
+	t.fillRequests(p)
+}
+
+func (t *Torrent) onBitfield(p *peerConn, b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.avail {
+		if p.bitfield.has(i) {
+			t.avail[i]--
+		}
+	}
+	p.bitfield = bitfield(b)
+	for i := range t.avail {
+		if p.bitfield.has(i) {
+			t.avail[i]++
+		}
+	}
+	t.updateInterest(p)
+	t.fillRequests(p)
+}
+
+func (t *Torrent) updateInterest(p *peerConn) {
+	if t.state != StateDownloading {
+		return
+	}
+	for i, w := range t.wanted {
+		if w && !t.have.has(i) && p.bitfield.has(i) {
+			if !p.interested {
+				p.interested = true
+				p.send(msgInterested)
+			}
+			return
+		}
+	}
+}
+
+func (t *Torrent) onRequest(p *peerConn, index int, begin, length int64) {
+	t.mu.Lock()
+	ok := !p.amChoking && t.st != nil && t.have.has(index) && t.st.stored(index) &&
+		length > 0 && length <= 128*1024 && begin+length <= t.info.PieceSize(index)
+	st := t.st
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	data, err := st.readPiece(index, begin, length)
+	if err != nil {
+		log.Debugf("torrent %s: failed read piece %d: %v", t.infoHash, index, err)
+		return
+	}
+	p.send(msgPiece, uint32s(int64(index), begin), data)
+	t.mu.Lock()
+	t.uploaded += length
+	t.mu.Unlock()
+}
+
+func (t *Torrent) onPiece(p *peerConn, index int, begin int64, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := block{piece: index, begin: begin}
+	if _, ok := p.pending[b]; !ok {
+		// cancelled or duplicated in the endgame
+		return nil
+	}
+	delete(p.pending, b)
+	p.lastActive = time.Now()
+	pp := t.inProgress[index]
+	if pp == nil {
+		t.fillRequests(p)
+		return nil
+	}
+	bi := int(begin / blockSize)
+	pp.pending[bi]--
+	if pp.received[bi] {
+		t.fillRequests(p)
+		return nil
+	}
+	if int64(len(data)) != min(blockSize, int64(len(pp.data))-begin) {
+		return errors.New("invalid block length")
+	}
+	copy(pp.data[begin:], data)
+	pp.received[bi] = true
+	pp.count++
+	t.downloaded += int64(len(data))
+	if pp.count == len(pp.received) {
+		delete(t.inProgress, index)
+		if sha1.Sum(pp.data) != t.info.Pieces[index] {
+			log.Warnf("torrent %s: piece %d from %s failed the hash check", t.infoHash, index, p.addr)
+			t.fillRequests(p)
+			return nil
+		}
+		if err := t.st.writePiece(index, pp.data); err != nil {
+			go t.fail(err)
+			return nil
+		}
+		t.have.set(index)
+		t.completed += t.st.wantedBytes(index)
+		for peer := range t.peers {
+			peer.send(msgHave, uint32s(int64(index)))
+		}
+		t.checkCompleted()
+	}
+	t.fillRequests(p)
+	return nil
+}
+
+// fillRequests sends the block requests to the peer until the pipeline is full
+func (t *Torrent) fillRequests(p *peerConn) {
+	if t.state != StateDownloading || p.choked || !p.interested {
+		return
+	}
+	for len(p.pending) < maxPendingRequests {
+		b, ok := t.pickBlock(p)
+		if !ok {
+			return
+		}
+		pp := t.inProgress[b.piece]
+		pp.pending[b.begin/blockSize]++
+		p.pending[b] = time.Now()
+		length := min(blockSize, int64(len(pp.data))-b.begin)
+		p.send(msgRequest, uint32s(int64(b.piece), b.begin, length))
+	}
+}
+
+// pickBlock picks the block to request from the peer, the pieces in progress are finished first,
+// then the rarest pieces, the blocks pending on the other peers are requested again in the endgame
+func (t *Torrent) pickBlock(p *peerConn) (block, bool) {
+	for index, pp := range t.inProgress {
+		if !p.bitfield.has(index) {
+			continue
+		}
+		for i, received := range pp.received {
+			if !received && pp.pending[i] == 0 {
+				return block{piece: index, begin: int64(i) * blockSize}, true
+			}
+		}
+	}
+	best, bestAvail, ties := -1, 0, 0
+	for i, w := range t.wanted {
+		if !w || t.have.has(i) || t.inProgress[i] != nil || !p.bitfield.has(i) {
+			continue
+		}
+		switch {
+		case best < 0 || t.avail[i] < bestAvail:
+			best, bestAvail, ties = i, t.avail[i], 1
+		case t.avail[i] == bestAvail:
+			// pick one of the rarest randomly
+			ties++
+			if rand.IntN(ties) == 0 {
+				best = i
+			}
+		}
+	}
+	if best >= 0 {
+		size := t.info.PieceSize(best)
+		n := int((size + blockSize - 1) / blockSize)
+		t.inProgress[best] = &pieceProgress{
+			data:     make([]byte, size),
+			received: make([]bool, n),
+			pending:  make([]int, n),
+		}
+		return block{piece: best}, true
+	}
+	for index, pp := range t.inProgress {
+		if !p.bitfield.has(index) {
+			continue
+		}
+		for i, received := range pp.received {
+			b := block{piece: index, begin: int64(i) * blockSize}
+			if _, ok := p.pending[b]; !received && !ok && pp.pending[i] < 2 {
+				return b, true
+			}
+		}
+	}
+	return block{}, false
+}
+
+func (t *Torrent) onExtHandshake(p *peerConn, utMetadata, metadataSize int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.utMetadata = utMetadata
+	p.metadataSize = metadataSize
+	t.requestMetadata(p)
+}
+
+// requestMetadata requests the missing pieces of the metadata of BEP 9
+func (t *Torrent) requestMetadata(p *peerConn) {
+	if t.info != nil || p.utMetadata == 0 || p.metadataSize <= 0 || p.metadataSize > maxMetadataSize {
+		return
+	}
+	if t.metadata == nil || t.metadataLen != p.metadataSize {
+		t.metadataLen = p.metadataSize
+		t.metadata = make([][]byte, (p.metadataSize+blockSize-1)/blockSize)
+	}
+	for i, piece := range t.metadata {
+		if piece == nil {
+			p.sendExtended(p.utMetadata, Encode(map[string]any{"msg_type": 0, "piece": i}))
+		}
+	}
+}
+
+func (t *Torrent) onMetadataRequest(p *peerConn, piece int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p.utMetadata == 0 {
+		return
+	}
+	if t.info == nil || piece < 0 || piece*blockSize >= len(t.info.Raw) {
+		p.sendExtended(p.utMetadata, Encode(map[string]any{"msg_type": 2, "piece": piece}))
+		return
+	}
+	data := t.info.Raw[piece*blockSize : min(len(t.info.Raw), (piece+1)*blockSize)]
+	msg := Encode(map[string]any{"msg_type": 1, "piece": piece, "total_size": len(t.info.Raw)})
+	p.sendExtended(p.utMetadata, append(msg, data...))
+}
+
+func (t *Torrent) onMetadataPiece(piece int, data []byte) {
+	t.mu.Lock()
+	if t.info != nil || piece < 0 || piece >= len(t.metadata) || t.metadata[piece] != nil {
+		t.mu.Unlock()
+		return
+	}
+	expected := min(blockSize, t.metadataLen-piece*blockSize)
+	if len(data) != expected {
+		t.mu.Unlock()
+		return
+	}
+	t.metadata[piece] = data
+	raw := make([]byte, 0, t.metadataLen)
+	for _, p := range t.metadata {
+		if p == nil {
+			t.mu.Unlock()
+			return
+		}
+		raw = append(raw, p...)
+	}
+	if sha1.Sum(raw) != t.infoHash {
+		log.Warnf("torrent %s: metadata failed the hash check", t.infoHash)
+		t.metadata = nil
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	info, err := ParseInfo(raw)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	go t.setInfo(info)
+}
+
+// tickLoop drops the stalled peers, sends the keep alives, and connects more peers
+func (t *Torrent) tickLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		t.mu.Lock()
+		for p := range t.peers {
+			for _, at := range p.pending {
+				if time.Since(at) > time.Minute && time.Since(p.lastActive) > time.Minute {
+					p.close()
+					break
+				}
+			}
+			select {
+			case p.out <- make([]byte, 4):
+			default:
+			}
+			if t.info == nil {
+				t.requestMetadata(p)
+			}
+		}
+		t.connectPeers()
+		t.mu.Unlock()
+	}
+}
+
+func (t *Torrent) announceReq(event string) *announceReq {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	left := t.total - t.completed
+	if t.info == nil {
+		// unknown yet
+		left = 1
+	}
+	return &announceReq{
+		infoHash:   t.infoHash,
+		peerID:     t.c.peerID,
+		port:       t.c.port,
+		uploaded:   t.uploaded,
+		downloaded: t.downloaded,
+		left:       left,
+		event:      event,
+	}
+}
+
+func (t *Torrent) trackerLoop(tracker string) {
+	event := "started"
+	completed := t.completedCh
+	for {
+		ctx, cancel := context.WithTimeout(t.ctx, time.Minute)
+		resp, err := announce(ctx, t.c.cfg.HTTPClient, tracker, t.announceReq(event))
+		cancel()
+		interval := defaultAnnounceInterval
+		if err != nil {
+			log.Debugf("torrent %s: failed announce to %s: %v", t.infoHash, tracker, err)
+			interval = 5 * time.Minute
+		} else {
+			event = ""
+			if resp.interval > 0 {
+				interval = max(resp.interval, minAnnounceInterval)
+			}
+			t.addPeers(resp.peers)
+		}
+		select {
+		case <-t.ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, _ = announce(ctx, t.c.cfg.HTTPClient, tracker, t.announceReq("stopped"))
+			cancel()
+			return
+		case <-completed:
+			completed = nil
+			event = "completed"
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (t *Torrent) dhtLoop() {
+	for {
+		ctx, cancel := context.WithTimeout(t.ctx, time.Minute)
+		t.c.dht.getPeers(ctx, t.infoHash, t.c.port, t.addPeers)
+		cancel()
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(5 * time.Minute):
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTracker is an http tracker which returns all the peers announced,
+// the number of the peers is sent to the channel on every announce
+func testTracker(announced chan<- int) *httptest.Server {
+	var mu sync.Mutex
+	peers := map[string][]byte{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		port, _ := strconv.Atoi(q.Get("port"))
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		peer := binary.BigEndian.AppendUint16(net.ParseIP(host).To4(), uint16(port))
+		mu.Lock()
+		defer mu.Unlock()
+		peers[q.Get("peer_id")] = peer
+		var compact []byte
+		for id, p := range peers {
+			if id != q.Get("peer_id") {
+				compact = append(compact, p...)
+			}
+		}
+		_, _ = w.Write(Encode(map[string]any{"interval": 60, "peers": compact}))
+		select {
+		case announced <- len(peers):
+		default:
+		}
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	announced := make(chan int, 16)
+	tracker := testTracker(announced)
+	defer tracker.Close()
+
+	// a multi-file torrent of which the pieces are across the files
+	const pieceLength = 32 * 1024
+	rnd := rand.New(rand.NewSource(1))
+	contents := [][]byte{make([]byte, 100_000), make([]byte, 50_000), make([]byte, 70_000)}
+	var all []byte
+	var files []any
+	seedDir := t.TempDir()
+	for i, c := range contents {
+		rnd.Read(c)
+		all = append(all, c...)
+		name := "f" + strconv.Itoa(i)
+		files = append(files, map[string]any{"length": len(c), "path": []any{"sub", name}})
+		if err := os.MkdirAll(filepath.Join(seedDir, "data", "sub"), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(seedDir, "data", "sub", name), c, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var pieces []byte
+	for i := 0; i < len(all); i += pieceLength {
+		h := sha1.Sum(all[i:min(len(all), i+pieceLength)])
+		pieces = append(pieces, h[:]...)
+	}
+	raw := Encode(map[string]any{"name": "data", "piece length": pieceLength, "pieces": pieces, "files": files})
+	// the info dict is spliced in as is, since Encode takes the bytes as a string
+	announce := tracker.URL + "/announce"
+	torrentFile := []byte("d8:announce" + strconv.Itoa(len(announce)) + ":" + announce + "4:info" + string(raw) + "e")
+	spec, err := ParseTorrent(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.InfoHash != sha1.Sum(raw) || len(spec.Info.Files) != 3 {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	cfg := Config{MaxPeers: 10}
+	seeder, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	seed, err := seeder.AddTorrent(spec, seedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-seed.Completed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("seeder not completed: %+v", seed.Stats())
+	}
+	// the seeder doesn't connect to the leechers, it must be known by the tracker first
+	select {
+	case <-announced:
+	case <-time.After(10 * time.Second):
+		t.Fatal("seeder not announced")
+	}
+
+	leecher, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+	// only the last two files are selected, and the metadata is fetched from the seeder
+	magnet := "magnet:?xt=urn:btih:" + spec.InfoHash.String() + "&tr=" + url.QueryEscape(tracker.URL+"/announce") + "&so=1-2"
+	mspec, err := ParseMagnet(magnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	leech, err := leecher.AddTorrent(mspec, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-leech.Completed():
+	case <-time.After(30 * time.Second):
+		t.Fatalf("leecher not completed: %+v", leech.Stats())
+	}
+	stats := leech.Stats()
+	if stats.TotalBytes != 120_000 || stats.CompletedBytes != 120_000 || stats.State != StateSeeding {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "data", "sub", "f0")); !os.IsNotExist(err) {
+		t.Fatalf("unselected file is created: %v", err)
+	}
+	for i := 1; i < 3; i++ {
+		got, err := os.ReadFile(filepath.Join(dir, "data", "sub", "f"+strconv.Itoa(i)))
+		if err != nil || !bytes.Equal(got, contents[i]) {
+			t.Fatalf("unexpected content of file %d: %v", i, err)
+		}
+	}
+	if seed.Stats().Uploaded == 0 {
+		t.Fatal("seeder uploaded nothing")
+	}
+	leech.Drop()
+	if leecher.NumTorrents() != 0 {
+		t.Fatal("torrent not removed")
+	}
+}
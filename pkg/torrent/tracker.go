@@ -0,0 +1,226 @@
+package torrent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnnounceInterval = 30 * time.Minute
+	minAnnounceInterval     = time.Minute
+)
+
+type announceReq struct {
+	infoHash   Hash
+	peerID     [20]byte
+	port       int
+	uploaded   int64
+	downloaded int64
+	left       int64
+	// started, completed, stopped or empty
+	event string
+}
+
+type announceResp struct {
+	interval time.Duration
+	peers    []string
+}
+
+// announce announces to the http or udp tracker and returns the peers
+func announce(ctx context.Context, client *http.Client, tracker string, req *announceReq) (*announceResp, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return announceHTTP(ctx, client, u, req)
+	case "udp":
+		return announceUDP(ctx, u.Host, req)
+	default:
+		return nil, fmt.Errorf("unsupported tracker %s", tracker)
+	}
+}
+
+func announceHTTP(ctx context.Context, client *http.Client, u *url.URL, req *announceReq) (*announceResp, error) {
+	q := []string{
+		"info_hash=" + url.QueryEscape(string(req.infoHash[:])),
+		"peer_id=" + url.QueryEscape(string(req.peerID[:])),
+		"port=" + strconv.Itoa(req.port),
+		"uploaded=" + strconv.FormatInt(req.uploaded, 10),
+		"downloaded=" + strconv.FormatInt(req.downloaded, 10),
+		"left=" + strconv.FormatInt(req.left, 10),
+		"compact=1",
+		"numwant=100",
+	}
+	if req.event != "" {
+		q = append(q, "event="+req.event)
+	}
+	// the info hash isn't valid utf-8, so the query is built by hand
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += strings.Join(q, "&")
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	v, err := Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracker response, status %d: %w", res.StatusCode, err)
+	}
+	d, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid tracker response")
+	}
+	if reason := dictString(d, "failure reason"); reason != "" {
+		return nil, fmt.Errorf("tracker failure: %s", reason)
+	}
+	resp := &announceResp{interval: time.Duration(dictInt(d, "interval")) * time.Second}
+	switch peers := d["peers"].(type) {
+	case string:
+		resp.peers = parseCompactPeers([]byte(peers), net.IPv4len)
+	case []any:
+		for _, p := range peers {
+			pd, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			ip := net.ParseIP(dictString(pd, "ip"))
+			port := dictInt(pd, "port")
+			if ip != nil && port > 0 && port < 65536 {
+				resp.peers = append(resp.peers, net.JoinHostPort(ip.String(), strconv.FormatInt(port, 10)))
+			}
+		}
+	}
+	resp.peers = append(resp.peers, parseCompactPeers([]byte(dictString(d, "peers6")), net.IPv6len)...)
+	return resp, nil
+}
+
+// parseCompactPeers parses the peers of the ip followed by the port in big endian
+func parseCompactPeers(b []byte, ipLen int) []string {
+	var peers []string
+	for i := 0; i+ipLen+2 <= len(b); i += ipLen + 2 {
+		ip := net.IP(b[i : i+ipLen])
+		port := binary.BigEndian.Uint16(b[i+ipLen:])
+		if port == 0 {
+			continue
+		}
+		peers = append(peers, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return peers
+}
+
+const (
+	udpProtocolID     = 0x41727101980
+	udpActionConnect  = 0
+	udpActionAnnounce = 1
+	udpActionError    = 3
+)
+
+// announceUDP announces to the udp tracker of BEP 15
+func announceUDP(ctx context.Context, host string, req *announceReq) (*announceResp, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	connect := make([]byte, 16)
+	binary.BigEndian.PutUint64(connect, udpProtocolID)
+	binary.BigEndian.PutUint32(connect[8:], udpActionConnect)
+	resp, err := udpTransact(ctx, conn, connect, 16)
+	if err != nil {
+		return nil, err
+	}
+	connID := binary.BigEndian.Uint64(resp[8:])
+
+	events := map[string]uint32{"": 0, "completed": 1, "started": 2, "stopped": 3}
+	b := make([]byte, 98)
+	binary.BigEndian.PutUint64(b, connID)
+	binary.BigEndian.PutUint32(b[8:], udpActionAnnounce)
+	copy(b[16:], req.infoHash[:])
+	copy(b[36:], req.peerID[:])
+	binary.BigEndian.PutUint64(b[56:], uint64(req.downloaded))
+	binary.BigEndian.PutUint64(b[64:], uint64(req.left))
+	binary.BigEndian.PutUint64(b[72:], uint64(req.uploaded))
+	binary.BigEndian.PutUint32(b[80:], events[req.event])
+	binary.BigEndian.PutUint32(b[88:], rand.Uint32())
+	binary.BigEndian.PutUint32(b[92:], 0xFFFFFFFF)
+	binary.BigEndian.PutUint16(b[96:], uint16(req.port))
+	resp, err = udpTransact(ctx, conn, b, 20)
+	if err != nil {
+		return nil, err
+	}
+	ipLen := net.IPv4len
+	if addr, ok := conn.RemoteAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		ipLen = net.IPv6len
+	}
+	return &announceResp{
+		interval: time.Duration(binary.BigEndian.Uint32(resp[8:])) * time.Second,
+		peers:    parseCompactPeers(resp[20:], ipLen),
+	}, nil
+}
+
+// udpTransact sends the request with a new transaction id and waits for the response, with retries
+func udpTransact(ctx context.Context, conn net.Conn, req []byte, minLen int) ([]byte, error) {
+	tid := rand.Uint32()
+	binary.BigEndian.PutUint32(req[12:], tid)
+	action := binary.BigEndian.Uint32(req[8:])
+	buf := make([]byte, 4096)
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err = conn.Write(req); err != nil {
+			return nil, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second << attempt))
+		for {
+			var n int
+			n, err = conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if n < 8 || binary.BigEndian.Uint32(buf[4:]) != tid {
+				continue
+			}
+			if binary.BigEndian.Uint32(buf) == udpActionError {
+				return nil, fmt.Errorf("tracker failure: %s", buf[8:n])
+			}
+			if binary.BigEndian.Uint32(buf) != action || n < minLen {
+				return nil, errors.New("invalid tracker response")
+			}
+			return buf[:n], nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
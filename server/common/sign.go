@@ -15,3 +15,13 @@ func Sign(obj model.Obj, parent string, encrypt bool) string {
 	}
 	return sign.Sign(stdpath.Join(parent, obj.GetName()))
 }
+
+// SharingSign signs a path inside a sharing, so that links of a restricted
+// sharing can be opened by browsers without the Authorization header
+func SharingSign(sid, path string) string {
+	return sign.Sign(stdpath.Join("/@s", sid, path))
+}
+
+func VerifySharingSign(sid, path, s string) error {
+	return sign.Verify(stdpath.Join("/@s", sid, path), s)
+}
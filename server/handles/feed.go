@@ -0,0 +1,170 @@
+package handles
+
+import (
+	"strconv"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/feed"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// getOwnFeed gets the feed by the id query, only admins can access the feeds of others
+func getOwnFeed(c *gin.Context, id uint) (*model.Feed, bool) {
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	f, err := feed.GetFeedById(id)
+	if err != nil || (!user.IsAdmin() && f.CreatorId != user.ID) {
+		common.ErrorStrResp(c, "feed not found", 404)
+		return nil, false
+	}
+	return f, true
+}
+
+func ListFeeds(c *gin.Context) {
+	var req model.PageReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	req.Validate()
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	var feeds []model.Feed
+	var total int64
+	var err error
+	if user.IsAdmin() {
+		feeds, total, err = feed.GetFeeds(req.Page, req.PerPage)
+	} else {
+		feeds, total, err = feed.GetFeedsByCreatorId(user.ID, req.Page, req.PerPage)
+	}
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	common.SuccessResp(c, common.PageResp{
+		Content: feeds,
+		Total:   total,
+	})
+}
+
+func GetFeed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if f, ok := getOwnFeed(c, uint(id)); ok {
+		common.SuccessResp(c, f)
+	}
+}
+
+func CreateFeed(c *gin.Context) {
+	var req model.Feed
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if !user.CanAddOfflineDownloadTasks() {
+		common.ErrorStrResp(c, "permission denied", 403)
+		return
+	}
+	if _, err := user.JoinPath(req.DstDir); err != nil {
+		common.ErrorResp(c, err, 403)
+		return
+	}
+	req.ID = 0
+	req.CreatorId = user.ID
+	req.LastCheckAt, req.LastError = nil, ""
+	if err := feed.CreateFeed(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.SuccessResp(c, req)
+}
+
+func UpdateFeed(c *gin.Context) {
+	var req model.Feed
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	f, ok := getOwnFeed(c, req.ID)
+	if !ok {
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if f.CreatorId == user.ID {
+		if _, err := user.JoinPath(req.DstDir); err != nil {
+			common.ErrorResp(c, err, 403)
+			return
+		}
+	}
+	if err := feed.UpdateFeed(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.SuccessResp(c)
+}
+
+func DeleteFeed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if _, ok := getOwnFeed(c, uint(id)); !ok {
+		return
+	}
+	if err = feed.DeleteFeedById(uint(id)); err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	common.SuccessResp(c)
+}
+
+// CheckFeed checks the feed immediately, and returns the number of the items enqueued
+func CheckFeed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	f, ok := getOwnFeed(c, uint(id))
+	if !ok {
+		return
+	}
+	n, err := feed.Check(c.Request.Context(), f)
+	if err != nil {
+		common.ErrorWithDataResp(c, errors.WithMessage(err, "failed check feed"), 500, gin.H{"enqueued": n})
+		return
+	}
+	common.SuccessResp(c, gin.H{"enqueued": n})
+}
+
+type ListFeedItemsReq struct {
+	model.PageReq
+	ID uint `json:"id" form:"id"`
+}
+
+func ListFeedItems(c *gin.Context) {
+	var req ListFeedItemsReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	req.Validate()
+	if _, ok := getOwnFeed(c, req.ID); !ok {
+		return
+	}
+	items, total, err := feed.GetFeedItems(req.ID, req.Page, req.PerPage)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	common.SuccessResp(c, common.PageResp{
+		Content: items,
+		Total:   total,
+	})
+}
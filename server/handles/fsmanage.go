@@ -220,6 +220,63 @@ func FsCopy(c *gin.Context) {
 	}
 }
 
+type SyncReq struct {
+	SrcDir string `json:"src_dir"`
+	DstDir string `json:"dst_dir"`
+	fs.SyncArgs
+	DryRun bool `json:"dry_run"`
+}
+
+func FsSync(c *gin.Context) {
+	var req SyncReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if !user.CanCopy() || (req.Mode == fs.SyncMirror && !user.CanRemove()) {
+		common.ErrorResp(c, errs.PermissionDenied, 403)
+		return
+	}
+	srcDir, err := user.JoinPath(req.SrcDir)
+	if err != nil {
+		common.ErrorResp(c, err, 403)
+		return
+	}
+	dstDir, err := user.JoinPath(req.DstDir)
+	if err != nil {
+		common.ErrorResp(c, err, 403)
+		return
+	}
+	if utils.IsSubPath(srcDir, dstDir) || utils.IsSubPath(dstDir, srcDir) {
+		common.ErrorStrResp(c, "src dir and dst dir can't contain each other", 400)
+		return
+	}
+	if req.DryRun {
+		actions, err := fs.SyncPlan(c.Request.Context(), srcDir, dstDir, req.SyncArgs)
+		if err != nil {
+			common.ErrorResp(c, err, 500)
+			return
+		}
+		common.SuccessResp(c, gin.H{
+			"actions": actions,
+		})
+		return
+	}
+	t, err := fs.Sync(c.Request.Context(), srcDir, dstDir, req.SyncArgs)
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c, gin.H{
+		"task": getTaskInfo(t),
+	})
+}
+
 type RenameReq struct {
 	Path      string `json:"path"`
 	Name      string `json:"name"`
@@ -1,6 +1,7 @@
 package handles
 
 import (
+	"context"
 	"fmt"
 	stdpath "path"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/errs"
 	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
@@ -17,6 +19,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 type ListReq struct {
@@ -115,7 +118,7 @@ func FsList(c *gin.Context, req *ListReq, user *model.User) {
 		}
 	}
 	common.SuccessResp(c, FsListResp{
-		Content:           toObjsResp(objs, reqPath, isEncrypt(meta, reqPath)),
+		Content:           toObjsResp(c.Request.Context(), objs, reqPath, isEncrypt(meta, reqPath)),
 		Total:             int64(total),
 		Readme:            getReadme(meta, reqPath),
 		Header:            getHeader(meta, reqPath),
@@ -226,10 +229,10 @@ func pagination(objs []model.Obj, req *model.PageReq) (int, []model.Obj) {
 	return total, objs[start:end]
 }
 
-func toObjsResp(objs []model.Obj, parent string, encrypt bool) []ObjResp {
+func toObjsResp(ctx context.Context, objs []model.Obj, parent string, encrypt bool) []ObjResp {
 	var resp []ObjResp
 	for _, obj := range objs {
-		thumb, _ := model.GetThumb(obj)
+		thumb := getThumb(ctx, obj, parent)
 		mountDetails, _ := model.GetStorageDetails(obj)
 		resp = append(resp, ObjResp{
 			Name:         obj.GetName(),
@@ -255,11 +258,12 @@ type FsGetReq struct {
 
 type FsGetResp struct {
 	ObjResp
-	RawURL   string    `json:"raw_url"`
-	Readme   string    `json:"readme"`
-	Header   string    `json:"header"`
-	Provider string    `json:"provider"`
-	Related  []ObjResp `json:"related"`
+	RawURL   string          `json:"raw_url"`
+	Readme   string          `json:"readme"`
+	Header   string          `json:"header"`
+	Provider string          `json:"provider"`
+	Related  []ObjResp       `json:"related"`
+	Media    *media.Metadata `json:"media,omitempty"`
 }
 
 func FsGetSplit(c *gin.Context) {
@@ -357,8 +361,19 @@ func FsGet(c *gin.Context, req *FsGetReq, user *model.User) {
 		related = filterRelated(sameLevelFiles, obj)
 	}
 	parentMeta, _ := op.GetNearestMeta(parentPath)
-	thumb, _ := model.GetThumb(obj)
+	thumb := getThumb(c.Request.Context(), obj, parentPath)
 	mountDetails, _ := model.GetStorageDetails(obj)
+	var metadata *media.Metadata
+	if media.Enabled() && media.Supported(obj) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		metadata, err = media.Get(ctx, reqPath, obj)
+		cancel()
+		if err != nil {
+			log.Warnf("failed to get media metadata of %s: %+v", reqPath, err)
+		} else if !media.GPSEnabled() {
+			metadata = metadata.WithoutGPS()
+		}
+	}
 	common.SuccessResp(c, FsGetResp{
 		ObjResp: ObjResp{
 			Name:         obj.GetName(),
@@ -377,7 +392,8 @@ func FsGet(c *gin.Context, req *FsGetReq, user *model.User) {
 		Readme:   getReadme(meta, reqPath),
 		Header:   getHeader(meta, reqPath),
 		Provider: provider,
-		Related:  toObjsResp(related, parentPath, isEncrypt(parentMeta, parentPath)),
+		Related:  toObjsResp(c.Request.Context(), related, parentPath, isEncrypt(parentMeta, parentPath)),
+		Media:    metadata,
 	})
 }
 
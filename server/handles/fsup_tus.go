@@ -0,0 +1,316 @@
+package handles
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	stdpath "path"
+	"strconv"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/tus"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// resumable upload following the tus protocol, see https://tus.io/protocols/resumable-upload
+// the destination is given by the File-Path header like /fs/put, so that FsUp checks apply
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,termination,concatenation"
+	tusMaxSize    = int64(1) << 40
+)
+
+func tusError(c *gin.Context, err error, code int) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.String(code, err.Error())
+	c.Abort()
+}
+
+func tusStatus(err error) int {
+	switch errors.Cause(err) {
+	case tus.ErrNotFound:
+		return http.StatusNotFound
+	case tus.ErrOffsetMismatch, tus.ErrLocked:
+		return http.StatusConflict
+	case tus.ErrSizeExceeded:
+		return http.StatusRequestEntityTooLarge
+	case tus.ErrNotComplete:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func tusCheckVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		tusError(c, errors.New("unsupported tus version"), http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// tusUploadPath returns the destination path from the File-Path header
+func tusUploadPath(c *gin.Context, user *model.User) (string, error) {
+	path, err := url.PathUnescape(c.GetHeader("File-Path"))
+	if err != nil {
+		return "", err
+	}
+	return user.JoinPath(path)
+}
+
+// tusSession returns the upload of the id param which must belong to the current user
+func tusSession(c *gin.Context) (*tus.Session, bool) {
+	s, err := tus.Get(c.Param("id"))
+	if err != nil {
+		tusError(c, err, tusStatus(err))
+		return nil, false
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if s.UserID != user.ID {
+		tusError(c, tus.ErrNotFound, http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+func tusLocation(c *gin.Context, id string) string {
+	return common.GetApiUrl(c.Request.Context()) + "/api/fs/tus/" + id
+}
+
+// parseTusMetadata parses the Upload-Metadata header, "key base64value,key2 base64value2"
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, " ")
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value of %s", key)
+		}
+		meta[key] = string(v)
+	}
+	return meta, nil
+}
+
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(tusMaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+func TusCreate(c *gin.Context) {
+	defer func() {
+		_, _ = utils.CopyWithBuffer(io.Discard, c.Request.Body)
+		_ = c.Request.Body.Close()
+	}()
+	if !tusCheckVersion(c) {
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	path, err := tusUploadPath(c, user)
+	if err != nil {
+		tusError(c, err, http.StatusForbidden)
+		return
+	}
+	meta, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		tusError(c, err, http.StatusBadRequest)
+		return
+	}
+	concat := c.GetHeader("Upload-Concat")
+	partial := concat == "partial"
+	final := strings.HasPrefix(concat, "final;")
+	if !partial {
+		if shouldIgnoreSystemFile(stdpath.Base(path)) {
+			tusError(c, errs.IgnoredSystemFile, http.StatusForbidden)
+			return
+		}
+		if c.GetHeader("Overwrite") == "false" {
+			if res, _ := fs.Get(c.Request.Context(), path, &fs.GetArgs{NoLog: true}); res != nil {
+				tusError(c, errors.New("file exists"), http.StatusForbidden)
+				return
+			}
+		}
+		storage, err := fs.GetStorage(path, &fs.GetStoragesArgs{})
+		if err != nil {
+			tusError(c, err, http.StatusBadRequest)
+			return
+		}
+		if storage.Config().NoUpload {
+			tusError(c, errs.UploadNotSupported, http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	info := tus.Info{
+		UserID:   user.ID,
+		Path:     path,
+		Partial:  partial,
+		Modified: getLastModified(c),
+		Mimetype: meta["filetype"],
+		Hash:     make(map[string]string),
+		Metadata: meta,
+	}
+	if md5 := c.GetHeader("X-File-Md5"); md5 != "" {
+		info.Hash[utils.MD5.Name] = md5
+	}
+	if sha1 := c.GetHeader("X-File-Sha1"); sha1 != "" {
+		info.Hash[utils.SHA1.Name] = sha1
+	}
+	if sha256 := c.GetHeader("X-File-Sha256"); sha256 != "" {
+		info.Hash[utils.SHA256.Name] = sha256
+	}
+	var s *tus.Session
+	if final {
+		var partials []*tus.Session
+		for _, u := range strings.Fields(strings.TrimPrefix(concat, "final;")) {
+			p, err := tus.Get(stdpath.Base(u))
+			if err != nil || p.UserID != user.ID || !p.Partial {
+				tusError(c, fmt.Errorf("invalid partial upload %s", u), http.StatusBadRequest)
+				return
+			}
+			partials = append(partials, p)
+		}
+		s, err = tus.Concat(info, partials)
+	} else {
+		info.Size, err = strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+		if err != nil || info.Size < 0 {
+			tusError(c, errors.New("invalid Upload-Length"), http.StatusBadRequest)
+			return
+		}
+		if info.Size > tusMaxSize {
+			tusError(c, tus.ErrSizeExceeded, http.StatusRequestEntityTooLarge)
+			return
+		}
+		s, err = tus.Create(info)
+	}
+	if err != nil {
+		tusError(c, err, tusStatus(err))
+		return
+	}
+	// creation-with-upload
+	if !final && c.GetHeader("Content-Type") == "application/offset+octet-stream" {
+		if _, err = s.Write(0, c.Request.Body); err != nil {
+			tusError(c, err, tusStatus(err))
+			return
+		}
+	}
+	if !tusFinish(c, s) {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", tusLocation(c, s.ID))
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+func TusHead(c *gin.Context) {
+	if !tusCheckVersion(c) {
+		return
+	}
+	s, ok := tusSession(c)
+	if !ok {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(s.Size, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	if s.Partial {
+		c.Header("Upload-Concat", "partial")
+	}
+	c.Status(http.StatusOK)
+}
+
+func TusPatch(c *gin.Context) {
+	defer func() {
+		_, _ = utils.CopyWithBuffer(io.Discard, c.Request.Body)
+		_ = c.Request.Body.Close()
+	}()
+	if !tusCheckVersion(c) {
+		return
+	}
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		tusError(c, errors.New("invalid Content-Type"), http.StatusUnsupportedMediaType)
+		return
+	}
+	s, ok := tusSession(c)
+	if !ok {
+		return
+	}
+	// the permission checked by FsUp is of File-Path, which must be the destination of the upload
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	if path, err := tusUploadPath(c, user); err != nil || path != s.Path {
+		tusError(c, errs.PermissionDenied, http.StatusForbidden)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		tusError(c, errors.New("invalid Upload-Offset"), http.StatusBadRequest)
+		return
+	}
+	if _, err = s.Write(offset, c.Request.Body); err != nil {
+		tusError(c, err, tusStatus(err))
+		return
+	}
+	if !tusFinish(c, s) {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	c.Header("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+func TusDelete(c *gin.Context) {
+	if !tusCheckVersion(c) {
+		return
+	}
+	s, ok := tusSession(c)
+	if !ok {
+		return
+	}
+	tus.Terminate(s)
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// tusFinish hands the completed upload over to an upload task, the upload is kept if the task fails,
+// and an empty PATCH at the end of it finishes it again
+func tusFinish(c *gin.Context, s *tus.Session) bool {
+	if !s.Complete() || s.Partial {
+		return true
+	}
+	file, err := s.Stream()
+	if err != nil {
+		tusError(c, err, tusStatus(err))
+		return false
+	}
+	file.WebPutAsTask = true
+	t, err := fs.PutAsTask(c.Request.Context(), stdpath.Dir(s.Path), file)
+	if err != nil {
+		_ = file.Close()
+		file.OnUploaded(false)
+		tusError(c, err, http.StatusInternalServerError)
+		return false
+	}
+	c.Header("Upload-Task-Id", t.GetID())
+	return true
+}
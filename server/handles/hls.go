@@ -0,0 +1,80 @@
+package handles
+
+import (
+	"fmt"
+	"net/url"
+	stdpath "path"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/hls"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// HLS serves the playlist of the video, or the segment if the segment is given in the query
+func HLS(c *gin.Context) {
+	rawPath := c.Request.Context().Value(conf.PathKey).(string)
+	if !hls.Enabled() {
+		common.ErrorPage(c, errors.New("hls is disabled"), 403)
+		return
+	}
+	storage, err := fs.GetStorage(rawPath, &fs.GetStoragesArgs{})
+	if err != nil {
+		common.ErrorPage(c, err, 500)
+		return
+	}
+	if !canProxy(storage, stdpath.Base(rawPath)) {
+		common.ErrorPage(c, errors.New("proxy not allowed"), 403)
+		return
+	}
+	obj, err := fs.Get(c.Request.Context(), rawPath, &fs.GetArgs{NoLog: true})
+	if err != nil {
+		common.ErrorPage(c, err, 404)
+		return
+	}
+	if !hls.Supported(obj) {
+		common.ErrorPage(c, errors.New("not a video"), 400)
+		return
+	}
+	if segment := c.Query("segment"); segment != "" {
+		file, err := hls.Segment(c.Request.Context(), rawPath, obj, segment)
+		if err != nil {
+			common.ErrorPage(c, err, hlsErrorCode(err))
+			return
+		}
+		c.Header("Content-Type", "video/mp2t")
+		c.Header("Cache-Control", "max-age=86400")
+		c.File(file)
+		return
+	}
+	playlist, err := hls.Playlist(c.Request.Context(), rawPath, obj)
+	if err != nil {
+		common.ErrorPage(c, err, hlsErrorCode(err))
+		return
+	}
+	// the segments are requested with the sign of the playlist
+	query := ""
+	if s := c.Query("sign"); s != "" {
+		query = "&sign=" + url.QueryEscape(s)
+	}
+	prefix := fmt.Sprintf("%s/hls%s?segment=", common.GetApiUrl(c), utils.EncodePath(rawPath, true))
+	playlist = hls.RewritePlaylist(playlist, func(name string) string {
+		return prefix + url.QueryEscape(name) + query
+	})
+	c.Header("Cache-Control", "no-cache")
+	c.Data(200, "application/vnd.apple.mpegurl", playlist)
+}
+
+func hlsErrorCode(err error) int {
+	switch {
+	case errors.Is(err, hls.ErrBusy):
+		return 503
+	case errs.IsObjectNotFound(err):
+		return 404
+	}
+	return 500
+}
@@ -1,6 +1,7 @@
 package handles
 
 import (
+	"net/http"
 	"strings"
 
 	_115 "github.com/OpenListTeam/OpenList/v4/drivers/115"
@@ -114,6 +115,43 @@ func SetTransmission(c *gin.Context) {
 	common.SuccessResp(c, "ok")
 }
 
+type SetBitTorrentReq struct {
+	ListenPort string `json:"listen_port" form:"listen_port"`
+	DHT        string `json:"dht" form:"dht"`
+	MaxPeers   string `json:"max_peers" form:"max_peers"`
+	SeedRatio  string `json:"seed_ratio" form:"seed_ratio"`
+	Seedtime   string `json:"seedtime" form:"seedtime"`
+}
+
+func SetBitTorrent(c *gin.Context) {
+	var req SetBitTorrentReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	items := []model.SettingItem{
+		{Key: conf.BitTorrentListenPort, Value: req.ListenPort, Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentDHT, Value: req.DHT, Type: conf.TypeBool, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentMaxPeers, Value: req.MaxPeers, Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentSeedRatio, Value: req.SeedRatio, Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+		{Key: conf.BitTorrentSeedtime, Value: req.Seedtime, Type: conf.TypeNumber, Group: model.OFFLINE_DOWNLOAD, Flag: model.PRIVATE},
+	}
+	if err := op.SaveSettingItems(items); err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	_tool, err := tool.Tools.Get("BitTorrent")
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	if _, err := _tool.Init(); err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c, "ok")
+}
+
 type Set115Req struct {
 	TempDir string `json:"temp_dir" form:"temp_dir"`
 }
@@ -479,6 +517,27 @@ type AddOfflineDownloadReq struct {
 	Path         string   `json:"path"`
 	Tool         string   `json:"tool"`
 	DeletePolicy string   `json:"delete_policy"`
+	// the extra headers sent with the requests of the urls, only supported by SimpleHttp
+	Headers map[string]string `json:"headers"`
+	Cookie  string            `json:"cookie"`
+	Referer string            `json:"referer"`
+}
+
+func (r *AddOfflineDownloadReq) header() http.Header {
+	header := http.Header{}
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+	if r.Cookie != "" {
+		header.Set("Cookie", r.Cookie)
+	}
+	if r.Referer != "" {
+		header.Set("Referer", r.Referer)
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
 }
 
 func AddOfflineDownload(c *gin.Context) {
@@ -498,6 +557,11 @@ func AddOfflineDownload(c *gin.Context) {
 		common.ErrorResp(c, err, 403)
 		return
 	}
+	header := req.header()
+	if header != nil && req.Tool != "SimpleHttp" {
+		common.ErrorStrResp(c, "custom headers are only supported by SimpleHttp", 400)
+		return
+	}
 	var tasks []task.TaskExtensionInfo
 	for _, url := range req.Urls {
 		// Filter out empty lines and whitespace-only strings
@@ -511,6 +575,7 @@ func AddOfflineDownload(c *gin.Context) {
 			DstDirPath:   reqPath,
 			Tool:         req.Tool,
 			DeletePolicy: tool.DeletePolicy(req.DeletePolicy),
+			Header:       header,
 		})
 		if err != nil {
 			common.ErrorResp(c, err, 500)
@@ -2,8 +2,12 @@ package handles
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	stdpath "path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
@@ -13,14 +17,17 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/internal/sharing"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/OpenListTeam/go-cache"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 func SharingGet(c *gin.Context, req *FsGetReq) {
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
 	sid, path, _ := strings.Cut(strings.TrimPrefix(req.Path, "/"), "/")
 	if sid == "" {
 		common.ErrorStrResp(c, "invalid share id", 400)
@@ -34,13 +41,12 @@ func SharingGet(c *gin.Context, req *FsGetReq) {
 		return
 	}
 	_ = countAccess(c.ClientIP(), s)
+	recordAccess(c, s, model.SharingAccessGet, path, 0)
 	url := ""
 	if !obj.IsDir() {
 		fakePath := fmt.Sprintf("/%s/%s", sid, path)
 		url = fmt.Sprintf("%s/sd%s", common.GetApiUrl(c), utils.EncodePath(fakePath, true))
-		if s.Pwd != "" {
-			url += "?pwd=" + s.Pwd
-		}
+		url = withSharingQuery(url, s, path)
 	}
 	thumb, _ := model.GetThumb(obj)
 	common.SuccessResp(c, FsGetResp{
@@ -65,6 +71,7 @@ func SharingGet(c *gin.Context, req *FsGetReq) {
 }
 
 func SharingList(c *gin.Context, req *ListReq) {
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
 	sid, path, _ := strings.Cut(strings.TrimPrefix(req.Path, "/"), "/")
 	if sid == "" {
 		common.ErrorStrResp(c, "invalid share id", 400)
@@ -78,6 +85,7 @@ func SharingList(c *gin.Context, req *ListReq) {
 		return
 	}
 	_ = countAccess(c.ClientIP(), s)
+	recordAccess(c, s, model.SharingAccessList, path, 0)
 	total, objs := pagination(objs, &req.PageReq)
 	common.SuccessResp(c, FsListResp{
 		Content: utils.MustSliceConvert(objs, func(obj model.Obj) ObjResp {
@@ -98,12 +106,13 @@ func SharingList(c *gin.Context, req *ListReq) {
 		Total:    int64(total),
 		Readme:   s.Readme,
 		Header:   s.Header,
-		Write:    false,
+		Write:    s.FileRequest,
 		Provider: "unknown",
 	})
 }
 
 func SharingArchiveMeta(c *gin.Context, req *ArchiveMetaReq) {
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
 	if !setting.GetBool(conf.ShareArchivePreview) {
 		common.ErrorStrResp(c, "sharing archives previewing is not allowed", 403)
 		return
@@ -131,11 +140,10 @@ func SharingArchiveMeta(c *gin.Context, req *ArchiveMetaReq) {
 		return
 	}
 	_ = countAccess(c.ClientIP(), s)
+	recordAccess(c, s, model.SharingAccessArchive, path, 0)
 	fakePath := fmt.Sprintf("/%s/%s", sid, path)
 	url := fmt.Sprintf("%s/sad%s", common.GetApiUrl(c), utils.EncodePath(fakePath, true))
-	if s.Pwd != "" {
-		url += "?pwd=" + s.Pwd
-	}
+	url = withSharingQuery(url, s, path)
 	common.SuccessResp(c, ArchiveMetaResp{
 		Comment:     ret.GetComment(),
 		IsEncrypted: ret.IsEncrypted(),
@@ -147,6 +155,7 @@ func SharingArchiveMeta(c *gin.Context, req *ArchiveMetaReq) {
 }
 
 func SharingArchiveList(c *gin.Context, req *ArchiveListReq) {
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
 	if !setting.GetBool(conf.ShareArchivePreview) {
 		common.ErrorStrResp(c, "sharing archives previewing is not allowed", 403)
 		return
@@ -177,6 +186,7 @@ func SharingArchiveList(c *gin.Context, req *ArchiveListReq) {
 		return
 	}
 	_ = countAccess(c.ClientIP(), s)
+	recordAccess(c, s, model.SharingAccessArchive, path, 0)
 	total, objs := pagination(objs, &req.PageReq)
 	ret, _ := utils.SliceConvert(objs, func(src model.Obj) (ObjResp, error) {
 		return toObjsRespWithoutSignAndThumb(src), nil
@@ -191,15 +201,22 @@ func SharingDown(c *gin.Context) {
 	sid := c.Request.Context().Value(conf.SharingIDKey).(string)
 	path := c.Request.Context().Value(conf.PathKey).(string)
 	path = utils.FixAndCleanPath(path)
-	pwd := c.Query("pwd")
+	pwd := sharingPwd(c)
 	s, err := op.GetSharingById(sid)
 	if err == nil {
 		if !s.Valid() {
 			err = errs.InvalidSharing
-		} else if !s.Verify(pwd) {
-			err = errs.WrongShareCode
+		} else if verr := sharing.Verify(c.Request.Context(), s, pwd); verr != nil {
+			err = verr
+		} else if !s.CanBrowse() {
+			err = errs.PermissionDenied
 		} else if len(s.Files) != 1 && path == "/" {
 			err = errors.New("cannot get sharing root link")
+		} else if s.FileMaxDownloads > 0 && c.Request.Method != http.MethodHead && !downloading(c, sid, path) {
+			var downloads int64
+			if downloads, err = op.CountSharingFileDownloads(sid, path); err == nil && downloads >= int64(s.FileMaxDownloads) {
+				err = errs.SharingDownloadLimited
+			}
 		}
 	}
 	if dealErrorPage(c, err) {
@@ -214,6 +231,7 @@ func SharingDown(c *gin.Context) {
 	if dealErrorPage(c, err) {
 		return
 	}
+	download := startDownload(c, s, path)
 	if setting.GetBool(conf.ShareForceProxy) || common.ShouldProxy(storage, stdpath.Base(actualPath)) {
 		if _, ok := c.GetQuery("d"); !ok {
 			if url := common.GenerateDownProxyURL(storage.GetStorage(), unwrapPath); url != "" {
@@ -232,6 +250,9 @@ func SharingDown(c *gin.Context) {
 		}
 		_ = countAccess(c.ClientIP(), s)
 		proxy(c, link, obj, storage.GetStorage().ProxyRange)
+		if download != nil {
+			download.addBytes(int64(c.Writer.Size()))
+		}
 	} else {
 		link, _, err := op.Link(c.Request.Context(), storage, actualPath, model.LinkArgs{
 			IP:       c.ClientIP(),
@@ -256,15 +277,17 @@ func SharingArchiveExtract(c *gin.Context) {
 	sid := c.Request.Context().Value(conf.SharingIDKey).(string)
 	path := c.Request.Context().Value(conf.PathKey).(string)
 	path = utils.FixAndCleanPath(path)
-	pwd := c.Query("pwd")
+	pwd := sharingPwd(c)
 	innerPath := utils.FixAndCleanPath(c.Query("inner"))
 	archivePass := c.Query("pass")
 	s, err := op.GetSharingById(sid)
 	if err == nil {
 		if !s.Valid() {
 			err = errs.InvalidSharing
-		} else if !s.Verify(pwd) {
-			err = errs.WrongShareCode
+		} else if verr := sharing.Verify(c.Request.Context(), s, pwd); verr != nil {
+			err = verr
+		} else if !s.CanBrowse() {
+			err = errs.PermissionDenied
 		} else if len(s.Files) != 1 && path == "/" {
 			err = errors.New("cannot extract sharing root")
 		}
@@ -314,6 +337,96 @@ func SharingArchiveExtract(c *gin.Context) {
 		fileName := stdpath.Base(innerPath)
 		proxyInternalExtract(c, rc, size, fileName)
 	}
+	recordAccess(c, s, model.SharingAccessArchive, path, int64(c.Writer.Size()))
+}
+
+func SharingUpload(c *gin.Context) {
+	defer func() {
+		if n, _ := io.ReadFull(c.Request.Body, []byte{0}); n == 1 {
+			_, _ = utils.CopyWithBuffer(io.Discard, c.Request.Body)
+		}
+		_ = c.Request.Body.Close()
+	}()
+	sid := c.Request.Context().Value(conf.SharingIDKey).(string)
+	path := c.Request.Context().Value(conf.PathKey).(string)
+	path = utils.FixAndCleanPath(path)
+	if path == "/" {
+		common.ErrorStrResp(c, "file name is required", 400)
+		return
+	}
+	pwd := sharingPwd(c)
+	dir, name := stdpath.Split(path)
+	if shouldIgnoreSystemFile(name) {
+		common.ErrorStrResp(c, errs.IgnoredSystemFile.Error(), 403)
+		return
+	}
+	size := c.Request.ContentLength
+	if size < 0 {
+		sizeStr := c.GetHeader("X-File-Size")
+		if sizeStr != "" {
+			var err error
+			size, err = strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil {
+				common.ErrorResp(c, err, 400)
+				return
+			}
+		}
+	}
+	mimetype := c.GetHeader("Content-Type")
+	if len(mimetype) == 0 {
+		mimetype = utils.GetMimeType(name)
+	}
+	s := &stream.FileStream{
+		Obj: &model.Object{
+			Name:     name,
+			Size:     size,
+			Modified: getLastModified(c),
+		},
+		Reader:       c.Request.Body,
+		Mimetype:     mimetype,
+		WebPutAsTask: true,
+	}
+	// the upload is recorded after the task succeeds, the declared size is limited by the sharing
+	access := newAccess(c, sid, model.SharingAccessUpload, stdpath.Join(dir, name), s.GetSize())
+	sh, t, err := sharing.Put(c.Request.Context(), sid, dir, s, model.SharingListArgs{
+		Refresh: false,
+		Pwd:     pwd,
+	}, func() {
+		saveAccess(access, nil)
+	})
+	if dealError(c, err) {
+		return
+	}
+	_ = countAccess(c.ClientIP(), sh)
+	common.SuccessResp(c, gin.H{
+		"task": getTaskInfo(t),
+	})
+}
+
+// sharingPwd gets the session token or the password of the sharing from the request
+func sharingPwd(c *gin.Context) string {
+	if st := c.Query("st"); st != "" {
+		return st
+	}
+	if pwd := c.GetHeader("Password"); pwd != "" {
+		return pwd
+	}
+	return c.Query("pwd")
+}
+
+// withSharingQuery appends the query needed to access a link of the sharing
+func withSharingQuery(url string, s *model.Sharing, path string) string {
+	query := make([]string, 0, 2)
+	if s.HasPwd() {
+		query = append(query, "st="+sharing.Token(s))
+	}
+	if s.Restricted() {
+		query = append(query, "sign="+common.SharingSign(s.ID, utils.FixAndCleanPath(path)))
+	}
+	if len(query) == 0 {
+		return url
+	}
+	return url + "?" + strings.Join(query, "&")
 }
 
 func dealError(c *gin.Context, err error) bool {
@@ -323,8 +436,16 @@ func dealError(c *gin.Context, err error) bool {
 		common.ErrorStrResp(c, "the share does not exist", 500)
 	} else if errors.Is(err, errs.InvalidSharing) {
 		common.ErrorStrResp(c, "the share has expired or is no longer valid", 500)
+	} else if errors.Is(err, errs.SharingNeedLogin) {
+		common.ErrorResp(c, err, 401)
+	} else if errors.Is(err, errs.SharingAuthLimit) {
+		common.ErrorResp(c, err, 429)
 	} else if errors.Is(err, errs.WrongShareCode) {
 		common.ErrorResp(c, err, 403)
+	} else if errors.Is(err, errs.PermissionDenied) || errors.Is(err, errs.SharingUploadNotAllowed) ||
+		errors.Is(err, errs.SharingUploadLimitExceeded) || errors.Is(err, errs.SharingUploadRejected) ||
+		errors.Is(err, errs.ObjectAlreadyExists) {
+		common.ErrorResp(c, err, 403)
 	} else if errors.Is(err, errs.WrongArchivePassword) {
 		common.ErrorResp(c, err, 202)
 	} else {
@@ -340,7 +461,12 @@ func dealErrorPage(c *gin.Context, err error) bool {
 		common.ErrorPage(c, errors.New("the share does not exist"), 500)
 	} else if errors.Is(err, errs.InvalidSharing) {
 		common.ErrorPage(c, errors.New("the share has expired or is no longer valid"), 500)
-	} else if errors.Is(err, errs.WrongShareCode) {
+	} else if errors.Is(err, errs.SharingNeedLogin) {
+		common.ErrorPage(c, err, 401)
+	} else if errors.Is(err, errs.SharingAuthLimit) {
+		common.ErrorPage(c, err, 429)
+	} else if errors.Is(err, errs.WrongShareCode) || errors.Is(err, errs.PermissionDenied) ||
+		errors.Is(err, errs.SharingDownloadLimited) {
 		common.ErrorPage(c, err, 403)
 	} else if errors.Is(err, errs.WrongArchivePassword) {
 		common.ErrorPage(c, err, 202)
@@ -352,11 +478,36 @@ func dealErrorPage(c *gin.Context, err error) bool {
 
 type SharingResp struct {
 	*model.Sharing
+	Pwd         string `json:"pwd"`
 	CreatorName string `json:"creator"`
 	CreatorRole int    `json:"creator_role"`
 }
 
+func toSharingResp(s *model.Sharing) SharingResp {
+	resp := SharingResp{
+		Sharing:     s,
+		CreatorName: s.Creator.Username,
+		CreatorRole: s.Creator.Role,
+	}
+	if s.HasPwd() {
+		resp.Pwd = model.MaskedSharingPwd
+	}
+	return resp
+}
+
+type SharingDetailResp struct {
+	SharingResp
+	Stats    *model.SharingStats `json:"stats"`
+	Accesses common.PageResp     `json:"accesses"`
+}
+
 func GetSharing(c *gin.Context) {
+	var req model.PageReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	req.Validate()
 	sid := c.Query("id")
 	user := c.Request.Context().Value(conf.UserKey).(*model.User)
 	s, err := op.GetSharingById(sid)
@@ -364,10 +515,23 @@ func GetSharing(c *gin.Context) {
 		common.ErrorStrResp(c, "sharing not found", 404)
 		return
 	}
-	common.SuccessResp(c, SharingResp{
-		Sharing:     s,
-		CreatorName: s.Creator.Username,
-		CreatorRole: s.Creator.Role,
+	stats, err := op.GetSharingStats(sid)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	accesses, total, err := op.GetSharingAccesses(sid, req.Page, req.PerPage)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	common.SuccessResp(c, SharingDetailResp{
+		SharingResp: toSharingResp(s),
+		Stats:       stats,
+		Accesses: common.PageResp{
+			Content: accesses,
+			Total:   total,
+		},
 	})
 }
 
@@ -393,11 +557,7 @@ func ListSharings(c *gin.Context) {
 	}
 	common.SuccessResp(c, common.PageResp{
 		Content: utils.MustSliceConvert(sharings, func(s model.Sharing) SharingResp {
-			return SharingResp{
-				Sharing:     &s,
-				CreatorName: s.Creator.Username,
-				CreatorRole: s.Creator.Role,
-			}
+			return toSharingResp(&s)
 		}),
 		Total: total,
 	})
@@ -413,9 +573,18 @@ type UpdateSharingReq struct {
 	Readme      string     `json:"readme"`
 	Header      string     `json:"header"`
 	model.Sort
-	CreatorName string `json:"creator"`
-	Accessed    int    `json:"accessed"`
-	ID          string `json:"id"`
+	FileRequest      bool     `json:"file_request"`
+	HideContent      bool     `json:"hide_content"`
+	MaxFileSize      int64    `json:"max_file_size"`
+	MaxFileCount     int      `json:"max_file_count"`
+	Uploaded         int      `json:"uploaded"`
+	AllowedExts      string   `json:"allowed_exts"`
+	FileMaxDownloads int      `json:"file_max_downloads"`
+	AllowedUsers     []string `json:"allowed_users"`
+	AllowedDomains   string   `json:"allowed_domains"`
+	CreatorName      string   `json:"creator"`
+	Accessed         int      `json:"accessed"`
+	ID               string   `json:"id"`
 }
 
 func UpdateSharing(c *gin.Context) {
@@ -428,6 +597,16 @@ func UpdateSharing(c *gin.Context) {
 		common.ErrorStrResp(c, "must add at least 1 object", 400)
 		return
 	}
+	if req.FileRequest && len(req.Files) != 1 {
+		common.ErrorStrResp(c, "file request must have exactly 1 target folder", 400)
+		return
+	}
+	for _, name := range req.AllowedUsers {
+		if _, err := op.GetUserByName(name); err != nil {
+			common.ErrorStrResp(c, fmt.Sprintf("no such a user [%s]", name), 400)
+			return
+		}
+	}
 	var user *model.User
 	var err error
 	reqUser := c.Request.Context().Value(conf.UserKey).(*model.User)
@@ -462,7 +641,9 @@ func UpdateSharing(c *gin.Context) {
 	}
 	s.Files = req.Files
 	s.Expires = req.Expires
-	s.Pwd = req.Pwd
+	if req.Pwd != model.MaskedSharingPwd {
+		s.SetPwd(req.Pwd)
+	}
 	s.Accessed = req.Accessed
 	s.MaxAccessed = req.MaxAccessed
 	s.Disabled = req.Disabled
@@ -470,15 +651,20 @@ func UpdateSharing(c *gin.Context) {
 	s.Header = req.Header
 	s.Readme = req.Readme
 	s.Remark = req.Remark
+	s.FileRequest = req.FileRequest
+	s.HideContent = req.HideContent
+	s.MaxFileSize = req.MaxFileSize
+	s.MaxFileCount = req.MaxFileCount
+	s.Uploaded = req.Uploaded
+	s.AllowedExts = req.AllowedExts
+	s.FileMaxDownloads = req.FileMaxDownloads
+	s.AllowedUsers = req.AllowedUsers
+	s.AllowedDomains = req.AllowedDomains
 	s.Creator = user
 	if err = op.UpdateSharing(s); err != nil {
 		common.ErrorResp(c, err, 500)
 	} else {
-		common.SuccessResp(c, SharingResp{
-			Sharing:     s,
-			CreatorName: s.Creator.Username,
-			CreatorRole: s.Creator.Role,
-		})
+		common.SuccessResp(c, toSharingResp(s))
 	}
 }
 
@@ -493,6 +679,16 @@ func CreateSharing(c *gin.Context) {
 		common.ErrorStrResp(c, "must add at least 1 object", 400)
 		return
 	}
+	if req.FileRequest && len(req.Files) != 1 {
+		common.ErrorStrResp(c, "file request must have exactly 1 target folder", 400)
+		return
+	}
+	for _, name := range req.AllowedUsers {
+		if _, err := op.GetUserByName(name); err != nil {
+			common.ErrorStrResp(c, fmt.Sprintf("no such a user [%s]", name), 400)
+			return
+		}
+	}
 	var user *model.User
 	reqUser := c.Request.Context().Value(conf.UserKey).(*model.User)
 	if reqUser.IsAdmin() && req.CreatorName != "" {
@@ -518,33 +714,68 @@ func CreateSharing(c *gin.Context) {
 	}
 	s := &model.Sharing{
 		SharingDB: &model.SharingDB{
-			ID:          req.ID,
-			Expires:     req.Expires,
-			Pwd:         req.Pwd,
-			Accessed:    req.Accessed,
-			MaxAccessed: req.MaxAccessed,
-			Disabled:    req.Disabled,
-			Sort:        req.Sort,
-			Remark:      req.Remark,
-			Readme:      req.Readme,
-			Header:      req.Header,
+			ID:               req.ID,
+			Expires:          req.Expires,
+			Accessed:         req.Accessed,
+			MaxAccessed:      req.MaxAccessed,
+			Disabled:         req.Disabled,
+			Sort:             req.Sort,
+			Remark:           req.Remark,
+			Readme:           req.Readme,
+			Header:           req.Header,
+			FileRequest:      req.FileRequest,
+			HideContent:      req.HideContent,
+			MaxFileSize:      req.MaxFileSize,
+			MaxFileCount:     req.MaxFileCount,
+			Uploaded:         req.Uploaded,
+			AllowedExts:      req.AllowedExts,
+			FileMaxDownloads: req.FileMaxDownloads,
+			AllowedDomains:   req.AllowedDomains,
 		},
-		Files:   req.Files,
-		Creator: user,
+		Files:        req.Files,
+		AllowedUsers: req.AllowedUsers,
+		Creator:      user,
 	}
+	s.SetPwd(req.Pwd)
 	var id string
 	if id, err = op.CreateSharing(s); err != nil {
 		common.ErrorResp(c, err, 500)
 	} else {
 		s.ID = id
-		common.SuccessResp(c, SharingResp{
-			Sharing:     s,
-			CreatorName: s.Creator.Username,
-			CreatorRole: s.Creator.Role,
-		})
+		common.SuccessResp(c, toSharingResp(s))
 	}
 }
 
+type SharingTokenReq struct {
+	ID  string `json:"id" form:"id" binding:"required"`
+	Pwd string `json:"pwd" form:"pwd"`
+}
+
+// SharingToken exchanges the password of a sharing for a short-lived session token
+func SharingToken(c *gin.Context) {
+	var req SharingTokenReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
+	s, err := op.GetSharingById(req.ID)
+	if err != nil {
+		err = errs.SharingNotFound
+	} else if !s.Valid() {
+		err = errs.InvalidSharing
+	} else {
+		err = sharing.Verify(c.Request.Context(), s, req.Pwd)
+	}
+	if dealError(c, err) {
+		return
+	}
+	common.SuccessResp(c, gin.H{
+		"token":      sharing.Token(s),
+		"expires_in": int64(model.SharingTokenDuration.Seconds()),
+	})
+}
+
 func DeleteSharing(c *gin.Context) {
 	sid := c.Query("id")
 	user := c.Request.Context().Value(conf.UserKey).(*model.User)
@@ -593,3 +824,116 @@ func countAccess(ip string, s *model.Sharing) error {
 	}
 	return nil
 }
+
+func downloadingKey(c *gin.Context, sid, path string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", sid, c.ClientIP(), model.SharingAccessDownload, utils.FixAndCleanPath(path))
+}
+
+// sharingDownload is a download of a sharing file, the bytes served by its requests are added to its access record
+type sharingDownload struct {
+	mu sync.Mutex
+	// id of the access record, 0 before it is saved
+	id    uint
+	bytes int64
+}
+
+func (d *sharingDownload) saved(id uint) {
+	d.mu.Lock()
+	d.id = id
+	bytes := d.bytes
+	d.bytes = 0
+	d.mu.Unlock()
+	d.save(id, bytes)
+}
+
+func (d *sharingDownload) addBytes(bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	d.mu.Lock()
+	if d.id == 0 {
+		d.bytes += bytes
+		d.mu.Unlock()
+		return
+	}
+	id := d.id
+	d.mu.Unlock()
+	go d.save(id, bytes)
+}
+
+func (d *sharingDownload) save(id uint, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	if err := op.AddSharingAccessBytes(id, bytes); err != nil {
+		log.Warnf("failed record download bytes of sharing access %d: %+v", id, err)
+	}
+}
+
+// downloadMu serializes the check and start of the downloads
+var downloadMu sync.Mutex
+
+// downloading reports whether the client is downloading the file, the range requests of a download
+// like playing a video are counted as one download and not limited
+func downloading(c *gin.Context, sid, path string) bool {
+	_, ok := AccessCache.Get(downloadingKey(c, sid, path))
+	return ok
+}
+
+// startDownload returns the download of the file by the client. A new download is recorded at its first request,
+// the following requests in AccessCountDelay from it belong to the same download, so that the limit of the downloads
+// can't be bypassed by requesting the file repeatedly.
+func startDownload(c *gin.Context, s *model.Sharing, path string) *sharingDownload {
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+	key := downloadingKey(c, s.ID, path)
+	downloadMu.Lock()
+	defer downloadMu.Unlock()
+	if v, ok := AccessCache.Get(key); ok {
+		return v.(*sharingDownload)
+	}
+	d := &sharingDownload{}
+	AccessCache.Set(key, d, cache.WithEx[interface{}](AccessCountDelay))
+	saveAccess(newAccess(c, s.ID, model.SharingAccessDownload, path, 0), d.saved)
+	return d
+}
+
+// recordAccess saves a view of the sharing in background, the views from the same client
+// are deduplicated like countAccess. The downloads are recorded by startDownload.
+func recordAccess(c *gin.Context, s *model.Sharing, typ, path string, bytes int64) {
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	key := fmt.Sprintf("%s:%s:%s:%s", s.ID, c.ClientIP(), typ, path)
+	if _, ok := AccessCache.Get(key); ok {
+		return
+	}
+	AccessCache.Set(key, struct{}{}, cache.WithEx[interface{}](AccessCountDelay))
+	saveAccess(newAccess(c, s.ID, typ, path, bytes), nil)
+}
+
+func newAccess(c *gin.Context, sid, typ, path string, bytes int64) *model.SharingAccess {
+	return &model.SharingAccess{
+		SharingID: sid,
+		Type:      typ,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Path:      utils.FixAndCleanPath(path),
+		Bytes:     max(bytes, 0),
+		Time:      time.Now(),
+	}
+}
+
+// saveAccess saves the access event in background, saved is called with its id after it is saved
+func saveAccess(access *model.SharingAccess, saved func(id uint)) {
+	go func() {
+		if err := op.CreateSharingAccess(access); err != nil {
+			log.Warnf("failed record access of sharing %s: %+v", access.SharingID, err)
+			return
+		}
+		if saved != nil {
+			saved(access.ID)
+		}
+	}()
+}
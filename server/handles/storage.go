@@ -33,6 +33,7 @@ func makeStorageResp(ctx *gin.Context, storages []model.Storage) []*StorageResp
 	detailsChan := make(chan detailWithIndex, len(storages))
 	workerCount := 0
 	for i, s := range storages {
+		op.MaskStorageAddition(&s)
 		ret[i] = &StorageResp{
 			Storage:      s,
 			MountDetails: nil,
@@ -174,6 +175,7 @@ func GetStorage(c *gin.Context) {
 		common.ErrorResp(c, err, 500, true)
 		return
 	}
+	op.MaskStorageAddition(storage)
 	common.SuccessResp(c, storage)
 }
 
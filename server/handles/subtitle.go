@@ -0,0 +1,217 @@
+package handles
+
+import (
+	"fmt"
+	stdpath "path"
+	"strconv"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/media"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the folders which the subtitles of the videos are put in
+var subtitleDirs = []string{"subs", "sub", "subtitles", "subtitle"}
+
+type SubtitleResp struct {
+	Name     string `json:"name"`
+	Format   string `json:"format"`
+	Language string `json:"language"`
+	Embedded bool   `json:"embedded"`
+	// the url of the subtitle in webvtt
+	URL string `json:"url"`
+}
+
+// FsSubtitles lists the subtitles of the video, the files beside the video or in the subtitle folders,
+// and the text tracks embedded in the video
+func FsSubtitles(c *gin.Context) {
+	var req FsGetReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	user := c.Request.Context().Value(conf.UserKey).(*model.User)
+	reqPath, err := user.JoinPath(req.Path)
+	if err != nil {
+		common.ErrorResp(c, err, 403)
+		return
+	}
+	meta, err := op.GetNearestMeta(reqPath)
+	if err != nil {
+		if !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			common.ErrorResp(c, err, 500)
+			return
+		}
+	}
+	common.GinWithValue(c, conf.MetaKey, meta)
+	if !common.CanAccess(user, meta, reqPath, req.Password) {
+		common.ErrorStrResp(c, "password is incorrect or you have no permission", 403)
+		return
+	}
+	obj, err := fs.Get(c.Request.Context(), reqPath, &fs.GetArgs{})
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	if obj.IsDir() || utils.GetFileType(obj.GetName()) != conf.VIDEO {
+		common.ErrorStrResp(c, "not a video", 400)
+		return
+	}
+	parent := stdpath.Dir(reqPath)
+	base := strings.TrimSuffix(obj.GetName(), stdpath.Ext(obj.GetName()))
+	resp := make([]SubtitleResp, 0)
+	for _, sub := range findSubtitles(c, parent, base) {
+		// the subtitle folders may have their own meta
+		subMeta, err := op.GetNearestMeta(sub.path)
+		if err != nil && !errors.Is(errors.Cause(err), errs.MetaNotFound) {
+			log.Warnf("failed to get the meta of %s: %+v", sub.path, err)
+			continue
+		}
+		if !common.CanAccess(user, subMeta, sub.path, req.Password) {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(sub.path, parent), "/")
+		label := strings.TrimSuffix(stdpath.Base(sub.path), stdpath.Ext(sub.path))
+		if l := strings.Trim(strings.TrimPrefix(label, base), ".-_ "); l != "" {
+			label = l
+		}
+		resp = append(resp, SubtitleResp{
+			Name:     name,
+			Format:   utils.Ext(sub.obj.GetName()),
+			Language: label,
+			URL:      subtitleURL(c, sub.path, common.Sign(sub.obj, stdpath.Dir(sub.path), isEncrypt(subMeta, sub.path)), ""),
+		})
+	}
+	if media.Supported(obj) {
+		m, err := media.Get(c.Request.Context(), reqPath, obj)
+		if err != nil {
+			log.Warnf("failed to get the subtitle tracks of %s: %+v", reqPath, err)
+		} else {
+			s := common.Sign(obj, parent, isEncrypt(meta, reqPath))
+			for _, t := range m.Subtitles {
+				name := t.Name
+				if name == "" {
+					name = fmt.Sprintf("Track %d", t.ID)
+				}
+				resp = append(resp, SubtitleResp{
+					Name:     name,
+					Format:   t.Codec,
+					Language: t.Language,
+					Embedded: true,
+					URL:      subtitleURL(c, reqPath, s, strconv.Itoa(t.ID)),
+				})
+			}
+		}
+	}
+	common.SuccessResp(c, resp)
+}
+
+type subtitleFile struct {
+	path string
+	obj  model.Obj
+}
+
+// findSubtitles finds the subtitles starting with the name of the video, the subtitle folders of the video
+// with only one video are all for it, as well as the folders named after the video in them
+func findSubtitles(c *gin.Context, parent, base string) []subtitleFile {
+	objs, err := fs.List(c.Request.Context(), parent, &fs.ListArgs{})
+	if err != nil {
+		return nil
+	}
+	videos := 0
+	for _, o := range objs {
+		if !o.IsDir() && utils.GetFileType(o.GetName()) == conf.VIDEO {
+			videos++
+		}
+	}
+	var subs []subtitleFile
+	for _, o := range objs {
+		p := stdpath.Join(parent, o.GetName())
+		if !o.IsDir() {
+			if media.IsSubtitle(o.GetName()) && strings.HasPrefix(o.GetName(), base) {
+				subs = append(subs, subtitleFile{path: p, obj: o})
+			}
+			continue
+		}
+		if !utils.SliceContains(subtitleDirs, strings.ToLower(o.GetName())) {
+			continue
+		}
+		children, err := fs.List(c.Request.Context(), p, &fs.ListArgs{})
+		if err != nil {
+			continue
+		}
+		for _, child := range children {
+			cp := stdpath.Join(p, child.GetName())
+			if child.IsDir() && child.GetName() == base {
+				files, err := fs.List(c.Request.Context(), cp, &fs.ListArgs{})
+				if err != nil {
+					continue
+				}
+				for _, f := range files {
+					if !f.IsDir() && media.IsSubtitle(f.GetName()) {
+						subs = append(subs, subtitleFile{path: stdpath.Join(cp, f.GetName()), obj: f})
+					}
+				}
+			} else if !child.IsDir() && media.IsSubtitle(child.GetName()) &&
+				(videos == 1 || strings.HasPrefix(child.GetName(), base)) {
+				subs = append(subs, subtitleFile{path: cp, obj: child})
+			}
+		}
+	}
+	return subs
+}
+
+func subtitleURL(c *gin.Context, path, sign, track string) string {
+	query := make([]string, 0, 2)
+	if track != "" {
+		query = append(query, "track="+track)
+	}
+	if sign != "" {
+		query = append(query, "sign="+sign)
+	}
+	u := common.GetApiUrl(c) + "/vtt" + utils.EncodePath(path, true)
+	if len(query) > 0 {
+		u += "?" + strings.Join(query, "&")
+	}
+	return u
+}
+
+// Subtitle serves the subtitle file, or the track embedded in the video if the track is given, in webvtt
+func Subtitle(c *gin.Context) {
+	rawPath := c.Request.Context().Value(conf.PathKey).(string)
+	obj, err := fs.Get(c.Request.Context(), rawPath, &fs.GetArgs{NoLog: true})
+	if err != nil {
+		common.ErrorPage(c, err, 404)
+		return
+	}
+	var vtt []byte
+	if track := c.Query("track"); track != "" {
+		var id int
+		if id, err = strconv.Atoi(track); err != nil {
+			common.ErrorPage(c, err, 400)
+			return
+		}
+		vtt, err = media.EmbeddedSubtitleVTT(c.Request.Context(), rawPath, obj, id)
+	} else {
+		vtt, err = media.SubtitleVTT(c.Request.Context(), rawPath, obj)
+	}
+	if err != nil {
+		if errs.IsObjectNotFound(err) {
+			common.ErrorPage(c, err, 404)
+		} else {
+			common.ErrorPage(c, err, 500)
+		}
+		return
+	}
+	c.Header("Cache-Control", "max-age=86400")
+	c.Data(200, "text/vtt; charset=utf-8", vtt)
+}
@@ -0,0 +1,61 @@
+package handles
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/fs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/sign"
+	"github.com/OpenListTeam/OpenList/v4/internal/thumbnail"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// getThumb returns the thumbnail of the object, the thumbnail service is used if the storage doesn't provide one
+func getThumb(ctx context.Context, obj model.Obj, parent string) string {
+	if thumb, ok := model.GetThumb(obj); ok && thumb != "" {
+		return thumb
+	}
+	if !thumbnail.Enabled() {
+		return ""
+	}
+	path := stdpath.Join(parent, obj.GetName())
+	if !thumbnail.Supported(path, obj) {
+		return ""
+	}
+	return utils.EncodePath(common.GetApiUrl(ctx)+stdpath.Join("/t", path), true) + "?sign=" + sign.SignThumb(path)
+}
+
+// Thumbnail serves the thumbnail generated by the thumbnail service,
+// the sign is always required since generating a thumbnail is expensive
+func Thumbnail(c *gin.Context) {
+	rawPath := c.Request.Context().Value(conf.PathKey).(string)
+	if err := sign.VerifyThumb(rawPath, strings.TrimSuffix(c.Query("sign"), "/")); err != nil {
+		common.ErrorPage(c, err, 401)
+		return
+	}
+	if !thumbnail.Enabled() {
+		common.ErrorPage(c, errors.New("thumbnail is disabled"), 403)
+		return
+	}
+	obj, err := fs.Get(c.Request.Context(), rawPath, &fs.GetArgs{NoLog: true})
+	if err != nil {
+		common.ErrorPage(c, err, 404)
+		return
+	}
+	thumb, err := thumbnail.Get(c.Request.Context(), rawPath, obj)
+	if err != nil {
+		common.ErrorPage(c, err, 500)
+		return
+	}
+	c.Header("Content-Type", thumb.ContentType)
+	c.Header("Cache-Control", "max-age=86400")
+	http.ServeContent(c.Writer, c.Request, "", obj.ModTime(), bytes.NewReader(thumb.Data))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/setting"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -17,116 +18,69 @@ import (
 func Auth(allowDisabledGuest bool) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
-		if subtle.ConstantTimeCompare([]byte(token), []byte(setting.GetStr(conf.Token))) == 1 {
-			admin, err := op.GetAdmin()
-			if err != nil {
-				common.ErrorResp(c, err, 500)
-				c.Abort()
-				return
-			}
-			common.GinWithValue(c, conf.UserKey, admin)
-			log.Debugf("use admin token: %+v", admin)
-			c.Next()
-			return
-		}
-		if token == "" {
-			guest, err := op.GetGuest()
-			if err != nil {
-				common.ErrorResp(c, err, 500)
-				c.Abort()
-				return
-			}
-			if !allowDisabledGuest && guest.Disabled {
-				common.ErrorStrResp(c, "Guest user is disabled, login please", 401)
-				c.Abort()
-				return
-			}
-			common.GinWithValue(c, conf.UserKey, guest)
-			log.Debugf("use empty token: %+v", guest)
-			c.Next()
-			return
-		}
-		userClaims, err := common.ParseToken(token)
-		if err != nil {
-			common.ErrorResp(c, err, 401)
-			c.Abort()
-			return
-		}
-		user, err := op.GetUserByName(userClaims.Username)
+		user, code, err := tokenUser(token)
 		if err != nil {
-			common.ErrorResp(c, err, 401)
+			common.ErrorResp(c, err, code)
 			c.Abort()
 			return
 		}
-		// validate password timestamp
-		if userClaims.PwdTS != user.PwdTS {
-			common.ErrorStrResp(c, "Password has been changed, login please", 401)
-			c.Abort()
-			return
-		}
-		if user.Disabled {
-			common.ErrorStrResp(c, "Current user is disabled, replace please", 401)
+		if !allowDisabledGuest && user.IsGuest() && user.Disabled {
+			common.ErrorStrResp(c, "Guest user is disabled, login please", 401)
 			c.Abort()
 			return
 		}
 		common.GinWithValue(c, conf.UserKey, user)
-		log.Debugf("use login token: %+v", user)
 		c.Next()
 	}
 }
 
 func Authn(c *gin.Context) {
-	token := c.GetHeader("Authorization")
+	user, code, err := tokenUser(c.GetHeader("Authorization"))
+	if err != nil {
+		common.ErrorResp(c, err, code)
+		c.Abort()
+		return
+	}
+	common.GinWithValue(c, conf.UserKey, user)
+	c.Next()
+}
+
+// tokenUser returns the user of the token, which is the admin for the admin token and the guest for the empty token,
+// the status code of the response is returned with the error
+func tokenUser(token string) (*model.User, int, error) {
 	if subtle.ConstantTimeCompare([]byte(token), []byte(setting.GetStr(conf.Token))) == 1 {
 		admin, err := op.GetAdmin()
 		if err != nil {
-			common.ErrorResp(c, err, 500)
-			c.Abort()
-			return
+			return nil, 500, err
 		}
-		common.GinWithValue(c, conf.UserKey, admin)
 		log.Debugf("use admin token: %+v", admin)
-		c.Next()
-		return
+		return admin, 200, nil
 	}
 	if token == "" {
 		guest, err := op.GetGuest()
 		if err != nil {
-			common.ErrorResp(c, err, 500)
-			c.Abort()
-			return
+			return nil, 500, err
 		}
-		common.GinWithValue(c, conf.UserKey, guest)
 		log.Debugf("use empty token: %+v", guest)
-		c.Next()
-		return
+		return guest, 200, nil
 	}
 	userClaims, err := common.ParseToken(token)
 	if err != nil {
-		common.ErrorResp(c, err, 401)
-		c.Abort()
-		return
+		return nil, 401, err
 	}
 	user, err := op.GetUserByName(userClaims.Username)
 	if err != nil {
-		common.ErrorResp(c, err, 401)
-		c.Abort()
-		return
+		return nil, 401, err
 	}
 	// validate password timestamp
 	if userClaims.PwdTS != user.PwdTS {
-		common.ErrorStrResp(c, "Password has been changed, login please", 401)
-		c.Abort()
-		return
+		return nil, 401, errors.New("Password has been changed, login please")
 	}
 	if user.Disabled {
-		common.ErrorStrResp(c, "Current user is disabled, replace please", 401)
-		c.Abort()
-		return
+		return nil, 401, errors.New("Current user is disabled, replace please")
 	}
-	common.GinWithValue(c, conf.UserKey, user)
 	log.Debugf("use login token: %+v", user)
-	c.Next()
+	return user, 200, nil
 }
 
 func AuthNotGuest(c *gin.Context) {
@@ -1,14 +1,56 @@
 package middlewares
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 )
 
 func SharingIdParse(c *gin.Context) {
 	sid := c.Param("sid")
 	common.GinWithValue(c, conf.SharingIDKey, sid)
+	common.GinWithValue(c, conf.ClientIPKey, c.ClientIP())
+	s, err := op.GetSharingById(sid)
+	if err != nil || !s.Restricted() {
+		c.Next()
+		return
+	}
+	// links of a restricted sharing generated by the api are signed
+	path := c.Request.Context().Value(conf.PathKey).(string)
+	if sign := c.Query("sign"); sign != "" && c.Request.Method != http.MethodPut {
+		if common.VerifySharingSign(sid, path, strings.TrimSuffix(sign, "/")) == nil {
+			c.Next()
+			return
+		}
+	}
+	errorResp := common.ErrorPage
+	if c.Request.Method == http.MethodPut {
+		errorResp = common.ErrorResp
+	}
+	token := c.GetHeader("Authorization")
+	if token == "" {
+		errorResp(c, errs.SharingNeedLogin, 401)
+		c.Abort()
+		return
+	}
+	user, _, err := tokenUser(token)
+	if err != nil {
+		errorResp(c, errors.WithMessage(errs.SharingNeedLogin, err.Error()), 401)
+		c.Abort()
+		return
+	}
+	if !s.AllowUser(user) {
+		errorResp(c, errs.PermissionDenied, 403)
+		c.Abort()
+		return
+	}
+	common.GinWithValue(c, conf.UserKey, user)
 	c.Next()
 }
 
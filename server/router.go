@@ -55,6 +55,10 @@ func Init(e *gin.Engine) {
 	g.HEAD("/ad/*path", middlewares.PathParse, archiveSignCheck, handles.ArchiveDown)
 	g.HEAD("/ap/*path", middlewares.PathParse, archiveSignCheck, handles.ArchiveProxy)
 	g.HEAD("/ae/*path", middlewares.PathParse, archiveSignCheck, handles.ArchiveInternalExtract)
+	g.GET("/t/*path", middlewares.PathParse, handles.Thumbnail)
+	g.HEAD("/t/*path", middlewares.PathParse, handles.Thumbnail)
+	g.GET("/hls/*path", middlewares.PathParse, signCheck, downloadLimiter, handles.HLS)
+	g.GET("/vtt/*path", middlewares.PathParse, signCheck, handles.Subtitle)
 
 	g.GET("/sd/:sid", middlewares.EmptyPathParse, middlewares.SharingIdParse, downloadLimiter, handles.SharingDown)
 	g.GET("/sd/:sid/*path", middlewares.PathParse, middlewares.SharingIdParse, downloadLimiter, handles.SharingDown)
@@ -64,6 +68,7 @@ func Init(e *gin.Engine) {
 	g.GET("/sad/:sid/*path", middlewares.PathParse, middlewares.SharingIdParse, downloadLimiter, handles.SharingArchiveExtract)
 	g.HEAD("/sad/:sid", middlewares.EmptyPathParse, middlewares.SharingIdParse, handles.SharingArchiveExtract)
 	g.HEAD("/sad/:sid/*path", middlewares.PathParse, middlewares.SharingIdParse, handles.SharingArchiveExtract)
+	g.PUT("/su/:sid/*path", middlewares.PathParse, middlewares.SharingIdParse, middlewares.UploadRateLimiter(stream.ClientUploadLimit), handles.SharingUpload)
 
 	api := g.Group("/api")
 	auth := api.Group("", middlewares.Auth(false))
@@ -100,11 +105,13 @@ func Init(e *gin.Engine) {
 	public.Any("/settings", handles.PublicSettings)
 	public.Any("/offline_download_tools", handles.OfflineDownloadTools)
 	public.Any("/archive_extensions", handles.ArchiveExtensions)
+	public.POST("/share_token", handles.SharingToken)
 
 	_fs(auth.Group("/fs"))
 	fsAndShare(api.Group("/fs", middlewares.Auth(true)))
 	_task(auth.Group("/task", middlewares.AuthNotGuest))
 	_sharing(auth.Group("/share", middlewares.AuthNotGuest))
+	_feed(auth.Group("/feed", middlewares.AuthNotGuest))
 	admin(auth.Group("/admin", middlewares.AuthAdmin))
 	if flags.Debug || flags.Dev {
 		debug(g.Group("/debug"))
@@ -158,6 +165,7 @@ func admin(g *gin.RouterGroup) {
 	setting.POST("/set_aria2", handles.SetAria2)
 	setting.POST("/set_qbit", handles.SetQbittorrent)
 	setting.POST("/set_transmission", handles.SetTransmission)
+	setting.POST("/set_bittorrent", handles.SetBitTorrent)
 	setting.POST("/set_115", handles.Set115)
 	setting.POST("/set_115_open", handles.Set115Open)
 	setting.POST("/set_123_pan", handles.Set123Pan)
@@ -181,6 +189,15 @@ func admin(g *gin.RouterGroup) {
 	index.POST("/clear", middlewares.SearchIndex, handles.ClearIndex)
 	index.GET("/progress", middlewares.SearchIndex, handles.GetProgress)
 
+	job := g.Group("/job")
+	job.GET("/list", handles.ListJobs)
+	job.GET("/get", handles.GetJob)
+	job.POST("/create", handles.CreateJob)
+	job.POST("/update", handles.UpdateJob)
+	job.POST("/delete", handles.DeleteJob)
+	job.POST("/run", handles.RunJob)
+	job.GET("/runs", handles.ListJobRuns)
+
 	scan := g.Group("/scan")
 	scan.POST("/start", handles.StartManualScan)
 	scan.POST("/stop", handles.StopManualScan)
@@ -199,6 +216,7 @@ func _fs(g *gin.RouterGroup) {
 	g.Any("/search", middlewares.SearchIndex, handles.Search)
 	g.Any("/other", handles.FsOther)
 	g.Any("/dirs", handles.FsDirs)
+	g.Any("/subtitles", handles.FsSubtitles)
 	g.POST("/mkdir", handles.FsMkdir)
 	g.POST("/rename", handles.FsRename)
 	g.POST("/batch_rename", handles.FsBatchRename)
@@ -206,11 +224,17 @@ func _fs(g *gin.RouterGroup) {
 	g.POST("/move", handles.FsMove)
 	g.POST("/recursive_move", handles.FsRecursiveMove)
 	g.POST("/copy", handles.FsCopy)
+	g.POST("/sync", handles.FsSync)
 	g.POST("/remove", handles.FsRemove)
 	g.POST("/remove_empty_directory", handles.FsRemoveEmptyDirectory)
 	uploadLimiter := middlewares.UploadRateLimiter(stream.ClientUploadLimit)
 	g.PUT("/put", middlewares.FsUp, uploadLimiter, handles.FsStream)
 	g.PUT("/form", middlewares.FsUp, uploadLimiter, handles.FsForm)
+	g.OPTIONS("/tus", handles.TusOptions)
+	g.POST("/tus", middlewares.FsUp, uploadLimiter, handles.TusCreate)
+	g.HEAD("/tus/:id", handles.TusHead)
+	g.PATCH("/tus/:id", middlewares.FsUp, uploadLimiter, handles.TusPatch)
+	g.DELETE("/tus/:id", handles.TusDelete)
 	g.POST("/link", middlewares.AuthAdmin, handles.Link)
 	// g.POST("/add_aria2", handles.AddOfflineDownload)
 	// g.POST("/add_qbit", handles.AddQbittorrent)
@@ -235,6 +259,16 @@ func _sharing(g *gin.RouterGroup) {
 	g.POST("/disable", handles.SetEnableSharing(true))
 }
 
+func _feed(g *gin.RouterGroup) {
+	g.GET("/list", handles.ListFeeds)
+	g.GET("/get", handles.GetFeed)
+	g.POST("/create", handles.CreateFeed)
+	g.POST("/update", handles.UpdateFeed)
+	g.POST("/delete", handles.DeleteFeed)
+	g.POST("/check", handles.CheckFeed)
+	g.GET("/items", handles.ListFeedItems)
+}
+
 func Cors(r *gin.Engine) {
 	config := cors.DefaultConfig()
 	// config.AllowAllOrigins = true